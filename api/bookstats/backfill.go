@@ -2,175 +2,377 @@ package bookstats
 
 import (
 	"log"
-	"time"
+	"math"
+	"strings"
 
 	"github.com/pocketbase/pocketbase/core"
 )
 
 // bookStats holds the aggregated stats for a single book.
 type bookStats struct {
-	RatingSum       float64
-	RatingCount     int
-	ReviewCount     int
-	ReadsCount      int
-	WantToReadCount int
+	RatingSum             float64   `db:"rating_sum"`
+	RatingCount           int       `db:"rating_count"`
+	ReviewCount           int       `db:"review_count"`
+	ReadsCount            int       `db:"reads_count"`
+	WantToReadCount       int       `db:"want_to_read_count"`
+	CurrentlyReadingCount int       `db:"currently_reading_count"`
+	DNFCount              int       `db:"dnf_count"`
+	RatingHistogram       Histogram `db:"rating_histogram"`
+	WeightedScore         float64   `db:"weighted_score"`
+	FinishCount           int       `db:"finish_count"`
+	MedianDaysToFinish    float64   `db:"median_days_to_finish"`
 }
 
-// BackfillAll recalculates book_stats for every book in the database
-// using batch aggregation queries instead of per-book queries.
-// It returns the number of rows upserted and any error encountered.
-func BackfillAll(app core.App) (int, error) {
-	statsMap := make(map[string]*bookStats)
+// columns returns the stats keyed by book_stats column.
+func (s bookStats) columns() map[string]any {
+	return map[string]any{
+		"rating_sum":              s.RatingSum,
+		"rating_count":            s.RatingCount,
+		"review_count":            s.ReviewCount,
+		"reads_count":             s.ReadsCount,
+		"want_to_read_count":      s.WantToReadCount,
+		"currently_reading_count": s.CurrentlyReadingCount,
+		"dnf_count":               s.DNFCount,
+		"rating_histogram":        s.RatingHistogram,
+		"weighted_score":          s.WeightedScore,
+		"finish_count":            s.FinishCount,
+		"median_days_to_finish":   s.MedianDaysToFinish,
+	}
+}
 
-	// Ensure every book gets an entry (even if all counts are zero).
-	type bookRow struct {
-		ID string `db:"id"`
+// floatTolerance absorbs rounding in sums, scores and medians built up from
+// deltas in a different order than a fresh aggregate.
+const floatTolerance = 1e-6
+
+// diff returns the columns whose values differ between s and o.
+func (s bookStats) diff(o bookStats) []string {
+	var cols []string
+	near := func(a, b float64) bool { return math.Abs(a-b) <= floatTolerance }
+	if !near(s.RatingSum, o.RatingSum) {
+		cols = append(cols, "rating_sum")
+	}
+	if s.RatingCount != o.RatingCount {
+		cols = append(cols, "rating_count")
+	}
+	if s.ReviewCount != o.ReviewCount {
+		cols = append(cols, "review_count")
+	}
+	if s.ReadsCount != o.ReadsCount {
+		cols = append(cols, "reads_count")
+	}
+	if s.WantToReadCount != o.WantToReadCount {
+		cols = append(cols, "want_to_read_count")
+	}
+	if s.CurrentlyReadingCount != o.CurrentlyReadingCount {
+		cols = append(cols, "currently_reading_count")
+	}
+	if s.DNFCount != o.DNFCount {
+		cols = append(cols, "dnf_count")
 	}
-	var books []bookRow
-	if err := app.DB().NewQuery("SELECT id FROM books").All(&books); err != nil {
-		return 0, err
+	if !s.RatingHistogram.equal(o.RatingHistogram) {
+		cols = append(cols, "rating_histogram")
 	}
-	for _, b := range books {
-		statsMap[b.ID] = &bookStats{}
+	if !near(s.WeightedScore, o.WeightedScore) {
+		cols = append(cols, "weighted_score")
 	}
+	if s.FinishCount != o.FinishCount {
+		cols = append(cols, "finish_count")
+	}
+	if !near(s.MedianDaysToFinish, o.MedianDaysToFinish) {
+		cols = append(cols, "median_days_to_finish")
+	}
+	return cols
+}
 
-	// 1. Batch query: rating/review stats from user_books.
-	type ratingRow struct {
-		Book        string  `db:"book"`
-		RatingSum   float64 `db:"rating_sum"`
-		RatingCount int     `db:"rating_count"`
-		ReviewCount int     `db:"review_count"`
+// addRating counts one rating into the histogram.
+func (s *bookStats) addRating(rating float64) {
+	if s.RatingHistogram == nil {
+		s.RatingHistogram = Histogram{}
 	}
-	var ratingRows []ratingRow
-	err := app.DB().NewQuery(`
-		SELECT
-			book,
-			COALESCE(SUM(CASE WHEN rating > 0 THEN rating ELSE 0 END), 0) as rating_sum,
-			COALESCE(SUM(CASE WHEN rating > 0 THEN 1 ELSE 0 END), 0) as rating_count,
-			COALESCE(SUM(CASE WHEN review_text != '' AND review_text IS NOT NULL THEN 1 ELSE 0 END), 0) as review_count
-		FROM user_books
-		GROUP BY book
-	`).All(&ratingRows)
-	if err != nil {
-		return 0, err
+	s.RatingHistogram[starBucket(rating)]++
+}
+
+// setStatus stores a status count in the field for its slug.
+func (s *bookStats) setStatus(slug string, count int) {
+	switch statusColumns[slug] {
+	case "reads_count":
+		s.ReadsCount = count
+	case "want_to_read_count":
+		s.WantToReadCount = count
+	case "currently_reading_count":
+		s.CurrentlyReadingCount = count
+	case "dnf_count":
+		s.DNFCount = count
 	}
-	for _, r := range ratingRows {
-		s := statsMap[r.Book]
-		if s == nil {
-			s = &bookStats{}
-			statsMap[r.Book] = s
-		}
-		s.RatingSum = r.RatingSum
-		s.RatingCount = r.RatingCount
-		s.ReviewCount = r.ReviewCount
-	}
-
-	// 2. Batch query: reads count (tag slug = 'finished').
-	type tagCountRow struct {
-		Book  string `db:"book"`
-		Count int    `db:"count"`
-	}
-	var readRows []tagCountRow
-	err = app.DB().NewQuery(`
-		SELECT btv.book, COUNT(DISTINCT btv.user) as count
-		FROM book_tag_values btv
-		JOIN tag_values tv ON btv.tag_value = tv.id
-		WHERE tv.slug = 'finished'
-		GROUP BY btv.book
-	`).All(&readRows)
+}
+
+// ratingSQL aggregates rating and review stats from user_books.
+const ratingSQL = `
+	SELECT
+		book,
+		COALESCE(SUM(CASE WHEN rating > 0 THEN rating ELSE 0 END), 0) as rating_sum,
+		COALESCE(SUM(CASE WHEN rating > 0 THEN 1 ELSE 0 END), 0) as rating_count,
+		COALESCE(SUM(CASE WHEN review_text != '' AND review_text IS NOT NULL THEN 1 ELSE 0 END), 0) as review_count
+	FROM user_books
+`
+
+// ratingsSQL lists individual ratings, for the histogram.
+const ratingsSQL = `
+	SELECT book, rating FROM user_books WHERE rating > 0
+`
+
+// finishSQL lists the days each reader with both dates took to finish.
+// Entries finished before they were started are data-entry mistakes and
+// are left out.
+const finishSQL = `
+	SELECT book, julianday(date_read) - julianday(date_started) as days
+	FROM user_books
+	WHERE date_started != '' AND date_started IS NOT NULL
+	  AND date_read != '' AND date_read IS NOT NULL
+	  AND julianday(date_read) >= julianday(date_started)
+`
+
+// statusSQL counts distinct users per book holding each counted status.
+const statusSQL = `
+	SELECT btv.book, tv.slug, COUNT(DISTINCT btv.user) as count
+	FROM book_tag_values btv
+	JOIN tag_values tv ON btv.tag_value = tv.id
+	WHERE tv.slug IN ('finished', 'want-to-read', 'currently-reading', 'dnf')
+`
+
+type ratingRow struct {
+	Book        string  `db:"book"`
+	RatingSum   float64 `db:"rating_sum"`
+	RatingCount int     `db:"rating_count"`
+	ReviewCount int     `db:"review_count"`
+}
+
+type bookRating struct {
+	Book   string  `db:"book"`
+	Rating float64 `db:"rating"`
+}
+
+type finishRow struct {
+	Book string  `db:"book"`
+	Days float64 `db:"days"`
+}
+
+type statusRow struct {
+	Book  string `db:"book"`
+	Slug  string `db:"slug"`
+	Count int    `db:"count"`
+}
+
+// statusCounts returns one book's status counts.
+func statusCounts(app core.App, bookID string) ([]statusRow, error) {
+	var rows []statusRow
+	err := app.DB().NewQuery(statusSQL + " AND btv.book = {:book} GROUP BY btv.book, tv.slug").
+		Bind(map[string]any{"book": bookID}).All(&rows)
+	return rows, err
+}
+
+// finishTimes returns how many readers of a book recorded both reading
+// dates and the median days they took.
+func finishTimes(app core.App, bookID string) (int, float64, error) {
+	var rows []finishRow
+	err := app.DB().NewQuery(finishSQL + " AND book = {:book}").
+		Bind(map[string]any{"book": bookID}).All(&rows)
 	if err != nil {
-		log.Printf("[BookStats] warning: reads count query failed: %v", err)
+		return 0, 0, err
 	}
-	for _, r := range readRows {
-		s := statsMap[r.Book]
-		if s == nil {
-			s = &bookStats{}
-			statsMap[r.Book] = s
-		}
-		s.ReadsCount = r.Count
-	}
-
-	// 3. Batch query: want-to-read count (tag slug = 'want-to-read').
-	var wtrRows []tagCountRow
-	err = app.DB().NewQuery(`
-		SELECT btv.book, COUNT(DISTINCT btv.user) as count
-		FROM book_tag_values btv
-		JOIN tag_values tv ON btv.tag_value = tv.id
-		WHERE tv.slug = 'want-to-read'
-		GROUP BY btv.book
-	`).All(&wtrRows)
+	days := make([]float64, len(rows))
+	for i, r := range rows {
+		days[i] = r.Days
+	}
+	return len(days), median(days), nil
+}
+
+// compute aggregates one book's stats from its source records.
+func compute(app core.App, bookID string) (bookStats, error) {
+	s := bookStats{RatingHistogram: Histogram{}}
+	params := map[string]any{"book": bookID}
+	var ratings []ratingRow
+	err := app.DB().NewQuery(ratingSQL + " WHERE book = {:book} GROUP BY book").
+		Bind(params).All(&ratings)
 	if err != nil {
-		log.Printf("[BookStats] warning: want-to-read count query failed: %v", err)
+		return s, err
 	}
-	for _, r := range wtrRows {
-		s := statsMap[r.Book]
-		if s == nil {
-			s = &bookStats{}
-			statsMap[r.Book] = s
-		}
-		s.WantToReadCount = r.Count
+	if len(ratings) > 0 {
+		s.RatingSum = ratings[0].RatingSum
+		s.RatingCount = ratings[0].RatingCount
+		s.ReviewCount = ratings[0].ReviewCount
 	}
+	s.WeightedScore = WeightedScore(s.RatingSum, s.RatingCount)
 
-	// 4. Load existing book_stats records into a map for fast lookup.
-	existingMap := make(map[string]*core.Record)
-	existingRecords, err := app.FindAllRecords("book_stats")
-	if err == nil {
-		for _, rec := range existingRecords {
-			existingMap[rec.GetString("book")] = rec
-		}
+	var each []bookRating
+	if err := app.DB().NewQuery(ratingsSQL + " AND book = {:book}").Bind(params).All(&each); err != nil {
+		return s, err
+	}
+	for _, r := range each {
+		s.addRating(r.Rating)
 	}
 
-	coll, err := app.FindCollectionByNameOrId("book_stats")
+	statuses, err := statusCounts(app, bookID)
 	if err != nil {
-		return 0, err
+		return s, err
+	}
+	for _, r := range statuses {
+		s.setStatus(r.Slug, r.Count)
 	}
 
-	// 5. Upsert all stats.
-	updated := 0
-	for bookID, s := range statsMap {
-		rec, ok := existingMap[bookID]
-		if !ok {
-			rec = core.NewRecord(coll)
-			rec.Set("book", bookID)
+	s.FinishCount, s.MedianDaysToFinish, err = finishTimes(app, bookID)
+	return s, err
+}
+
+// Drift is a stored book_stats value that disagreed with the records it
+// counts.
+type Drift struct {
+	Book   string `json:"book"`
+	Column string `json:"column"`
+	Stored any    `json:"stored"`
+	Actual any    `json:"actual"`
+}
+
+// RepairReport is what a BackfillAll run checked and fixed.
+type RepairReport struct {
+	Books    int     `json:"books"`
+	Created  int     `json:"created"`
+	Repaired int     `json:"repaired"`
+	Drift    []Drift `json:"drift"`
+}
+
+// maxReportedDrift caps how many corrections a report lists.
+const maxReportedDrift = 100
+
+// BackfillAll repairs drift between book_stats and the records it counts.
+// The hooks keep stats current, so this only finds rows left wrong by raw
+// SQL writes, crashes or bugs: it aggregates every book in a few batch
+// queries, compares with the stored row, and recomputes and rewrites just
+// the rows that disagree (creating rows for books that have none). Every
+// correction is logged, and the first maxReportedDrift are reported.
+func BackfillAll(app core.App) (*RepairReport, error) {
+	statsMap := make(map[string]*bookStats)
+
+	// Ensure every book gets an entry (even if all counts are zero).
+	var bookIDs []string
+	if err := app.DB().NewQuery("SELECT id FROM books").Column(&bookIDs); err != nil {
+		return nil, err
+	}
+	for _, id := range bookIDs {
+		statsMap[id] = &bookStats{RatingHistogram: Histogram{}}
+	}
+
+	// 1. Batch query: rating/review stats from user_books.
+	var ratingRows []ratingRow
+	if err := app.DB().NewQuery(ratingSQL + " GROUP BY book").All(&ratingRows); err != nil {
+		return nil, err
+	}
+	for _, r := range ratingRows {
+		if s := statsMap[r.Book]; s != nil {
+			s.RatingSum = r.RatingSum
+			s.RatingCount = r.RatingCount
+			s.ReviewCount = r.ReviewCount
 		}
-		rec.Set("reads_count", s.ReadsCount)
-		rec.Set("want_to_read_count", s.WantToReadCount)
-		rec.Set("rating_sum", s.RatingSum)
-		rec.Set("rating_count", s.RatingCount)
-		rec.Set("review_count", s.ReviewCount)
-
-		if err := app.Save(rec); err != nil {
-			log.Printf("[BookStats] error saving stats for book %s: %v", bookID, err)
-			continue
+	}
+
+	for _, s := range statsMap {
+		s.WeightedScore = WeightedScore(s.RatingSum, s.RatingCount)
+	}
+	var each []bookRating
+	if err := app.DB().NewQuery(ratingsSQL).All(&each); err != nil {
+		return nil, err
+	}
+	for _, r := range each {
+		if s := statsMap[r.Book]; s != nil {
+			s.addRating(r.Rating)
 		}
-		updated++
 	}
 
-	return updated, nil
-}
+	// 2. Batch query: status counts from book_tag_values.
+	var statusRows []statusRow
+	if err := app.DB().NewQuery(statusSQL + " GROUP BY btv.book, tv.slug").All(&statusRows); err != nil {
+		return nil, err
+	}
+	for _, r := range statusRows {
+		if s := statsMap[r.Book]; s != nil {
+			s.setStatus(r.Slug, r.Count)
+		}
+	}
 
-// StartPoller runs BackfillAll once immediately, then every 24 hours.
-// It blocks forever, so it should be called from a goroutine.
-func StartPoller(app core.App) {
-	// Run once on startup.
-	start := time.Now()
-	updated, err := BackfillAll(app)
-	if err != nil {
-		log.Printf("[BookStats] startup backfill error: %v", err)
-	} else {
-		log.Printf("[BookStats] startup backfill complete: %d books updated in %s", updated, time.Since(start).Round(time.Millisecond))
+	// 3. Batch query: finish times from user_books.
+	var finishRows []finishRow
+	if err := app.DB().NewQuery(finishSQL).All(&finishRows); err != nil {
+		return nil, err
+	}
+	finishDays := make(map[string][]float64)
+	for _, r := range finishRows {
+		finishDays[r.Book] = append(finishDays[r.Book], r.Days)
+	}
+	for bookID, days := range finishDays {
+		if s := statsMap[bookID]; s != nil {
+			s.FinishCount, s.MedianDaysToFinish = len(days), median(days)
+		}
+	}
+
+	// 4. Load the stored rows.
+	type storedRow struct {
+		bookStats
+		Book string `db:"book"`
+	}
+	var storedRows []storedRow
+	if err := app.DB().NewQuery(`
+		SELECT book, rating_sum, rating_count, review_count, reads_count,
+			   want_to_read_count, currently_reading_count, dnf_count,
+			   rating_histogram, weighted_score, finish_count, median_days_to_finish
+		FROM book_stats
+	`).All(&storedRows); err != nil {
+		return nil, err
+	}
+	stored := make(map[string]bookStats, len(storedRows))
+	for _, r := range storedRows {
+		stored[r.Book] = r.bookStats
 	}
 
-	// Then run every 24 hours.
-	ticker := time.NewTicker(24 * time.Hour)
-	defer ticker.Stop()
-	for range ticker.C {
-		start := time.Now()
-		updated, err := BackfillAll(app)
+	// 5. Rewrite the rows that disagree. The book is recomputed inside a
+	// transaction so a write since the batch queries isn't undone.
+	report := &RepairReport{Books: len(statsMap), Drift: []Drift{}}
+	for bookID, s := range statsMap {
+		old, ok := stored[bookID]
+		if ok && len(old.diff(*s)) == 0 {
+			continue
+		}
+		err := app.RunInTransaction(func(txApp core.App) error {
+			actual, err := compute(txApp, bookID)
+			if err != nil {
+				return err
+			}
+			var fixed []string
+			if ok {
+				if fixed = old.diff(actual); len(fixed) == 0 {
+					return nil
+				}
+			}
+			if err := set(txApp, bookID, actual.columns()); err != nil {
+				return err
+			}
+			if !ok {
+				report.Created++
+				return nil
+			}
+			report.Repaired++
+			was, now := old.columns(), actual.columns()
+			for _, col := range fixed {
+				if len(report.Drift) < maxReportedDrift {
+					report.Drift = append(report.Drift, Drift{bookID, col, was[col], now[col]})
+				}
+			}
+			log.Printf("[BookStats] repaired drift in %s for book %s", strings.Join(fixed, ", "), bookID)
+			return nil
+		})
 		if err != nil {
-			log.Printf("[BookStats] periodic backfill error: %v", err)
-		} else {
-			log.Printf("[BookStats] periodic backfill complete: %d books updated in %s", updated, time.Since(start).Round(time.Millisecond))
+			log.Printf("[BookStats] error repairing stats for book %s: %v", bookID, err)
 		}
 	}
+
+	return report, nil
 }
@@ -0,0 +1,55 @@
+package bookstats
+
+import "github.com/pocketbase/pocketbase/core"
+
+// EditionStats is a book's stats among the readers who selected one edition.
+// EditionKey is "" for readers who haven't selected one.
+type EditionStats struct {
+	EditionKey    string   `db:"edition_key" json:"edition_key"`
+	Readers       int      `db:"readers" json:"readers"`
+	RatingSum     float64  `db:"rating_sum" json:"-"`
+	RatingCount   int      `db:"rating_count" json:"rating_count"`
+	AverageRating *float64 `db:"-" json:"average_rating"`
+	ReviewCount   int      `db:"review_count" json:"review_count"`
+	ReadsCount    int      `db:"reads_count" json:"reads_count"`
+	DNFCount      int      `db:"dnf_count" json:"dnf_count"`
+}
+
+// Editions breaks a book's stats down by the edition each reader selected,
+// most read first. Unlike the book_stats row it is computed on demand.
+func Editions(app core.App, bookID string) ([]EditionStats, error) {
+	var rows []EditionStats
+	err := app.DB().NewQuery(`
+		SELECT
+			COALESCE(ub.selected_edition_key, '') as edition_key,
+			COUNT(*) as readers,
+			COALESCE(SUM(CASE WHEN ub.rating > 0 THEN ub.rating ELSE 0 END), 0) as rating_sum,
+			COALESCE(SUM(CASE WHEN ub.rating > 0 THEN 1 ELSE 0 END), 0) as rating_count,
+			COALESCE(SUM(CASE WHEN ub.review_text != '' AND ub.review_text IS NOT NULL THEN 1 ELSE 0 END), 0) as review_count,
+			COALESCE(SUM(EXISTS (
+				SELECT 1 FROM book_tag_values btv JOIN tag_values tv ON tv.id = btv.tag_value
+				WHERE btv.user = ub.user AND btv.book = ub.book AND tv.slug = 'finished'
+			)), 0) as reads_count,
+			COALESCE(SUM(EXISTS (
+				SELECT 1 FROM book_tag_values btv JOIN tag_values tv ON tv.id = btv.tag_value
+				WHERE btv.user = ub.user AND btv.book = ub.book AND tv.slug = 'dnf'
+			)), 0) as dnf_count
+		FROM user_books ub
+		WHERE ub.book = {:book}
+		GROUP BY 1
+		ORDER BY readers DESC, edition_key
+	`).Bind(map[string]any{"book": bookID}).All(&rows)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		if rows[i].RatingCount > 0 {
+			avg := rows[i].RatingSum / float64(rows[i].RatingCount)
+			rows[i].AverageRating = &avg
+		}
+	}
+	if rows == nil {
+		rows = []EditionStats{}
+	}
+	return rows, nil
+}
@@ -0,0 +1,337 @@
+package bookstats
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/store"
+)
+
+// statusColumns maps the status tag value slugs that are counted to their
+// book_stats column. Each counts distinct users holding that status.
+var statusColumns = map[string]string{
+	"finished":          "reads_count",
+	"want-to-read":      "want_to_read_count",
+	"currently-reading": "currently_reading_count",
+	"dnf":               "dnf_count",
+}
+
+// delta is a change to some of a book's book_stats columns. Keys of the
+// form "stars:<bucket>" change a rating_histogram bucket.
+type delta map[string]float64
+
+// starsKey is the delta key for a rating_histogram bucket.
+const starsKey = "stars:"
+
+// RegisterHooks keeps book_stats in step with the records it counts. Every
+// create, update or delete of a user_books or book_tag_values record applies
+// the change it makes to its book's counts in the same transaction as the
+// write, so a failed write leaves the stats alone and concurrent writers
+// add to each other's totals instead of overwriting them. Writes that
+// bypass record hooks (raw SQL) must call Recount.
+func RegisterHooks(app core.App) {
+	onWrite(app, "user_books", applyUserBook)
+	onWrite(app, "book_tag_values", applyTagValue)
+}
+
+// onWrite runs fn after each successful create, update or delete in
+// collection, inside the write's transaction (joining the caller's if the
+// write is already part of one). before is nil for creates and after is nil
+// for deletes. An error from fn rolls the write back.
+func onWrite(app core.App, collection string, fn func(app core.App, before, after *core.Record) error) {
+	app.OnRecordCreate(collection).BindFunc(func(e *core.RecordEvent) error {
+		return e.App.RunInTransaction(func(txApp core.App) error {
+			return store.NextThen(e, txApp, func() error { return fn(txApp, nil, e.Record) })
+		})
+	})
+	app.OnRecordUpdate(collection).BindFunc(func(e *core.RecordEvent) error {
+		return e.App.RunInTransaction(func(txApp core.App) error {
+			// Original() is only the state the record was loaded with, so
+			// one saved twice from memory would look unchanged; read what
+			// is stored instead.
+			before, err := txApp.FindRecordById(collection, e.Record.Id)
+			if err != nil {
+				return err
+			}
+			return store.NextThen(e, txApp, func() error { return fn(txApp, before, e.Record) })
+		})
+	})
+	app.OnRecordDelete(collection).BindFunc(func(e *core.RecordEvent) error {
+		return e.App.RunInTransaction(func(txApp core.App) error {
+			return store.NextThen(e, txApp, func() error { return fn(txApp, e.Record, nil) })
+		})
+	})
+}
+
+// applyUserBook moves a shelf entry's rating and review between books'
+// totals as it is added, edited, moved or removed.
+func applyUserBook(app core.App, before, after *core.Record) error {
+	var oldBook, newBook string
+	oldDelta, newDelta := delta{}, delta{}
+	if before != nil {
+		oldBook, oldDelta = before.GetString("book"), userBookDelta(before)
+	}
+	if after != nil {
+		newBook, newDelta = after.GetString("book"), userBookDelta(after)
+	}
+
+	if oldBook == newBook {
+		for col, v := range oldDelta {
+			newDelta[col] -= v
+		}
+		if err := apply(app, newBook, newDelta); err != nil {
+			return err
+		}
+	} else {
+		for col, v := range oldDelta {
+			oldDelta[col] = -v
+		}
+		if err := apply(app, oldBook, oldDelta); err != nil {
+			return err
+		}
+		if err := apply(app, newBook, newDelta); err != nil {
+			return err
+		}
+	}
+
+	// A median can't be updated by a delta, so the finish times of any
+	// book gaining, losing or changing a finished read are recomputed.
+	oldDates, newDates := readingDates(before), readingDates(after)
+	if oldDates == newDates && (oldBook == newBook || oldDates == [2]string{}) {
+		return nil
+	}
+	if oldBook != "" && oldBook != newBook {
+		if err := refreshFinishTimes(app, oldBook); err != nil {
+			return err
+		}
+	}
+	if newBook == "" {
+		return nil
+	}
+	return refreshFinishTimes(app, newBook)
+}
+
+// readingDates is a shelf entry's start and finish dates, or zero unless it
+// has both.
+func readingDates(r *core.Record) [2]string {
+	if r == nil || r.GetString("date_started") == "" || r.GetString("date_read") == "" {
+		return [2]string{}
+	}
+	return [2]string{r.GetString("date_started"), r.GetString("date_read")}
+}
+
+// userBookDelta is what one shelf entry contributes to its book's stats.
+func userBookDelta(r *core.Record) delta {
+	d := delta{}
+	if rating := r.GetFloat("rating"); rating > 0 {
+		d["rating_sum"] = rating
+		d["rating_count"] = 1
+		d[starsKey+starBucket(rating)] = 1
+	}
+	if r.GetString("review_text") != "" {
+		d["review_count"] = 1
+	}
+	return d
+}
+
+// applyTagValue counts a user in or out of a book's status counts as their
+// status tags change. Users are counted once per status however many
+// values with that slug they hold, so only the first added and the last
+// removed change a count.
+func applyTagValue(app core.App, before, after *core.Record) error {
+	if before != nil && after != nil &&
+		before.GetString("user") == after.GetString("user") &&
+		before.GetString("book") == after.GetString("book") &&
+		before.GetString("tag_value") == after.GetString("tag_value") {
+		return nil
+	}
+	if before != nil {
+		if err := moveStatus(app, before, -1); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		return moveStatus(app, after, 1)
+	}
+	return nil
+}
+
+// moveStatus adds (sign 1) or removes (sign -1) the user of a
+// book_tag_values record from the count for its value's slug, if the user
+// holds no other value with that slug on the book.
+func moveStatus(app core.App, r *core.Record, sign float64) error {
+	bookID := r.GetString("book")
+	var slug string
+	err := app.DB().NewQuery("SELECT slug FROM tag_values WHERE id = {:id}").
+		Bind(map[string]any{"id": r.GetString("tag_value")}).Row(&slug)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The value itself is being deleted, cascading to this record, so
+		// its slug is gone; count the book's statuses from scratch.
+		return recountStatuses(app, bookID)
+	} else if err != nil {
+		return err
+	}
+	col, ok := statusColumns[slug]
+	if !ok {
+		return nil
+	}
+
+	var others int
+	err = app.DB().NewQuery(`
+		SELECT COUNT(*)
+		FROM book_tag_values btv
+		JOIN tag_values tv ON tv.id = btv.tag_value
+		WHERE btv.user = {:user} AND btv.book = {:book} AND tv.slug = {:slug} AND btv.id != {:id}
+	`).Bind(map[string]any{
+		"user": r.GetString("user"),
+		"book": bookID,
+		"slug": slug,
+		"id":   r.Id,
+	}).Row(&others)
+	if err != nil {
+		return err
+	}
+	if others > 0 {
+		return nil
+	}
+	return apply(app, bookID, delta{col: sign})
+}
+
+// apply adds d to a book's stats row, creating the row if the book has
+// none. Counts never go below zero; drift is left for BackfillAll to repair.
+// The weighted score follows any change to the rating totals.
+func apply(app core.App, bookID string, d delta) error {
+	var cols, buckets []string
+	for key, v := range d {
+		if v == 0 {
+			continue
+		}
+		if strings.HasPrefix(key, starsKey) {
+			buckets = append(buckets, strings.TrimPrefix(key, starsKey))
+		} else {
+			cols = append(cols, key)
+		}
+	}
+	if bookID == "" || len(cols)+len(buckets) == 0 {
+		return nil
+	}
+	sort.Strings(cols)
+	sort.Strings(buckets)
+
+	// A book being deleted has already lost its row; don't recreate it.
+	_, err := app.DB().NewQuery(`
+		INSERT INTO book_stats (book, weighted_score)
+		SELECT {:book}, {:prior_mean} WHERE EXISTS (SELECT 1 FROM books WHERE id = {:book})
+		ON CONFLICT(book) DO NOTHING
+	`).Bind(priorParams(map[string]any{"book": bookID})).Execute()
+	if err != nil {
+		return err
+	}
+
+	params := map[string]any{"book": bookID}
+	sets := make([]string, 0, len(cols)+1)
+	for _, col := range cols {
+		sets = append(sets, col+" = MAX(0, "+col+" + {:"+col+"})")
+		params[col] = d[col]
+	}
+	if len(buckets) > 0 {
+		// Bucket keys come from starBucket, so they are safe to inline.
+		pairs := make([]string, len(buckets))
+		for i, b := range buckets {
+			path := `'$."` + b + `"'`
+			param := fmt.Sprintf("stars%d", i)
+			pairs[i] = path + ", MAX(0, COALESCE(json_extract(rating_histogram, " + path + "), 0) + {:" + param + "})"
+			params[param] = int(d[starsKey+b])
+		}
+		sets = append(sets, "rating_histogram = json_set(COALESCE(NULLIF(rating_histogram, 'null'), '{}'), "+
+			strings.Join(pairs, ", ")+")")
+	}
+	_, err = app.DB().NewQuery(
+		"UPDATE book_stats SET " + strings.Join(sets, ", ") + " WHERE book = {:book}",
+	).Bind(params).Execute()
+	if err != nil {
+		return err
+	}
+
+	if d["rating_sum"] == 0 && d["rating_count"] == 0 {
+		return nil
+	}
+	_, err = app.DB().NewQuery(
+		"UPDATE book_stats SET weighted_score = " + weightedScoreSQL + " WHERE book = {:book}",
+	).Bind(priorParams(map[string]any{"book": bookID})).Execute()
+	return err
+}
+
+// refreshFinishTimes sets a book's finish count and median days to finish
+// from its shelf entries' reading dates.
+func refreshFinishTimes(app core.App, bookID string) error {
+	count, days, err := finishTimes(app, bookID)
+	if err != nil {
+		return err
+	}
+	return set(app, bookID, map[string]any{
+		"finish_count":          count,
+		"median_days_to_finish": days,
+	})
+}
+
+// recountStatuses sets a book's status counts from its book_tag_values.
+func recountStatuses(app core.App, bookID string) error {
+	counts := map[string]any{}
+	for _, col := range statusColumns {
+		counts[col] = 0
+	}
+	rows, err := statusCounts(app, bookID)
+	if err != nil {
+		return err
+	}
+	for _, r := range rows {
+		counts[statusColumns[r.Slug]] = r.Count
+	}
+	return set(app, bookID, counts)
+}
+
+// Recount recomputes a book's stats from scratch. Use it after changing
+// user_books or book_tag_values with raw SQL, which skips the hooks.
+func Recount(app core.App, bookID string) error {
+	s, err := compute(app, bookID)
+	if err != nil {
+		return err
+	}
+	return set(app, bookID, s.columns())
+}
+
+// set overwrites some of a book's stats columns, creating its row if
+// needed.
+func set(app core.App, bookID string, values map[string]any) error {
+	cols := make([]string, 0, len(values))
+	for col := range values {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	params := priorParams(map[string]any{"book": bookID})
+	sets := make([]string, len(cols))
+	for i, col := range cols {
+		sets[i] = col + " = excluded." + col
+		params[col] = values[col]
+	}
+	insertCols := cols
+	if _, ok := values["weighted_score"]; !ok {
+		// A new row's score is the prior, as for a book with no ratings.
+		insertCols = append([]string{"weighted_score"}, cols...)
+		params["weighted_score"] = params["prior_mean"]
+	}
+	_, err := app.DB().NewQuery(`
+		INSERT INTO book_stats (book, ` + strings.Join(insertCols, ", ") + `)
+		SELECT {:book}, {:` + strings.Join(insertCols, "}, {:") + `}
+		WHERE EXISTS (SELECT 1 FROM books WHERE id = {:book})
+		ON CONFLICT(book) DO UPDATE SET ` + strings.Join(sets, ", "),
+	).Bind(params).Execute()
+	return err
+}
@@ -0,0 +1,178 @@
+package bookstats
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Default Bayesian prior: a book's weighted score starts as if it already
+// had priorWeight ratings averaging priorMean, so a handful of ratings
+// can't lift it past books rated well by many readers.
+const (
+	defaultPriorMean   = 3.5
+	defaultPriorWeight = 10
+)
+
+var (
+	priorOnce   sync.Once
+	priorMean   float64
+	priorWeight float64
+)
+
+// Prior returns the mean rating and the number of ratings it counts as in
+// weighted scores, from RATING_PRIOR_MEAN and RATING_PRIOR_WEIGHT (defaults
+// 3.5 and 10). Changing them takes effect for each book at its next rating
+// change, and for all books at the next drift repair.
+func Prior() (mean, weight float64) {
+	priorOnce.Do(func() {
+		priorMean = envFloat("RATING_PRIOR_MEAN", defaultPriorMean)
+		priorWeight = envFloat("RATING_PRIOR_WEIGHT", defaultPriorWeight)
+	})
+	return priorMean, priorWeight
+}
+
+// envFloat reads a positive float environment variable, returning def when
+// it is unset or invalid.
+func envFloat(name string, def float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil && v > 0 {
+		return v
+	}
+	return def
+}
+
+// WeightedScore is the Bayesian average of ratings under Prior.
+func WeightedScore(ratingSum float64, ratingCount int) float64 {
+	mean, weight := Prior()
+	return (weight*mean + ratingSum) / (weight + float64(ratingCount))
+}
+
+// weightedScoreSQL is WeightedScore over a book_stats row.
+const weightedScoreSQL = "({:prior_weight} * {:prior_mean} + rating_sum) / ({:prior_weight} + rating_count)"
+
+// priorParams binds the prior for weightedScoreSQL.
+func priorParams(params map[string]any) map[string]any {
+	mean, weight := Prior()
+	params["prior_mean"] = mean
+	params["prior_weight"] = weight
+	return params
+}
+
+// Histogram counts ratings by half star, keyed "0.5" to "5.0".
+type Histogram map[string]int
+
+// StarBuckets lists every histogram key in order.
+var StarBuckets = []string{"0.5", "1.0", "1.5", "2.0", "2.5", "3.0", "3.5", "4.0", "4.5", "5.0"}
+
+// starBucket returns the histogram key for a rating, rounded to the nearest
+// half star.
+func starBucket(rating float64) string {
+	return strconv.FormatFloat(math.Max(0.5, math.Round(rating*2)/2), 'f', 1, 64)
+}
+
+// Full returns the histogram with every bucket present.
+func (h Histogram) Full() Histogram {
+	full := make(Histogram, len(StarBuckets))
+	for _, b := range StarBuckets {
+		full[b] = h[b]
+	}
+	return full
+}
+
+// equal compares histograms, treating missing buckets as zero.
+func (h Histogram) equal(o Histogram) bool {
+	for k, v := range h {
+		if o[k] != v {
+			return false
+		}
+	}
+	for k, v := range o {
+		if h[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Scan reads a rating_histogram column.
+func (h *Histogram) Scan(src any) error {
+	*h = Histogram{}
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("rating_histogram: unexpected type %T", src)
+	}
+	if len(data) == 0 || string(data) == "null" {
+		return nil
+	}
+	return json.Unmarshal(data, h)
+}
+
+// Value stores a histogram without its empty buckets.
+func (h Histogram) Value() (driver.Value, error) {
+	trimmed := Histogram{}
+	for k, v := range h {
+		if v != 0 {
+			trimmed[k] = v
+		}
+	}
+	data, err := json.Marshal(trimmed)
+	return string(data), err
+}
+
+// median returns the median of values, or 0 for none.
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
+
+// OrderBy returns an ORDER BY expression ranking books by a stats sort key,
+// over book_stats aliased as alias (which may be NULL for books with no
+// row), and whether the key is known. Keys:
+//
+//	rating       Bayesian-weighted score, best first
+//	average      plain mean rating, best first, unrated last
+//	ratings      number of ratings, most first
+//	reads        readers who finished, most first
+//	dnf_rate     share of finishers and DNFs who gave up, lowest first
+//	finish_time  median days from start to finish, quickest first
+//
+// Callers append their own tie-breakers.
+func OrderBy(key, alias string) (string, bool) {
+	a := alias + "."
+	switch key {
+	case "rating":
+		mean, _ := Prior()
+		return "COALESCE(" + a + "weighted_score, " + strconv.FormatFloat(mean, 'f', -1, 64) + ") DESC", true
+	case "average":
+		return a + "rating_sum * 1.0 / NULLIF(" + a + "rating_count, 0) DESC NULLS LAST", true
+	case "ratings":
+		return "COALESCE(" + a + "rating_count, 0) DESC", true
+	case "reads":
+		return "COALESCE(" + a + "reads_count, 0) DESC", true
+	case "dnf_rate":
+		return a + "dnf_count * 1.0 / NULLIF(" + a + "reads_count + " + a + "dnf_count, 0) ASC NULLS LAST", true
+	case "finish_time":
+		return "CASE WHEN " + a + "finish_count > 0 THEN " + a + "median_days_to_finish END ASC NULLS LAST", true
+	}
+	return "", false
+}
@@ -323,13 +323,11 @@ func GetFeed(app core.App) func(e *core.RequestEvent) error {
 				}
 			}
 			if len(filtered) > 0 {
-				placeholders := make([]string, len(filtered))
-				for i, t := range filtered {
-					key := fmt.Sprintf("type%d", i)
-					placeholders[i] = "{:" + key + "}"
-					params[key] = t
+				placeholders, binds := inPlaceholders(filtered)
+				for k, v := range binds {
+					params[k] = v
 				}
-				query += " AND a.activity_type IN (" + strings.Join(placeholders, ", ") + ")"
+				query += " AND a.activity_type IN (" + placeholders + ")"
 			}
 		}
 
@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/store"
+)
+
+// authorMetadataTTL is how long a fetched authors row is served before a
+// background refresh is scheduled.
+const authorMetadataTTL = 30 * 24 * time.Hour
+
+// ensureAuthor finds or creates the authors record for an OL key and/or name.
+// With a key, an existing keyless record of the same name (from an import
+// that had no key) is adopted rather than duplicated. Without a key, names
+// match case-insensitively, preferring records that have a key.
+func ensureAuthor(app core.App, key, name string) (*core.Record, error) {
+	if key != "" {
+		if rec, err := app.FindFirstRecordByData("authors", "ol_key", key); err == nil {
+			return rec, nil
+		}
+	}
+
+	type idRow struct {
+		ID string `db:"id"`
+	}
+	var row idRow
+	query := `SELECT id FROM authors WHERE name = {:name} COLLATE NOCASE ORDER BY ol_key = '' ASC LIMIT 1`
+	if key != "" {
+		query = `SELECT id FROM authors WHERE ol_key = '' AND name = {:name} COLLATE NOCASE LIMIT 1`
+	}
+	if name != "" {
+		if err := app.DB().NewQuery(query).Bind(map[string]any{"name": name}).One(&row); err == nil {
+			rec, err := app.FindRecordById("authors", row.ID)
+			if err == nil {
+				if key != "" {
+					rec.Set("ol_key", key)
+					if err := app.Save(rec); err != nil {
+						return nil, err
+					}
+				}
+				return rec, nil
+			}
+		}
+	}
+
+	if name == "" {
+		name = key
+	}
+	coll, err := app.FindCollectionByNameOrId("authors")
+	if err != nil {
+		return nil, err
+	}
+	rec := core.NewRecord(coll)
+	rec.Set("ol_key", key)
+	rec.Set("name", name)
+	if err := app.Save(rec); err != nil {
+		// Lost a race with a concurrent insert of the same key.
+		if key != "" {
+			if existing, findErr := app.FindFirstRecordByData("authors", "ol_key", key); findErr == nil {
+				return existing, nil
+			}
+		}
+		return nil, err
+	}
+	return rec, nil
+}
+
+// syncBookAuthors makes the book's "author" links in book_authors match its
+// authors string, using author_keys when they line up with the names. Links
+// with other roles (translator, illustrator, editor) are left alone.
+func syncBookAuthors(app core.App, book *core.Record) error {
+	names := splitAuthors(book.GetString("authors"))
+	var keys []string
+	_ = book.UnmarshalJSONField("author_keys", &keys)
+	if len(keys) != len(names) {
+		keys = nil
+	}
+
+	existing, err := app.FindRecordsByFilter("book_authors",
+		"book = {:book} && role = 'author'", "", 0, 0,
+		map[string]any{"book": book.Id},
+	)
+	if err != nil {
+		return err
+	}
+	byAuthor := make(map[string]*core.Record, len(existing))
+	for _, link := range existing {
+		byAuthor[link.GetString("author")] = link
+	}
+
+	coll, err := app.FindCollectionByNameOrId("book_authors")
+	if err != nil {
+		return err
+	}
+	keep := map[string]bool{}
+	for i, name := range names {
+		key := ""
+		if keys != nil {
+			key = keys[i]
+		}
+		author, err := ensureAuthor(app, key, name)
+		if err != nil {
+			return err
+		}
+		if keep[author.Id] {
+			continue
+		}
+		keep[author.Id] = true
+
+		link := byAuthor[author.Id]
+		if link == nil {
+			link = core.NewRecord(coll)
+			link.Set("book", book.Id)
+			link.Set("author", author.Id)
+			link.Set("role", "author")
+		} else if link.GetInt("position") == i {
+			continue
+		}
+		link.Set("position", i)
+		if err := app.Save(link); err != nil {
+			return err
+		}
+	}
+
+	for authorID, link := range byAuthor {
+		if !keep[authorID] {
+			if err := app.Delete(link); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// bookAuthorsFor returns a book's credited people in display order as
+// {name, key, role} maps.
+func bookAuthorsFor(app core.App, bookID string) []map[string]any {
+	type row struct {
+		Name string `db:"name"`
+		Key  string `db:"ol_key"`
+		Role string `db:"role"`
+	}
+	var rows []row
+	_ = app.DB().NewQuery(`
+		SELECT a.name, a.ol_key, ba.role
+		FROM book_authors ba
+		JOIN authors a ON a.id = ba.author
+		WHERE ba.book = {:book}
+		ORDER BY ba.role != 'author', ba.position, a.name
+	`).Bind(map[string]any{"book": bookID}).All(&rows)
+
+	results := make([]map[string]any, 0, len(rows))
+	for _, r := range rows {
+		results = append(results, map[string]any{
+			"name": r.Name,
+			"key":  nilIfEmpty(r.Key),
+			"role": r.Role,
+		})
+	}
+	return results
+}
+
+// refreshAuthor fetches an author from the catalog and stores it in the
+// authors collection, creating the record if needed.
+func refreshAuthor(app core.App, authorKey string) (*core.Record, error) {
+	a, err := newCatalog().author(authorKey)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := ensureAuthor(app, authorKey, a.Name)
+	if err != nil {
+		return nil, err
+	}
+	if a.Name != "" {
+		rec.Set("name", a.Name)
+	}
+	rec.Set("bio", a.Bio)
+	rec.Set("photo_url", a.PhotoURL)
+	rec.Set("birth_date", a.BirthDate)
+	rec.Set("death_date", a.DeathDate)
+	rec.Set("alternate_names", a.AlternateNames)
+	rec.Set("links", a.Links)
+	rec.Set("fetched_at", store.FormatTime(time.Now()))
+	if err := app.Save(rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// authorRouteKey is the key an author is addressed by in /authors/{authorKey}
+// routes: the OL key, or the record id for authors without one.
+func authorRouteKey(id, olKey string) string {
+	if olKey != "" {
+		return olKey
+	}
+	return id
+}
+
+// authorPhotoURL is an author's stored photo, else their Open Library photo
+// by key, or nil for a keyless author without one.
+func authorPhotoURL(olKey, photoURL string) any {
+	if photoURL != "" {
+		return photoURL
+	}
+	if olKey == "" {
+		return nil
+	}
+	return fmt.Sprintf("https://covers.openlibrary.org/a/olid/%s-M.jpg", olKey)
+}
+
+// authorRefreshing dedupes background refreshes triggered by page views.
+var authorRefreshing sync.Map
+
+// loadAuthor returns the local authors record for an OL key. Authors that
+// have never been fetched are fetched synchronously; stale ones are returned
+// as-is and refreshed in the background. Returns nil when the author is
+// unknown locally and the catalog is unreachable.
+func loadAuthor(app core.App, authorKey string) *core.Record {
+	rec, _ := app.FindFirstRecordByData("authors", "ol_key", authorKey)
+	if rec == nil {
+		// Authors without an OL key are addressed by their record id and
+		// have nothing to fetch.
+		if local, err := app.FindRecordById("authors", authorKey); err == nil && local.GetString("ol_key") == "" {
+			return local
+		}
+	}
+
+	fetchedAt := time.Time{}
+	if rec != nil {
+		fetchedAt = rec.GetDateTime("fetched_at").Time()
+	}
+
+	if fetchedAt.IsZero() {
+		if fresh, err := refreshAuthor(app, authorKey); err == nil {
+			return fresh
+		}
+		return rec
+	}
+
+	if time.Since(fetchedAt) > authorMetadataTTL {
+		if _, inFlight := authorRefreshing.LoadOrStore(authorKey, struct{}{}); !inFlight {
+			go func() {
+				defer authorRefreshing.Delete(authorKey)
+				if _, err := refreshAuthor(app, authorKey); err != nil {
+					log.Printf("[Authors] refresh %s failed: %v", authorKey, err)
+				}
+			}()
+		}
+	}
+	return rec
+}
+
+// followedAuthors lists a user's followed authors, newest first, with names
+// and photos resolved through the authors collection.
+func followedAuthors(app core.App, userID string, limit, offset int) ([]map[string]any, error) {
+	type row struct {
+		AuthorKey  string `db:"author_key"`
+		AuthorName string `db:"author_name"`
+		PhotoURL   string `db:"photo_url"`
+	}
+	var rows []row
+	err := app.DB().NewQuery(`
+		SELECT af.author_key,
+			COALESCE(NULLIF(a.name, ''), af.author_name) AS author_name,
+			COALESCE(a.photo_url, '') AS photo_url
+		FROM author_follows af
+		LEFT JOIN authors a ON a.id = af.author
+		WHERE af.user = {:user}
+		ORDER BY af.created DESC, af.rowid DESC
+		LIMIT {:limit} OFFSET {:offset}
+	`).Bind(map[string]any{"user": userID, "limit": limit, "offset": offset}).All(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]map[string]any, len(rows))
+	for i, r := range rows {
+		results[i] = map[string]any{
+			"author_key":  r.AuthorKey,
+			"author_name": r.AuthorName,
+			"photo_url":   nilIfEmpty(r.PhotoURL),
+		}
+	}
+	return results, nil
+}
+
+// localAuthorWorks pages through the books credited to an author in
+// book_authors, shaped like the catalog's author works listing.
+func localAuthorWorks(app core.App, authorID string, limit, offset int) ([]map[string]any, int) {
+	params := map[string]any{"author": authorID, "limit": limit, "offset": offset}
+
+	var total int
+	_ = app.DB().NewQuery(`
+		SELECT COUNT(DISTINCT book) FROM book_authors WHERE author = {:author}
+	`).Bind(params).Row(&total)
+
+	type row struct {
+		OLID     string `db:"open_library_id"`
+		Title    string `db:"title"`
+		CoverURL string `db:"cover_url"`
+	}
+	var rows []row
+	_ = app.DB().NewQuery(`
+		SELECT DISTINCT b.open_library_id, b.title, b.cover_url
+		FROM book_authors ba
+		JOIN books b ON b.id = ba.book
+		WHERE ba.author = {:author}
+		ORDER BY b.publication_year DESC, b.title
+		LIMIT {:limit} OFFSET {:offset}
+	`).Bind(params).All(&rows)
+
+	works := make([]map[string]any, 0, len(rows))
+	for _, r := range rows {
+		works = append(works, map[string]any{
+			"key":       r.OLID,
+			"title":     r.Title,
+			"cover_url": nilIfEmpty(r.CoverURL),
+		})
+	}
+	return works, total
+}
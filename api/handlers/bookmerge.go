@@ -0,0 +1,488 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/bookstats"
+	"github.com/tristansaldanha/rosslib/api/search"
+)
+
+// errMergeDryRun rolls back the merge transaction after the report is built.
+var errMergeDryRun = errors.New("dry run")
+
+// bookMergeTable describes a collection with a relation to books. key lists
+// the other columns that make a row unique per book; a source row whose key
+// already exists on the target is a conflict and one side is dropped. For
+// perUser tables the side whose user_books record won is kept, otherwise the
+// target's row is.
+type bookMergeTable struct {
+	table   string
+	col     string
+	key     []string
+	perUser bool
+}
+
+var bookMergeTables = []bookMergeTable{
+	{table: "collection_items", col: "book", key: []string{"collection"}},
+	{table: "book_tag_values", col: "book", key: []string{"user", "tag_value"}, perUser: true},
+	{table: "threads", col: "book"},
+	{table: "book_quotes", col: "book"},
+	{table: "book_links", col: "from_book", key: []string{"to_book", "link_type", "user"}},
+	{table: "book_links", col: "to_book", key: []string{"from_book", "link_type", "user"}},
+	{table: "book_series", col: "book", key: []string{"series"}},
+	{table: "genre_ratings", col: "book", key: []string{"user", "genre"}, perUser: true},
+	{table: "reading_sessions", col: "book"},
+	{table: "progress_events", col: "book"},
+	{table: "book_follows", col: "book", key: []string{"user"}},
+	{table: "review_likes", col: "book", key: []string{"user", "review_user"}},
+	{table: "review_comments", col: "book"},
+	{table: "recommendations", col: "book", key: []string{"sender", "recipient"}},
+	{table: "activities", col: "book"},
+	// Credits aren't unioned: if the target already has people in a role,
+	// the source's credits for that role are dropped.
+	{table: "book_authors", col: "book", key: []string{"role"}},
+	{table: "book_redirects", col: "book"},
+	{table: "book_isbns", col: "book"},
+}
+
+// bookMergeFillFields are copied from the source book when empty on the
+// target.
+var bookMergeFillFields = []string{
+	"subtitle", "cover_url", "isbn13", "publication_year", "publisher",
+	"page_count", "subjects", "description", "first_sentence",
+}
+
+type mergeTableCounts struct {
+	Moved   int `json:"moved"`
+	Dropped int `json:"dropped"`
+}
+
+type mergeUserConflict struct {
+	User string `json:"user"`
+	Kept string `json:"kept"` // "source" or "target"
+}
+
+type bookMergeReport struct {
+	Source       string                       `json:"source"`
+	Target       string                       `json:"target"`
+	DryRun       bool                         `json:"dry_run"`
+	Tables       map[string]*mergeTableCounts `json:"tables"`
+	Conflicts    []mergeUserConflict          `json:"user_conflicts"`
+	FieldsFilled []string                     `json:"fields_filled"`
+}
+
+func (r *bookMergeReport) counts(table string) *mergeTableCounts {
+	c, ok := r.Tables[table]
+	if !ok {
+		c = &mergeTableCounts{}
+		r.Tables[table] = c
+	}
+	return c
+}
+
+// MergeBooks handles POST /admin/books/merge
+// Body: { "source": "OL1W", "target": "OL2W", "dry_run": true }
+// Moves everything attached to the source book onto the target, deletes the
+// source and leaves a redirect from its OL ID. With dry_run the merge runs
+// in a transaction that is rolled back, so the report is exact.
+func MergeBooks(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		var body struct {
+			Source string `json:"source"`
+			Target string `json:"target"`
+			DryRun bool   `json:"dry_run"`
+		}
+		if err := e.BindBody(&body); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "invalid request body"})
+		}
+		if body.Source == "" || body.Target == "" {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "source and target are required"})
+		}
+		if body.Source == body.Target {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "source and target must differ"})
+		}
+
+		source, err := app.FindFirstRecordByData("books", "open_library_id", body.Source)
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "source book not found"})
+		}
+		target, err := app.FindFirstRecordByData("books", "open_library_id", body.Target)
+		if err != nil {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "target book not found"})
+		}
+
+		report, err := mergeBooks(app, source, target, e.Auth.Id, body.DryRun)
+		if err != nil {
+			log.Printf("[BookMerge] %s -> %s failed: %v", body.Source, body.Target, err)
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "merge failed: " + err.Error()})
+		}
+		if !body.DryRun {
+			log.Printf("[BookMerge] merged %s into %s", body.Source, body.Target)
+		}
+		return e.JSON(http.StatusOK, report)
+	}
+}
+
+// mergeBooks merges source into target inside a transaction and returns what
+// moved. With dryRun the transaction is rolled back.
+func mergeBooks(app core.App, source, target *core.Record, mergedBy string, dryRun bool) (*bookMergeReport, error) {
+	report := &bookMergeReport{
+		Source:       source.GetString("open_library_id"),
+		Target:       target.GetString("open_library_id"),
+		DryRun:       dryRun,
+		Tables:       map[string]*mergeTableCounts{},
+		Conflicts:    []mergeUserConflict{},
+		FieldsFilled: []string{},
+	}
+
+	err := app.RunInTransaction(func(txApp core.App) error {
+		m := &bookMerger{app: txApp, src: source.Id, dst: target.Id, report: report}
+		if err := m.mergeUserBooks(); err != nil {
+			return fmt.Errorf("user_books: %w", err)
+		}
+		if err := m.dropExclusiveTagConflicts(); err != nil {
+			return fmt.Errorf("book_tag_values: %w", err)
+		}
+		for _, t := range bookMergeTables {
+			if err := m.repoint(t); err != nil {
+				return fmt.Errorf("%s: %w", t.table, err)
+			}
+		}
+		if err := m.repointUnlisted(); err != nil {
+			return err
+		}
+		if err := m.dropSelfLinks(); err != nil {
+			return fmt.Errorf("book_links: %w", err)
+		}
+
+		// Re-read inside the transaction; the records passed in may be stale.
+		dst, err := txApp.FindRecordById("books", target.Id)
+		if err != nil {
+			return err
+		}
+		for _, field := range bookMergeFillFields {
+			if isZeroField(dst, field) && !isZeroField(source, field) {
+				dst.Set(field, source.Get(field))
+				report.FieldsFilled = append(report.FieldsFilled, field)
+			}
+		}
+		if len(report.FieldsFilled) > 0 {
+			if err := txApp.Save(dst); err != nil {
+				return err
+			}
+		}
+
+		redirectsColl, err := txApp.FindCollectionByNameOrId("book_redirects")
+		if err != nil {
+			return err
+		}
+		redirect := core.NewRecord(redirectsColl)
+		redirect.Set("from_ol_id", report.Source)
+		redirect.Set("book", target.Id)
+		redirect.Set("merged_by", mergedBy)
+		if err := txApp.Save(redirect); err != nil {
+			return err
+		}
+
+		// Deleting the source cascades anything left behind, including its
+		// book_stats row.
+		src, err := txApp.FindRecordById("books", source.Id)
+		if err != nil {
+			return err
+		}
+		if err := txApp.Delete(src); err != nil {
+			return err
+		}
+
+		// Series, credits, shelves and labels were re-pointed with raw SQL,
+		// which bypasses the search and stats hooks.
+		if err := search.IndexBook(txApp, target.Id); err != nil {
+			return fmt.Errorf("search index: %w", err)
+		}
+		if err := bookstats.Recount(txApp, target.Id); err != nil {
+			return fmt.Errorf("book stats: %w", err)
+		}
+
+		if dryRun {
+			return errMergeDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errMergeDryRun) {
+		return nil, err
+	}
+	return report, nil
+}
+
+type bookMerger struct {
+	app    core.App
+	src    string
+	dst    string
+	report *bookMergeReport
+	// winner maps user id -> "source" or "target" for users who had the
+	// book on both records.
+	winner map[string]string
+}
+
+// userBookRichFields are filled on the kept user_books record from the
+// dropped one when empty, and count towards how rich a record is.
+var userBookRichFields = []string{
+	"rating", "review_text", "date_read", "date_started", "date_dnf",
+	"progress_pages", "progress_percent", "selected_edition_key",
+	"selected_edition_cover_url", "device_total_pages",
+}
+
+// mergeUserBooks resolves users who have the book on both records by keeping
+// the richer user_books record (ties go to the target), filling its empty
+// fields from the other, and deleting the other. Reviews weigh double.
+func (m *bookMerger) mergeUserBooks() error {
+	m.winner = map[string]string{}
+	srcRecs, err := m.app.FindRecordsByFilter("user_books", "book = {:book}", "", 0, 0, map[string]any{"book": m.src})
+	if err != nil {
+		return err
+	}
+	dstRecs, err := m.app.FindRecordsByFilter("user_books", "book = {:book}", "", 0, 0, map[string]any{"book": m.dst})
+	if err != nil {
+		return err
+	}
+	dstByUser := make(map[string]*core.Record, len(dstRecs))
+	for _, r := range dstRecs {
+		dstByUser[r.GetString("user")] = r
+	}
+
+	richness := func(r *core.Record) int {
+		score := 0
+		for _, f := range userBookRichFields {
+			if !isZeroField(r, f) {
+				score++
+			}
+		}
+		if r.GetString("review_text") != "" {
+			score++
+		}
+		return score
+	}
+
+	counts := m.report.counts("user_books")
+	for _, s := range srcRecs {
+		user := s.GetString("user")
+		d, ok := dstByUser[user]
+		if !ok {
+			continue
+		}
+		keep, drop, side := d, s, "target"
+		if richness(s) > richness(d) {
+			keep, drop, side = s, d, "source"
+		}
+		m.winner[user] = side
+		m.report.Conflicts = append(m.report.Conflicts, mergeUserConflict{User: user, Kept: side})
+
+		filled := false
+		for _, f := range userBookRichFields {
+			if isZeroField(keep, f) && !isZeroField(drop, f) {
+				keep.Set(f, drop.Get(f))
+				filled = true
+			}
+		}
+		// Keep the earliest date_added so shelf history isn't shortened.
+		if added := drop.GetDateTime("date_added"); !added.IsZero() &&
+			(isZeroField(keep, "date_added") || added.Time().Before(keep.GetDateTime("date_added").Time())) {
+			keep.Set("date_added", drop.Get("date_added"))
+			filled = true
+		}
+		if err := m.app.Delete(drop); err != nil {
+			return err
+		}
+		if filled {
+			if err := m.app.Save(keep); err != nil {
+				return err
+			}
+		}
+		counts.Dropped++
+	}
+
+	res, err := m.app.DB().NewQuery(`UPDATE user_books SET book = {:dst} WHERE book = {:src}`).
+		Bind(map[string]any{"src": m.src, "dst": m.dst}).Execute()
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	counts.Moved += int(n)
+	return nil
+}
+
+// dropExclusiveTagConflicts handles select_one tag keys (e.g. status): a user
+// can only hold one value per key on a book, so the losing side's values for
+// keys both sides have are dropped.
+func (m *bookMerger) dropExclusiveTagConflicts() error {
+	var rows []mergeConflictRow
+	err := m.app.DB().NewQuery(`
+		SELECT s.id AS src, d.id AS dst, s."user" AS user
+		FROM book_tag_values s
+		JOIN book_tag_values d ON d.book = {:dst} AND d."user" = s."user" AND d.tag_key = s.tag_key
+		JOIN tag_keys tk ON tk.id = s.tag_key AND tk.mode = 'select_one'
+		WHERE s.book = {:src} AND d.tag_value != s.tag_value
+	`).Bind(map[string]any{"src": m.src, "dst": m.dst}).All(&rows)
+	if err != nil {
+		return err
+	}
+	return m.dropConflicts("book_tag_values", rows, true)
+}
+
+type mergeConflictRow struct {
+	Src  string `db:"src"`
+	Dst  string `db:"dst"`
+	User string `db:"user"`
+}
+
+// repoint moves a table's rows from the source book to the target, first
+// dropping one side of any row that would collide on t.key.
+func (m *bookMerger) repoint(t bookMergeTable) error {
+	params := map[string]any{"src": m.src, "dst": m.dst}
+
+	if len(t.key) > 0 {
+		var on []string
+		for _, k := range t.key {
+			on = append(on, fmt.Sprintf(`d."%s" = s."%s"`, k, k))
+		}
+		userCol := `''`
+		if t.perUser {
+			userCol = `s."user"`
+		}
+		var rows []mergeConflictRow
+		err := m.app.DB().NewQuery(fmt.Sprintf(`
+			SELECT s.id AS src, d.id AS dst, %s AS user
+			FROM %s s
+			JOIN %s d ON d."%s" = {:dst} AND %s
+			WHERE s."%s" = {:src}
+		`, userCol, t.table, t.table, t.col, strings.Join(on, " AND "), t.col)).Bind(params).All(&rows)
+		if err != nil {
+			return err
+		}
+		if err := m.dropConflicts(t.table, rows, t.perUser); err != nil {
+			return err
+		}
+	}
+
+	res, err := m.app.DB().NewQuery(fmt.Sprintf(
+		`UPDATE %s SET "%s" = {:dst} WHERE "%s" = {:src}`, t.table, t.col, t.col,
+	)).Bind(params).Execute()
+	if err != nil {
+		return err
+	}
+	n, _ := res.RowsAffected()
+	m.report.counts(t.table).Moved += int(n)
+	return nil
+}
+
+// dropConflicts deletes one record of each conflicting pair through the app,
+// so cascades (e.g. votes on a dropped book link) still apply.
+func (m *bookMerger) dropConflicts(table string, rows []mergeConflictRow, perUser bool) error {
+	dropped := map[string]bool{}
+	for _, r := range rows {
+		id := r.Src
+		if perUser && m.winner[r.User] == "source" {
+			id = r.Dst
+		}
+		if dropped[id] {
+			continue
+		}
+		dropped[id] = true
+		rec, err := m.app.FindRecordById(table, id)
+		if err != nil {
+			continue
+		}
+		if err := m.app.Delete(rec); err != nil {
+			return err
+		}
+		m.report.counts(table).Dropped++
+	}
+	return nil
+}
+
+// repointUnlisted moves rows in any other collection that relates to books,
+// so collections added later aren't silently cascaded away with the source.
+func (m *bookMerger) repointUnlisted() error {
+	books, err := m.app.FindCollectionByNameOrId("books")
+	if err != nil {
+		return err
+	}
+	listed := map[string]bool{"user_books": true, "book_stats": true}
+	for _, t := range bookMergeTables {
+		listed[t.table+"."+t.col] = true
+	}
+	collections, err := m.app.FindAllCollections(core.CollectionTypeBase)
+	if err != nil {
+		return err
+	}
+	for _, c := range collections {
+		if listed[c.Name] {
+			continue
+		}
+		for _, f := range c.Fields {
+			rel, ok := f.(*core.RelationField)
+			if !ok || rel.CollectionId != books.Id || rel.MaxSelect != 1 || listed[c.Name+"."+rel.Name] {
+				continue
+			}
+			if err := m.repoint(bookMergeTable{table: c.Name, col: rel.Name}); err != nil {
+				return fmt.Errorf("%s: %w", c.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// dropSelfLinks removes book links that pointed between the two merged books.
+func (m *bookMerger) dropSelfLinks() error {
+	links, err := m.app.FindRecordsByFilter("book_links",
+		"from_book = {:dst} && to_book = {:dst}", "", 0, 0,
+		map[string]any{"dst": m.dst},
+	)
+	if err != nil {
+		return err
+	}
+	for _, l := range links {
+		if err := m.app.Delete(l); err != nil {
+			return err
+		}
+		c := m.report.counts("book_links")
+		c.Moved--
+		c.Dropped++
+	}
+	return nil
+}
+
+// isZeroField reports whether a record field holds its empty value.
+func isZeroField(r *core.Record, field string) bool {
+	switch v := r.Get(field).(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case float64:
+		return v == 0
+	case int:
+		return v == 0
+	}
+	return r.GetString(field) == "" || isEmptyJSON(r.GetString(field))
+}
+
+// resolveBookRedirect returns the book a merged-away OL work ID now points
+// to, or nil.
+func resolveBookRedirect(app core.App, olID string) *core.Record {
+	redirect, err := app.FindFirstRecordByData("book_redirects", "from_ol_id", olID)
+	if err != nil {
+		return nil
+	}
+	book, err := app.FindRecordById("books", redirect.GetString("book"))
+	if err != nil {
+		return nil
+	}
+	return book
+}
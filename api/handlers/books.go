@@ -11,9 +11,13 @@ import (
 	"strings"
 
 	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/bookstats"
+	"github.com/tristansaldanha/rosslib/api/isbn"
+	"github.com/tristansaldanha/rosslib/api/search"
 )
 
-// SearchBooks handles GET /books/search?q=...&page=1
+// SearchBooks handles GET /books/search?q=...&page=1&sort=...
 func SearchBooks(app core.App) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
 		q := e.Request.URL.Query().Get("q")
@@ -30,31 +34,22 @@ func SearchBooks(app core.App) func(e *core.RequestEvent) error {
 		}
 		offset := (page - 1) * perPage
 
-		// Search local books first
-		localBooks, _ := app.FindRecordsByFilter("books",
-			"title LIKE {:q} || authors LIKE {:q}",
-			"-created", perPage, offset,
-			map[string]any{"q": "%" + q + "%"},
-		)
+		// Search local books first, ranked by the full-text index or, with
+		// ?sort=rating|average|ratings|reads|dnf_rate|finish_time, by their
+		// stats with relevance breaking ties. Open Library results have no
+		// stats and always follow.
+		order, _ := bookstats.OrderBy(e.Request.URL.Query().Get("sort"), "bs")
+		localIDs, localTotal, err := search.BooksBy(app, q, order, perPage, offset)
+		if err != nil {
+			log.Printf("[Search] books %q: %v", q, err)
+		}
+		localBooks := findRecordsInOrder(app, "books", localIDs)
 
 		var results []map[string]any
 		seenOLIDs := map[string]bool{}
 
 		// Batch-fetch book_stats for all local books
-		statsMap := map[string]*core.Record{} // bookId -> stats record
-		if len(localBooks) > 0 {
-			var bookIDs []any
-			for _, b := range localBooks {
-				bookIDs = append(bookIDs, b.Id)
-			}
-			allStats, _ := app.FindRecordsByFilter("book_stats",
-				"book IN {:ids}", "", len(localBooks), 0,
-				map[string]any{"ids": bookIDs},
-			)
-			for _, s := range allStats {
-				statsMap[s.GetString("book")] = s
-			}
-		}
+		statsMap := batchBookStats(app, localBooks) // bookId -> stats record
 
 		// Batch-fetch link counts for all local books
 		linkCountMap := map[string]int{} // bookId -> count
@@ -64,16 +59,17 @@ func SearchBooks(app core.App) func(e *core.RequestEvent) error {
 				Count  int    `db:"count"`
 			}
 			var linkCounts []linkCountRow
-			var bookIDs []any
-			for _, b := range localBooks {
-				bookIDs = append(bookIDs, b.Id)
+			bookIDs := make([]string, len(localBooks))
+			for i, b := range localBooks {
+				bookIDs[i] = b.Id
 			}
+			placeholders, binds := inPlaceholders(bookIDs)
 			_ = app.DB().NewQuery(`
 				SELECT from_book, COUNT(*) as count
 				FROM book_links
-				WHERE from_book IN {:ids} AND (deleted_at IS NULL OR deleted_at = '')
+				WHERE from_book IN (` + placeholders + `) AND (deleted_at IS NULL OR deleted_at = '')
 				GROUP BY from_book
-			`).Bind(map[string]any{"ids": bookIDs}).All(&linkCounts)
+			`).Bind(binds).All(&linkCounts)
 			for _, lc := range linkCounts {
 				linkCountMap[lc.BookID] = lc.Count
 			}
@@ -85,6 +81,7 @@ func SearchBooks(app core.App) func(e *core.RequestEvent) error {
 
 			var avgRating *float64
 			var ratingCount, alreadyReadCount int
+			weightedRating, _ := bookstats.Prior()
 			if s, ok := statsMap[b.Id]; ok {
 				if rc := s.GetInt("rating_count"); rc > 0 {
 					avg := s.GetFloat("rating_sum") / float64(rc)
@@ -92,6 +89,7 @@ func SearchBooks(app core.App) func(e *core.RequestEvent) error {
 				}
 				ratingCount = s.GetInt("rating_count")
 				alreadyReadCount = s.GetInt("reads_count")
+				weightedRating = s.GetFloat("weighted_score")
 			}
 
 			var subjects []string
@@ -115,6 +113,7 @@ func SearchBooks(app core.App) func(e *core.RequestEvent) error {
 				"cover_url":         b.GetString("cover_url"),
 				"edition_count":     0,
 				"average_rating":    avgRating,
+				"weighted_rating":   weightedRating,
 				"rating_count":      ratingCount,
 				"already_read_count": alreadyReadCount,
 				"subjects":          subjects,
@@ -187,6 +186,7 @@ func SearchBooks(app core.App) func(e *core.RequestEvent) error {
 						"cover_url":         coverURL,
 						"edition_count":     doc["edition_count"],
 						"average_rating":    nil,
+						"weighted_rating":   nil,
 						"rating_count":      0,
 						"already_read_count": 0,
 						"subjects":          olSubjects,
@@ -206,6 +206,9 @@ func SearchBooks(app core.App) func(e *core.RequestEvent) error {
 
 		// Estimate total from OL numFound (which is the most complete source)
 		total := len(results)
+		if localTotal > total {
+			total = localTotal
+		}
 		if olData != nil {
 			if numFound, ok := olData["numFound"].(float64); ok && int(numFound) > total {
 				total = int(numFound)
@@ -221,98 +224,63 @@ func SearchBooks(app core.App) func(e *core.RequestEvent) error {
 }
 
 // LookupBook handles GET /books/lookup?isbn=...&ol_id=...
+// ISBNs may be ISBN-10, ISBN-13 or an EAN barcode, with or without hyphens.
+// Books already holding the ISBN (for any edition) resolve locally.
 func LookupBook(app core.App) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
-		isbn := e.Request.URL.Query().Get("isbn")
+		rawISBN := e.Request.URL.Query().Get("isbn")
 		olID := e.Request.URL.Query().Get("ol_id")
 
-		if isbn == "" && olID == "" {
+		if rawISBN == "" && olID == "" {
 			return e.JSON(http.StatusBadRequest, map[string]any{"error": "isbn or ol_id required"})
 		}
 
-		ol := newOLClient()
-
-		if isbn != "" {
-			data, err := ol.get(fmt.Sprintf("/isbn/%s.json", isbn))
+		var parsed isbn.ISBN
+		if rawISBN != "" {
+			var err error
+			parsed, err = isbn.Parse(rawISBN)
 			if err != nil {
-				return e.JSON(http.StatusNotFound, map[string]any{"error": "Book not found"})
+				return e.JSON(http.StatusBadRequest, map[string]any{"error": "invalid ISBN"})
 			}
-			// Extract work ID from the ISBN response
-			if works, ok := data["works"].([]any); ok && len(works) > 0 {
-				if w, ok := works[0].(map[string]any); ok {
-					if key, ok := w["key"].(string); ok {
-						olID = strings.TrimPrefix(key, "/works/")
-					}
-				}
+			m, found := matchBook(app, parsed.ISBN13(), "", "")
+			if !found {
+				return e.JSON(http.StatusNotFound, map[string]any{"error": "Book not found"})
 			}
+			olID = m.WorkID
 		}
 
 		if olID == "" {
 			return e.JSON(http.StatusNotFound, map[string]any{"error": "Book not found"})
 		}
 
-		// Fetch work details from OL
-		workData, err := ol.get(fmt.Sprintf("/works/%s.json", olID))
-		if err != nil {
+		// Store the work locally (fetching the full snapshot if it has never
+		// been fetched) and remember the ISBN it was found by.
+		book := loadWorkMetadata(app, olID)
+		if book == nil {
 			return e.JSON(http.StatusNotFound, map[string]any{"error": "Book not found"})
 		}
-
-		title, _ := workData["title"].(string)
-		var coverURL string
-		if covers, ok := workData["covers"].([]any); ok && len(covers) > 0 {
-			if coverID, ok := covers[0].(float64); ok {
-				coverURL = fmt.Sprintf("https://covers.openlibrary.org/b/id/%.0f-M.jpg", coverID)
+		var isbnOut, isbn10, hyphenated any
+		if rawISBN != "" {
+			book, _ = upsertBookFields(app, book.GetString("open_library_id"), bookFields{ISBN13: parsed.ISBN13()}, false)
+			if book == nil {
+				return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to save book"})
 			}
-		}
-
-		// Fetch authors
-		var authorNames []string
-		if authorList, ok := workData["authors"].([]any); ok {
-			for _, a := range authorList {
-				if aMap, ok := a.(map[string]any); ok {
-					if authorRef, ok := aMap["author"].(map[string]any); ok {
-						if key, ok := authorRef["key"].(string); ok {
-							aData, err := ol.get(key + ".json")
-							if err == nil {
-								if name, ok := aData["name"].(string); ok {
-									authorNames = append(authorNames, name)
-								}
-							}
-						}
-					}
-				}
+			isbnOut = parsed.ISBN13()
+			hyphenated = parsed.Hyphenate()
+			if s, ok := parsed.ISBN10(); ok {
+				isbn10 = s
 			}
 		}
 
-		authors := strings.Join(authorNames, ", ")
-
-		// Extract subjects from OL work data (up to 10)
-		var olSubjects []string
-		if subjectList, ok := workData["subjects"].([]any); ok {
-			for _, s := range subjectList {
-				if str, ok := s.(string); ok && str != "" {
-					olSubjects = append(olSubjects, str)
-					if len(olSubjects) >= 10 {
-						break
-					}
-				}
-			}
-		}
-		subjects := strings.Join(olSubjects, ", ")
-
-		// Upsert local book
-		book, err := upsertBook(app, olID, title, coverURL, isbn, authors, 0, subjects)
-		if err != nil {
-			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to save book"})
-		}
-
 		return e.JSON(http.StatusOK, map[string]any{
-			"key":       olID,
-			"book_id":   book.Id,
-			"title":     title,
-			"authors":   authorNames,
-			"cover_url": coverURL,
-			"isbn":      isbn,
+			"key":             book.GetString("open_library_id"),
+			"book_id":         book.Id,
+			"title":           book.GetString("title"),
+			"authors":         splitAuthors(book.GetString("authors")),
+			"cover_url":       book.GetString("cover_url"),
+			"isbn":            isbnOut,
+			"isbn10":          isbn10,
+			"isbn_hyphenated": hyphenated,
 		})
 	}
 }
@@ -328,7 +296,7 @@ func ScanBook(app core.App) func(e *core.RequestEvent) error {
 		}
 
 		// Delegate to lookup
-		e.Request.URL.RawQuery = "isbn=" + data.ISBN
+		e.Request.URL.RawQuery = "isbn=" + url.QueryEscape(data.ISBN)
 		return LookupBook(app)(e)
 	}
 }
@@ -336,10 +304,10 @@ func ScanBook(app core.App) func(e *core.RequestEvent) error {
 // seriesPositionRegex matches patterns like "Book 3", "#5", "Vol. 2", etc.
 var seriesPositionRegex = regexp.MustCompile(`(?i)(?:book|#|no\.?|vol\.?|volume|part)\s*(\d+)`)
 
-// populateSeriesFromOL checks Open Library edition data for series information
+// populateSeriesFromOL checks catalog edition data for series information
 // and creates series + book_series records if none exist yet. This is best-effort;
 // errors are logged but never surface to the caller.
-func populateSeriesFromOL(app core.App, ol *cachedOLClient, bookRec *core.Record, workID string, subjects []string) {
+func populateSeriesFromOL(app core.App, catalog *catalogChain, bookRec *core.Record, workID string, subjects []string) {
 	// Skip if book already has series links
 	type countResult struct {
 		Count int `db:"count"`
@@ -359,7 +327,7 @@ func populateSeriesFromOL(app core.App, ol *cachedOLClient, bookRec *core.Record
 	seen := map[string]bool{}
 
 	// 1. Check OL editions for series field
-	editionsData, err := ol.get(fmt.Sprintf("/works/%s/editions.json?limit=50", workID))
+	editionsData, err := catalog.editions(workID, 50, 0)
 	if err == nil {
 		if entries, ok := editionsData["entries"].([]any); ok {
 			for _, entry := range entries {
@@ -491,102 +459,54 @@ func GetBookDetail(app core.App) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
 		workID := e.Request.PathValue("workId")
 
-		// Try local first
-		localBooks, _ := app.FindRecordsByFilter("books",
-			"open_library_id = {:id}", "", 1, 0,
-			map[string]any{"id": workID},
-		)
-
-		// Fetch from OL for enriched data
-		ol := newOLClient()
-		workData, olErr := ol.get(fmt.Sprintf("/works/%s.json", workID))
+		// Render from the local record; first views fetch it from the
+		// catalog, stale ones are refreshed in the background.
+		var localBooks []*core.Record
+		if rec := loadWorkMetadata(app, workID); rec != nil {
+			localBooks = []*core.Record{rec}
+			// Merged works resolve to the surviving book, whose key the
+			// client should redirect to.
+			workID = rec.GetString("open_library_id")
+		}
 
 		title := ""
-		var description *string
+		var subtitle, description, firstSentence *string
 		var coverURL *string
 		var authors []map[string]any
-		var firstPubYear *float64
+		var firstPubYear *int
 		var pageCount *int
 		var publisher *string
 		var subjects []string
+		var links []CatalogLink
+		var excerpts []CatalogExcerpt
+		var editionCount int
+		isbns := []string{}
 
-		if olErr == nil {
-			if t, ok := workData["title"].(string); ok {
-				title = t
+		if len(localBooks) > 0 {
+			book := localBooks[0]
+			title = book.GetString("title")
+			if st := book.GetString("subtitle"); st != "" {
+				subtitle = &st
 			}
-			if desc, ok := workData["description"].(string); ok {
-				description = &desc
-			} else if descMap, ok := workData["description"].(map[string]any); ok {
-				if v, ok := descMap["value"].(string); ok {
-					description = &v
-				}
+			if d := book.GetString("description"); d != "" {
+				description = &d
 			}
-			if covers, ok := workData["covers"].([]any); ok && len(covers) > 0 {
-				if coverID, ok := covers[0].(float64); ok {
-					url := fmt.Sprintf("https://covers.openlibrary.org/b/id/%.0f-L.jpg", coverID)
-					coverURL = &url
-				}
+			if fs := book.GetString("first_sentence"); fs != "" {
+				firstSentence = &fs
 			}
-			if authorList, ok := workData["authors"].([]any); ok {
-				for _, a := range authorList {
-					if aMap, ok := a.(map[string]any); ok {
-						if authorRef, ok := aMap["author"].(map[string]any); ok {
-							if key, ok := authorRef["key"].(string); ok {
-								aData, err := ol.get(key + ".json")
-								if err == nil {
-									if name, ok := aData["name"].(string); ok {
-										authorKey := strings.TrimPrefix(key, "/authors/")
-										authors = append(authors, map[string]any{
-											"name": name,
-											"key":  authorKey,
-										})
-									}
-								}
-							}
-						}
-					}
-				}
-			}
-			// Extract subjects (up to 10)
-			if subjectList, ok := workData["subjects"].([]any); ok {
-				for _, s := range subjectList {
-					if str, ok := s.(string); ok && str != "" {
-						subjects = append(subjects, str)
-						if len(subjects) >= 10 {
-							break
-						}
-					}
-				}
-			}
-		}
 
-		// Fallback to local data
-		if title == "" && len(localBooks) > 0 {
-			title = localBooks[0].GetString("title")
-			if cv := localBooks[0].GetString("cover_url"); cv != "" {
+			var coverIDs []int
+			_ = book.UnmarshalJSONField("cover_ids", &coverIDs)
+			if len(coverIDs) > 0 {
+				url := fmt.Sprintf("https://covers.openlibrary.org/b/id/%d-L.jpg", coverIDs[0])
+				coverURL = &url
+			} else if cv := book.GetString("cover_url"); cv != "" {
 				coverURL = &cv
 			}
-			if a := localBooks[0].GetString("authors"); a != "" {
-				for _, name := range splitAuthors(a) {
-					authors = append(authors, map[string]any{
-						"name": name,
-						"key":  nil,
-					})
-				}
-			}
-		}
 
-		// Fetch edition count from OL
-		var editionCount int
-		editionsData, edErr := ol.get(fmt.Sprintf("/works/%s/editions.json?limit=0", workID))
-		if edErr == nil {
-			if size, ok := editionsData["size"].(float64); ok {
-				editionCount = int(size)
-			}
-		}
-		// Fallback subjects from local book record
-		if len(subjects) == 0 && len(localBooks) > 0 {
-			if s := localBooks[0].GetString("subjects"); s != "" {
+			authors = bookAuthorsFor(app, book.Id)
+
+			if s := book.GetString("subjects"); s != "" {
 				for _, part := range strings.Split(s, ",") {
 					part = strings.TrimSpace(part)
 					if part != "" {
@@ -597,16 +517,26 @@ func GetBookDetail(app core.App) func(e *core.RequestEvent) error {
 					}
 				}
 			}
-		}
 
-		// Populate page_count and publisher from local data (OL work data doesn't include these)
-		if len(localBooks) > 0 {
-			if pc := localBooks[0].GetInt("page_count"); pc > 0 {
+			if y := book.GetInt("publication_year"); y > 0 {
+				firstPubYear = &y
+			}
+			if pc := book.GetInt("page_count"); pc > 0 {
 				pageCount = &pc
 			}
-			if pub := localBooks[0].GetString("publisher"); pub != "" {
+			if pub := book.GetString("publisher"); pub != "" {
 				publisher = &pub
 			}
+			editionCount = book.GetInt("edition_count")
+			isbns = bookISBNList(app, book)
+			_ = book.UnmarshalJSONField("links", &links)
+			_ = book.UnmarshalJSONField("excerpts", &excerpts)
+		}
+		if links == nil {
+			links = []CatalogLink{}
+		}
+		if excerpts == nil {
+			excerpts = []CatalogExcerpt{}
 		}
 
 		// Get local stats
@@ -632,17 +562,6 @@ func GetBookDetail(app core.App) func(e *core.RequestEvent) error {
 			subjects = []string{}
 		}
 
-		// Back-fill subjects on the local book record if empty
-		if len(localBooks) > 0 && len(subjects) > 0 && localBooks[0].GetString("subjects") == "" {
-			localBooks[0].Set("subjects", strings.Join(subjects, ", "))
-			_ = app.Save(localBooks[0])
-		}
-
-		// Auto-populate series data from Open Library if not already present
-		if len(localBooks) > 0 {
-			populateSeriesFromOL(app, ol, localBooks[0], workID, subjects)
-		}
-
 		// Get series memberships
 		type seriesMembership struct {
 			SeriesID string `db:"series_id" json:"series_id"`
@@ -668,8 +587,12 @@ func GetBookDetail(app core.App) func(e *core.RequestEvent) error {
 		return e.JSON(http.StatusOK, map[string]any{
 			"key":                     workID,
 			"title":                   title,
+			"subtitle":                subtitle,
 			"authors":                 authors,
 			"description":             description,
+			"first_sentence":          firstSentence,
+			"excerpts":                excerpts,
+			"links":                   links,
 			"cover_url":               coverURL,
 			"average_rating":          avgRating,
 			"rating_count":            ratingCount,
@@ -679,6 +602,7 @@ func GetBookDetail(app core.App) func(e *core.RequestEvent) error {
 			"page_count":              pageCount,
 			"first_publish_year":      firstPubYear,
 			"edition_count":           editionCount,
+			"isbns":                   isbns,
 			"subjects":                subjects,
 			"series":                  seriesOut,
 		})
@@ -689,8 +613,7 @@ func GetBookDetail(app core.App) func(e *core.RequestEvent) error {
 func GetBookEditions(app core.App) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
 		workID := e.Request.PathValue("workId")
-		ol := newOLClient()
-		data, err := ol.get(fmt.Sprintf("/works/%s/editions.json?limit=20", workID))
+		data, err := newCatalog().editions(workID, 20, 0)
 		if err != nil {
 			return e.JSON(http.StatusOK, map[string]any{"entries": []any{}})
 		}
@@ -698,7 +621,7 @@ func GetBookEditions(app core.App) func(e *core.RequestEvent) error {
 	}
 }
 
-// GetBookStats handles GET /books/{workId}/stats
+// GetBookStats handles GET /books/{workId}/stats?by_edition=true
 func GetBookStats(app core.App) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
 		workID := e.Request.PathValue("workId")
@@ -707,32 +630,74 @@ func GetBookStats(app core.App) func(e *core.RequestEvent) error {
 			"open_library_id = {:id}", "", 1, 0,
 			map[string]any{"id": workID},
 		)
-		if len(books) == 0 {
-			return e.JSON(http.StatusOK, map[string]any{
-				"reads_count": 0, "want_to_read_count": 0,
-				"rating_sum": 0, "rating_count": 0, "review_count": 0,
-			})
+		var s *core.Record
+		if len(books) > 0 {
+			stats, err := app.FindRecordsByFilter("book_stats",
+				"book = {:book}", "", 1, 0,
+				map[string]any{"book": books[0].Id},
+			)
+			if err == nil && len(stats) > 0 {
+				s = stats[0]
+			}
+		}
+		if s == nil {
+			// No row yet: every count is zero and the score is the prior.
+			c, _ := app.FindCollectionByNameOrId("book_stats")
+			s = core.NewRecord(c)
+			mean, _ := bookstats.Prior()
+			s.Set("weighted_score", mean)
 		}
 
-		stats, err := app.FindRecordsByFilter("book_stats",
-			"book = {:book}", "", 1, 0,
-			map[string]any{"book": books[0].Id},
-		)
-		if err != nil || len(stats) == 0 {
-			return e.JSON(http.StatusOK, map[string]any{
-				"reads_count": 0, "want_to_read_count": 0,
-				"rating_sum": 0, "rating_count": 0, "review_count": 0,
-			})
+		var histogram bookstats.Histogram
+		_ = histogram.Scan(s.GetString("rating_histogram"))
+
+		ratingCount := s.GetInt("rating_count")
+		var avgRating *float64
+		if ratingCount > 0 {
+			avg := s.GetFloat("rating_sum") / float64(ratingCount)
+			avgRating = &avg
+		}
+		reads, dnf := s.GetInt("reads_count"), s.GetInt("dnf_count")
+		var dnfRate *float64
+		if reads+dnf > 0 {
+			rate := float64(dnf) / float64(reads+dnf)
+			dnfRate = &rate
+		}
+		finishCount := s.GetInt("finish_count")
+		var medianDays *float64
+		if finishCount > 0 {
+			days := s.GetFloat("median_days_to_finish")
+			medianDays = &days
+		}
+
+		result := map[string]any{
+			"reads_count":             reads,
+			"want_to_read_count":      s.GetInt("want_to_read_count"),
+			"currently_reading_count": s.GetInt("currently_reading_count"),
+			"dnf_count":               dnf,
+			"rating_sum":              s.GetFloat("rating_sum"),
+			"rating_count":            ratingCount,
+			"review_count":            s.GetInt("review_count"),
+			"average_rating":          avgRating,
+			"weighted_rating":         s.GetFloat("weighted_score"),
+			"rating_histogram":        histogram.Full(),
+			"dnf_rate":                dnfRate,
+			"finish_count":            finishCount,
+			"median_days_to_finish":   medianDays,
+		}
+
+		if e.Request.URL.Query().Get("by_edition") == "true" {
+			editions := []bookstats.EditionStats{}
+			if len(books) > 0 {
+				var err error
+				if editions, err = bookstats.Editions(app, books[0].Id); err != nil {
+					return e.JSON(http.StatusInternalServerError, map[string]any{"error": "failed to load edition stats"})
+				}
+			}
+			result["editions"] = editions
 		}
 
-		s := stats[0]
-		return e.JSON(http.StatusOK, map[string]any{
-			"reads_count":        s.GetInt("reads_count"),
-			"want_to_read_count": s.GetInt("want_to_read_count"),
-			"rating_sum":         s.GetFloat("rating_sum"),
-			"rating_count":       s.GetInt("rating_count"),
-			"review_count":       s.GetInt("review_count"),
-		})
+		return e.JSON(http.StatusOK, result)
 	}
 }
 
@@ -826,16 +791,8 @@ func GetBookReviews(app core.App) func(e *core.RequestEvent) error {
 					Followee string `db:"followee"`
 				}
 				var followRows []followRow
-				placeholders := ""
-				bindParams := map[string]any{"viewer": viewerID}
-				for i, id := range reviewerIDs {
-					key := fmt.Sprintf("uid%d", i)
-					if i > 0 {
-						placeholders += ", "
-					}
-					placeholders += "{:" + key + "}"
-					bindParams[key] = id
-				}
+				placeholders, bindParams := inPlaceholders(reviewerIDs)
+				bindParams["viewer"] = viewerID
 				followQuery := fmt.Sprintf(`SELECT followee FROM follows WHERE follower = {:viewer} AND followee IN (%s) AND status = 'active'`, placeholders)
 				_ = app.DB().NewQuery(followQuery).Bind(bindParams).All(&followRows)
 				for _, f := range followRows {
@@ -888,20 +845,27 @@ func GetPopularBooks(app core.App) func(e *core.RequestEvent) error {
 			CoverURL  *string `db:"cover_url" json:"cover_url"`
 			PubYear   *int    `db:"publication_year" json:"publish_year"`
 			AvgRating *float64 `db:"avg_rating" json:"average_rating"`
+			Weighted  float64 `db:"weighted_score" json:"weighted_rating"`
 			RatCount  int     `db:"rating_count" json:"rating_count"`
 			Reads     int     `db:"reads_count" json:"already_read_count"`
 		}
+		// ?sort=rating|average|ratings|reads|dnf_rate|finish_time; reads by
+		// default.
+		order, ok := bookstats.OrderBy(e.Request.URL.Query().Get("sort"), "bs")
+		if !ok {
+			order, _ = bookstats.OrderBy("reads", "bs")
+		}
 		var rows []row
 		err := app.DB().NewQuery(`
 			SELECT b.open_library_id, b.title, b.authors, b.cover_url, b.publication_year,
 				CASE WHEN bs.rating_count > 0
 					THEN ROUND(bs.rating_sum * 1.0 / bs.rating_count, 2)
 					ELSE NULL END AS avg_rating,
-				bs.rating_count, bs.reads_count
+				ROUND(bs.weighted_score, 2) AS weighted_score, bs.rating_count, bs.reads_count
 			FROM book_stats bs
 			JOIN books b ON bs.book = b.id
 			WHERE bs.reads_count > 0 OR bs.rating_count > 0
-			ORDER BY bs.reads_count DESC, bs.rating_count DESC
+			ORDER BY ` + order + `, bs.reads_count DESC, bs.rating_count DESC
 			LIMIT 12
 		`).All(&rows)
 		if err != nil {
@@ -917,6 +881,7 @@ func GetPopularBooks(app core.App) func(e *core.RequestEvent) error {
 				"cover_url":          r.CoverURL,
 				"publish_year":       r.PubYear,
 				"average_rating":     r.AvgRating,
+				"weighted_rating":    r.Weighted,
 				"rating_count":       r.RatCount,
 				"already_read_count": r.Reads,
 			})
@@ -929,22 +894,25 @@ func GetPopularBooks(app core.App) func(e *core.RequestEvent) error {
 }
 
 // GetPopularAuthors handles GET /authors/popular
-// Returns the most-read authors on Rosslib, aggregated from user_books + books using json_each.
+// Returns the most-read authors on Rosslib, counted over user_books through
+// book_authors.
 func GetPopularAuthors(app core.App) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
 		type row struct {
+			ID        string `db:"id"`
+			Key       string `db:"ol_key"`
 			Author    string `db:"author"`
+			PhotoURL  string `db:"photo_url"`
 			BookCount int    `db:"book_count"`
 		}
 
 		var rows []row
 		err := app.DB().NewQuery(`
-			SELECT je.value AS author, COUNT(*) AS book_count
-			FROM books b, json_each(b.authors) je
-			JOIN user_books ub ON ub.book = b.id
-			WHERE b.authors IS NOT NULL AND b.authors != '[]'
-			GROUP BY je.value
-			HAVING author != ''
+			SELECT a.id, a.ol_key, a.name AS author, a.photo_url, COUNT(*) AS book_count
+			FROM user_books ub
+			JOIN book_authors ba ON ba.book = ub.book AND ba.role = 'author'
+			JOIN authors a ON a.id = ba.author
+			GROUP BY a.id
 			ORDER BY book_count DESC
 			LIMIT 12
 		`).All(&rows)
@@ -955,7 +923,9 @@ func GetPopularAuthors(app core.App) func(e *core.RequestEvent) error {
 		results := make([]map[string]any, 0, len(rows))
 		for _, r := range rows {
 			results = append(results, map[string]any{
+				"key":        authorRouteKey(r.ID, r.Key),
 				"name":       r.Author,
+				"photo_url":  nilIfEmpty(r.PhotoURL),
 				"book_count": r.BookCount,
 			})
 		}
@@ -1023,6 +993,8 @@ func GetTrendingBooks(app core.App) func(e *core.RequestEvent) error {
 }
 
 // SearchAuthors handles GET /authors/search?q=...
+// Authors already known locally (by name or alternate name, via the
+// full-text index) come first, followed by Open Library's author search.
 func SearchAuthors(app core.App) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
 		q := e.Request.URL.Query().Get("q")
@@ -1030,53 +1002,97 @@ func SearchAuthors(app core.App) func(e *core.RequestEvent) error {
 			return e.JSON(http.StatusOK, map[string]any{"total": 0, "results": []any{}})
 		}
 
-		ol := newOLClient()
-		raw, err := ol.getRaw(fmt.Sprintf("/search/authors.json?q=%s&limit=20", q))
+		type localRow struct {
+			ID        string `db:"id"`
+			Key       string `db:"ol_key"`
+			Name      string `db:"name"`
+			BirthDate string `db:"birth_date"`
+			DeathDate string `db:"death_date"`
+			PhotoURL  string `db:"photo_url"`
+		}
+		ids, err := search.Authors(app, q, 20)
 		if err != nil {
-			return e.JSON(http.StatusOK, map[string]any{"total": 0, "results": []any{}})
+			log.Printf("[Search] authors %q: %v", q, err)
+		}
+		idsJSON, _ := json.Marshal(ids)
+		var local []localRow
+		_ = app.DB().NewQuery(`
+			SELECT a.id, a.ol_key, a.name, a.birth_date, a.death_date, a.photo_url
+			FROM json_each({:ids}) ranked
+			JOIN authors a ON a.id = ranked.value
+			ORDER BY ranked.key
+		`).Bind(map[string]any{"ids": string(idsJSON)}).All(&local)
+
+		results := make([]map[string]any, 0, len(local))
+		byKey := map[string]map[string]any{}
+		for _, a := range local {
+			r := map[string]any{
+				"key":          authorRouteKey(a.ID, a.Key),
+				"name":         a.Name,
+				"birth_date":   nilIfEmpty(a.BirthDate),
+				"death_date":   nilIfEmpty(a.DeathDate),
+				"top_work":     nil,
+				"work_count":   nil,
+				"top_subjects": nil,
+				"photo_url":    authorPhotoURL(a.Key, a.PhotoURL),
+			}
+			results = append(results, r)
+			if a.Key != "" {
+				byKey[a.Key] = r
+			}
 		}
 
+		total := len(results)
+		merged := 0
+		ol := newOLClient()
+		raw, err := ol.getRaw(fmt.Sprintf("/search/authors.json?q=%s&limit=20", url.QueryEscape(q)))
 		var data map[string]any
-		if err := json.Unmarshal(raw, &data); err != nil {
-			return e.JSON(http.StatusOK, map[string]any{"total": 0, "results": []any{}})
-		}
+		if err == nil && json.Unmarshal(raw, &data) == nil {
+			numFound := 0
+			if t, ok := data["numFound"].(float64); ok {
+				numFound = int(t)
+			}
+			if docs, ok := data["docs"].([]any); ok {
+				for _, d := range docs {
+					doc, ok := d.(map[string]any)
+					if !ok {
+						continue
+					}
+					key, _ := doc["key"].(string)
+					name, _ := doc["name"].(string)
+
+					if r, ok := byKey[key]; ok {
+						r["top_work"] = doc["top_work"]
+						r["work_count"] = doc["work_count"]
+						r["top_subjects"] = doc["top_subjects"]
+						merged++
+						continue
+					}
+					if len(results) >= 20 {
+						continue
+					}
 
-		total := 0
-		if t, ok := data["numFound"].(float64); ok {
-			total = int(t)
-		}
+					var photoURL *string
+					// OL doesn't return photo in search, construct from key
+					if key != "" {
+						url := fmt.Sprintf("https://covers.openlibrary.org/a/olid/%s-M.jpg", key)
+						photoURL = &url
+					}
 
-		var results []map[string]any
-		if docs, ok := data["docs"].([]any); ok {
-			for _, d := range docs {
-				doc, ok := d.(map[string]any)
-				if !ok {
-					continue
-				}
-				key, _ := doc["key"].(string)
-				name, _ := doc["name"].(string)
-
-				var photoURL *string
-				// OL doesn't return photo in search, construct from key
-				if key != "" {
-					url := fmt.Sprintf("https://covers.openlibrary.org/a/olid/%s-M.jpg", key)
-					photoURL = &url
+					results = append(results, map[string]any{
+						"key":          key,
+						"name":         name,
+						"birth_date":   doc["birth_date"],
+						"death_date":   doc["death_date"],
+						"top_work":     doc["top_work"],
+						"work_count":   doc["work_count"],
+						"top_subjects": doc["top_subjects"],
+						"photo_url":    photoURL,
+					})
 				}
-
-				results = append(results, map[string]any{
-					"key":          key,
-					"name":         name,
-					"birth_date":   doc["birth_date"],
-					"death_date":   doc["death_date"],
-					"top_work":     doc["top_work"],
-					"work_count":   doc["work_count"],
-					"top_subjects": doc["top_subjects"],
-					"photo_url":    photoURL,
-				})
 			}
-		}
-		if results == nil {
-			results = []map[string]any{}
+			// Local matches that OL also returned are already in numFound.
+			total = numFound + len(local) - merged
 		}
 
 		return e.JSON(http.StatusOK, map[string]any{
@@ -1107,56 +1123,44 @@ func GetAuthorDetail(app core.App) func(e *core.RequestEvent) error {
 			}
 		}
 
-		// Fetch author metadata.
-		authorData, err := ol.get(fmt.Sprintf("/authors/%s.json", authorKey))
-		if err != nil {
+		// Author metadata is served from the authors collection, fetched
+		// from the catalog on first view.
+		author := loadAuthor(app, authorKey)
+		if author == nil {
 			return e.JSON(http.StatusNotFound, map[string]any{"error": "Author not found"})
 		}
 
-		// Extract author fields.
-		name, _ := authorData["name"].(string)
-
-		var bio *string
-		switch b := authorData["bio"].(type) {
-		case string:
-			bio = &b
-		case map[string]any:
-			if v, ok := b["value"].(string); ok {
-				bio = &v
-			}
+		name := author.GetString("name")
+		var bio, birthDate, deathDate, photoURL *string
+		if v := author.GetString("bio"); v != "" {
+			bio = &v
 		}
-
-		var birthDate, deathDate *string
-		if v, ok := authorData["birth_date"].(string); ok {
+		if v := author.GetString("birth_date"); v != "" {
 			birthDate = &v
 		}
-		if v, ok := authorData["death_date"].(string); ok {
+		if v := author.GetString("death_date"); v != "" {
 			deathDate = &v
 		}
-
-		var photoURL *string
-		if photos, ok := authorData["photos"].([]any); ok && len(photos) > 0 {
-			if id, ok := photos[0].(float64); ok && int(id) > 0 {
-				u := fmt.Sprintf("https://covers.openlibrary.org/a/id/%d-L.jpg", int(id))
-				photoURL = &u
-			}
+		if v := author.GetString("photo_url"); v != "" {
+			photoURL = &v
 		}
 
+		var alternateNames []string
+		_ = author.UnmarshalJSONField("alternate_names", &alternateNames)
+
+		var authorLinks []CatalogLink
+		_ = author.UnmarshalJSONField("links", &authorLinks)
 		var links []map[string]any
-		if rawLinks, ok := authorData["links"].([]any); ok {
-			for _, rl := range rawLinks {
-				if lm, ok := rl.(map[string]any); ok {
-					title, _ := lm["title"].(string)
-					url, _ := lm["url"].(string)
-					if title != "" && url != "" {
-						links = append(links, map[string]any{"title": title, "url": url})
-					}
-				}
-			}
+		for _, l := range authorLinks {
+			links = append(links, map[string]any{"title": l.Title, "url": l.URL})
 		}
 
-		// Fetch works with pagination.
-		worksData, _ := ol.get(fmt.Sprintf("/authors/%s/works.json?limit=%d&offset=%d", authorKey, limit, offset))
+		// Fetch works with pagination. Authors without an OL key only have
+		// the books held locally.
+		var worksData map[string]any
+		if author.GetString("ol_key") != "" {
+			worksData, _ = ol.get(fmt.Sprintf("/authors/%s/works.json?limit=%d&offset=%d", authorKey, limit, offset))
+		}
 
 		workCount := 0
 		var works []map[string]any
@@ -1195,20 +1199,29 @@ func GetAuthorDetail(app core.App) func(e *core.RequestEvent) error {
 				}
 			}
 		}
+		if worksData == nil {
+			// Catalog unreachable or keyless author: fall back to the books
+			// we hold locally.
+			works, workCount = localAuthorWorks(app, author.Id, limit, offset)
+		}
 		if works == nil {
 			works = []map[string]any{}
 		}
+		if alternateNames == nil {
+			alternateNames = []string{}
+		}
 
 		return e.JSON(http.StatusOK, map[string]any{
-			"key":        authorKey,
-			"name":       name,
-			"bio":        bio,
-			"birth_date": birthDate,
-			"death_date": deathDate,
-			"photo_url":  photoURL,
-			"links":      links,
-			"work_count": workCount,
-			"works":      works,
+			"key":             authorKey,
+			"name":            name,
+			"alternate_names": alternateNames,
+			"bio":             bio,
+			"birth_date":      birthDate,
+			"death_date":      deathDate,
+			"photo_url":       photoURL,
+			"links":           links,
+			"work_count":      workCount,
+			"works":           works,
 		})
 	}
 }
@@ -1264,14 +1277,28 @@ func FollowAuthor(app core.App) func(e *core.RequestEvent) error {
 			return e.JSON(http.StatusOK, map[string]any{"message": "Already following"})
 		}
 
+		author := loadAuthor(app, authorKey)
+		if author == nil {
+			var err error
+			author, err = ensureAuthor(app, authorKey, data.AuthorName)
+			if err != nil {
+				return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to resolve author"})
+			}
+		}
+		authorName := author.GetString("name")
+		if authorName == "" {
+			authorName = data.AuthorName
+		}
+
 		coll, err := app.FindCollectionByNameOrId("author_follows")
 		if err != nil {
 			return err
 		}
 		rec := core.NewRecord(coll)
 		rec.Set("user", user.Id)
+		rec.Set("author", author.Id)
 		rec.Set("author_key", authorKey)
-		rec.Set("author_name", data.AuthorName)
+		rec.Set("author_name", authorName)
 		if err := app.Save(rec); err != nil {
 			return e.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
 		}
@@ -1318,21 +1345,10 @@ func GetFollowedAuthors(app core.App) func(e *core.RequestEvent) error {
 			SELECT COUNT(*) FROM author_follows WHERE "user" = {:user}
 		`).Bind(map[string]any{"user": user.Id}).Row(&total)
 
-		records, err := app.FindRecordsByFilter("author_follows",
-			"user = {:user}", "-created", limit, offset,
-			map[string]any{"user": user.Id},
-		)
+		results, err := followedAuthors(app, user.Id, limit, offset)
 		if err != nil {
 			return e.JSON(http.StatusOK, map[string]any{"authors": []any{}, "total": 0})
 		}
-
-		results := make([]map[string]any, len(records))
-		for i, r := range records {
-			results[i] = map[string]any{
-				"author_key":  r.GetString("author_key"),
-				"author_name": r.GetString("author_name"),
-			}
-		}
 		return e.JSON(http.StatusOK, map[string]any{"authors": results, "total": total})
 	}
 }
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// CatalogProvider is an external source of book metadata. Providers are
+// consulted in order by catalogChain; new sources register a factory with
+// registerCatalogProvider and are enabled via CATALOG_PROVIDERS.
+//
+// Books are keyed locally by Open Library work ID, so a provider that cannot
+// produce one returns matches with an empty WorkID and the chain maps them
+// back through the providers that can.
+type CatalogProvider interface {
+	Name() string
+	SearchByISBN(isbn string) (*CatalogMatch, error)
+	SearchByTitleAuthor(title, author string) (*CatalogMatch, error)
+	GetWork(workID string) (*CatalogWork, error)
+	// GetEditions returns an Open Library-shaped editions document
+	// ({"size": n, "entries": [...]}); clients consume it directly.
+	GetEditions(workID string, limit, offset int) (map[string]any, error)
+	GetAuthor(authorKey string) (*CatalogAuthor, error)
+}
+
+var (
+	errCatalogNotFound    = errors.New("not found in catalog")
+	errCatalogUnsupported = errors.New("operation not supported by catalog provider")
+)
+
+// CatalogMatch is a single search hit.
+type CatalogMatch struct {
+	WorkID   string
+	Title    string
+	Authors  []string
+	CoverURL string
+	ISBN13   string
+	Year     int
+}
+
+// CatalogWork is the provider-neutral view of a work record.
+type CatalogWork struct {
+	WorkID           string
+	Title            string
+	Subtitle         string
+	Description      string
+	FirstSentence    string
+	CoverURL         string
+	CoverURLLarge    string
+	CoverIDs         []int
+	AuthorKeys       []string
+	Subjects         []string
+	Links            []CatalogLink
+	Excerpts         []CatalogExcerpt
+	FirstPublishYear int
+}
+
+// CatalogExcerpt is a short passage quoted on a work page.
+type CatalogExcerpt struct {
+	Text    string `json:"text"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// CatalogAuthor is the provider-neutral view of an author record.
+type CatalogAuthor struct {
+	Key            string
+	Name           string
+	AlternateNames []string
+	Bio            string
+	BirthDate      string
+	DeathDate      string
+	PhotoURL       string
+	Links          []CatalogLink
+}
+
+// CatalogLink is an external link attached to an author.
+type CatalogLink struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
+
+// catalogProviderFactories holds every known provider by name.
+var catalogProviderFactories = map[string]func() CatalogProvider{}
+
+// registerCatalogProvider makes a provider available to CATALOG_PROVIDERS.
+func registerCatalogProvider(name string, factory func() CatalogProvider) {
+	catalogProviderFactories[name] = factory
+}
+
+const defaultCatalogProviders = "openlibrary,googlebooks"
+
+// catalogChain runs lookups against an ordered list of providers.
+type catalogChain struct {
+	providers []CatalogProvider
+}
+
+var (
+	globalCatalog *catalogChain
+	catalogOnce   sync.Once
+)
+
+// newCatalog returns the singleton provider chain, built from the
+// comma-separated CATALOG_PROVIDERS env var (default "openlibrary,googlebooks").
+func newCatalog() *catalogChain {
+	catalogOnce.Do(func() {
+		names := os.Getenv("CATALOG_PROVIDERS")
+		if names == "" {
+			names = defaultCatalogProviders
+		}
+		globalCatalog = &catalogChain{}
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			factory, ok := catalogProviderFactories[name]
+			if !ok {
+				log.Printf("[Catalog] unknown provider %q, skipping", name)
+				continue
+			}
+			globalCatalog.providers = append(globalCatalog.providers, factory())
+		}
+	})
+	return globalCatalog
+}
+
+// work fetches a work from the first provider that has it.
+func (c *catalogChain) work(workID string) (*CatalogWork, error) {
+	for _, p := range c.providers {
+		if w, err := p.GetWork(workID); err == nil {
+			return w, nil
+		}
+	}
+	return nil, errCatalogNotFound
+}
+
+// editions fetches a work's editions from the first provider that has them.
+func (c *catalogChain) editions(workID string, limit, offset int) (map[string]any, error) {
+	for _, p := range c.providers {
+		if data, err := p.GetEditions(workID, limit, offset); err == nil {
+			return data, nil
+		}
+	}
+	return nil, errCatalogNotFound
+}
+
+// author fetches an author from the first provider that has them.
+func (c *catalogChain) author(authorKey string) (*CatalogAuthor, error) {
+	for _, p := range c.providers {
+		if a, err := p.GetAuthor(authorKey); err == nil {
+			return a, nil
+		}
+	}
+	return nil, errCatalogNotFound
+}
+
+// lookup runs the remote match cascade for an imported or scanned book. Each
+// provider is tried in turn with: ISBN, title+author, title only (with any
+// author name stripped from the front), and title truncated at the first
+// comma. Title-only hits must pass titleMatchesResult. title and author
+// should already be cleaned of source-specific noise.
+func (c *catalogChain) lookup(isbn, title, author string) (*CatalogMatch, bool) {
+	for _, p := range c.providers {
+		if m := c.lookupWith(p, isbn, title, author); m != nil {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+func (c *catalogChain) lookupWith(p CatalogProvider, isbn, title, author string) *CatalogMatch {
+	// accept returns a usable match, or nil. When check is non-empty the hit
+	// must also resemble that title.
+	accept := func(m *CatalogMatch, err error, check string) *CatalogMatch {
+		if err != nil || m == nil {
+			return nil
+		}
+		if check != "" && !titleMatchesResult(check, m.Title) {
+			return nil
+		}
+		if m.WorkID == "" {
+			return c.resolve(p, m, isbn)
+		}
+		return m
+	}
+
+	if isbn != "" {
+		m, err := p.SearchByISBN(isbn)
+		if hit := accept(m, err, ""); hit != nil {
+			return hit
+		}
+	}
+	if title == "" {
+		return nil
+	}
+
+	m, err := p.SearchByTitleAuthor(title, author)
+	if hit := accept(m, err, ""); hit != nil {
+		return hit
+	}
+
+	// Author may be wrong or missing; also handles titles like
+	// "Arthur C. Clark Expedition to Earth".
+	stripped := stripAuthorPrefix(title, author)
+	m, err = p.SearchByTitleAuthor(stripped, "")
+	if hit := accept(m, err, stripped); hit != nil {
+		return hit
+	}
+
+	// Last resort: drop comma-subtitles.
+	if idx := strings.Index(title, ","); idx > 0 {
+		shortened := strings.TrimSpace(title[:idx])
+		if len(shortened) > 3 {
+			m, err = p.SearchByTitleAuthor(shortened, author)
+			if hit := accept(m, err, shortened); hit != nil {
+				return hit
+			}
+		}
+	}
+	return nil
+}
+
+// resolve maps a match from a provider without work IDs (e.g. Google Books)
+// back to a work ID by re-searching the other providers with the match's
+// ISBN, then its title and first author.
+func (c *catalogChain) resolve(from CatalogProvider, m *CatalogMatch, isbn string) *CatalogMatch {
+	author := ""
+	if len(m.Authors) > 0 {
+		author = m.Authors[0]
+	}
+	for _, p := range c.providers {
+		if p == from {
+			continue
+		}
+		if m.ISBN13 != "" && m.ISBN13 != isbn {
+			if hit, err := p.SearchByISBN(m.ISBN13); err == nil && hit != nil && hit.WorkID != "" {
+				return hit
+			}
+		}
+		if m.Title != "" {
+			hit, err := p.SearchByTitleAuthor(m.Title, author)
+			if err == nil && hit != nil && hit.WorkID != "" && titleMatchesResult(m.Title, hit.Title) {
+				return hit
+			}
+		}
+	}
+	return nil
+}
+
+// matchBook finds a work for an imported row: first a local book holding the
+// same ISBN, then a confident fuzzy match in the local catalog, then the
+// catalog chain. isbn13 should already be normalized.
+func matchBook(app core.App, isbn13, title, author string) (*CatalogMatch, bool) {
+	m, _ := matchBookCandidates(app, isbn13, title, author)
+	return m, m != nil
+}
+
+// matchBookCandidates is matchBook that, when nothing matches, also returns
+// the local books close enough to offer instead.
+func matchBookCandidates(app core.App, isbn13, title, author string) (*CatalogMatch, []localCandidate) {
+	if m, ok := findLocalBookByISBN(app, isbn13); ok {
+		return m, nil
+	}
+	var local []localCandidate
+	if title != "" {
+		var m *CatalogMatch
+		if m, local = matchLocalBook(app, title, author); m != nil {
+			return m, nil
+		}
+	}
+	if m, ok := newCatalog().lookup(isbn13, title, author); ok {
+		return m, nil
+	}
+	return nil, local
+}
+
+// findLocalBookByISBN returns an already-known book holding the ISBN (of any
+// of its editions) so imports can skip remote lookups.
+func findLocalBookByISBN(app core.App, isbn13 string) (*CatalogMatch, bool) {
+	if isbn13 == "" {
+		return nil, false
+	}
+	var rec *core.Record
+	if link, err := app.FindFirstRecordByData("book_isbns", "isbn13", isbn13); err == nil {
+		rec, _ = app.FindRecordById("books", link.GetString("book"))
+	}
+	if rec == nil {
+		existing, err := app.FindRecordsByFilter("books",
+			"isbn13 = {:isbn}",
+			"", 1, 0,
+			map[string]any{"isbn": isbn13},
+		)
+		if err != nil || len(existing) == 0 {
+			return nil, false
+		}
+		rec = existing[0]
+	}
+	m := &CatalogMatch{
+		WorkID:   rec.GetString("open_library_id"),
+		Title:    rec.GetString("title"),
+		CoverURL: rec.GetString("cover_url"),
+		ISBN13:   isbn13,
+	}
+	if a := rec.GetString("authors"); a != "" {
+		m.Authors = strings.Split(a, ", ")
+	}
+	return m, m.WorkID != ""
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+func init() {
+	registerCatalogProvider("googlebooks", func() CatalogProvider {
+		return newGBClient()
+	})
+}
+
+// gbClient is a Google Books API client used as a fallback catalog lookup.
+// Google Books has no Open Library work IDs, so its matches are mapped back
+// through the rest of the chain. Works, editions and authors are unsupported.
+type gbClient struct {
+	httpClient *http.Client
+	baseURL    string
+	apiKey     string
+}
+
+func newGBClient() *gbClient {
+	baseURL := os.Getenv("GOOGLE_BOOKS_BASE_URL")
+	if baseURL == "" {
+		baseURL = "https://www.googleapis.com/books/v1"
+	}
+	return &gbClient{
+		httpClient: newExternalHTTPClient(10*time.Second, gbGuard),
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     os.Getenv("GOOGLE_BOOKS_API_KEY"),
+	}
+}
+
+func (c *gbClient) Name() string { return "googlebooks" }
+
+// SearchByISBN queries Google Books for a volume matching the given ISBN.
+func (c *gbClient) SearchByISBN(isbn string) (*CatalogMatch, error) {
+	return c.search("isbn:" + isbn)
+}
+
+// SearchByTitleAuthor queries Google Books by title and optional author.
+func (c *gbClient) SearchByTitleAuthor(title, author string) (*CatalogMatch, error) {
+	q := "intitle:" + title
+	if author != "" {
+		q += "+inauthor:" + author
+	}
+	return c.search(q)
+}
+
+func (c *gbClient) GetWork(workID string) (*CatalogWork, error) {
+	return nil, errCatalogUnsupported
+}
+
+func (c *gbClient) GetEditions(workID string, limit, offset int) (map[string]any, error) {
+	return nil, errCatalogUnsupported
+}
+
+func (c *gbClient) GetAuthor(authorKey string) (*CatalogAuthor, error) {
+	return nil, errCatalogUnsupported
+}
+
+func (c *gbClient) search(query string) (*CatalogMatch, error) {
+	u := c.baseURL + "/volumes?q=" + url.QueryEscape(query) + "&maxResults=1"
+	if c.apiKey != "" {
+		u += "&key=" + url.QueryEscape(c.apiKey)
+	}
+	resp, err := c.httpClient.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Google Books API returned %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var data map[string]any
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	items, ok := data["items"].([]any)
+	if !ok || len(items) == 0 {
+		return nil, errCatalogNotFound
+	}
+	item, ok := items[0].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid item")
+	}
+	vol, ok := item["volumeInfo"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("no volumeInfo")
+	}
+	result := &CatalogMatch{}
+	if t, ok := vol["title"].(string); ok {
+		result.Title = t
+	}
+	if result.Title == "" {
+		return nil, errCatalogNotFound
+	}
+	if authors, ok := vol["authors"].([]any); ok {
+		for _, a := range authors {
+			if s, ok := a.(string); ok {
+				result.Authors = append(result.Authors, s)
+			}
+		}
+	}
+	// Extract ISBN-13 from industry identifiers
+	if ids, ok := vol["industryIdentifiers"].([]any); ok {
+		for _, id := range ids {
+			if idMap, ok := id.(map[string]any); ok {
+				if idMap["type"] == "ISBN_13" {
+					if v, ok := idMap["identifier"].(string); ok {
+						result.ISBN13 = v
+					}
+				}
+			}
+		}
+	}
+	return result, nil
+}
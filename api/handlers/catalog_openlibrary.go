@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+func init() {
+	registerCatalogProvider("openlibrary", func() CatalogProvider {
+		return &olProvider{ol: newOLClient()}
+	})
+}
+
+// olSearchFields is the field list requested for single-hit OL searches.
+const olSearchFields = "key,title,author_name,first_publish_year,cover_i"
+
+// olProvider serves the catalog from Open Library through the shared cached
+// client. Its base URL comes from OPEN_LIBRARY_BASE_URL.
+type olProvider struct {
+	ol *cachedOLClient
+}
+
+func (p *olProvider) Name() string { return "openlibrary" }
+
+// SearchByISBN tries the direct edition endpoint, then the search index
+// (which covers ISBNs across all editions).
+func (p *olProvider) SearchByISBN(isbn string) (*CatalogMatch, error) {
+	data, err := p.ol.get(fmt.Sprintf("/isbn/%s.json", url.PathEscape(isbn)))
+	if err == nil {
+		m := &CatalogMatch{ISBN13: isbn}
+		if works, ok := data["works"].([]any); ok && len(works) > 0 {
+			if w, ok := works[0].(map[string]any); ok {
+				if key, ok := w["key"].(string); ok {
+					m.WorkID = strings.TrimPrefix(key, "/works/")
+				}
+			}
+		}
+		if t, ok := data["title"].(string); ok {
+			m.Title = t
+		}
+		if covers, ok := data["covers"].([]any); ok && len(covers) > 0 {
+			if coverID, ok := covers[0].(float64); ok {
+				m.CoverURL = fmt.Sprintf("https://covers.openlibrary.org/b/id/%.0f-M.jpg", coverID)
+			}
+		}
+		if m.WorkID != "" {
+			return m, nil
+		}
+	}
+
+	return p.search("isbn=" + url.QueryEscape(isbn))
+}
+
+func (p *olProvider) SearchByTitleAuthor(title, author string) (*CatalogMatch, error) {
+	q := "title=" + url.QueryEscape(title)
+	if author != "" {
+		q += "&author=" + url.QueryEscape(author)
+	}
+	return p.search(q)
+}
+
+func (p *olProvider) search(q string) (*CatalogMatch, error) {
+	data, err := p.ol.get(fmt.Sprintf("/search.json?%s&fields=%s&limit=1", q, olSearchFields))
+	if err != nil {
+		return nil, err
+	}
+	olID, title, coverURL, authors, found := extractOLSearchResult(data)
+	if !found {
+		return nil, errCatalogNotFound
+	}
+	m := &CatalogMatch{WorkID: olID, Title: title, CoverURL: coverURL, Authors: authors}
+	if docs, ok := data["docs"].([]any); ok && len(docs) > 0 {
+		if doc, ok := docs[0].(map[string]any); ok {
+			if y, ok := doc["first_publish_year"].(float64); ok {
+				m.Year = int(y)
+			}
+		}
+	}
+	return m, nil
+}
+
+func (p *olProvider) GetWork(workID string) (*CatalogWork, error) {
+	data, err := p.ol.get(fmt.Sprintf("/works/%s.json", workID))
+	if err != nil {
+		return nil, err
+	}
+
+	w := &CatalogWork{WorkID: workID}
+	if t, ok := data["title"].(string); ok {
+		w.Title = t
+	}
+	if t, ok := data["subtitle"].(string); ok {
+		w.Subtitle = t
+	}
+	w.Description = olText(data["description"])
+	w.FirstSentence = olText(data["first_sentence"])
+	if covers, ok := data["covers"].([]any); ok {
+		for _, c := range covers {
+			// OL uses -1 as a placeholder for removed covers.
+			if id, ok := c.(float64); ok && id > 0 {
+				w.CoverIDs = append(w.CoverIDs, int(id))
+			}
+		}
+	}
+	if len(w.CoverIDs) > 0 {
+		w.CoverURL = fmt.Sprintf("https://covers.openlibrary.org/b/id/%d-M.jpg", w.CoverIDs[0])
+		w.CoverURLLarge = fmt.Sprintf("https://covers.openlibrary.org/b/id/%d-L.jpg", w.CoverIDs[0])
+	}
+	if rawLinks, ok := data["links"].([]any); ok {
+		for _, rl := range rawLinks {
+			if lm, ok := rl.(map[string]any); ok {
+				title, _ := lm["title"].(string)
+				u, _ := lm["url"].(string)
+				if title != "" && u != "" {
+					w.Links = append(w.Links, CatalogLink{Title: title, URL: u})
+				}
+			}
+		}
+	}
+	if rawExcerpts, ok := data["excerpts"].([]any); ok {
+		for _, re := range rawExcerpts {
+			if em, ok := re.(map[string]any); ok {
+				text := olText(em["excerpt"])
+				if text == "" {
+					continue
+				}
+				comment, _ := em["comment"].(string)
+				w.Excerpts = append(w.Excerpts, CatalogExcerpt{Text: text, Comment: comment})
+			}
+		}
+	}
+	if d, ok := data["first_publish_date"].(string); ok {
+		if m := yearRegex.FindString(d); m != "" {
+			w.FirstPublishYear, _ = strconv.Atoi(m)
+		}
+	}
+	if authorList, ok := data["authors"].([]any); ok {
+		for _, a := range authorList {
+			if aMap, ok := a.(map[string]any); ok {
+				if authorRef, ok := aMap["author"].(map[string]any); ok {
+					if key, ok := authorRef["key"].(string); ok {
+						w.AuthorKeys = append(w.AuthorKeys, strings.TrimPrefix(key, "/authors/"))
+					}
+				}
+			}
+		}
+	}
+	// Keep the first 10 subjects; OL works can carry hundreds.
+	if subjectList, ok := data["subjects"].([]any); ok {
+		for _, s := range subjectList {
+			if str, ok := s.(string); ok && str != "" {
+				w.Subjects = append(w.Subjects, str)
+				if len(w.Subjects) >= 10 {
+					break
+				}
+			}
+		}
+	}
+	return w, nil
+}
+
+func (p *olProvider) GetEditions(workID string, limit, offset int) (map[string]any, error) {
+	path := fmt.Sprintf("/works/%s/editions.json?limit=%d", workID, limit)
+	if offset > 0 {
+		path += fmt.Sprintf("&offset=%d", offset)
+	}
+	return p.ol.get(path)
+}
+
+func (p *olProvider) GetAuthor(authorKey string) (*CatalogAuthor, error) {
+	data, err := p.ol.get(fmt.Sprintf("/authors/%s.json", authorKey))
+	if err != nil {
+		return nil, err
+	}
+
+	a := &CatalogAuthor{Key: authorKey}
+	a.Name, _ = data["name"].(string)
+	if alts, ok := data["alternate_names"].([]any); ok {
+		for _, alt := range alts {
+			if s, ok := alt.(string); ok && s != "" && s != a.Name {
+				a.AlternateNames = append(a.AlternateNames, s)
+			}
+		}
+	}
+	a.Bio = olText(data["bio"])
+	a.BirthDate, _ = data["birth_date"].(string)
+	a.DeathDate, _ = data["death_date"].(string)
+	if photos, ok := data["photos"].([]any); ok && len(photos) > 0 {
+		if id, ok := photos[0].(float64); ok && int(id) > 0 {
+			a.PhotoURL = fmt.Sprintf("https://covers.openlibrary.org/a/id/%d-L.jpg", int(id))
+		}
+	}
+	if rawLinks, ok := data["links"].([]any); ok {
+		for _, rl := range rawLinks {
+			if lm, ok := rl.(map[string]any); ok {
+				title, _ := lm["title"].(string)
+				u, _ := lm["url"].(string)
+				if title != "" && u != "" {
+					a.Links = append(a.Links, CatalogLink{Title: title, URL: u})
+				}
+			}
+		}
+	}
+	return a, nil
+}
+
+// yearRegex pulls a four-digit year out of free-form OL dates ("June 1965").
+var yearRegex = regexp.MustCompile(`\b\d{4}\b`)
+
+// olText reads an OL text value, which is either a plain string or a typed
+// object like {"type": "/type/text", "value": "..."}.
+func olText(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case map[string]any:
+		s, _ := t["value"].(string)
+		return s
+	}
+	return ""
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Shelves, labels and libraries can be downloaded as citations with
+// ?format=bibtex, ris or csl-json, for reference managers. Each handler
+// checks the viewer may see the list, then passes its books here.
+
+// citationFormat is a format lists can be exported as.
+type citationFormat struct {
+	contentType string
+	ext         string
+	write       func(sb *strings.Builder, books []citationBook)
+}
+
+var citationFormats = map[string]citationFormat{
+	"bibtex":   {"application/x-bibtex; charset=utf-8", "bib", writeBibTeX},
+	"ris":      {"application/x-research-info-systems; charset=utf-8", "ris", writeRIS},
+	"csl-json": {"application/vnd.citationstyles.csl+json", "json", writeCSLJSON},
+}
+
+// citationBook is a book with what a citation needs. Edition fields come
+// from the edition the list's owner selected, if any. Authors are the
+// book's "author" credits in book_authors, in order.
+type citationBook struct {
+	BookID          string   `db:"book_id"`
+	OLID            string   `db:"open_library_id"`
+	Title           string   `db:"title"`
+	Subtitle        string   `db:"subtitle"`
+	Authors         []string `db:"-"`
+	ISBN13          string   `db:"isbn13"`
+	Publisher       string   `db:"publisher"`
+	PublicationYear int      `db:"publication_year"`
+	PageCount       int      `db:"page_count"`
+	EditionKey      string   `db:"edition_key"`
+	Series          string   `db:"series"`
+	SeriesPosition  int      `db:"series_position"`
+}
+
+// url links to the edition on Open Library, or else the work.
+func (b citationBook) url() string {
+	if b.EditionKey != "" {
+		return "https://openlibrary.org/books/" + b.EditionKey
+	}
+	if b.OLID != "" {
+		return "https://openlibrary.org/works/" + b.OLID
+	}
+	return ""
+}
+
+func (b citationBook) fullTitle() string {
+	if b.Subtitle != "" {
+		return b.Title + ": " + b.Subtitle
+	}
+	return b.Title
+}
+
+// writeCitations responds with bookIDs, in order, as a citation file named
+// after name.
+func writeCitations(app core.App, e *core.RequestEvent, format, name, ownerID string, bookIDs []string) error {
+	f, ok := citationFormats[format]
+	if !ok {
+		return e.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid format"})
+	}
+
+	books := []citationBook{}
+	if len(bookIDs) > 0 {
+		placeholders, params := inPlaceholders(bookIDs)
+		params["owner"] = ownerID
+		var found []citationBook
+		err := app.DB().NewQuery(`
+			SELECT b.id as book_id, b.open_library_id, b.title, b.subtitle,
+				   b.isbn13, b.publisher, b.publication_year, b.page_count,
+				   COALESCE(ub.selected_edition_key, '') as edition_key,
+				   COALESCE(s.name, '') as series,
+				   COALESCE(bs.position, 0) as series_position
+			FROM books b
+			LEFT JOIN user_books ub ON ub.book = b.id AND ub.user = {:owner}
+			LEFT JOIN book_series bs ON bs.id = (SELECT id FROM book_series WHERE book = b.id LIMIT 1)
+			LEFT JOIN series s ON s.id = bs.series
+			WHERE b.id IN (` + placeholders + `)
+		`).Bind(params).All(&found)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to export"})
+		}
+
+		type authorRow struct {
+			BookID string `db:"book"`
+			Name   string `db:"name"`
+		}
+		var authors []authorRow
+		err = app.DB().NewQuery(`
+			SELECT ba.book, a.name
+			FROM book_authors ba
+			JOIN authors a ON a.id = ba.author
+			WHERE ba.role = 'author' AND ba.book IN (` + placeholders + `)
+			ORDER BY ba.position
+		`).Bind(params).All(&authors)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to export"})
+		}
+		bookAuthors := make(map[string][]string, len(found))
+		for _, a := range authors {
+			bookAuthors[a.BookID] = append(bookAuthors[a.BookID], a.Name)
+		}
+
+		byID := make(map[string]citationBook, len(found))
+		for _, b := range found {
+			b.Authors = bookAuthors[b.BookID]
+			byID[b.BookID] = b
+		}
+		for _, id := range bookIDs {
+			if b, ok := byID[id]; ok {
+				books = append(books, b)
+			}
+		}
+	}
+
+	var sb strings.Builder
+	f.write(&sb, books)
+
+	e.Response.Header().Set("Content-Type", f.contentType)
+	e.Response.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, f.ext))
+	e.Response.WriteHeader(http.StatusOK)
+	_, _ = e.Response.Write([]byte(sb.String()))
+	return nil
+}
+
+// splitAuthorName splits "Ursula K. Le Guin" into "Ursula K. Le" and
+// "Guin". Names are stored as written, so the last word is the best guess
+// at a family name.
+func splitAuthorName(name string) (given, family string) {
+	name = strings.TrimSpace(name)
+	i := strings.LastIndex(name, " ")
+	if i < 0 {
+		return "", name
+	}
+	return name[:i], name[i+1:]
+}
+
+var bibtexKeyStrip = regexp.MustCompile(`[^a-z0-9]+`)
+
+// writeBibTeX writes @book entries keyed author-year-word, e.g.
+// herbert1965dune.
+func writeBibTeX(sb *strings.Builder, books []citationBook) {
+	used := map[string]int{}
+	for i, b := range books {
+		key := ""
+		if len(b.Authors) > 0 {
+			_, family := splitAuthorName(b.Authors[0])
+			key = family
+		}
+		if b.PublicationYear > 0 {
+			key += strconv.Itoa(b.PublicationYear)
+		}
+		if words := strings.Fields(b.Title); len(words) > 0 {
+			key += words[0]
+		}
+		key = bibtexKeyStrip.ReplaceAllString(strings.ToLower(key), "")
+		if key == "" {
+			key = "book"
+		}
+		// Repeated keys get a letter: herbert1965dune, herbert1965duneb.
+		if n := used[key]; n > 0 {
+			used[key]++
+			key += string(rune('a' + n))
+		} else {
+			used[key] = 1
+		}
+
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(sb, "@book{%s,\n", key)
+		field := func(name, value string) {
+			if value != "" {
+				fmt.Fprintf(sb, "  %s = {%s},\n", name, bibtexEscape(value))
+			}
+		}
+		field("title", b.fullTitle())
+		field("author", strings.Join(b.Authors, " and "))
+		if b.PublicationYear > 0 {
+			field("year", strconv.Itoa(b.PublicationYear))
+		}
+		field("publisher", b.Publisher)
+		field("isbn", b.ISBN13)
+		if b.PageCount > 0 {
+			field("pagetotal", strconv.Itoa(b.PageCount))
+		}
+		field("series", b.Series)
+		if b.Series != "" && b.SeriesPosition > 0 {
+			field("number", strconv.Itoa(b.SeriesPosition))
+		}
+		field("url", b.url())
+		sb.WriteString("}\n")
+	}
+}
+
+var bibtexEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`, `}`, `\}`,
+	`&`, `\&`, `%`, `\%`, `$`, `\$`, `#`, `\#`, `_`, `\_`,
+	`~`, `\textasciitilde{}`, `^`, `\textasciicircum{}`,
+)
+
+func bibtexEscape(s string) string {
+	return bibtexEscaper.Replace(s)
+}
+
+// writeRIS writes one BOOK record per book.
+func writeRIS(sb *strings.Builder, books []citationBook) {
+	for _, b := range books {
+		tag := func(name, value string) {
+			if value = strings.Join(strings.Fields(value), " "); value != "" {
+				fmt.Fprintf(sb, "%s  - %s\r\n", name, value)
+			}
+		}
+		tag("TY", "BOOK")
+		tag("TI", b.fullTitle())
+		for _, a := range b.Authors {
+			tag("AU", authorLastFirst(a))
+		}
+		if b.PublicationYear > 0 {
+			tag("PY", strconv.Itoa(b.PublicationYear))
+		}
+		tag("PB", b.Publisher)
+		tag("SN", b.ISBN13)
+		tag("T3", b.Series)
+		if b.Series != "" && b.SeriesPosition > 0 {
+			tag("VL", strconv.Itoa(b.SeriesPosition))
+		}
+		tag("UR", b.url())
+		sb.WriteString("ER  - \r\n")
+	}
+}
+
+// writeCSLJSON writes a CSL-JSON array, as Zotero and citeproc read.
+func writeCSLJSON(sb *strings.Builder, books []citationBook) {
+	type name struct {
+		Family string `json:"family"`
+		Given  string `json:"given,omitempty"`
+	}
+	items := make([]map[string]any, 0, len(books))
+	for _, b := range books {
+		item := map[string]any{
+			"id":    b.BookID,
+			"type":  "book",
+			"title": b.fullTitle(),
+		}
+		var authors []name
+		for _, a := range b.Authors {
+			given, family := splitAuthorName(a)
+			authors = append(authors, name{family, given})
+		}
+		if len(authors) > 0 {
+			item["author"] = authors
+		}
+		if b.PublicationYear > 0 {
+			item["issued"] = map[string]any{"date-parts": [][]int{{b.PublicationYear}}}
+		}
+		if b.Publisher != "" {
+			item["publisher"] = b.Publisher
+		}
+		if b.ISBN13 != "" {
+			item["ISBN"] = b.ISBN13
+		}
+		if b.PageCount > 0 {
+			item["number-of-pages"] = b.PageCount
+		}
+		if b.Series != "" {
+			item["collection-title"] = b.Series
+			if b.SeriesPosition > 0 {
+				item["collection-number"] = b.SeriesPosition
+			}
+		}
+		if u := b.url(); u != "" {
+			item["URL"] = u
+		}
+		items = append(items, item)
+	}
+	data, _ := json.MarshalIndent(items, "", "  ")
+	sb.Write(data)
+	sb.WriteString("\n")
+}
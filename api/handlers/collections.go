@@ -26,7 +26,7 @@ func GetMyShelves(app core.App) func(e *core.RequestEvent) error {
 		}
 
 		// Batch-load item counts for all shelves in a single query
-		shelfIDs := make([]any, len(shelves))
+		shelfIDs := make([]string, len(shelves))
 		for i, s := range shelves {
 			shelfIDs[i] = s.Id
 		}
@@ -240,7 +240,7 @@ func GetUserShelves(app core.App) func(e *core.RequestEvent) error {
 		}
 
 		// Batch-load item counts for all shelves in a single query
-		shelfIDs := make([]any, len(shelves))
+		shelfIDs := make([]string, len(shelves))
 		for i, s := range shelves {
 			shelfIDs[i] = s.Id
 		}
@@ -361,6 +361,10 @@ func GetShelfDetail(app core.App) func(e *core.RequestEvent) error {
 			return e.JSON(http.StatusNotFound, map[string]any{"error": "Shelf not found"})
 		}
 		shelf := shelves[0]
+		// Only the owner sees shelves they haven't made public.
+		if !shelf.GetBool("is_public") && viewerID != targetUser.Id {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "Shelf not found"})
+		}
 
 		sortParam := e.Request.URL.Query().Get("sort")
 		var orderClause string
@@ -399,6 +403,14 @@ func GetShelfDetail(app core.App) func(e *core.RequestEvent) error {
 			books = []bookRow{}
 		}
 
+		if format := e.Request.URL.Query().Get("format"); format != "" {
+			ids := make([]string, len(books))
+			for i, b := range books {
+				ids[i] = b.BookID
+			}
+			return writeCitations(app, e, format, username+"-"+shelfSlug, targetUser.Id, ids)
+		}
+
 		detail := map[string]any{
 			"id":              shelf.Id,
 			"name":            shelf.GetString("name"),
@@ -639,6 +651,8 @@ func RemoveBookFromShelf(app core.App) func(e *core.RequestEvent) error {
 }
 
 // ExportCSV handles GET /me/export/csv
+// format=goodreads or format=storygraph writes the columns of that
+// service's export instead of rosslib's own.
 func ExportCSV(app core.App) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
 		user := e.Auth
@@ -646,16 +660,41 @@ func ExportCSV(app core.App) func(e *core.RequestEvent) error {
 			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
 		}
 
+		switch format := e.Request.URL.Query().Get("format"); format {
+		case "", "csv":
+		case "goodreads", "storygraph":
+			entries, err := loadExportEntries(app, user.Id)
+			if err != nil {
+				return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to export library"})
+			}
+			var sb strings.Builder
+			if format == "goodreads" {
+				writeGoodreadsCSV(&sb, entries)
+			} else {
+				writeStoryGraphCSV(&sb, entries)
+			}
+			e.Response.Header().Set("Content-Type", "text/csv")
+			e.Response.Header().Set("Content-Disposition", `attachment; filename="rosslib-`+format+`.csv"`)
+			e.Response.WriteHeader(http.StatusOK)
+			_, _ = e.Response.Write([]byte(sb.String()))
+			return nil
+		default:
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid format"})
+		}
+
 		query := `
 			SELECT b.open_library_id, b.title, b.authors, b.isbn13,
 				   ub.rating, ub.review_text, ub.date_started, ub.date_read,
 				   ub.date_added as date_added,
-				   COALESCE(tv.slug, '') as status
+				   COALESCE((
+					   SELECT tv.slug FROM book_tag_values btv
+					   JOIN tag_keys tk ON btv.tag_key = tk.id AND tk.slug = 'status'
+					   JOIN tag_values tv ON btv.tag_value = tv.id
+					   WHERE btv.user = ub.user AND btv.book = ub.book
+					   LIMIT 1
+				   ), '') as status
 			FROM user_books ub
 			JOIN books b ON ub.book = b.id
-			LEFT JOIN book_tag_values btv ON btv.user = ub.user AND btv.book = ub.book
-			LEFT JOIN tag_keys tk ON btv.tag_key = tk.id AND tk.slug = 'status'
-			LEFT JOIN tag_values tv ON btv.tag_value = tv.id AND tk.id IS NOT NULL
 			WHERE ub.user = {:user}
 			ORDER BY ub.date_added DESC
 		`
@@ -0,0 +1,554 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// An account archive is a zip holding archive.json, everything the user
+// owns as versioned JSON, and their avatar and banner under files/. Books
+// are referred to by Open Library ID and other users by username, so an
+// archive can be restored on another server; records that others refer to
+// keep their id, which is only meaningful within the archive. The format is
+// described in docs/documentation/archive.md.
+//
+// Archives are built by export jobs in the background and kept until the
+// next one replaces them.
+//
+//	building → done
+//	        ↘
+//	          failed
+
+// archiveFormat and archiveVersion identify archive.json. The version is
+// bumped when a change would break readers of older archives; new sections
+// and fields don't bump it.
+const (
+	archiveFormat  = "rosslib-archive"
+	archiveVersion = 1
+)
+
+// exportArchiveMaxAge is how long a finished archive is served before a
+// request builds a fresh one.
+const exportArchiveMaxAge = 24 * time.Hour
+
+// archiveSection is one list in archive.json: the user's records of a
+// collection, selected by owner.
+type archiveSection struct {
+	key        string
+	collection string
+	owner      string   // filter for the user's records; binds {:user}
+	fields     []string // written as stored; empty values are left out
+	// refs are relation fields and how they're written: "book" (Open
+	// Library ID), "user" (username), "thread" or "book_link" (an object
+	// identifying it), or "local" (the id of a record in another section).
+	refs map[string]string
+	// withID keeps the record's id, for sections other sections refer to.
+	withID bool
+}
+
+// archiveSections are written in order, each after the sections it refers
+// to, so a restore can read them front to back.
+var archiveSections = []archiveSection{
+	{key: "library", collection: "user_books", owner: "user = {:user}",
+		fields: []string{"rating", "review_text", "spoiler", "date_added", "date_started", "date_read", "date_dnf",
+			"progress_pages", "progress_percent", "device_total_pages", "selected_edition_key", "selected_edition_cover_url"},
+		refs: map[string]string{"book": "book"}},
+	{key: "label_keys", collection: "tag_keys", owner: "user = {:user}",
+		fields: []string{"name", "slug", "mode"}, withID: true},
+	{key: "label_values", collection: "tag_values", owner: "tag_key.user = {:user}",
+		fields: []string{"name", "slug"},
+		refs:   map[string]string{"tag_key": "local"}, withID: true},
+	{key: "book_labels", collection: "book_tag_values", owner: "user = {:user}",
+		refs: map[string]string{"book": "book", "tag_key": "local", "tag_value": "local"}},
+	{key: "shelves", collection: "collections", owner: "user = {:user}",
+		fields: []string{"name", "slug", "description", "is_exclusive", "exclusive_group", "is_public",
+			"collection_type", "operation_type", "is_continuous"},
+		refs: map[string]string{"source_collection_a": "local", "source_collection_b": "local"}, withID: true},
+	{key: "shelf_items", collection: "collection_items", owner: "user = {:user}",
+		fields: []string{"rating", "review_text", "spoiler", "date_read"},
+		refs:   map[string]string{"collection": "local", "book": "book"}},
+	{key: "reading_sessions", collection: "reading_sessions", owner: "user = {:user}",
+		fields: []string{"date_started", "date_finished", "rating", "notes"},
+		refs:   map[string]string{"book": "book"}},
+	{key: "progress_events", collection: "progress_events", owner: "user = {:user}",
+		fields: []string{"pages", "percent", "pages_read", "percent_read", "recorded_at"},
+		refs:   map[string]string{"book": "book"}},
+	{key: "quotes", collection: "book_quotes", owner: "user = {:user}",
+		fields: []string{"text", "page_number", "note", "is_public", "location", "highlighted_at"},
+		refs:   map[string]string{"book": "book"}},
+	{key: "genre_ratings", collection: "genre_ratings", owner: "user = {:user}",
+		fields: []string{"genre", "rating"},
+		refs:   map[string]string{"book": "book"}},
+	{key: "reading_goals", collection: "reading_goals", owner: "user = {:user}",
+		fields: []string{"year", "target"}},
+	{key: "threads", collection: "threads", owner: "user = {:user} && deleted_at = ''",
+		fields: []string{"title", "body", "spoiler", "locked_at"},
+		refs:   map[string]string{"book": "book"}, withID: true},
+	{key: "thread_comments", collection: "thread_comments", owner: "user = {:user} && deleted_at = ''",
+		fields: []string{"parent", "body"},
+		refs:   map[string]string{"thread": "thread"}, withID: true},
+	{key: "review_comments", collection: "review_comments", owner: "user = {:user} && deleted_at = ''",
+		fields: []string{"body"},
+		refs:   map[string]string{"book": "book", "review_user": "user"}},
+	{key: "review_likes", collection: "review_likes", owner: "user = {:user}",
+		refs: map[string]string{"book": "book", "review_user": "user"}},
+	{key: "book_links", collection: "book_links", owner: "user = {:user} && deleted_at = ''",
+		fields: []string{"link_type", "note"},
+		refs:   map[string]string{"from_book": "book", "to_book": "book"}},
+	{key: "book_link_votes", collection: "book_link_votes", owner: "user = {:user}",
+		refs: map[string]string{"book_link": "book_link"}},
+	{key: "book_link_edits", collection: "book_link_edits", owner: "user = {:user}",
+		fields: []string{"proposed_type", "proposed_note", "status", "reviewer_comment", "reviewed_at"},
+		refs:   map[string]string{"book_link": "book_link"}},
+	{key: "following", collection: "follows", owner: "follower = {:user}",
+		fields: []string{"status"},
+		refs:   map[string]string{"followee": "user"}},
+	{key: "followers", collection: "follows", owner: "followee = {:user}",
+		fields: []string{"status"},
+		refs:   map[string]string{"follower": "user"}},
+	{key: "blocks", collection: "blocks", owner: "blocker = {:user}",
+		refs: map[string]string{"blocked": "user"}},
+	{key: "author_follows", collection: "author_follows", owner: "user = {:user}",
+		fields: []string{"author_key", "author_name"}},
+	{key: "book_follows", collection: "book_follows", owner: "user = {:user}",
+		refs: map[string]string{"book": "book"}},
+	{key: "recommendations_sent", collection: "recommendations", owner: "sender = {:user}",
+		fields: []string{"note", "status"},
+		refs:   map[string]string{"recipient": "user", "book": "book"}},
+	{key: "recommendations_received", collection: "recommendations", owner: "recipient = {:user}",
+		fields: []string{"note", "status"},
+		refs:   map[string]string{"sender": "user", "book": "book"}},
+	{key: "saved_searches", collection: "saved_searches", owner: "user = {:user}",
+		fields: []string{"name", "query", "filters", "target"}},
+	{key: "notification_preferences", collection: "notification_preferences", owner: "user = {:user}",
+		fields: []string{"new_publication", "book_new_thread", "book_new_link", "book_new_review", "review_liked",
+			"thread_mention", "book_recommendation", "review_comment", "new_follower"}},
+	{key: "pending_imports", collection: "pending_imports", owner: "user = {:user}",
+		fields: []string{"source", "title", "author", "isbn13", "exclusive_shelf", "custom_shelves", "rating",
+			"review_text", "date_read", "date_added", "status", "highlights"}},
+	{key: "feedback", collection: "feedback", owner: "user = {:user}",
+		fields: []string{"type", "title", "description", "steps_to_reproduce", "severity", "status"}},
+}
+
+// archiveProfileFields are the user record fields in "profile".
+var archiveProfileFields = []string{"username", "display_name", "name", "email", "bio", "is_private", "theme", "author_key", "created"}
+
+// archiveBookFields are written for each book in "books".
+var archiveBookFields = []string{"title", "subtitle", "authors", "isbn13", "cover_url", "publication_year", "publisher", "page_count"}
+
+// archiveWriter builds archive.json for one user, remembering the books
+// and users its records refer to.
+type archiveWriter struct {
+	app       core.App
+	userID    string
+	books     map[string]*core.Record // by record id
+	bookOrder []string
+	usernames map[string]string
+}
+
+// record writes one record of a section.
+func (w *archiveWriter) record(s archiveSection, rec *core.Record) map[string]any {
+	out := map[string]any{}
+	if s.withID {
+		out["id"] = rec.Id
+	}
+	for _, f := range s.fields {
+		if v := rec.Get(f); !archiveEmpty(v) {
+			out[f] = v
+		}
+	}
+	// Timestamps come along where the collection keeps them.
+	for _, f := range []string{"created", "updated"} {
+		if rec.Collection().Fields.GetByName(f) != nil {
+			if v := rec.Get(f); !archiveEmpty(v) {
+				out[f] = v
+			}
+		}
+	}
+	for field, kind := range s.refs {
+		id := rec.GetString(field)
+		if id == "" {
+			continue
+		}
+		var v any
+		switch kind {
+		case "book":
+			v = w.book(id)
+		case "user":
+			v = w.username(id)
+		case "thread":
+			v = w.thread(id)
+		case "book_link":
+			v = w.bookLink(id)
+		default:
+			v = id
+		}
+		if !archiveEmpty(v) {
+			out[field] = v
+		}
+	}
+	return out
+}
+
+// book returns a book's Open Library ID and adds it to "books".
+func (w *archiveWriter) book(id string) string {
+	if b, ok := w.books[id]; ok {
+		if b == nil {
+			return ""
+		}
+		return b.GetString("open_library_id")
+	}
+	b, err := w.app.FindRecordById("books", id)
+	if err != nil {
+		w.books[id] = nil
+		return ""
+	}
+	w.books[id] = b
+	w.bookOrder = append(w.bookOrder, id)
+	return b.GetString("open_library_id")
+}
+
+func (w *archiveWriter) username(id string) string {
+	if name, ok := w.usernames[id]; ok {
+		return name
+	}
+	var name string
+	if u, err := w.app.FindRecordById("users", id); err == nil {
+		name = u.GetString("username")
+	}
+	w.usernames[id] = name
+	return name
+}
+
+// thread identifies a thread, which may be someone else's, by its book,
+// author and title along with its id.
+func (w *archiveWriter) thread(id string) any {
+	t, err := w.app.FindRecordById("threads", id)
+	if err != nil {
+		return nil
+	}
+	return map[string]any{
+		"id":    t.Id,
+		"book":  w.book(t.GetString("book")),
+		"user":  w.username(t.GetString("user")),
+		"title": t.GetString("title"),
+	}
+}
+
+// bookLink identifies a community link by the books it joins and its type.
+func (w *archiveWriter) bookLink(id string) any {
+	l, err := w.app.FindRecordById("book_links", id)
+	if err != nil {
+		return nil
+	}
+	return map[string]any{
+		"from_book": w.book(l.GetString("from_book")),
+		"to_book":   w.book(l.GetString("to_book")),
+		"link_type": l.GetString("link_type"),
+	}
+}
+
+// archiveEmpty reports whether a value is left out of the archive.
+func archiveEmpty(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case types.DateTime:
+		return v.IsZero()
+	case types.JSONRaw:
+		return len(v) == 0 || string(v) == "null"
+	case []string:
+		return len(v) == 0
+	}
+	return false
+}
+
+// buildArchive writes the user's archive as a zip. progress is called after
+// each section.
+func buildArchive(app core.App, user *core.Record, progress func(done int)) ([]byte, error) {
+	w := &archiveWriter{
+		app:       app,
+		userID:    user.Id,
+		books:     map[string]*core.Record{},
+		usernames: map[string]string{},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	profile := map[string]any{}
+	for _, f := range archiveProfileFields {
+		if v := user.Get(f); !archiveEmpty(v) {
+			profile[f] = v
+		}
+	}
+	for _, field := range []string{"avatar", "banner"} {
+		name, err := writeArchiveFile(app, zw, user, field)
+		if err != nil {
+			return nil, fmt.Errorf("copy %s: %w", field, err)
+		}
+		if name != "" {
+			profile[field] = name
+		}
+	}
+
+	archive := map[string]any{
+		"format":      archiveFormat,
+		"version":     archiveVersion,
+		"exported_at": types.NowDateTime(),
+		"profile":     profile,
+	}
+	for i, s := range archiveSections {
+		records, err := app.FindRecordsByFilter(s.collection, s.owner, "", 0, 0,
+			map[string]any{"user": user.Id})
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", s.key, err)
+		}
+		items := make([]map[string]any, 0, len(records))
+		for _, rec := range records {
+			items = append(items, w.record(s, rec))
+		}
+		archive[s.key] = items
+		progress(i + 1)
+	}
+
+	books := make([]map[string]any, 0, len(w.bookOrder))
+	for _, id := range w.bookOrder {
+		b := w.books[id]
+		item := map[string]any{"open_library_id": b.GetString("open_library_id")}
+		for _, f := range archiveBookFields {
+			if v := b.Get(f); !archiveEmpty(v) && v != 0.0 {
+				item[f] = v
+			}
+		}
+		books = append(books, item)
+	}
+	archive["books"] = books
+
+	data, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	f, err := zw.Create("archive.json")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeArchiveFile copies one of the user's uploaded files into the zip as
+// files/<field><ext> and returns that name, or "" when there's no file.
+func writeArchiveFile(app core.App, zw *zip.Writer, user *core.Record, field string) (string, error) {
+	stored := user.GetString(field)
+	if stored == "" {
+		return "", nil
+	}
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return "", err
+	}
+	defer fsys.Close()
+
+	r, err := fsys.GetReader(user.BaseFilesPath() + "/" + stored)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	name := "files/" + field + path.Ext(stored)
+	f, err := zw.Create(name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// ResumeExportJobs queues archives that were being built when the server
+// last stopped, for exports started before the job queue (queued ones resume
+// on their own); they start over. Called once at startup.
+func ResumeExportJobs(app core.App) {
+	jobs, err := app.FindRecordsByFilter("export_jobs", "status = 'building'", "", 0, 0)
+	if err != nil {
+		log.Printf("[Export] find unfinished jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		startExportJob(app, job.Id)
+	}
+	if len(jobs) > 0 {
+		log.Printf("[Export] resumed %d jobs", len(jobs))
+	}
+}
+
+func runExportJob(app core.App, id string) {
+	job, err := app.FindRecordById("export_jobs", id)
+	if err != nil {
+		log.Printf("[Export] load job %s: %v", id, err)
+		return
+	}
+	if err := buildExportJob(app, job); err != nil {
+		log.Printf("[Export] job %s: %v", id, err)
+		job.Set("status", "failed")
+		job.Set("error", err.Error())
+		if err := app.Save(job); err != nil {
+			log.Printf("[Export] save failed job %s: %v", id, err)
+		}
+	}
+}
+
+// buildExportJob builds the archive, attaches it to the job and removes the
+// user's older archives.
+func buildExportJob(app core.App, job *core.Record) error {
+	user, err := app.FindRecordById("users", job.GetString("user"))
+	if err != nil {
+		return err
+	}
+
+	lastSave := time.Now()
+	data, err := buildArchive(app, user, func(done int) {
+		if time.Since(lastSave) < importJobSaveInterval {
+			return
+		}
+		job.Set("processed", done)
+		if err := app.Save(job); err != nil {
+			log.Printf("[Export] save progress %s: %v", job.Id, err)
+		}
+		lastSave = time.Now()
+	})
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("rosslib-archive-%s.zip", user.GetString("username"))
+	file, err := filesystem.NewFileFromBytes(data, name)
+	if err != nil {
+		return err
+	}
+	job.Set("archive", file)
+	job.Set("processed", len(archiveSections))
+	job.Set("status", "done")
+	if err := app.Save(job); err != nil {
+		return err
+	}
+
+	older, err := app.FindRecordsByFilter("export_jobs",
+		"user = {:user} && id != {:id} && status != 'building'", "", 0, 0,
+		map[string]any{"user": user.Id, "id": job.Id},
+	)
+	if err == nil {
+		for _, old := range older {
+			if err := app.Delete(old); err != nil {
+				log.Printf("[Export] delete old job %s: %v", old.Id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// exportJobJSON is the API view of a job.
+func exportJobJSON(job *core.Record) map[string]any {
+	return map[string]any{
+		"id":        job.Id,
+		"status":    job.GetString("status"),
+		"total":     job.GetInt("total"),
+		"processed": job.GetInt("processed"),
+		"error":     nilIfEmpty(job.GetString("error")),
+		"created":   job.GetString("created"),
+		"updated":   job.GetString("updated"),
+	}
+}
+
+// ExportArchive handles GET /me/export/archive
+// Downloads the user's latest archive. While one is being built, or when
+// there is none, none recent enough, or ?refresh=true, it returns 202 with
+// the export job instead; clients poll until the download arrives.
+func ExportArchive(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		user := e.Auth
+		if user == nil {
+			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
+		}
+
+		latest, _ := app.FindRecordsByFilter("export_jobs",
+			"user = {:user}", "-created", 1, 0,
+			map[string]any{"user": user.Id},
+		)
+		refresh := e.Request.URL.Query().Get("refresh") == "true"
+		if len(latest) > 0 {
+			job := latest[0]
+			switch job.GetString("status") {
+			case "building":
+				startExportJob(app, job.Id)
+				return e.JSON(http.StatusAccepted, exportJobJSON(job))
+			case "failed":
+				if !refresh {
+					return e.JSON(http.StatusInternalServerError, map[string]any{
+						"error": "Failed to build archive: " + job.GetString("error"),
+					})
+				}
+			case "done":
+				fresh := time.Since(job.GetDateTime("updated").Time()) < exportArchiveMaxAge
+				if fresh && !refresh {
+					return serveExportArchive(app, e, job)
+				}
+			}
+		}
+
+		coll, err := app.FindCollectionByNameOrId("export_jobs")
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to start export"})
+		}
+		job := core.NewRecord(coll)
+		job.Set("user", user.Id)
+		job.Set("status", "building")
+		job.Set("total", len(archiveSections))
+		job.Set("processed", 0)
+		if err := app.Save(job); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to start export"})
+		}
+
+		startExportJob(app, job.Id)
+
+		return e.JSON(http.StatusAccepted, exportJobJSON(job))
+	}
+}
+
+func serveExportArchive(app core.App, e *core.RequestEvent, job *core.Record) error {
+	fsys, err := app.NewFilesystem()
+	if err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to read archive"})
+	}
+	defer fsys.Close()
+
+	key := job.BaseFilesPath() + "/" + job.GetString("archive")
+	name := fmt.Sprintf("rosslib-archive-%s-%s.zip",
+		e.Auth.GetString("username"), job.GetDateTime("updated").Time().Format("2006-01-02"))
+	// The same URL serves newer archives later.
+	e.Response.Header().Set("Cache-Control", "private, no-cache")
+	if err := fsys.Serve(e.Response, e.Request, key, name); err != nil {
+		return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to read archive"})
+	}
+	return nil
+}
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/isbn"
+)
+
+// The Goodreads and StoryGraph exports write a library in the shape each
+// service's own export has, so it can be imported there, or back here
+// through the goodreads and storygraph importers.
+
+var goodreadsExportColumns = []string{
+	"Book Id", "Title", "Author", "Author l-f", "Additional Authors", "ISBN", "ISBN13",
+	"My Rating", "Average Rating", "Publisher", "Binding", "Number of Pages",
+	"Year Published", "Original Publication Year", "Date Read", "Date Added",
+	"Bookshelves", "Bookshelves with positions", "Exclusive Shelf", "My Review",
+	"Spoiler", "Private Notes", "Read Count", "Owned Copies",
+}
+
+var storyGraphExportColumns = []string{
+	"Title", "Authors", "Contributors", "ISBN/UID", "Format", "Read Status",
+	"Date Added", "Last Date Read", "Dates Read", "Read Count", "Moods", "Pace",
+	"Character- or Plot-Driven?", "Strong Character Development?",
+	"Loveable Characters?", "Diverse Characters?", "Flawed Characters?",
+	"Star Rating", "Review", "Content Warnings", "Content Warning Description",
+	"Tags", "Owned?",
+}
+
+// exportEntry is one book of the library with its labels and reading
+// sessions.
+type exportEntry struct {
+	BookID          string  `db:"book_id"`
+	Title           string  `db:"title"`
+	Authors         string  `db:"authors"`
+	ISBN13          string  `db:"isbn13"`
+	Publisher       string  `db:"publisher"`
+	PageCount       int     `db:"page_count"`
+	PublicationYear int     `db:"publication_year"`
+	RatingCount     int     `db:"rating_count"`
+	RatingSum       float64 `db:"rating_sum"`
+	Rating          float64 `db:"rating"`
+	ReviewText      string  `db:"review_text"`
+	Spoiler         bool    `db:"spoiler"`
+	DateAdded       string  `db:"date_added"`
+	DateStarted     string  `db:"date_started"`
+	DateRead        string  `db:"date_read"`
+	Status          string  `db:"status"`
+
+	labels   []exportLabel
+	sessions []exportSession
+}
+
+// exportLabel is a non-status label on a book.
+type exportLabel struct {
+	KeyName   string `db:"key_name"`
+	KeySlug   string `db:"key_slug"`
+	ValueName string `db:"value_name"`
+	ValueSlug string `db:"value_slug"`
+	Book      string `db:"book"`
+}
+
+// name is the label as a shelf or tag. Importers turn a shelf into a label
+// whose one value repeats its name, so those export as the key; other
+// labels export as their value.
+func (l exportLabel) name(slug bool) string {
+	standalone := l.KeySlug == l.ValueSlug
+	switch {
+	case slug && standalone:
+		return l.KeySlug
+	case slug:
+		return l.ValueSlug
+	case standalone:
+		return l.KeyName
+	default:
+		return l.ValueName
+	}
+}
+
+type exportSession struct {
+	Book         string `db:"book"`
+	DateStarted  string `db:"date_started"`
+	DateFinished string `db:"date_finished"`
+}
+
+// loadExportEntries reads a user's library, most recently added first.
+func loadExportEntries(app core.App, userID string) ([]*exportEntry, error) {
+	params := map[string]any{"user": userID}
+	var entries []*exportEntry
+	err := app.DB().NewQuery(`
+		SELECT b.id as book_id, b.title, b.authors, b.isbn13, b.publisher,
+			   b.page_count, b.publication_year,
+			   COALESCE(bs.rating_count, 0) as rating_count,
+			   COALESCE(bs.rating_sum, 0) as rating_sum,
+			   ub.rating, ub.review_text, ub.spoiler, ub.date_added,
+			   ub.date_started, ub.date_read,
+			   COALESCE((
+				   SELECT tv.slug FROM book_tag_values btv
+				   JOIN tag_keys tk ON btv.tag_key = tk.id AND tk.slug = 'status'
+				   JOIN tag_values tv ON btv.tag_value = tv.id
+				   WHERE btv.user = ub.user AND btv.book = ub.book
+				   LIMIT 1
+			   ), '') as status
+		FROM user_books ub
+		JOIN books b ON ub.book = b.id
+		LEFT JOIN book_stats bs ON bs.book = b.id
+		WHERE ub.user = {:user}
+		ORDER BY ub.date_added DESC
+	`).Bind(params).All(&entries)
+	if err != nil {
+		return nil, err
+	}
+	byBook := make(map[string]*exportEntry, len(entries))
+	for _, e := range entries {
+		byBook[e.BookID] = e
+	}
+
+	var labels []exportLabel
+	err = app.DB().NewQuery(`
+		SELECT btv.book, tk.name as key_name, tk.slug as key_slug,
+			   tv.name as value_name, tv.slug as value_slug
+		FROM book_tag_values btv
+		JOIN tag_keys tk ON btv.tag_key = tk.id
+		JOIN tag_values tv ON btv.tag_value = tv.id
+		WHERE btv.user = {:user} AND tk.slug != 'status'
+		ORDER BY tk.name, tv.name
+	`).Bind(params).All(&labels)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range labels {
+		if e, ok := byBook[l.Book]; ok {
+			e.labels = append(e.labels, l)
+		}
+	}
+
+	var sessions []exportSession
+	err = app.DB().NewQuery(`
+		SELECT book, date_started, date_finished
+		FROM reading_sessions
+		WHERE user = {:user} AND date_finished != ''
+		ORDER BY date_finished
+	`).Bind(params).All(&sessions)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sessions {
+		if e, ok := byBook[s.Book]; ok {
+			e.sessions = append(e.sessions, s)
+		}
+	}
+	return entries, nil
+}
+
+// lastRead is when the book was last finished.
+func (e *exportEntry) lastRead() string {
+	if e.DateRead != "" {
+		return e.DateRead
+	}
+	if n := len(e.sessions); n > 0 {
+		return e.sessions[n-1].DateFinished
+	}
+	return ""
+}
+
+// readCount counts finished sessions; a finished book without any was
+// read once.
+func (e *exportEntry) readCount() int {
+	if len(e.sessions) == 0 && (e.Status == "finished" || e.DateRead != "") {
+		return 1
+	}
+	return len(e.sessions)
+}
+
+func (e *exportEntry) labelNames(slug bool) string {
+	names := make([]string, 0, len(e.labels))
+	seen := map[string]bool{}
+	for _, l := range e.labels {
+		if n := l.name(slug); !seen[n] {
+			seen[n] = true
+			names = append(names, n)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// writeGoodreadsCSV writes entries with the columns of Goodreads' "Export
+// Library".
+func writeGoodreadsCSV(sb *strings.Builder, entries []*exportEntry) {
+	writeCSVRow(sb, goodreadsExportColumns)
+	for _, e := range entries {
+		authors := splitAuthors(e.Authors)
+		author, authorLF := "", ""
+		if len(authors) > 0 {
+			author = authors[0]
+			authorLF = authorLastFirst(author)
+		}
+		avg := ""
+		if e.RatingCount > 0 {
+			avg = fmt.Sprintf("%.2f", e.RatingSum/float64(e.RatingCount))
+		}
+		spoiler := ""
+		if e.Spoiler {
+			spoiler = "true"
+		}
+		owned := "0"
+		if e.Status == "owned" {
+			owned = "1"
+		}
+
+		writeCSVRow(sb, []string{
+			"",
+			e.Title,
+			author,
+			authorLF,
+			strings.Join(authors[min(1, len(authors)):], ", "),
+			// Goodreads wraps ISBNs as formulas so spreadsheets keep
+			// leading zeros.
+			`="` + isbn.To10(e.ISBN13) + `"`,
+			`="` + e.ISBN13 + `"`,
+			strconv.FormatFloat(e.Rating, 'f', -1, 64),
+			avg,
+			e.Publisher,
+			"",
+			exportInt(e.PageCount),
+			exportInt(e.PublicationYear),
+			exportInt(e.PublicationYear),
+			exportDate(e.lastRead()),
+			exportDate(e.DateAdded),
+			e.labelNames(true),
+			"",
+			goodreadsExclusiveShelf(e.Status),
+			e.ReviewText,
+			spoiler,
+			"",
+			strconv.Itoa(e.readCount()),
+			owned,
+		})
+	}
+}
+
+// writeStoryGraphCSV writes entries with the columns of StoryGraph's
+// export.
+func writeStoryGraphCSV(sb *strings.Builder, entries []*exportEntry) {
+	writeCSVRow(sb, storyGraphExportColumns)
+	for _, e := range entries {
+		// Each finished read is "start-finish", or just "finish".
+		var reads []string
+		for _, s := range e.sessions {
+			reads = append(reads, exportDateRange(s.DateStarted, s.DateFinished))
+		}
+		if len(reads) == 0 && e.DateRead != "" {
+			reads = append(reads, exportDateRange(e.DateStarted, e.DateRead))
+		}
+		rating := ""
+		if e.Rating > 0 {
+			rating = strconv.FormatFloat(e.Rating, 'f', -1, 64)
+		}
+		owned := "No"
+		if e.Status == "owned" {
+			owned = "Yes"
+		}
+
+		writeCSVRow(sb, []string{
+			e.Title,
+			e.Authors,
+			"",
+			e.ISBN13,
+			"",
+			storyGraphReadStatus(e.Status),
+			exportDate(e.DateAdded),
+			exportDate(e.lastRead()),
+			strings.Join(reads, ", "),
+			strconv.Itoa(e.readCount()),
+			"", "", "", "", "", "", "",
+			rating,
+			e.ReviewText,
+			"", "",
+			e.labelNames(false),
+			owned,
+		})
+	}
+}
+
+// goodreadsExclusiveShelf maps a status to the exclusive shelf
+// mapGoodreadsShelf reads back. DNF and Owned are custom exclusive shelves
+// on Goodreads.
+func goodreadsExclusiveShelf(status string) string {
+	switch status {
+	case "want-to-read":
+		return "to-read"
+	case "currently-reading":
+		return "currently-reading"
+	case "finished":
+		return "read"
+	case "dnf":
+		return "did-not-finish"
+	case "owned":
+		return "owned"
+	default:
+		return ""
+	}
+}
+
+// storyGraphReadStatus maps a status to StoryGraph's. StoryGraph has no
+// owned status; owned books are unread books with "Owned?" set.
+func storyGraphReadStatus(status string) string {
+	switch status {
+	case "want-to-read", "owned":
+		return "to-read"
+	case "currently-reading":
+		return "currently-reading"
+	case "finished":
+		return "read"
+	case "dnf":
+		return "did-not-finish"
+	default:
+		return ""
+	}
+}
+
+// authorLastFirst turns "Frank Herbert" into "Herbert, Frank", as
+// Goodreads' "Author l-f" column and RIS write names.
+func authorLastFirst(name string) string {
+	given, family := splitAuthorName(name)
+	if given == "" {
+		return family
+	}
+	return family + ", " + given
+}
+
+// exportDate formats a stored date as YYYY/MM/DD, the form both services
+// export.
+func exportDate(s string) string {
+	if len(s) < 10 {
+		return ""
+	}
+	t, err := time.Parse("2006-01-02", s[:10])
+	if err != nil {
+		return ""
+	}
+	return t.Format("2006/01/02")
+}
+
+func exportDateRange(started, finished string) string {
+	if d := exportDate(started); d != "" {
+		return d + "-" + exportDate(finished)
+	}
+	return exportDate(finished)
+}
+
+func exportInt(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+func writeCSVRow(sb *strings.Builder, fields []string) {
+	for i, f := range fields {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(csvEscape(f))
+	}
+	sb.WriteByte('\n')
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Fixture modes, selected with HTTP_FIXTURES_MODE.
+//
+//   - record: outbound catalog/LLM requests go to the network as usual and
+//     every response is written to HTTP_FIXTURES_DIR.
+//   - replay: responses are served from HTTP_FIXTURES_DIR and the network is
+//     never touched; a request with no fixture fails.
+//
+// Anything else (the default) leaves HTTP traffic untouched.
+const (
+	fixtureRecord = "record"
+	fixtureReplay = "replay"
+)
+
+// fixtureMode returns the configured record/replay mode, or "" when off.
+func fixtureMode() string {
+	switch m := os.Getenv("HTTP_FIXTURES_MODE"); m {
+	case fixtureRecord, fixtureReplay:
+		return m
+	default:
+		return ""
+	}
+}
+
+func fixtureDir() string {
+	if d := os.Getenv("HTTP_FIXTURES_DIR"); d != "" {
+		return d
+	}
+	return "fixtures"
+}
+
+// newExternalHTTPClient returns the client used for all outbound catalog and
+// LLM calls, wrapped in the record/replay transport when enabled. A non-nil
+// guard adds rate limiting, retries and a circuit breaker; it is skipped in
+// replay mode since nothing leaves the process.
+func newExternalHTTPClient(timeout time.Duration, guard *outboundGuard) *http.Client {
+	var transport http.RoundTripper = http.DefaultTransport
+	mode := fixtureMode()
+	if mode != "" {
+		transport = &fixtureTransport{
+			mode: mode,
+			dir:  fixtureDir(),
+			next: transport,
+		}
+	}
+	if guard != nil && mode != fixtureReplay {
+		transport = &guardedTransport{guard: guard, next: transport}
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// fixture is the on-disk form of a recorded response.
+type fixture struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	RequestBody string `json:"request_body,omitempty"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body"`
+	RecordedAt  string `json:"recorded_at"`
+}
+
+// fixtureTransport records or replays responses keyed by method, URL and
+// request body. Credentials (the Google Books "key" param and API key
+// headers) are left out of both the key and the stored file.
+type fixtureTransport struct {
+	mode string
+	dir  string
+	next http.RoundTripper
+}
+
+func (t *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	cleanURL := redactURL(req.URL)
+	path := t.path(req.Method, req.URL.Host, cleanURL, reqBody)
+
+	if t.mode == fixtureReplay {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("no fixture for %s %s", req.Method, cleanURL)
+		}
+		var f fixture
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return nil, fmt.Errorf("bad fixture %s: %w", path, err)
+		}
+		resp := &http.Response{
+			StatusCode:    f.Status,
+			Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{},
+			Body:          io.NopCloser(strings.NewReader(f.Body)),
+			ContentLength: int64(len(f.Body)),
+			Request:       req,
+		}
+		if f.ContentType != "" {
+			resp.Header.Set("Content-Type", f.ContentType)
+		}
+		return resp, nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	f := fixture{
+		Method:      req.Method,
+		URL:         cleanURL,
+		RequestBody: string(reqBody),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        string(body),
+		RecordedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := writeFixture(path, f); err != nil {
+		log.Printf("[Fixtures] failed to record %s: %v", cleanURL, err)
+	}
+	return resp, nil
+}
+
+// path returns <dir>/<host>/<sha256>.json for a request.
+func (t *fixtureTransport) path(method, host, cleanURL string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + cleanURL + "\n"))
+	h.Write(body)
+	return filepath.Join(t.dir, host, hex.EncodeToString(h.Sum(nil))[:32]+".json")
+}
+
+func writeFixture(path string, f fixture) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// redactURL drops credentials from a URL so fixtures are portable and safe
+// to commit.
+func redactURL(u *url.URL) string {
+	clean := *u
+	q := clean.Query()
+	if q.Has("key") {
+		q.Del("key")
+		clean.RawQuery = q.Encode()
+	}
+	return clean.String()
+}
@@ -6,6 +6,8 @@ import (
 	"strings"
 
 	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/bookstats"
 )
 
 // ListGenres handles GET /genres
@@ -76,7 +78,7 @@ func ListGenres(app core.App) func(e *core.RequestEvent) error {
 	}
 }
 
-// GetGenreBooks handles GET /genres/{slug}/books?page=1&limit=20&sort=title|rating|year
+// GetGenreBooks handles GET /genres/{slug}/books?page=1&limit=20&sort=title|year|rating|average|ratings|reads|dnf_rate|finish_time
 func GetGenreBooks(app core.App) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
 		slug := e.Request.PathValue("slug")
@@ -125,20 +127,7 @@ func GetGenreBooks(app core.App) func(e *core.RequestEvent) error {
 		}
 
 		// Batch-fetch book_stats for ratings/counts
-		statsMap := map[string]*core.Record{}
-		if len(matchedBooks) > 0 {
-			var bookIDs []any
-			for _, b := range matchedBooks {
-				bookIDs = append(bookIDs, b.Id)
-			}
-			allStats, _ := app.FindRecordsByFilter("book_stats",
-				"book IN {:ids}", "", 0, 0,
-				map[string]any{"ids": bookIDs},
-			)
-			for _, s := range allStats {
-				statsMap[s.GetString("book")] = s
-			}
-		}
+		statsMap := batchBookStats(app, matchedBooks)
 
 		// Sort matched books
 		switch sortParam {
@@ -150,17 +139,6 @@ func GetGenreBooks(app core.App) func(e *core.RequestEvent) error {
 					}
 				}
 			}
-		case "rating":
-			// Sort by average rating descending (books without ratings go last)
-			for i := 0; i < len(matchedBooks); i++ {
-				for j := i + 1; j < len(matchedBooks); j++ {
-					ri := avgRatingForBook(statsMap, matchedBooks[i].Id)
-					rj := avgRatingForBook(statsMap, matchedBooks[j].Id)
-					if rj > ri {
-						matchedBooks[i], matchedBooks[j] = matchedBooks[j], matchedBooks[i]
-					}
-				}
-			}
 		case "year":
 			// Sort by publication year descending (newest first)
 			for i := 0; i < len(matchedBooks); i++ {
@@ -173,7 +151,11 @@ func GetGenreBooks(app core.App) func(e *core.RequestEvent) error {
 				}
 			}
 		default:
-			// Default: no explicit sort (order as stored)
+			// Stats sorts (see bookstats.OrderBy) are ranked by the database;
+			// anything else leaves the order as stored.
+			if order, ok := bookstats.OrderBy(sortParam, "bs"); ok {
+				matchedBooks = orderBooksByStats(app, matchedBooks, order)
+			}
 		}
 
 		// Paginate
@@ -200,6 +182,7 @@ func GetGenreBooks(app core.App) func(e *core.RequestEvent) error {
 
 			var avgRating *float64
 			var ratingCount, alreadyReadCount int
+			weightedRating, _ := bookstats.Prior()
 			if s, ok := statsMap[b.Id]; ok {
 				if rc := s.GetInt("rating_count"); rc > 0 {
 					avg := s.GetFloat("rating_sum") / float64(rc)
@@ -207,6 +190,7 @@ func GetGenreBooks(app core.App) func(e *core.RequestEvent) error {
 				}
 				ratingCount = s.GetInt("rating_count")
 				alreadyReadCount = s.GetInt("reads_count")
+				weightedRating = s.GetFloat("weighted_score")
 			}
 
 			var subjects []string
@@ -230,6 +214,7 @@ func GetGenreBooks(app core.App) func(e *core.RequestEvent) error {
 				"cover_url":          b.GetString("cover_url"),
 				"edition_count":      0,
 				"average_rating":     avgRating,
+				"weighted_rating":    weightedRating,
 				"rating_count":       ratingCount,
 				"already_read_count": alreadyReadCount,
 				"subjects":           subjects,
@@ -249,12 +234,39 @@ func GetGenreBooks(app core.App) func(e *core.RequestEvent) error {
 	}
 }
 
-// avgRatingForBook returns the average rating for a book, or 0 if no ratings.
-func avgRatingForBook(statsMap map[string]*core.Record, bookID string) float64 {
-	if s, ok := statsMap[bookID]; ok {
-		if rc := s.GetInt("rating_count"); rc > 0 {
-			return s.GetFloat("rating_sum") / float64(rc)
+// orderBooksByStats sorts books by an ORDER BY expression over their
+// book_stats rows (aliased bs), breaking ties by title. Books the query
+// doesn't return keep their place after the rest.
+func orderBooksByStats(app core.App, books []*core.Record, order string) []*core.Record {
+	bookIDs := make([]string, len(books))
+	byID := make(map[string]*core.Record, len(books))
+	for i, b := range books {
+		bookIDs[i] = b.Id
+		byID[b.Id] = b
+	}
+	placeholders, params := inPlaceholders(bookIDs)
+	var ids []string
+	err := app.DB().NewQuery(`
+		SELECT b.id
+		FROM books b
+		LEFT JOIN book_stats bs ON bs.book = b.id
+		WHERE b.id IN (` + placeholders + `)
+		ORDER BY ` + order + `, LOWER(b.title)
+	`).Bind(params).Column(&ids)
+	if err != nil {
+		return books
+	}
+	sorted := make([]*core.Record, 0, len(books))
+	for _, id := range ids {
+		if b := byID[id]; b != nil {
+			sorted = append(sorted, b)
+			delete(byID, id)
+		}
+	}
+	for _, b := range books {
+		if byID[b.Id] != nil {
+			sorted = append(sorted, b)
 		}
 	}
-	return 0
+	return sorted
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
@@ -171,39 +172,14 @@ func fetchBooksFromOpenLibrary(app core.App, rng *rand.Rand, count int) ([]*core
 // SimulateGhosts handles POST /admin/ghosts/simulate
 func SimulateGhosts(app core.App) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
-		// Find all ghost users
-		ghosts, err := app.FindRecordsByFilter("users",
-			"is_ghost = true", "", 100, 0, nil,
-		)
-		if err != nil || len(ghosts) == 0 {
+		results, fetchLogs, err := simulateGhosts(app)
+		if errors.Is(err, errNoGhosts) {
 			return e.JSON(http.StatusOK, map[string]any{
 				"results": []any{},
 				"error":   "No ghost users found. Seed ghosts first.",
 			})
 		}
-
-		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
-
-		// Fetch fresh books from Open Library (enough for all ghosts, ~5 per ghost)
-		needed := len(ghosts) * 5
-		if needed < 50 {
-			needed = 50
-		}
-		fetchedBooks, fetchLogs := fetchBooksFromOpenLibrary(app, rng, needed)
-
-		// Also include any existing local books for variety
-		localBooks, _ := app.FindRecordsByFilter("books", "1=1", "-created", 200, 0, nil)
-		localSet := make(map[string]bool)
-		for _, b := range fetchedBooks {
-			localSet[b.Id] = true
-		}
-		for _, b := range localBooks {
-			if !localSet[b.Id] {
-				fetchedBooks = append(fetchedBooks, b)
-			}
-		}
-
-		if len(fetchedBooks) == 0 {
+		if err != nil {
 			return e.JSON(http.StatusOK, map[string]any{
 				"results":    []any{},
 				"fetch_logs": fetchLogs,
@@ -211,89 +187,133 @@ func SimulateGhosts(app core.App) func(e *core.RequestEvent) error {
 			})
 		}
 
-		type ghostResult struct {
-			Ghost   string   `json:"ghost"`
-			Actions []string `json:"actions"`
-		}
-		var results []ghostResult
+		return e.JSON(http.StatusOK, map[string]any{
+			"results":    results,
+			"fetch_logs": fetchLogs,
+		})
+	}
+}
 
-		for _, ghost := range ghosts {
-			gr := ghostResult{
-				Ghost:   ghost.GetString("username"),
-				Actions: []string{},
-			}
+var (
+	errNoGhosts     = errors.New("no ghost users")
+	errNoGhostBooks = errors.New("no books available for ghosts")
+)
 
-			// Find books this ghost hasn't rated yet
-			ratedBooks, _ := app.FindRecordsByFilter("user_books",
-				"user = {:user}", "", 1000, 0,
-				map[string]any{"user": ghost.Id},
-			)
-			ratedSet := make(map[string]bool)
-			for _, rb := range ratedBooks {
-				ratedSet[rb.GetString("book")] = true
-			}
+type ghostResult struct {
+	Ghost   string   `json:"ghost"`
+	Actions []string `json:"actions"`
+}
 
-			var available []*core.Record
-			for _, b := range fetchedBooks {
-				if !ratedSet[b.Id] {
-					available = append(available, b)
-				}
-			}
+// simulateGhosts has each ghost rate and finish a few books it hasn't read,
+// fetched fresh from Open Library plus recent local books. Used by the admin
+// endpoint and the ghost_simulation task.
+func simulateGhosts(app core.App) ([]ghostResult, []string, error) {
+	// Find all ghost users
+	ghosts, err := app.FindRecordsByFilter("users",
+		"is_ghost = true", "", 100, 0, nil,
+	)
+	if err != nil || len(ghosts) == 0 {
+		return nil, nil, errNoGhosts
+	}
 
-			if len(available) == 0 {
-				gr.Actions = append(gr.Actions, "Already rated all available books")
-				results = append(results, gr)
-				continue
-			}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
 
-			// Shuffle available books
-			rng.Shuffle(len(available), func(i, j int) {
-				available[i], available[j] = available[j], available[i]
-			})
+	// Fetch fresh books from Open Library (enough for all ghosts, ~5 per ghost)
+	needed := len(ghosts) * 5
+	if needed < 50 {
+		needed = 50
+	}
+	fetchedBooks, fetchLogs := fetchBooksFromOpenLibrary(app, rng, needed)
 
-			numBooks := rng.Intn(5) + 1
-			if numBooks > len(available) {
-				numBooks = len(available)
-			}
+	// Also include any existing local books for variety
+	localBooks, _ := app.FindRecordsByFilter("books", "1=1", "-created", 200, 0, nil)
+	localSet := make(map[string]bool)
+	for _, b := range fetchedBooks {
+		localSet[b.Id] = true
+	}
+	for _, b := range localBooks {
+		if !localSet[b.Id] {
+			fetchedBooks = append(fetchedBooks, b)
+		}
+	}
 
-			for i := 0; i < numBooks; i++ {
-				book := available[i]
-
-				coll, _ := app.FindCollectionByNameOrId("user_books")
-				ub := core.NewRecord(coll)
-				ub.Set("user", ghost.Id)
-				ub.Set("book", book.Id)
-				rating := rng.Intn(5) + 1
-				ub.Set("rating", rating)
-				ub.Set("date_added", time.Now().UTC().Format(time.RFC3339))
-				if err := app.Save(ub); err != nil {
-					gr.Actions = append(gr.Actions, fmt.Sprintf("Failed to rate \"%s\": %v", book.GetString("title"), err))
-					continue
-				}
+	if len(fetchedBooks) == 0 {
+		return nil, fetchLogs, errNoGhostBooks
+	}
 
-				setStatusTag(app, ghost.Id, book.Id, "finished")
-				refreshBookStats(app, book.Id)
+	var results []ghostResult
+	for _, ghost := range ghosts {
+		gr := ghostResult{
+			Ghost:   ghost.GetString("username"),
+			Actions: []string{},
+		}
 
-				// Record activities so they appear in feeds
-				recordActivity(app, ghost.Id, "rated", map[string]any{
-					"book":     book.Id,
-					"metadata": fmt.Sprintf(`{"rating":%d}`, rating),
-				})
-				recordActivity(app, ghost.Id, "finished_book", map[string]any{
-					"book": book.Id,
-				})
+		// Find books this ghost hasn't rated yet
+		ratedBooks, _ := app.FindRecordsByFilter("user_books",
+			"user = {:user}", "", 1000, 0,
+			map[string]any{"user": ghost.Id},
+		)
+		ratedSet := make(map[string]bool)
+		for _, rb := range ratedBooks {
+			ratedSet[rb.GetString("book")] = true
+		}
 
-				gr.Actions = append(gr.Actions, fmt.Sprintf("Rated \"%s\" %d/5", book.GetString("title"), rating))
+		var available []*core.Record
+		for _, b := range fetchedBooks {
+			if !ratedSet[b.Id] {
+				available = append(available, b)
 			}
+		}
 
+		if len(available) == 0 {
+			gr.Actions = append(gr.Actions, "Already rated all available books")
 			results = append(results, gr)
+			continue
 		}
 
-		return e.JSON(http.StatusOK, map[string]any{
-			"results":    results,
-			"fetch_logs": fetchLogs,
+		// Shuffle available books
+		rng.Shuffle(len(available), func(i, j int) {
+			available[i], available[j] = available[j], available[i]
 		})
+
+		numBooks := rng.Intn(5) + 1
+		if numBooks > len(available) {
+			numBooks = len(available)
+		}
+
+		for i := 0; i < numBooks; i++ {
+			book := available[i]
+
+			coll, _ := app.FindCollectionByNameOrId("user_books")
+			ub := core.NewRecord(coll)
+			ub.Set("user", ghost.Id)
+			ub.Set("book", book.Id)
+			rating := rng.Intn(5) + 1
+			ub.Set("rating", rating)
+			ub.Set("date_added", time.Now().UTC().Format(time.RFC3339))
+			if err := app.Save(ub); err != nil {
+				gr.Actions = append(gr.Actions, fmt.Sprintf("Failed to rate \"%s\": %v", book.GetString("title"), err))
+				continue
+			}
+
+			setStatusTag(app, ghost.Id, book.Id, "finished")
+
+			// Record activities so they appear in feeds
+			recordActivity(app, ghost.Id, "rated", map[string]any{
+				"book":     book.Id,
+				"metadata": fmt.Sprintf(`{"rating":%d}`, rating),
+			})
+			recordActivity(app, ghost.Id, "finished_book", map[string]any{
+				"book": book.Id,
+			})
+
+			gr.Actions = append(gr.Actions, fmt.Sprintf("Rated \"%s\" %d/5", book.GetString("title"), rating))
+		}
+
+		results = append(results, gr)
 	}
+
+	return results, fetchLogs, nil
 }
 
 // GetGhostStatus handles GET /admin/ghosts/status
@@ -1,15 +1,9 @@
 package handlers
 
 import (
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
-	"os"
 	"regexp"
 	"strings"
-	"time"
 	"unicode"
 
 	"github.com/pocketbase/pocketbase/core"
@@ -243,21 +237,28 @@ func ensureTagValue(app core.App, tagKeyID, name string) (*core.Record, error) {
 }
 
 
+// inPlaceholders returns the placeholder list for an IN (...) clause over ids
+// and the params binding it. PocketBase doesn't expand a slice bound to a
+// single placeholder, so every value needs its own.
+func inPlaceholders(ids []string) (string, map[string]any) {
+	placeholders := make([]string, len(ids))
+	params := make(map[string]any, len(ids))
+	for i, id := range ids {
+		key := fmt.Sprintf("id%d", i)
+		placeholders[i] = "{:" + key + "}"
+		params[key] = id
+	}
+	return strings.Join(placeholders, ", "), params
+}
+
 // batchShelfCounts returns a map of collection ID → item count using a single query.
-func batchShelfCounts(app core.App, shelfIDs []any) map[string]int {
+func batchShelfCounts(app core.App, shelfIDs []string) map[string]int {
 	counts := make(map[string]int, len(shelfIDs))
 	if len(shelfIDs) == 0 {
 		return counts
 	}
 
-	// Build placeholder list for IN clause
-	placeholders := make([]string, len(shelfIDs))
-	binds := map[string]any{}
-	for i, id := range shelfIDs {
-		key := fmt.Sprintf("id%d", i)
-		placeholders[i] = "{:" + key + "}"
-		binds[key] = id
-	}
+	placeholders, binds := inPlaceholders(shelfIDs)
 
 	type countRow struct {
 		Collection string `db:"collection"`
@@ -266,7 +267,7 @@ func batchShelfCounts(app core.App, shelfIDs []any) map[string]int {
 	var rows []countRow
 	_ = app.DB().NewQuery(
 		"SELECT collection, COUNT(*) as count FROM collection_items WHERE collection IN (" +
-			strings.Join(placeholders, ",") +
+			placeholders +
 			") GROUP BY collection",
 	).Bind(binds).All(&rows)
 
@@ -276,6 +277,31 @@ func batchShelfCounts(app core.App, shelfIDs []any) map[string]int {
 	return counts
 }
 
+// batchBookStats returns the book_stats records of the given books, keyed by
+// book ID. Books without a stats row are left out.
+func batchBookStats(app core.App, books []*core.Record) map[string]*core.Record {
+	stats := make(map[string]*core.Record, len(books))
+	if len(books) == 0 {
+		return stats
+	}
+
+	bookIDs := make([]string, len(books))
+	for i, b := range books {
+		bookIDs[i] = b.Id
+	}
+	placeholders, binds := inPlaceholders(bookIDs)
+
+	var ids []string
+	_ = app.DB().NewQuery(
+		"SELECT id FROM book_stats WHERE book IN (" + placeholders + ")",
+	).Bind(binds).Column(&ids)
+	records, _ := app.FindRecordsByIds("book_stats", ids)
+	for _, r := range records {
+		stats[r.GetString("book")] = r
+	}
+	return stats
+}
+
 // isAllowedImageType checks if a MIME type is an allowed image format for uploads.
 func isAllowedImageType(contentType string) bool {
 	switch contentType {
@@ -286,309 +312,38 @@ func isAllowedImageType(contentType string) bool {
 	}
 }
 
-// gbClient is a Google Books API client used as a fallback catalog lookup.
-type gbClient struct {
-	httpClient *http.Client
-	apiKey     string
-}
-
-func newGBClient() *gbClient {
-	return &gbClient{
-		httpClient: &http.Client{Timeout: 10 * time.Second},
-		apiKey:     os.Getenv("GOOGLE_BOOKS_API_KEY"),
-	}
-}
-
-// gbResult holds the fields we extract from a Google Books volume.
-type gbResult struct {
-	Title   string
-	Authors []string
-	ISBN13  string
-}
-
-// searchByISBN queries Google Books for a volume matching the given ISBN.
-func (c *gbClient) searchByISBN(isbn string) (*gbResult, error) {
-	return c.search("isbn:" + isbn)
-}
-
-// searchByTitleAuthor queries Google Books by title and optional author.
-func (c *gbClient) searchByTitleAuthor(title, author string) (*gbResult, error) {
-	q := "intitle:" + title
-	if author != "" {
-		q += "+inauthor:" + author
-	}
-	return c.search(q)
+// upsertBook finds or creates a book record by open_library_id, filling in
+// any empty fields. See upsertBookFields to overwrite stale values.
+func upsertBook(app core.App, olID, title, coverURL, isbn13, authors string, pubYear int, subjects string) (*core.Record, error) {
+	return upsertBookFields(app, olID, bookFields{
+		Title:    title,
+		CoverURL: coverURL,
+		ISBN13:   isbn13,
+		Authors:  authors,
+		PubYear:  pubYear,
+		Subjects: subjects,
+	}, false)
 }
 
-func (c *gbClient) search(query string) (*gbResult, error) {
-	u := "https://www.googleapis.com/books/v1/volumes?q=" + url.QueryEscape(query) + "&maxResults=1"
-	if c.apiKey != "" {
-		u += "&key=" + url.QueryEscape(c.apiKey)
-	}
-	resp, err := c.httpClient.Get(u)
-	if err != nil {
-		return nil, err
+// findRecordsInOrder loads records by id in the order given, skipping ids
+// that no longer exist.
+func findRecordsInOrder(app core.App, collection string, ids []string) []*core.Record {
+	if len(ids) == 0 {
+		return nil
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Google Books API returned %d", resp.StatusCode)
-	}
-	body, err := io.ReadAll(resp.Body)
+	recs, err := app.FindRecordsByIds(collection, ids)
 	if err != nil {
-		return nil, err
-	}
-	var data map[string]any
-	if err := json.Unmarshal(body, &data); err != nil {
-		return nil, err
-	}
-	items, ok := data["items"].([]any)
-	if !ok || len(items) == 0 {
-		return nil, fmt.Errorf("no results")
-	}
-	item, ok := items[0].(map[string]any)
-	if !ok {
-		return nil, fmt.Errorf("invalid item")
-	}
-	vol, ok := item["volumeInfo"].(map[string]any)
-	if !ok {
-		return nil, fmt.Errorf("no volumeInfo")
-	}
-	result := &gbResult{}
-	if t, ok := vol["title"].(string); ok {
-		result.Title = t
-	}
-	if authors, ok := vol["authors"].([]any); ok {
-		for _, a := range authors {
-			if s, ok := a.(string); ok {
-				result.Authors = append(result.Authors, s)
-			}
-		}
-	}
-	// Extract ISBN-13 from industry identifiers
-	if ids, ok := vol["industryIdentifiers"].([]any); ok {
-		for _, id := range ids {
-			if idMap, ok := id.(map[string]any); ok {
-				if idMap["type"] == "ISBN_13" {
-					if v, ok := idMap["identifier"].(string); ok {
-						result.ISBN13 = v
-					}
-				}
-			}
-		}
-	}
-	return result, nil
-}
-
-// googleBooksLookup tries Google Books as a fallback, then maps the result
-// back to Open Library by searching OL with the Google Books title/author.
-// Returns the same tuple as extractOLSearchResult.
-func googleBooksLookup(gb *gbClient, ol *cachedOLClient, isbn, title, author string) (olID, matchTitle, coverURL string, authors []string, found bool) {
-	var gbr *gbResult
-	var err error
-
-	// Try ISBN first
-	if isbn != "" {
-		gbr, err = gb.searchByISBN(isbn)
-	}
-	// Fall back to title+author
-	if err != nil || gbr == nil {
-		if title == "" {
-			return
-		}
-		gbr, err = gb.searchByTitleAuthor(title, author)
-	}
-	if err != nil || gbr == nil || gbr.Title == "" {
-		return
-	}
-
-	// Now try to map the Google Books result back to Open Library
-	// Use the (potentially better) title/authors from Google Books
-	gbTitle := gbr.Title
-	gbAuthor := ""
-	if len(gbr.Authors) > 0 {
-		gbAuthor = gbr.Authors[0]
-	}
-
-	// Try OL search with Google's ISBN first (if Google found one we didn't have)
-	if gbr.ISBN13 != "" && gbr.ISBN13 != isbn {
-		data, searchErr := ol.get(fmt.Sprintf("/search.json?isbn=%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", url.QueryEscape(gbr.ISBN13)))
-		if searchErr == nil {
-			olID, matchTitle, coverURL, authors, found = extractOLSearchResult(data)
-			if found {
-				return
-			}
-		}
-	}
-
-	// Try OL search with Google's title+author
-	q := "title=" + url.QueryEscape(gbTitle)
-	if gbAuthor != "" {
-		q += "&author=" + url.QueryEscape(gbAuthor)
+		return nil
 	}
-	data, searchErr := ol.get(fmt.Sprintf("/search.json?%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", q))
-	if searchErr == nil {
-		id, mt, cu, au, ok := extractOLSearchResult(data)
-		if ok && titleMatchesResult(gbTitle, mt) {
-			olID, matchTitle, coverURL, authors, found = id, mt, cu, au, ok
-			return
-		}
+	byID := make(map[string]*core.Record, len(recs))
+	for _, r := range recs {
+		byID[r.Id] = r
 	}
-
-	return
-}
-
-// upsertBook finds or creates a book record by open_library_id.
-func upsertBook(app core.App, olID, title, coverURL, isbn13, authors string, pubYear int, subjects string) (*core.Record, error) {
-	existing, err := app.FindRecordsByFilter("books",
-		"open_library_id = {:id}",
-		"", 1, 0,
-		map[string]any{"id": olID},
-	)
-	if err == nil && len(existing) > 0 {
-		rec := existing[0]
-		// Update fields if they were empty
-		changed := false
-		if rec.GetString("title") == "" && title != "" {
-			rec.Set("title", title)
-			changed = true
-		}
-		if rec.GetString("cover_url") == "" && coverURL != "" {
-			rec.Set("cover_url", coverURL)
-			changed = true
+	ordered := make([]*core.Record, 0, len(recs))
+	for _, id := range ids {
+		if r, ok := byID[id]; ok {
+			ordered = append(ordered, r)
 		}
-		if rec.GetString("isbn13") == "" && isbn13 != "" {
-			rec.Set("isbn13", isbn13)
-			changed = true
-		}
-		if rec.GetString("authors") == "" && authors != "" {
-			rec.Set("authors", authors)
-			changed = true
-		}
-		if rec.GetInt("publication_year") == 0 && pubYear != 0 {
-			rec.Set("publication_year", pubYear)
-			changed = true
-		}
-		if rec.GetString("subjects") == "" && subjects != "" {
-			rec.Set("subjects", subjects)
-			changed = true
-		}
-		if changed {
-			if err := app.Save(rec); err != nil {
-				return nil, err
-			}
-		}
-		return rec, nil
 	}
-
-	booksColl, err := app.FindCollectionByNameOrId("books")
-	if err != nil {
-		return nil, err
-	}
-	rec := core.NewRecord(booksColl)
-	rec.Set("open_library_id", olID)
-	rec.Set("title", title)
-	rec.Set("cover_url", coverURL)
-	rec.Set("isbn13", isbn13)
-	rec.Set("authors", authors)
-	rec.Set("publication_year", pubYear)
-	rec.Set("subjects", subjects)
-	if err := app.Save(rec); err != nil {
-		return nil, err
-	}
-	return rec, nil
-}
-
-// recordActivity creates an activity record in a fire-and-forget goroutine.
-func recordActivity(app core.App, userID, activityType string, opts map[string]any) {
-	go func() {
-		coll, err := app.FindCollectionByNameOrId("activities")
-		if err != nil {
-			return
-		}
-		rec := core.NewRecord(coll)
-		rec.Set("user", userID)
-		rec.Set("activity_type", activityType)
-		rec.Set("created", time.Now().UTC().Format("2006-01-02 15:04:05.000Z"))
-		if v, ok := opts["book"]; ok {
-			rec.Set("book", v)
-		}
-		if v, ok := opts["target_user"]; ok {
-			rec.Set("target_user", v)
-		}
-		if v, ok := opts["collection_ref"]; ok {
-			rec.Set("collection_ref", v)
-		}
-		if v, ok := opts["thread"]; ok {
-			rec.Set("thread", v)
-		}
-		if v, ok := opts["metadata"]; ok {
-			rec.Set("metadata", v)
-		}
-		_ = app.Save(rec)
-	}()
-}
-
-// refreshBookStats recalculates the book_stats for a given book.
-func refreshBookStats(app core.App, bookID string) {
-	go func() {
-		type statsResult struct {
-			RatingSum   float64 `db:"rating_sum"`
-			RatingCount int     `db:"rating_count"`
-			ReviewCount int     `db:"review_count"`
-		}
-		var stats statsResult
-		err := app.DB().NewQuery(`
-			SELECT
-				COALESCE(SUM(CASE WHEN rating > 0 THEN rating ELSE 0 END), 0) as rating_sum,
-				COALESCE(SUM(CASE WHEN rating > 0 THEN 1 ELSE 0 END), 0) as rating_count,
-				COALESCE(SUM(CASE WHEN review_text != '' AND review_text IS NOT NULL THEN 1 ELSE 0 END), 0) as review_count
-			FROM user_books WHERE book = {:book}
-		`).Bind(map[string]any{"book": bookID}).One(&stats)
-		if err != nil {
-			return
-		}
-
-		// Count reads and want_to_read from book_tag_values + tag_values
-		type countResult struct {
-			Count int `db:"count"`
-		}
-		var readsCount countResult
-		_ = app.DB().NewQuery(`
-			SELECT COUNT(DISTINCT btv.user) as count
-			FROM book_tag_values btv
-			JOIN tag_values tv ON btv.tag_value = tv.id
-			WHERE btv.book = {:book} AND tv.slug = 'finished'
-		`).Bind(map[string]any{"book": bookID}).One(&readsCount)
-
-		var wtrCount countResult
-		_ = app.DB().NewQuery(`
-			SELECT COUNT(DISTINCT btv.user) as count
-			FROM book_tag_values btv
-			JOIN tag_values tv ON btv.tag_value = tv.id
-			WHERE btv.book = {:book} AND tv.slug = 'want-to-read'
-		`).Bind(map[string]any{"book": bookID}).One(&wtrCount)
-
-		// Upsert book_stats
-		existing, err := app.FindRecordsByFilter("book_stats",
-			"book = {:book}", "", 1, 0,
-			map[string]any{"book": bookID},
-		)
-		var rec *core.Record
-		if err == nil && len(existing) > 0 {
-			rec = existing[0]
-		} else {
-			coll, err := app.FindCollectionByNameOrId("book_stats")
-			if err != nil {
-				return
-			}
-			rec = core.NewRecord(coll)
-			rec.Set("book", bookID)
-		}
-		rec.Set("reads_count", readsCount.Count)
-		rec.Set("want_to_read_count", wtrCount.Count)
-		rec.Set("rating_sum", stats.RatingSum)
-		rec.Set("rating_count", stats.RatingCount)
-		rec.Set("review_count", stats.ReviewCount)
-		_ = app.Save(rec)
-	}()
+	return ordered
 }
@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/tristansaldanha/rosslib/api/isbn"
+)
+
+func init() { registerImporter(calibreImporter{}) }
+
+// calibreImporter reads a Calibre library: the metadata.db at the root of
+// the library folder, or the JSON written by
+// `calibredb list --for-machine --fields all`.
+type calibreImporter struct{}
+
+func (calibreImporter) Source() string                   { return "calibre" }
+func (calibreImporter) FuzzyMatch() bool                 { return true }
+func (calibreImporter) Status(shelf string) string       { return mapLibraryThingStatusSlug(shelf) }
+func (calibreImporter) CleanTitle(title string) string   { return cleanLibraryThingTitle(title) }
+func (calibreImporter) CleanAuthor(author string) string { return cleanGoodreadsAuthor(author) }
+
+// sqliteHeader starts every SQLite database file.
+const sqliteHeader = "SQLite format 3\x00"
+
+// calibreBook is one book of a library, from either format.
+type calibreBook struct {
+	title       string
+	author      string
+	isbn        string
+	rating      float64 // 0-10, as Calibre stores it
+	series      string
+	seriesIndex float64
+	tags        []string
+	added       string
+	read        *bool // from a custom "Read" yes/no column
+	dateRead    string
+}
+
+func (calibreImporter) Parse(r io.Reader) ([]ImportRow, error) {
+	br := bufio.NewReader(r)
+	var books []calibreBook
+	var err error
+	if header, _ := br.Peek(len(sqliteHeader)); string(header) == sqliteHeader {
+		books, err = readCalibreDB(br)
+	} else {
+		books, err = readCalibreJSON(br)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(books) == 0 {
+		return nil, errors.New("No books found")
+	}
+
+	rows := make([]ImportRow, 0, len(books))
+	for _, b := range books {
+		rows = append(rows, b.row())
+	}
+	return rows, nil
+}
+
+func (b calibreBook) row() ImportRow {
+	pr := ImportRow{
+		Title:         strings.TrimSpace(b.title),
+		Author:        strings.TrimSpace(b.author),
+		ISBN13:        isbn.Normalize(b.isbn),
+		CustomShelves: b.tags,
+		Series:        strings.TrimSpace(b.series),
+	}
+	if b.rating > 0 {
+		rating := b.rating / 2
+		pr.Rating = &rating
+	}
+	// Only whole-numbered books get a series position; 1.5 is a novella
+	// between volumes.
+	if pr.Series != "" && b.seriesIndex >= 1 && b.seriesIndex == math.Trunc(b.seriesIndex) {
+		pos := int(b.seriesIndex)
+		pr.SeriesPosition = &pos
+	}
+	if d := calibreDate(b.added); d != "" {
+		pr.DateAdded = &d
+	}
+	if d := calibreDate(b.dateRead); d != "" {
+		pr.DateRead = &d
+	}
+
+	// Calibre has no shelves; a "Read" column or a read date sets the status.
+	switch {
+	case b.read != nil && *b.read, b.read == nil && pr.DateRead != nil:
+		pr.ExclusiveShelfSlug = "read"
+	case b.read != nil:
+		pr.ExclusiveShelfSlug = "to-read"
+	}
+	return pr
+}
+
+// readCalibreDB reads books from a metadata.db.
+func readCalibreDB(r io.Reader) ([]calibreBook, error) {
+	invalid := errors.New("Invalid Calibre library")
+	db, closeDB, err := openImportDB(r)
+	if err != nil {
+		return nil, invalid
+	}
+	defer closeDB()
+
+	// Books are linked to their first author, series and rating through
+	// link tables; identifiers hold the ISBN newer versions record.
+	rows, err := db.Query(`
+		SELECT b.id, b.title, COALESCE(b.timestamp, ''), COALESCE(b.series_index, 1),
+			COALESCE((SELECT i.val FROM identifiers i WHERE i.book = b.id AND i.type = 'isbn' LIMIT 1), b.isbn, ''),
+			COALESCE((SELECT a.name FROM books_authors_link l JOIN authors a ON a.id = l.author
+				WHERE l.book = b.id ORDER BY l.id LIMIT 1), ''),
+			COALESCE((SELECT s.name FROM books_series_link l JOIN series s ON s.id = l.series
+				WHERE l.book = b.id LIMIT 1), ''),
+			COALESCE((SELECT r.rating FROM books_ratings_link l JOIN ratings r ON r.id = l.rating
+				WHERE l.book = b.id LIMIT 1), 0)
+		FROM books b
+		ORDER BY b.id
+	`)
+	if err != nil {
+		return nil, invalid
+	}
+	defer rows.Close()
+
+	var books []calibreBook
+	index := map[int64]int{}
+	for rows.Next() {
+		var id int64
+		var b calibreBook
+		if err := rows.Scan(&id, &b.title, &b.added, &b.seriesIndex, &b.isbn, &b.author, &b.series, &b.rating); err != nil {
+			return nil, invalid
+		}
+		index[id] = len(books)
+		books = append(books, b)
+	}
+	if rows.Err() != nil {
+		return nil, invalid
+	}
+
+	tags, err := db.Query(`
+		SELECT l.book, t.name FROM books_tags_link l JOIN tags t ON t.id = l.tag
+		ORDER BY l.book, t.name
+	`)
+	if err != nil {
+		return nil, invalid
+	}
+	defer tags.Close()
+	for tags.Next() {
+		var id int64
+		var name string
+		if err := tags.Scan(&id, &name); err != nil {
+			return nil, invalid
+		}
+		if i, ok := index[id]; ok {
+			books[i].tags = append(books[i].tags, name)
+		}
+	}
+	if tags.Err() != nil {
+		return nil, invalid
+	}
+
+	if err := readCalibreColumns(db, books, index); err != nil {
+		return nil, invalid
+	}
+	return books, nil
+}
+
+// readCalibreColumns fills in read flags and read dates from the library's
+// custom columns. Each custom column keeps its values in its own
+// custom_column_N table.
+func readCalibreColumns(db *sql.DB, books []calibreBook, index map[int64]int) error {
+	type column struct {
+		id       int64
+		datatype string
+	}
+	var columns []column
+	cols, err := db.Query(`SELECT id, label, name, datatype FROM custom_columns WHERE datatype IN ('bool', 'datetime')`)
+	if err != nil {
+		// Libraries that never had a custom column may lack the table.
+		return nil
+	}
+	for cols.Next() {
+		var id int64
+		var label, name, datatype string
+		if err := cols.Scan(&id, &label, &name, &datatype); err != nil {
+			cols.Close()
+			return err
+		}
+		if (datatype == "bool" && calibreReadColumn(label, name)) ||
+			(datatype == "datetime" && calibreDateReadColumn(label, name)) {
+			columns = append(columns, column{id, datatype})
+		}
+	}
+	cols.Close()
+
+	for _, c := range columns {
+		values, err := db.Query(fmt.Sprintf(`SELECT book, value FROM custom_column_%d`, c.id))
+		if err != nil {
+			return err
+		}
+		for values.Next() {
+			var id int64
+			var value sql.NullString
+			if err := values.Scan(&id, &value); err != nil {
+				values.Close()
+				return err
+			}
+			i, ok := index[id]
+			if !ok || !value.Valid {
+				continue
+			}
+			if c.datatype == "bool" {
+				read := value.String == "1" || strings.EqualFold(value.String, "true")
+				books[i].read = &read
+			} else {
+				books[i].dateRead = value.String
+			}
+		}
+		values.Close()
+	}
+	return nil
+}
+
+// readCalibreJSON reads books from `calibredb list --for-machine`, where
+// custom columns appear as "*label" keys.
+func readCalibreJSON(r io.Reader) ([]calibreBook, error) {
+	var entries []map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, errors.New("Invalid Calibre library")
+	}
+
+	books := make([]calibreBook, 0, len(entries))
+	for _, e := range entries {
+		var b calibreBook
+		var identifiers map[string]string
+		calibreField(e, "title", &b.title)
+		calibreField(e, "isbn", &b.isbn)
+		calibreField(e, "rating", &b.rating)
+		calibreField(e, "series", &b.series)
+		calibreField(e, "series_index", &b.seriesIndex)
+		calibreField(e, "timestamp", &b.added)
+		calibreField(e, "identifiers", &identifiers)
+		if identifiers["isbn"] != "" {
+			b.isbn = identifiers["isbn"]
+		}
+		if authors := calibreList(e["authors"], " & "); len(authors) > 0 {
+			b.author = authors[0]
+		}
+		b.tags = calibreList(e["tags"], ",")
+
+		for key, raw := range e {
+			label, ok := strings.CutPrefix(key, "*")
+			if !ok {
+				continue
+			}
+			switch {
+			case calibreReadColumn(label, ""):
+				var read bool
+				if json.Unmarshal(raw, &read) == nil && !bytes.Equal(raw, []byte("null")) {
+					b.read = &read
+				}
+			case calibreDateReadColumn(label, ""):
+				calibreField(e, key, &b.dateRead)
+			}
+		}
+		if strings.TrimSpace(b.title) != "" {
+			books = append(books, b)
+		}
+	}
+	return books, nil
+}
+
+// calibreField decodes one field of a JSON entry, leaving v alone when the
+// field is missing or of another type.
+func calibreField(e map[string]json.RawMessage, key string, v any) {
+	if raw, ok := e[key]; ok {
+		_ = json.Unmarshal(raw, v)
+	}
+}
+
+// calibreList reads a field written either as a list or as one string
+// joined with sep, depending on the Calibre version.
+func calibreList(raw json.RawMessage, sep string) []string {
+	var list []string
+	if json.Unmarshal(raw, &list) != nil {
+		var s string
+		if json.Unmarshal(raw, &s) != nil {
+			return nil
+		}
+		list = strings.Split(s, sep)
+	}
+	var out []string
+	for _, item := range list {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// calibreColumnKey folds a custom column's label or name: "date_read",
+// "Date Read" and "dateread" are the same column.
+func calibreColumnKey(s string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", " ", "", "-", "").Replace(s))
+}
+
+// calibreReadColumn reports whether a yes/no column records having read
+// a book, as the "Read" column Calibre's docs suggest does.
+func calibreReadColumn(label, name string) bool {
+	for _, s := range []string{label, name} {
+		switch calibreColumnKey(s) {
+		case "read", "isread", "haveread", "finished":
+			return true
+		}
+	}
+	return false
+}
+
+// calibreDateReadColumn reports whether a date column records when a book
+// was read.
+func calibreDateReadColumn(label, name string) bool {
+	for _, s := range []string{label, name} {
+		switch calibreColumnKey(s) {
+		case "dateread", "readdate", "datefinished", "finisheddate":
+			return true
+		}
+	}
+	return false
+}
+
+// calibreDate reduces a Calibre timestamp ("2024-01-15 10:00:00+00:00" or
+// ISO 8601) to YYYY-MM-DD. Calibre writes year 101 for unset dates.
+func calibreDate(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) < 10 {
+		return ""
+	}
+	t, err := time.Parse("2006-01-02", s[:10])
+	if err != nil || t.Year() < 1000 {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/tristansaldanha/rosslib/api/isbn"
+)
+
+func init() { registerImporter(goodreadsImporter{}) }
+
+// goodreadsImporter reads the CSV from Goodreads' "Export Library".
+type goodreadsImporter struct{}
+
+func (goodreadsImporter) Source() string                   { return "goodreads" }
+func (goodreadsImporter) FuzzyMatch() bool                 { return true }
+func (goodreadsImporter) Status(shelf string) string       { return mapGoodreadsShelf(shelf) }
+func (goodreadsImporter) CleanTitle(title string) string   { return cleanGoodreadsTitle(title) }
+func (goodreadsImporter) CleanAuthor(author string) string { return cleanGoodreadsAuthor(author) }
+
+func (goodreadsImporter) Parse(r io.Reader) ([]ImportRow, error) {
+	t, err := readImportTable(csv.NewReader(r), "Invalid CSV")
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]ImportRow, 0, len(t.rows))
+	for _, row := range t.rows {
+		pr := ImportRow{
+			Title:  t.get(row, "Title"),
+			Author: t.get(row, "Author"),
+			ISBN13: isbn.Normalize(t.get(row, "ISBN13")),
+		}
+		// Older exports only fill the ISBN-10 column.
+		if pr.ISBN13 == "" {
+			pr.ISBN13 = isbn.Normalize(t.get(row, "ISBN"))
+		}
+
+		// Map exclusive shelf — pass through Goodreads name
+		pr.ExclusiveShelfSlug = strings.ToLower(t.get(row, "Exclusive Shelf"))
+
+		if r, err := strconv.ParseFloat(t.get(row, "My Rating"), 64); err == nil && r > 0 {
+			pr.Rating = &r
+		}
+		if review := t.get(row, "My Review"); review != "" {
+			pr.ReviewText = &review
+		}
+		if dr := t.get(row, "Date Read"); dr != "" {
+			pr.DateRead = &dr
+		}
+		if da := t.get(row, "Date Added"); da != "" {
+			pr.DateAdded = &da
+		}
+
+		// Parse custom shelves from Bookshelves column. Custom exclusive
+		// shelves are listed there too.
+		if bookshelves := t.get(row, "Bookshelves"); bookshelves != "" {
+			for _, s := range strings.Split(bookshelves, ",") {
+				s = strings.TrimSpace(s)
+				if s != "" && s != "to-read" && s != "currently-reading" && s != "read" && !strings.EqualFold(s, pr.ExclusiveShelfSlug) {
+					pr.CustomShelves = append(pr.CustomShelves, s)
+				}
+			}
+		}
+
+		rows = append(rows, pr)
+	}
+	return rows, nil
+}
+
+func mapGoodreadsShelf(shelf string) string {
+	switch strings.ToLower(shelf) {
+	case "to-read":
+		return "want-to-read"
+	case "currently-reading":
+		return "currently-reading"
+	case "read":
+		return "finished"
+	// Custom exclusive shelves, as rosslib's Goodreads export writes them.
+	case "did-not-finish", "dnf":
+		return "dnf"
+	case "owned":
+		return "owned"
+	default:
+		return ""
+	}
+}
+
+// cleanGoodreadsTitle strips junk that Goodreads CSV titles commonly include.
+//
+// Examples:
+//
+//	"Children of Ruin (Children of Time, #2)" → "Children of Ruin"
+//	"Skunk Works: A Personal Memoir of My Years at Lockheed" → "Skunk Works"
+//	"Red Harvest by Dashiell Hammett (July 17 1989)" → "Red Harvest"
+//	"All Men Are Brothers by Gandhi,Mohandas K.. [2005] Paperback" → "All Men Are Brothers"
+//	"Man Plus (S.F. MASTERWORKS) by Pohl, Frederik New Edition (2000)" → "Man Plus"
+//	"Survival in Auschwitz[SURVIVAL IN AUSCHWITZ][Paperback]" → "Survival in Auschwitz"
+//	"The Wealth of Nations/Books I-III" → "The Wealth of Nations"
+//	"Destinies, Feb 1980 | The Science Fiction Magazine" → "Destinies"
+//	"[(The Soul of a Butterfly)] [by: Muhammad Ali]" → "The Soul of a Butterfly"
+func cleanGoodreadsTitle(title string) string {
+	// Strip [ and ] characters but keep inner content. This handles both
+	// metadata tags like [Hardcover] and decorative brackets like [(Title)].
+	// The inner content (format words, repeated titles, etc.) is cleaned
+	// by the later steps.
+	title = strings.NewReplacer("[", "", "]", "").Replace(title)
+	title = strings.TrimSpace(title)
+
+	// Strip everything from " by " or " by:" onward (embedded author/edition info).
+	// Only strip if " by" appears after at least two words so we don't break
+	// titles like "Stand by Me".
+	lower := strings.ToLower(title)
+	for _, sep := range []string{" by ", " by:"} {
+		if idx := strings.Index(lower, sep); idx > 0 {
+			before := strings.TrimSpace(title[:idx])
+			if strings.Contains(before, " ") {
+				title = before
+				break
+			}
+		}
+	}
+
+	// Strip leading "By Author Name " prefix when title starts with "By "
+	// and the real title follows. Detect by checking if stripping "By <words>"
+	// still leaves a multi-word remainder.
+	if strings.HasPrefix(title, "By ") {
+		rest := title[3:]
+		for _, sep := range []string{" The ", " A ", " An "} {
+			if idx := strings.Index(rest, sep); idx > 0 {
+				candidate := strings.TrimSpace(rest[idx:])
+				if len(candidate) > 3 {
+					title = candidate
+					break
+				}
+			}
+		}
+	}
+
+	// Strip trailing parenthetical content: "(Series Name, #N)", "(2000)", etc.
+	// Repeat to handle nested cases like "Title (A) by Author (2000)"
+	for {
+		idx := strings.LastIndex(title, "(")
+		if idx <= 0 {
+			break
+		}
+		title = strings.TrimSpace(title[:idx])
+	}
+
+	// Strip wrapping parens left over from decorative brackets: "(Title)" → "Title"
+	if strings.HasPrefix(title, "(") && strings.HasSuffix(title, ")") {
+		title = title[1 : len(title)-1]
+	}
+
+	// Strip " | " pipe-separated subtitles
+	if idx := strings.Index(title, " | "); idx > 0 {
+		title = strings.TrimSpace(title[:idx])
+	}
+	if idx := strings.Index(title, "|"); idx > 0 {
+		title = strings.TrimSpace(title[:idx])
+	}
+
+	// Strip "/subtitle" (but not mid-word slashes)
+	if idx := strings.Index(title, "/"); idx > 0 {
+		title = strings.TrimSpace(title[:idx])
+	}
+
+	// Strip subtitle after colon
+	if idx := strings.Index(title, ":"); idx > 0 {
+		title = strings.TrimSpace(title[:idx])
+	}
+
+	// Strip trailing junk words: "Paperback", "Hardcover", "Mass Market", edition years
+	for {
+		trimmed := strings.TrimRight(title, " .,")
+		changed := false
+		for _, suffix := range []string{"Paperback", "Hardcover", "Mass Market"} {
+			if strings.HasSuffix(trimmed, suffix) {
+				trimmed = strings.TrimSpace(trimmed[:len(trimmed)-len(suffix)])
+				changed = true
+			}
+		}
+		title = trimmed
+		if !changed {
+			break
+		}
+	}
+
+	return strings.TrimSpace(title)
+}
+
+// cleanGoodreadsAuthor returns a cleaned author name suitable for OL search,
+// or empty string if the author should be skipped (unknown, mangled, etc.).
+func cleanGoodreadsAuthor(author string) string {
+	author = strings.TrimSpace(author)
+	if author == "" {
+		return ""
+	}
+
+	lower := strings.ToLower(author)
+
+	// Skip placeholder/unknown authors
+	if lower == "unknown author" || lower == "unknown" || lower == "various" || lower == "anonymous" {
+		return ""
+	}
+
+	// Skip mangled multi-author with semicolons ("Leo ; Bradbury Margulies")
+	if strings.Contains(author, ";") {
+		return ""
+	}
+
+	// Skip concatenated names with no space ("PrimoLevi") — real names have spaces
+	if !strings.Contains(author, " ") && len(author) > 1 {
+		return ""
+	}
+
+	// Strip single-letter middle initials: "Balaji S. Srinivasan" → "Balaji Srinivasan"
+	// OL often doesn't index middle initials.
+	parts := strings.Fields(author)
+	var cleaned []string
+	for _, p := range parts {
+		trimmed := strings.TrimRight(p, ".")
+		if len(trimmed) == 1 && trimmed == strings.ToUpper(trimmed) {
+			continue // skip single-letter initials
+		}
+		cleaned = append(cleaned, p)
+	}
+	if len(cleaned) > 0 {
+		author = strings.Join(cleaned, " ")
+	}
+
+	return author
+}
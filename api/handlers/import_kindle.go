@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() { registerImporter(kindleImporter{}) }
+
+// kindleImporter reads the "My Clippings.txt" file on Kindle devices.
+type kindleImporter struct{}
+
+func (kindleImporter) Source() string                   { return "kindle" }
+func (kindleImporter) FuzzyMatch() bool                 { return true }
+func (kindleImporter) Status(string) string             { return "" }
+func (kindleImporter) CleanTitle(title string) string   { return cleanLibraryThingTitle(title) }
+func (kindleImporter) CleanAuthor(author string) string { return cleanGoodreadsAuthor(author) }
+
+// kindleClippingSeparator ends every clipping.
+const kindleClippingSeparator = "=========="
+
+var (
+	// "- Your Highlight on page 12 | Location 170-172 | Added on Sunday, January 14, 2024 10:15:32 PM"
+	// Older devices say "Highlight Loc." and omit "Your".
+	kindleMetaRe     = regexp.MustCompile(`(?i)^-\s*(?:Your\s+)?(Highlight|Note|Bookmark)\b(.*?)(?:\|\s*Added on\s+(.+))?$`)
+	kindlePageRe     = regexp.MustCompile(`(?i)\bpage\s+(\d+)`)
+	kindleLocationRe = regexp.MustCompile(`(?i)\b(?:location|loc\.)\s+(\d+(?:-\d+)?)`)
+	kindleAuthorRe   = regexp.MustCompile(`^(.*)\(([^()]*)\)\s*$`)
+)
+
+// kindleDateLayouts cover the English date formats Kindles write.
+var kindleDateLayouts = []string{
+	"Monday, January 2, 2006 3:04:05 PM",
+	"Monday, 2 January 2006 15:04:05",
+	"Monday, January 2, 2006, 3:04 PM",
+	"January 2, 2006 3:04:05 PM",
+}
+
+func (kindleImporter) Parse(r io.Reader) ([]ImportRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var books highlightBooks
+	var notes []kindleNote
+	var clipping []string
+	parsed := 0
+	flush := func() {
+		defer func() { clipping = clipping[:0] }()
+		if len(clipping) < 2 {
+			return
+		}
+		m := kindleMetaRe.FindStringSubmatch(strings.TrimSpace(clipping[1]))
+		if m == nil {
+			return
+		}
+		parsed++
+		title, author := splitKindleTitle(clipping[0])
+		book := books.book(title, author, "")
+
+		h := importHighlight{
+			Text: strings.TrimSpace(strings.Join(clipping[2:], "\n")),
+			Date: highlightDate(parseKindleDate(m[3])),
+		}
+		if pm := kindlePageRe.FindStringSubmatch(m[2]); pm != nil {
+			h.Page, _ = strconv.Atoi(pm[1])
+		}
+		if lm := kindleLocationRe.FindStringSubmatch(m[2]); lm != nil {
+			h.Location = lm[1]
+			h.start, h.end = parseHighlightLocation(lm[1])
+		}
+
+		switch strings.ToLower(m[1]) {
+		case "highlight":
+			book.highlights = append(book.highlights, h)
+		case "note":
+			notes = append(notes, kindleNote{book: book, highlight: h})
+		}
+	}
+
+	for scanner.Scan() {
+		// Kindles start each clipping with a byte order mark and end lines
+		// with CRLF.
+		line := strings.TrimRight(strings.TrimPrefix(scanner.Text(), "\uFEFF"), "\r")
+		if strings.TrimSpace(line) == kindleClippingSeparator {
+			flush()
+			continue
+		}
+		if len(clipping) == 0 && strings.TrimSpace(line) == "" {
+			continue
+		}
+		// The blank line between a clipping's header and its text.
+		if len(clipping) == 2 && strings.TrimSpace(line) == "" {
+			continue
+		}
+		clipping = append(clipping, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.New("Invalid clippings file")
+	}
+	flush()
+	if parsed == 0 {
+		return nil, errors.New("No clippings found")
+	}
+
+	for _, n := range notes {
+		attachKindleNote(n)
+	}
+	return highlightRows(books.order), nil
+}
+
+// kindleNote is a note clipping waiting to be attached to its highlight.
+type kindleNote struct {
+	book      *highlightBook
+	highlight importHighlight
+}
+
+// attachKindleNote puts a note on the highlight it was written at: Kindles
+// record notes at the highlight's last location. Notes without a highlight
+// to attach to are dropped, since a quote needs highlighted text.
+func attachKindleNote(n kindleNote) {
+	loc := n.highlight.start
+	for i := len(n.book.highlights) - 1; i >= 0; i-- {
+		h := &n.book.highlights[i]
+		if loc == 0 || h.start == 0 || loc < h.start || loc > h.end {
+			continue
+		}
+		if h.Note == "" {
+			h.Note = n.highlight.Text
+		} else {
+			h.Note += "\n" + n.highlight.Text
+		}
+		return
+	}
+}
+
+// splitKindleTitle splits "Title (Author)" clipping headers. Authors in
+// "Last, First" form are reversed, and only the first of several
+// semicolon-separated authors is kept.
+func splitKindleTitle(line string) (title, author string) {
+	line = strings.TrimSpace(line)
+	m := kindleAuthorRe.FindStringSubmatch(line)
+	if m == nil || strings.TrimSpace(m[1]) == "" {
+		return line, ""
+	}
+	author, _, _ = strings.Cut(m[2], ";")
+	return strings.TrimSpace(m[1]), cleanLibraryThingAuthor(author)
+}
+
+func parseKindleDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range kindleDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
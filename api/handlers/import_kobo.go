@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tristansaldanha/rosslib/api/isbn"
+)
+
+func init() { registerImporter(koboImporter{}) }
+
+// koboImporter reads highlights from KoboReader.sqlite, the database in
+// the .kobo folder of a Kobo e-reader.
+type koboImporter struct{}
+
+func (koboImporter) Source() string                   { return "kobo" }
+func (koboImporter) FuzzyMatch() bool                 { return true }
+func (koboImporter) Status(string) string             { return "" }
+func (koboImporter) CleanTitle(title string) string   { return cleanLibraryThingTitle(title) }
+func (koboImporter) CleanAuthor(author string) string { return cleanGoodreadsAuthor(author) }
+
+// koboDateLayouts are the timestamp formats Kobo firmware has used.
+var koboDateLayouts = []string{
+	"2006-01-02T15:04:05.000",
+	"2006-01-02T15:04:05Z",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+}
+
+func (koboImporter) Parse(r io.Reader) ([]ImportRow, error) {
+	invalid := errors.New("Invalid Kobo database")
+	db, closeDB, err := openImportDB(r)
+	if err != nil {
+		return nil, invalid
+	}
+	defer closeDB()
+
+	// Bookmark rows are annotations; the book they belong to is the
+	// content row with ContentType 6. Dog-ears have no text.
+	rows, err := db.Query(`
+		SELECT COALESCE(c.Title, ''), COALESCE(c.Attribution, ''), COALESCE(c.ISBN, ''),
+			   b.Text, COALESCE(b.Annotation, ''), COALESCE(b.DateCreated, '')
+		FROM Bookmark b
+		JOIN content c ON c.ContentID = b.VolumeID AND c.ContentType = 6
+		WHERE b.Text IS NOT NULL AND TRIM(b.Text) != ''
+		ORDER BY b.VolumeID, b.ChapterProgress, b.DateCreated
+	`)
+	if err != nil {
+		return nil, invalid
+	}
+	defer rows.Close()
+
+	var books highlightBooks
+	for rows.Next() {
+		var title, author, rawISBN, text, annotation, created string
+		if err := rows.Scan(&title, &author, &rawISBN, &text, &annotation, &created); err != nil {
+			return nil, invalid
+		}
+		author, _, _ = strings.Cut(author, ",")
+		book := books.book(strings.TrimSpace(title), strings.TrimSpace(author), isbn.Normalize(rawISBN))
+		book.highlights = append(book.highlights, importHighlight{
+			Text: text,
+			Note: annotation,
+			Date: highlightDate(parseKoboDate(created)),
+		})
+	}
+	if rows.Err() != nil {
+		return nil, invalid
+	}
+	if len(books.order) == 0 {
+		return nil, errors.New("No highlights found")
+	}
+	return highlightRows(books.order), nil
+}
+
+func parseKoboDate(s string) time.Time {
+	for _, layout := range koboDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
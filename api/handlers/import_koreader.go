@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() { registerImporter(koReaderImporter{}) }
+
+// koReaderImporter reads the JSON written by KOReader's Export highlights
+// plugin: one book object, or {"documents": [...]} when exporting all books.
+type koReaderImporter struct{}
+
+func (koReaderImporter) Source() string                   { return "koreader" }
+func (koReaderImporter) FuzzyMatch() bool                 { return true }
+func (koReaderImporter) Status(string) string             { return "" }
+func (koReaderImporter) CleanTitle(title string) string   { return cleanLibraryThingTitle(title) }
+func (koReaderImporter) CleanAuthor(author string) string { return cleanGoodreadsAuthor(author) }
+
+type koReaderDocument struct {
+	Title   string          `json:"title"`
+	Author  string          `json:"author"`
+	Entries []koReaderEntry `json:"entries"`
+}
+
+type koReaderEntry struct {
+	Text string          `json:"text"`
+	Note string          `json:"note"`
+	Page json.RawMessage `json:"page"` // a number, or a string for reflowed documents
+	Time int64           `json:"time"` // unix seconds
+	Sort string          `json:"sort"` // "highlight", "note" or "bookmark"
+}
+
+func (koReaderImporter) Parse(r io.Reader) ([]ImportRow, error) {
+	invalid := errors.New("Invalid KOReader export")
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, invalid
+	}
+
+	var docs []koReaderDocument
+	var all struct {
+		Documents []koReaderDocument `json:"documents"`
+	}
+	switch {
+	case json.Unmarshal(raw, &docs) == nil:
+	case json.Unmarshal(raw, &all) == nil && all.Documents != nil:
+		docs = all.Documents
+	default:
+		var doc koReaderDocument
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, invalid
+		}
+		docs = []koReaderDocument{doc}
+	}
+
+	var books highlightBooks
+	for _, d := range docs {
+		if strings.TrimSpace(d.Title) == "" {
+			continue
+		}
+		// KOReader joins several authors with newlines.
+		author, _, _ := strings.Cut(d.Author, "\n")
+		book := books.book(strings.TrimSpace(d.Title), strings.TrimSpace(author), "")
+		for _, e := range d.Entries {
+			if e.Sort == "bookmark" {
+				continue
+			}
+			h := importHighlight{Text: e.Text, Note: e.Note, Page: koReaderPage(e.Page)}
+			if e.Time > 0 {
+				h.Date = highlightDate(time.Unix(e.Time, 0))
+			}
+			book.highlights = append(book.highlights, h)
+		}
+	}
+	if len(books.order) == 0 {
+		return nil, errors.New("No highlights found")
+	}
+	return highlightRows(books.order), nil
+}
+
+// koReaderPage reads an entry's page, which is 0 when it isn't a number.
+func koReaderPage(raw json.RawMessage) int {
+	s := strings.Trim(string(raw), `"`)
+	n, _ := strconv.Atoi(s)
+	return n
+}
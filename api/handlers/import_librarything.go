@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/tristansaldanha/rosslib/api/isbn"
+)
+
+func init() { registerImporter(libraryThingImporter{}) }
+
+// libraryThingImporter reads LibraryThing's tab-separated export.
+type libraryThingImporter struct{}
+
+func (libraryThingImporter) Source() string                 { return "librarything" }
+func (libraryThingImporter) FuzzyMatch() bool               { return false }
+func (libraryThingImporter) Status(shelf string) string     { return mapLibraryThingStatusSlug(shelf) }
+func (libraryThingImporter) CleanTitle(title string) string { return cleanLibraryThingTitle(title) }
+func (libraryThingImporter) CleanAuthor(author string) string {
+	return cleanLibraryThingSearchAuthor(author)
+}
+
+// libraryThingStatusCollections are the Collections that set a status
+// rather than becoming custom shelves.
+var libraryThingStatusCollections = map[string]bool{
+	"currently reading": true, "to read": true, "wishlist": true,
+	"read but unowned": true, "your library": true,
+}
+
+func (libraryThingImporter) Parse(r io.Reader) ([]ImportRow, error) {
+	// LibraryThing exports use tab-separated values
+	reader := csv.NewReader(r)
+	reader.Comma = '\t'
+	reader.LazyQuotes = true
+	t, err := readImportTable(reader, "Invalid CSV/TSV")
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]ImportRow, 0, len(t.rows))
+	for _, row := range t.rows {
+		pr := ImportRow{Title: t.get(row, "Title")}
+
+		// LibraryThing uses "Author (First, Last)" — convert "Last, First" to "First Last"
+		rawAuthor := t.get(row, "Author (First, Last)")
+		if rawAuthor == "" {
+			rawAuthor = t.get(row, "Author (Last, First)")
+		}
+		pr.Author = cleanLibraryThingAuthor(rawAuthor)
+
+		// ISBN — LT may use "ISBN" or "ISBNs" columns (the latter may
+		// list several); take the first one that validates.
+		pr.ISBN13 = isbn.Normalize(t.get(row, "ISBN"))
+		if pr.ISBN13 == "" {
+			pr.ISBN13 = isbn.First(strings.NewReplacer("[", " ", "]", " ").Replace(t.get(row, "ISBNs")))
+		}
+
+		// Rating — LT uses 0-5 scale (sometimes 0-10 with halves)
+		if r, err := strconv.ParseFloat(t.get(row, "Rating"), 64); err == nil && r > 0 {
+			// LT ratings > 5 are on a 10-point scale; normalize to 5
+			if r > 5 {
+				r = r / 2.0
+			}
+			pr.Rating = &r
+		}
+
+		if review := t.get(row, "Review"); review != "" {
+			pr.ReviewText = &review
+		}
+
+		// Date Read
+		if dr := t.get(row, "Date Read"); dr != "" {
+			pr.DateRead = &dr
+		}
+
+		// Date Added (LT uses "Entry Date")
+		if da := t.get(row, "Entry Date"); da != "" {
+			pr.DateAdded = &da
+		}
+
+		// Map status from Collections
+		collections := t.get(row, "Collections")
+		pr.ExclusiveShelfSlug = mapLibraryThingStatus(collections, pr.DateRead != nil)
+
+		// Parse Collections and Tags (both comma-separated) as custom shelves
+		if collections != "" {
+			for _, c := range strings.Split(collections, ",") {
+				c = strings.TrimSpace(c)
+				if c != "" && !libraryThingStatusCollections[strings.ToLower(c)] {
+					pr.CustomShelves = append(pr.CustomShelves, c)
+				}
+			}
+		}
+		if tags := t.get(row, "Tags"); tags != "" {
+			for _, tag := range strings.Split(tags, ",") {
+				tag = strings.TrimSpace(tag)
+				if tag != "" {
+					pr.CustomShelves = append(pr.CustomShelves, tag)
+				}
+			}
+		}
+
+		rows = append(rows, pr)
+	}
+	return rows, nil
+}
+
+// mapLibraryThingStatus determines the exclusive shelf slug from LT Collections.
+// LibraryThing collections: "Currently Reading" → currently-reading,
+// "To Read"/"Wishlist" → to-read, "Read but unowned"/has date read → read.
+func mapLibraryThingStatus(collections string, hasDateRead bool) string {
+	lower := strings.ToLower(collections)
+	if strings.Contains(lower, "currently reading") {
+		return "currently-reading"
+	}
+	if strings.Contains(lower, "to read") || strings.Contains(lower, "wishlist") {
+		return "to-read"
+	}
+	if strings.Contains(lower, "read but unowned") || hasDateRead {
+		return "read"
+	}
+	return ""
+}
+
+// mapLibraryThingStatusSlug maps the LT exclusive shelf slug to internal status.
+func mapLibraryThingStatusSlug(slug string) string {
+	switch strings.ToLower(strings.TrimSpace(slug)) {
+	case "to-read":
+		return "want-to-read"
+	case "currently-reading":
+		return "currently-reading"
+	case "read":
+		return "finished"
+	default:
+		return ""
+	}
+}
+
+// cleanLibraryThingAuthor converts "Last, First" format to "First Last".
+func cleanLibraryThingAuthor(author string) string {
+	author = strings.TrimSpace(author)
+	if author == "" {
+		return ""
+	}
+	// LT format is typically "Last, First" — reverse it
+	if idx := strings.Index(author, ","); idx > 0 {
+		last := strings.TrimSpace(author[:idx])
+		first := strings.TrimSpace(author[idx+1:])
+		if first != "" && last != "" {
+			return first + " " + last
+		}
+	}
+	return author
+}
+
+// cleanLibraryThingTitle strips subtitle/series info from LT titles.
+func cleanLibraryThingTitle(title string) string {
+	title = strings.TrimSpace(title)
+
+	// Strip trailing parenthetical (series info)
+	for {
+		idx := strings.LastIndex(title, "(")
+		if idx <= 0 {
+			break
+		}
+		title = strings.TrimSpace(title[:idx])
+	}
+
+	// Strip subtitle after colon
+	if idx := strings.Index(title, ":"); idx > 0 {
+		title = strings.TrimSpace(title[:idx])
+	}
+
+	return strings.TrimSpace(title)
+}
+
+// cleanLibraryThingSearchAuthor returns a cleaned author suitable for OL search.
+func cleanLibraryThingSearchAuthor(author string) string {
+	author = strings.TrimSpace(author)
+	if author == "" {
+		return ""
+	}
+
+	lower := strings.ToLower(author)
+	if lower == "unknown" || lower == "anonymous" || lower == "various" {
+		return ""
+	}
+
+	return author
+}
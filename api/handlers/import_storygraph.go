@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/tristansaldanha/rosslib/api/isbn"
+)
+
+func init() { registerImporter(storyGraphImporter{}) }
+
+// storyGraphImporter reads StoryGraph's CSV export.
+type storyGraphImporter struct{}
+
+func (storyGraphImporter) Source() string                   { return "storygraph" }
+func (storyGraphImporter) FuzzyMatch() bool                 { return true }
+func (storyGraphImporter) Status(shelf string) string       { return mapStoryGraphStatus(shelf) }
+func (storyGraphImporter) CleanTitle(title string) string   { return cleanStoryGraphTitle(title) }
+func (storyGraphImporter) CleanAuthor(author string) string { return cleanStoryGraphAuthor(author) }
+
+func (storyGraphImporter) Parse(r io.Reader) ([]ImportRow, error) {
+	t, err := readImportTable(csv.NewReader(r), "Invalid CSV")
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]ImportRow, 0, len(t.rows))
+	for _, row := range t.rows {
+		pr := ImportRow{
+			Title:  t.get(row, "Title"),
+			Author: t.get(row, "Authors"),
+		}
+
+		// StoryGraph uses "ISBN/UID" column; UIDs for books without an
+		// ISBN don't parse and are dropped.
+		pr.ISBN13 = isbn.Normalize(t.get(row, "ISBN/UID"))
+
+		// Map StoryGraph read status; unread books marked owned are Owned.
+		pr.ExclusiveShelfSlug = strings.ToLower(t.get(row, "Read Status"))
+		if pr.ExclusiveShelfSlug == "to-read" && strings.EqualFold(t.get(row, "Owned?"), "yes") {
+			pr.ExclusiveShelfSlug = "owned"
+		}
+
+		if r, err := strconv.ParseFloat(t.get(row, "Star Rating"), 64); err == nil && r > 0 {
+			pr.Rating = &r
+		}
+		if review := t.get(row, "Review"); review != "" {
+			pr.ReviewText = &review
+		}
+
+		// Use Last Date Read, or the last of Dates Read ("Read Dates" in
+		// older exports) — a list of reads, each a range
+		// "2024/01/15-2024/02/20" or a single date
+		dates := t.get(row, "Last Date Read")
+		if dates == "" {
+			dates = t.get(row, "Dates Read")
+		}
+		if dates == "" {
+			dates = t.get(row, "Read Dates")
+		}
+		if dates != "" {
+			reads := strings.Split(dates, ",")
+			parts := strings.SplitN(reads[len(reads)-1], "-", 2)
+			// Take the last date as date_read (finish date)
+			lastDate := strings.TrimSpace(parts[len(parts)-1])
+			if lastDate != "" {
+				// Normalize slashes to dashes for consistency
+				lastDate = strings.ReplaceAll(lastDate, "/", "-")
+				pr.DateRead = &lastDate
+			}
+		}
+		if da := t.get(row, "Date Added"); da != "" {
+			pr.DateAdded = &da
+		}
+
+		// Parse Tags column — comma-separated tags become custom shelves
+		if tags := t.get(row, "Tags"); tags != "" {
+			for _, tag := range strings.Split(tags, ",") {
+				tag = strings.TrimSpace(tag)
+				if tag != "" {
+					pr.CustomShelves = append(pr.CustomShelves, tag)
+				}
+			}
+		}
+
+		rows = append(rows, pr)
+	}
+	return rows, nil
+}
+
+func mapStoryGraphStatus(status string) string {
+	switch strings.ToLower(strings.TrimSpace(status)) {
+	case "to-read":
+		return "want-to-read"
+	case "currently-reading":
+		return "currently-reading"
+	case "read":
+		return "finished"
+	case "did-not-finish":
+		return "dnf"
+	case "owned":
+		return "owned"
+	default:
+		return ""
+	}
+}
+
+// cleanStoryGraphTitle strips subtitle/series info from StoryGraph titles.
+// StoryGraph titles are generally cleaner than Goodreads but may include subtitles.
+func cleanStoryGraphTitle(title string) string {
+	title = strings.TrimSpace(title)
+
+	// Strip trailing parenthetical (series info)
+	for {
+		idx := strings.LastIndex(title, "(")
+		if idx <= 0 {
+			break
+		}
+		title = strings.TrimSpace(title[:idx])
+	}
+
+	// Strip subtitle after colon
+	if idx := strings.Index(title, ":"); idx > 0 {
+		title = strings.TrimSpace(title[:idx])
+	}
+
+	return strings.TrimSpace(title)
+}
+
+// cleanStoryGraphAuthor returns a cleaned author name for OL search.
+// StoryGraph may list multiple authors comma-separated; use the first.
+func cleanStoryGraphAuthor(author string) string {
+	author = strings.TrimSpace(author)
+	if author == "" {
+		return ""
+	}
+
+	// Take first author if comma-separated
+	if idx := strings.Index(author, ","); idx > 0 {
+		author = strings.TrimSpace(author[:idx])
+	}
+
+	return author
+}
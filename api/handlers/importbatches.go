@@ -0,0 +1,508 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/tristansaldanha/rosslib/api/store"
+)
+
+// importTracked are the collections an import batch records changes to, in
+// the order they're logged. Reverts replay the log backwards, so records
+// are deleted before the records they point at.
+var importTracked = []string{"tag_keys", "tag_values", "user_books", "book_tag_values", "book_quotes"}
+
+// importUntracked are fields left out when deciding whether a record changed.
+var importUntracked = []string{"created", "updated", "import_batch"}
+
+// importBatch is the provenance of one import commit. Every tracked record
+// the commit creates, changes or deletes gets a row in import_changes with
+// its values before and after, and created or changed records are stamped
+// with the batch id. Pending imports are only stamped; reverting deletes them.
+type importBatch struct {
+	app    core.App
+	record *core.Record
+	userID string
+	seq    int
+	// tags holds the user's tag_keys and tag_values, loaded on the first
+	// track and topped up with the rows added since (imports only ever add
+	// tags), so tracking a row doesn't re-read every tag the user has.
+	// tagsRowid is the highest rowid loaded per collection.
+	tags      importSnapshot
+	tagsRowid map[string]int64
+}
+
+// newImportBatch starts a batch for a commit about to run.
+func newImportBatch(app core.App, userID, source, jobID string) (*importBatch, error) {
+	coll, err := app.FindCollectionByNameOrId("import_batches")
+	if err != nil {
+		return nil, err
+	}
+	rec := core.NewRecord(coll)
+	rec.Set("user", userID)
+	rec.Set("source", source)
+	rec.Set("job", jobID)
+	rec.Set("status", "committing")
+	if err := app.Save(rec); err != nil {
+		return nil, err
+	}
+	return &importBatch{app: app, record: rec, userID: userID}, nil
+}
+
+// loadImportBatch reopens a batch to carry on committing into it, as a
+// resumed import job does.
+func loadImportBatch(app core.App, id string) (*importBatch, error) {
+	rec, err := app.FindRecordById("import_batches", id)
+	if err != nil {
+		return nil, err
+	}
+	var last struct {
+		Seq int `db:"seq"`
+	}
+	err = app.DB().NewQuery(`SELECT COALESCE(MAX(seq), 0) AS seq FROM import_changes WHERE batch = {:batch}`).
+		Bind(map[string]any{"batch": id}).One(&last)
+	if err != nil {
+		return nil, err
+	}
+	return &importBatch{app: app, record: rec, userID: rec.GetString("user"), seq: last.Seq}, nil
+}
+
+// finish records the commit's outcome and makes the batch revertible.
+func (b *importBatch) finish(result importResult) error {
+	b.record.Set("status", "committed")
+	b.record.Set("imported", result.Imported)
+	b.record.Set("failed", result.Failed)
+	b.record.Set("pending_saved", result.PendingSaved)
+	b.record.Set("committed_at", types.NowDateTime())
+	return b.app.Save(b.record)
+}
+
+// importSnapshot is the state of a user's tracked records, keyed by
+// collection and id.
+type importSnapshot map[[2]string]*core.Record
+
+// snapshot returns the user's tags, plus their shelf entry, tag assignments
+// and quotes for bookID when it is set.
+func (b *importBatch) snapshot(bookID string) (importSnapshot, error) {
+	if err := b.loadTags(); err != nil {
+		return nil, err
+	}
+	snap := make(importSnapshot, len(b.tags))
+	for key, r := range b.tags {
+		snap[key] = r
+	}
+	if bookID == "" {
+		return snap, nil
+	}
+	params := map[string]any{"user": b.userID, "book": bookID}
+	for _, coll := range []string{"user_books", "book_tag_values", "book_quotes"} {
+		records, err := b.app.FindRecordsByFilter(coll, "user = {:user} && book = {:book}", "", 0, 0, params)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			snap[[2]string{coll, r.Id}] = r
+		}
+	}
+	return snap, nil
+}
+
+// loadTags adds the user's tags created since the last call to b.tags.
+func (b *importBatch) loadTags() error {
+	if b.tags == nil {
+		b.tags = importSnapshot{}
+		b.tagsRowid = map[string]int64{}
+	}
+	queries := []struct {
+		collection string
+		sql        string
+	}{
+		{"tag_keys", `SELECT id, rowid FROM tag_keys WHERE user = {:user} AND rowid > {:after} ORDER BY rowid`},
+		{"tag_values", `
+			SELECT tv.id, tv.rowid FROM tag_values tv
+			JOIN tag_keys tk ON tk.id = tv.tag_key
+			WHERE tk.user = {:user} AND tv.rowid > {:after}
+			ORDER BY tv.rowid`},
+	}
+	for _, q := range queries {
+		var rows []struct {
+			ID    string `db:"id"`
+			Rowid int64  `db:"rowid"`
+		}
+		err := b.app.DB().NewQuery(q.sql).
+			Bind(map[string]any{"user": b.userID, "after": b.tagsRowid[q.collection]}).All(&rows)
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			continue
+		}
+		ids := make([]string, len(rows))
+		for i, r := range rows {
+			ids[i] = r.ID
+		}
+		records, err := b.app.FindRecordsByIds(q.collection, ids)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			b.tags[[2]string{q.collection, r.Id}] = r
+		}
+		b.tagsRowid[q.collection] = rows[len(rows)-1].Rowid
+	}
+	return nil
+}
+
+// track runs fn and logs how it changed the user's tracked records (see
+// snapshot for which). An error from fn is returned once the changes it
+// made before failing have been logged.
+func (b *importBatch) track(bookID string, fn func() error) error {
+	before, err := b.snapshot(bookID)
+	if err != nil {
+		return err
+	}
+	fnErr := fn()
+	after, err := b.snapshot(bookID)
+	if err != nil {
+		return err
+	}
+
+	// Changed and deleted records first, then created ones, so a revert
+	// clears the new records out of the way before restoring the old.
+	for _, action := range []string{"updated", "deleted", "created"} {
+		for _, coll := range importTracked {
+			for key, prev := range before {
+				if key[0] != coll {
+					continue
+				}
+				cur, ok := after[key]
+				switch {
+				case action == "deleted" && !ok:
+					err = b.log(coll, prev.Id, "deleted", prev, nil)
+				case action == "updated" && ok && importRecordChanged(prev, cur):
+					err = b.log(coll, prev.Id, "updated", prev, cur)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if action != "created" {
+				continue
+			}
+			for key, cur := range after {
+				if key[0] != coll {
+					continue
+				}
+				if _, ok := before[key]; !ok {
+					if err := b.log(coll, cur.Id, "created", nil, cur); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return fnErr
+}
+
+// log writes one change and stamps surviving records with the batch. prev
+// is nil for a created record and cur for a deleted one.
+func (b *importBatch) log(collection, recordID, action string, prev, cur *core.Record) error {
+	coll, err := b.app.FindCollectionByNameOrId("import_changes")
+	if err != nil {
+		return err
+	}
+	b.seq++
+	change := core.NewRecord(coll)
+	change.Set("batch", b.record.Id)
+	change.Set("seq", b.seq)
+	change.Set("collection", collection)
+	change.Set("record", recordID)
+	change.Set("action", action)
+	if prev != nil {
+		change.Set("before", prev.FieldsData())
+	}
+	if cur != nil {
+		change.Set("after", cur.FieldsData())
+	}
+	if err := b.app.Save(change); err != nil {
+		return err
+	}
+
+	if action == "deleted" {
+		return nil
+	}
+	// Raw SQL so stamping doesn't run record hooks a second time.
+	_, err = b.app.DB().NewQuery("UPDATE " + collection + " SET import_batch = {:batch} WHERE id = {:id}").
+		Bind(map[string]any{"batch": b.record.Id, "id": recordID}).Execute()
+	return err
+}
+
+// importRecordChanged reports whether a record's tracked fields differ.
+func importRecordChanged(prev, cur *core.Record) bool {
+	return !maps.Equal(importFields(prev.FieldsData()), importFields(cur.FieldsData()))
+}
+
+// importFields returns the tracked fields of a record's data, or of the data
+// logged for it in import_changes, each encoded as JSON so that the two
+// compare alike.
+func importFields(data map[string]any) map[string]string {
+	raw, _ := json.Marshal(data)
+	var values map[string]any
+	_ = json.Unmarshal(raw, &values)
+	fields := make(map[string]string, len(values))
+	for k, v := range values {
+		if k == "id" || slices.Contains(importUntracked, k) {
+			continue
+		}
+		encoded, _ := json.Marshal(v)
+		fields[k] = string(encoded)
+	}
+	return fields
+}
+
+// errImportBatchOverlap means a later import changed records this batch
+// also changed, so reverting it first would undo part of the later one.
+var errImportBatchOverlap = errors.New("overlapping import")
+
+// revertImportBatch undoes a batch's changes in one transaction. Records the
+// batch created are deleted (tags only when nothing uses them any more),
+// records it changed get back the fields it changed, and records it deleted
+// are recreated. A record that no longer is as the batch left it, because
+// the user edited or deleted it since, is kept as it is; kept is how many
+// such records there were.
+func revertImportBatch(app core.App, batch *core.Record) (kept int, err error) {
+	var overlap struct {
+		N int `db:"n"`
+	}
+	err = app.DB().NewQuery(`
+		SELECT COUNT(*) AS n
+		FROM import_changes later
+		JOIN import_batches lb ON lb.id = later.batch
+		WHERE lb.user = {:user} AND lb.status != 'reverted' AND lb.id != {:batch}
+		  AND lb.created > {:created}
+		  AND later.record IN (SELECT record FROM import_changes WHERE batch = {:batch})
+	`).Bind(map[string]any{
+		"user":    batch.GetString("user"),
+		"batch":   batch.Id,
+		"created": batch.GetString("created"),
+	}).One(&overlap)
+	if err != nil {
+		return 0, err
+	}
+	if overlap.N > 0 {
+		return 0, errImportBatchOverlap
+	}
+
+	changes, err := app.FindRecordsByFilter("import_changes",
+		"batch = {:batch}", "-seq", 0, 0,
+		map[string]any{"batch": batch.Id},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		// Records kept as the user has them, by collection and id. Their
+		// earlier changes in the batch are skipped too.
+		keep := map[[2]string]bool{}
+		for _, change := range changes {
+			coll := change.GetString("collection")
+			id := change.GetString("record")
+			action := change.GetString("action")
+			if keep[[2]string{coll, id}] {
+				continue
+			}
+
+			var before, after map[string]any
+			if err := change.UnmarshalJSONField("before", &before); err != nil {
+				return err
+			}
+			if err := change.UnmarshalJSONField("after", &after); err != nil {
+				return err
+			}
+
+			rec, findErr := txApp.FindRecordById(coll, id)
+			if action == "deleted" {
+				if findErr == nil {
+					continue // already back
+				}
+				collection, err := txApp.FindCollectionByNameOrId(coll)
+				if err != nil {
+					return err
+				}
+				rec = core.NewRecord(collection)
+				rec.Id = id
+				for k, v := range before {
+					if k != "id" {
+						rec.Set(k, v)
+					}
+				}
+				if err := txApp.Save(rec); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if findErr != nil {
+				// Gone already: a created record needs nothing more, and
+				// one the batch changed was deleted by the user since.
+				if action == "updated" {
+					keep[[2]string{coll, id}] = true
+				}
+				continue
+			}
+			// Changes logged before "after" was recorded have nothing to
+			// compare with, and are undone as they stand.
+			if after != nil && !maps.Equal(importFields(rec.FieldsData()), importFields(after)) {
+				keep[[2]string{coll, id}] = true
+				continue
+			}
+
+			if action == "created" {
+				if importTagInUse(txApp, coll, id) {
+					continue
+				}
+				if err := txApp.Delete(rec); err != nil {
+					return err
+				}
+				continue
+			}
+
+			prev, next := importFields(before), importFields(after)
+			for k, v := range before {
+				if k == "id" || slices.Contains(importUntracked, k) {
+					continue
+				}
+				if after == nil || prev[k] != next[k] {
+					rec.Set(k, v)
+				}
+			}
+			rec.Set("import_batch", before["import_batch"])
+			if err := txApp.Save(rec); err != nil {
+				return err
+			}
+		}
+		kept = len(keep)
+
+		pending, err := txApp.FindRecordsByFilter("pending_imports",
+			"import_batch = {:batch}", "", 0, 0,
+			map[string]any{"batch": batch.Id},
+		)
+		if err != nil {
+			return err
+		}
+		for _, p := range pending {
+			if err := txApp.Delete(p); err != nil {
+				return err
+			}
+		}
+
+		batch.Set("status", "reverted")
+		batch.Set("reverted_at", store.FormatTime(time.Now()))
+		return txApp.Save(batch)
+	})
+	return kept, err
+}
+
+// importTagInUse reports whether a tag key or value the batch created is
+// still assigned to any book.
+func importTagInUse(app core.App, collection, id string) bool {
+	var column string
+	switch collection {
+	case "tag_keys":
+		column = "tag_key"
+	case "tag_values":
+		column = "tag_value"
+	default:
+		return false
+	}
+	var row struct {
+		N int `db:"n"`
+	}
+	err := app.DB().NewQuery("SELECT COUNT(*) AS n FROM book_tag_values WHERE " + column + " = {:id}").
+		Bind(map[string]any{"id": id}).One(&row)
+	return err != nil || row.N > 0
+}
+
+func importBatchJSON(batch *core.Record) map[string]any {
+	return map[string]any{
+		"id":            batch.Id,
+		"source":        batch.GetString("source"),
+		"job":           nilIfEmpty(batch.GetString("job")),
+		"status":        batch.GetString("status"),
+		"imported":      batch.GetInt("imported"),
+		"failed":        batch.GetInt("failed"),
+		"pending_saved": batch.GetInt("pending_saved"),
+		"created":       batch.GetString("created"),
+		"reverted_at":   nilIfEmpty(batch.GetString("reverted_at")),
+	}
+}
+
+// GetImportHistory handles GET /me/imports
+// Returns the user's import batches, newest first.
+func GetImportHistory(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		user := e.Auth
+		if user == nil {
+			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
+		}
+
+		batches, err := app.FindRecordsByFilter("import_batches",
+			"user = {:user}", "-created", 100, 0,
+			map[string]any{"user": user.Id},
+		)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to load imports"})
+		}
+
+		items := make([]map[string]any, 0, len(batches))
+		for _, b := range batches {
+			items = append(items, importBatchJSON(b))
+		}
+		return e.JSON(http.StatusOK, items)
+	}
+}
+
+// RevertImport handles POST /me/imports/{id}/revert
+// Restores the user's shelves, tags and pending imports to how they were
+// before the import.
+func RevertImport(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		user := e.Auth
+		if user == nil {
+			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
+		}
+
+		batch, err := app.FindRecordById("import_batches", e.Request.PathValue("id"))
+		if err != nil || batch.GetString("user") != user.Id {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "Import not found"})
+		}
+		switch batch.GetString("status") {
+		case "reverted":
+			return e.JSON(http.StatusConflict, map[string]any{"error": "Import already reverted"})
+		case "committing":
+			return e.JSON(http.StatusConflict, map[string]any{"error": "Import is still being committed"})
+		}
+
+		kept, err := revertImportBatch(app, batch)
+		if errors.Is(err, errImportBatchOverlap) {
+			return e.JSON(http.StatusConflict, map[string]any{"error": "A later import changed the same books; revert it first"})
+		}
+		if err != nil {
+			log.Printf("[Import] revert %s: %v", batch.Id, err)
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to revert import"})
+		}
+
+		result := importBatchJSON(batch)
+		result["kept"] = kept
+		return e.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Highlight importers (Kindle, Kobo, KOReader) read e-reader annotations
+// rather than libraries. Each book becomes one row carrying its highlights;
+// committing a row saves them as the user's private book quotes and leaves
+// their shelves alone. Rows are matched, previewed, committed, reverted and
+// left pending like any other import.
+
+// importHighlight is one highlight, with the note attached to it if any.
+type importHighlight struct {
+	Text     string `json:"text"`
+	Note     string `json:"note,omitempty"`
+	Page     int    `json:"page,omitempty"`
+	Location string `json:"location,omitempty"`
+	Date     string `json:"date,omitempty"` // RFC 3339
+	// start and end bound Location for overlap checks; zero when unknown.
+	start, end int
+}
+
+// Limits of book_quotes.text and book_quotes.note.
+const (
+	importQuoteMaxText = 2000
+	importQuoteMaxNote = 500
+)
+
+// highlightBook collects a book's highlights while parsing.
+type highlightBook struct {
+	title, author, isbn13 string
+	highlights            []importHighlight
+}
+
+// highlightRows turns parsed books into import rows, in the order books
+// were first seen, dropping books left with no highlights.
+func highlightRows(books []*highlightBook) []ImportRow {
+	var rows []ImportRow
+	for _, b := range books {
+		hs := dedupeHighlights(b.highlights)
+		if len(hs) == 0 {
+			continue
+		}
+		rows = append(rows, ImportRow{
+			Title:      b.title,
+			Author:     b.author,
+			ISBN13:     b.isbn13,
+			Highlights: hs,
+		})
+	}
+	return rows
+}
+
+// highlightBooks groups highlights by title and author as they're parsed.
+type highlightBooks struct {
+	order []*highlightBook
+	byKey map[string]*highlightBook
+}
+
+func (g *highlightBooks) book(title, author, isbn13 string) *highlightBook {
+	if g.byKey == nil {
+		g.byKey = map[string]*highlightBook{}
+	}
+	key := strings.ToLower(title) + "\x00" + strings.ToLower(author)
+	b, ok := g.byKey[key]
+	if !ok {
+		b = &highlightBook{title: title, author: author, isbn13: isbn13}
+		g.byKey[key] = b
+		g.order = append(g.order, b)
+	}
+	return b
+}
+
+// parseHighlightLocation reads "170" or "170-172" into a range.
+func parseHighlightLocation(loc string) (start, end int) {
+	from, to, found := strings.Cut(strings.TrimSpace(loc), "-")
+	start, _ = strconv.Atoi(strings.TrimSpace(from))
+	end = start
+	if found {
+		if n, err := strconv.Atoi(strings.TrimSpace(to)); err == nil && n >= start {
+			end = n
+		}
+	}
+	return start, end
+}
+
+// foldHighlight normalizes highlight text for comparison: case, whitespace
+// and curly quotes don't count.
+func foldHighlight(s string) string {
+	s = strings.NewReplacer("‘", "'", "’", "'", "“", `"`, "”", `"`).Replace(s)
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// highlightsOverlap reports whether two highlights are the same passage:
+// one's text contains the other's and, when both have locations, their
+// ranges touch. E-readers keep the old clipping when a highlight is
+// extended, so the longer one supersedes it.
+func highlightsOverlap(a, b importHighlight) bool {
+	fa, fb := foldHighlight(a.Text), foldHighlight(b.Text)
+	if !strings.Contains(fa, fb) && !strings.Contains(fb, fa) {
+		return false
+	}
+	if a.start == 0 || b.start == 0 {
+		return true
+	}
+	return a.start <= b.end && b.start <= a.end
+}
+
+// dedupeHighlights drops empty highlights and collapses overlapping ones
+// into the longest, keeping any note either had.
+func dedupeHighlights(hs []importHighlight) []importHighlight {
+	var out []importHighlight
+	for _, h := range hs {
+		h.Text = strings.TrimSpace(h.Text)
+		h.Note = strings.TrimSpace(h.Note)
+		if h.Text == "" {
+			continue
+		}
+		merged := false
+		for i := range out {
+			if !highlightsOverlap(out[i], h) {
+				continue
+			}
+			if len(h.Text) > len(out[i].Text) {
+				if h.Note == "" {
+					h.Note = out[i].Note
+				}
+				out[i] = h
+			} else if out[i].Note == "" {
+				out[i].Note = h.Note
+			}
+			merged = true
+			break
+		}
+		if !merged {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// existingQuotes returns the folded text of the user's quotes for a book.
+func existingQuotes(app core.App, userID, bookID string) []string {
+	var rows []struct {
+		Text string `db:"text"`
+	}
+	_ = app.DB().NewQuery(`SELECT text FROM book_quotes WHERE user = {:user} AND book = {:book}`).
+		Bind(map[string]any{"user": userID, "book": bookID}).All(&rows)
+	texts := make([]string, len(rows))
+	for i, r := range rows {
+		texts[i] = foldHighlight(r.Text)
+	}
+	return texts
+}
+
+// highlightSaved reports whether a highlight is already among the folded
+// quote texts, whole or as part of a longer quote.
+func highlightSaved(saved []string, h importHighlight) bool {
+	text := foldHighlight(truncateRunes(h.Text, importQuoteMaxText))
+	for _, s := range saved {
+		if strings.Contains(s, text) {
+			return true
+		}
+	}
+	return false
+}
+
+// saveImportHighlights writes highlights the user doesn't already have as
+// quotes of a book, and reports whether it wrote any.
+func saveImportHighlights(app core.App, userID, bookID string, hs []importHighlight, public bool) (bool, error) {
+	coll, err := app.FindCollectionByNameOrId("book_quotes")
+	if err != nil {
+		return false, err
+	}
+	saved := existingQuotes(app, userID, bookID)
+	changed := false
+	for _, h := range hs {
+		if strings.TrimSpace(h.Text) == "" || highlightSaved(saved, h) {
+			continue
+		}
+		rec := core.NewRecord(coll)
+		rec.Set("user", userID)
+		rec.Set("book", bookID)
+		rec.Set("text", truncateRunes(h.Text, importQuoteMaxText))
+		rec.Set("note", truncateRunes(h.Note, importQuoteMaxNote))
+		if h.Page > 0 {
+			rec.Set("page_number", h.Page)
+		}
+		rec.Set("location", h.Location)
+		rec.Set("highlighted_at", h.Date)
+		rec.Set("is_public", public)
+		if err := app.Save(rec); err != nil {
+			return changed, err
+		}
+		saved = append(saved, foldHighlight(rec.GetString("text")))
+		changed = true
+	}
+	return changed, nil
+}
+
+// pendingHighlights returns the folded text of highlights already waiting
+// in the user's pending imports for a book from this source.
+func pendingHighlights(app core.App, userID, source, title, author string) []string {
+	records, err := app.FindRecordsByFilter("pending_imports",
+		"user = {:user} && source = {:source} && title = {:title} && author = {:author}",
+		"", 0, 0,
+		map[string]any{"user": userID, "source": source, "title": title, "author": author},
+	)
+	if err != nil {
+		return nil
+	}
+	var texts []string
+	for _, r := range records {
+		var hs []importHighlight
+		_ = r.UnmarshalJSONField("highlights", &hs)
+		for _, h := range hs {
+			texts = append(texts, foldHighlight(h.Text))
+		}
+	}
+	return texts
+}
+
+// unsavedHighlights drops highlights already in saved.
+func unsavedHighlights(saved []string, hs []importHighlight) []importHighlight {
+	var out []importHighlight
+	for _, h := range hs {
+		if !highlightSaved(saved, h) {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+// highlightDate formats an e-reader timestamp for importHighlight.Date.
+func highlightDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// truncateRunes cuts s to at most n characters.
+func truncateRunes(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
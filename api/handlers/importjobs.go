@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Import jobs run an import in the background: the upload is parsed into an
+// import_jobs record, matched row by row, then committed once the user has
+// confirmed the preview. Progress is saved as it goes, so clients can poll
+// the job or subscribe to it over realtime, and a job interrupted by a
+// restart picks up where it stopped.
+//
+//	matching → ready → committing → done
+//	      ↘            ↘
+//	        failed       failed
+
+// importJobSaveInterval is how often a running job saves its progress. It
+// bounds both realtime update frequency and the work redone after a restart.
+const importJobSaveInterval = 2 * time.Second
+
+// ResumeImportJobs queues jobs that were matching or committing when the
+// server last stopped, for imports started before the job queue (queued
+// ones resume on their own). Called once at startup.
+func ResumeImportJobs(app core.App) {
+	jobs, err := app.FindRecordsByFilter("import_jobs",
+		"status = 'matching' || status = 'committing'", "", 0, 0)
+	if err != nil {
+		log.Printf("[Import] find unfinished jobs: %v", err)
+		return
+	}
+	for _, job := range jobs {
+		startImportJob(app, job.Id)
+	}
+	if len(jobs) > 0 {
+		log.Printf("[Import] resumed %d jobs", len(jobs))
+	}
+}
+
+func runImportJob(app core.App, id string) {
+	job, err := app.FindRecordById("import_jobs", id)
+	if err != nil {
+		log.Printf("[Import] load job %s: %v", id, err)
+		return
+	}
+
+	imp, ok := importerFor(job.GetString("source"))
+	if !ok {
+		failImportJob(app, job, "Unknown import source")
+		return
+	}
+
+	switch job.GetString("status") {
+	case "matching":
+		err = matchImportJob(app, job, imp)
+	case "committing":
+		err = commitImportJob(app, job, imp)
+	}
+	if err != nil {
+		log.Printf("[Import] job %s: %v", id, err)
+		failImportJob(app, job, err.Error())
+	}
+}
+
+// failImportJob marks a job failed. A commit that fails partway leaves its
+// batch revertible with whatever it managed to write.
+func failImportJob(app core.App, job *core.Record, msg string) {
+	if job.GetString("status") == "committing" {
+		if batch, err := loadImportBatch(app, job.GetString("batch")); err == nil {
+			var result importResult
+			_ = job.UnmarshalJSONField("result", &result)
+			if err := batch.finish(result); err != nil {
+				log.Printf("[Import] finish batch %s: %v", batch.record.Id, err)
+			}
+		}
+	}
+	job.Set("status", "failed")
+	job.Set("error", msg)
+	if err := app.Save(job); err != nil {
+		log.Printf("[Import] save failed job %s: %v", job.Id, err)
+	}
+}
+
+// matchImportJob matches every row that doesn't have a status yet, then
+// marks the job ready for review.
+func matchImportJob(app core.App, job *core.Record, imp Importer) error {
+	var rows []ImportRow
+	if err := job.UnmarshalJSONField("rows", &rows); err != nil {
+		return err
+	}
+
+	var todo []int
+	for i, r := range rows {
+		if r.Status == "" {
+			todo = append(todo, i)
+		}
+	}
+
+	processed := len(rows) - len(todo)
+	lastSave := time.Now()
+	var saveErr error
+	matchImportRows(app, imp, rows, todo, func(i int) {
+		processed++
+		if saveErr != nil || time.Since(lastSave) < importJobSaveInterval {
+			return
+		}
+		job.Set("rows", rows)
+		job.Set("processed", processed)
+		saveErr = app.Save(job)
+		lastSave = time.Now()
+	})
+	if saveErr != nil {
+		return saveErr
+	}
+
+	diffImportRows(app, job.GetString("user"), imp, rows)
+	matched, ambiguous, unmatched := countImportMatches(rows)
+	job.Set("rows", rows)
+	job.Set("processed", len(rows))
+	job.Set("matched", matched)
+	job.Set("ambiguous", ambiguous)
+	job.Set("unmatched", unmatched)
+	job.Set("status", "ready")
+	return app.Save(job)
+}
+
+// commitImportJob writes the confirmed rows from where the job last saved
+// its progress, then the unmatched rows, and marks the job done. Rows
+// committed again after a restart find their changes already made and count
+// as unchanged.
+func commitImportJob(app core.App, job *core.Record, imp Importer) error {
+	var data importCommit
+	if err := job.UnmarshalJSONField("commit", &data); err != nil {
+		return err
+	}
+	var result importResult
+	if err := job.UnmarshalJSONField("result", &result); err != nil {
+		return err
+	}
+
+	batch, err := loadImportBatch(app, job.GetString("batch"))
+	if err != nil {
+		return err
+	}
+
+	userID := job.GetString("user")
+	plan, err := newImportPlan(app, userID, imp, batch, data)
+	if err != nil {
+		return err
+	}
+
+	lastSave := time.Now()
+	for i := job.GetInt("processed"); i < len(data.Rows); i++ {
+		result.add(commitImportRow(app, plan, data.Rows[i]))
+		if time.Since(lastSave) < importJobSaveInterval {
+			continue
+		}
+		job.Set("processed", i+1)
+		job.Set("result", result)
+		if err := app.Save(job); err != nil {
+			return err
+		}
+		lastSave = time.Now()
+	}
+
+	result.PendingSaved = savePendingImports(app, userID, imp.Source(), batch.record.Id, data.UnmatchedRows)
+	if err := batch.finish(result); err != nil {
+		return err
+	}
+
+	job.Set("processed", len(data.Rows))
+	job.Set("result", result)
+	job.Set("status", "done")
+	return app.Save(job)
+}
+
+// importJobJSON is the API view of a job. Rows and the shelf summary are
+// included once matching has finished and withRows is set.
+func importJobJSON(job *core.Record, withRows bool) map[string]any {
+	out := map[string]any{
+		"id":        job.Id,
+		"source":    job.GetString("source"),
+		"status":    job.GetString("status"),
+		"total":     job.GetInt("total"),
+		"processed": job.GetInt("processed"),
+		"matched":   job.GetInt("matched"),
+		"ambiguous": job.GetInt("ambiguous"),
+		"unmatched": job.GetInt("unmatched"),
+		"result":    job.Get("result"),
+		"batch_id":  nilIfEmpty(job.GetString("batch")),
+		"error":     nilIfEmpty(job.GetString("error")),
+		"created":   job.GetString("created"),
+		"updated":   job.GetString("updated"),
+	}
+	if withRows && job.GetString("status") != "matching" {
+		var rows []ImportRow
+		if err := job.UnmarshalJSONField("rows", &rows); err == nil {
+			added, unchanged, conflicting := countImportDiffs(rows)
+			out["new"] = added
+			out["unchanged"] = unchanged
+			out["conflicting"] = conflicting
+			out["rows"] = rows
+			out["shelves"] = importShelves(rows)
+		}
+	}
+	return out
+}
+
+// findImportJob loads a job owned by userID.
+func findImportJob(app core.App, id, userID string) (*core.Record, bool) {
+	job, err := app.FindRecordById("import_jobs", id)
+	if err != nil || job.GetString("user") != userID {
+		return nil, false
+	}
+	return job, true
+}
+
+// CreateImportJob handles POST /me/import/jobs
+// Accepts a multipart form with source and file, parses the export and
+// starts matching it in the background.
+func CreateImportJob(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		user := e.Auth
+		if user == nil {
+			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
+		}
+
+		imp, ok := importerFor(e.Request.FormValue("source"))
+		if !ok {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Unknown import source"})
+		}
+
+		file, _, err := e.Request.FormFile("file")
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "CSV file required"})
+		}
+		defer file.Close()
+
+		rows, err := parseImport(imp, file)
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		}
+
+		running, _ := app.FindRecordsByFilter("import_jobs",
+			"user = {:user} && (status = 'matching' || status = 'committing')",
+			"", 1, 0,
+			map[string]any{"user": user.Id},
+		)
+		if len(running) > 0 {
+			return e.JSON(http.StatusConflict, map[string]any{"error": "An import is already running"})
+		}
+
+		coll, err := app.FindCollectionByNameOrId("import_jobs")
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to create import job"})
+		}
+		job := core.NewRecord(coll)
+		job.Set("user", user.Id)
+		job.Set("source", imp.Source())
+		job.Set("status", "matching")
+		job.Set("total", len(rows))
+		job.Set("processed", 0)
+		job.Set("rows", rows)
+		if err := app.Save(job); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to create import job"})
+		}
+
+		startImportJob(app, job.Id)
+
+		return e.JSON(http.StatusAccepted, importJobJSON(job, false))
+	}
+}
+
+// GetImportJobs handles GET /me/import/jobs
+// Returns the user's 20 most recent jobs, without rows.
+func GetImportJobs(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		user := e.Auth
+		if user == nil {
+			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
+		}
+
+		jobs, err := app.FindRecordsByFilter("import_jobs",
+			"user = {:user}", "-created", 20, 0,
+			map[string]any{"user": user.Id},
+		)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to load import jobs"})
+		}
+
+		items := make([]map[string]any, 0, len(jobs))
+		for _, job := range jobs {
+			items = append(items, importJobJSON(job, false))
+		}
+		return e.JSON(http.StatusOK, items)
+	}
+}
+
+// GetImportJob handles GET /me/import/jobs/{id}
+func GetImportJob(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		user := e.Auth
+		if user == nil {
+			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
+		}
+
+		job, ok := findImportJob(app, e.Request.PathValue("id"), user.Id)
+		if !ok {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "Import job not found"})
+		}
+
+		return e.JSON(http.StatusOK, importJobJSON(job, true))
+	}
+}
+
+// CommitImportJob handles POST /me/import/jobs/{id}/commit
+// Accepts the same body as the commit endpoint and writes it in the
+// background.
+func CommitImportJob(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		user := e.Auth
+		if user == nil {
+			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
+		}
+
+		job, ok := findImportJob(app, e.Request.PathValue("id"), user.Id)
+		if !ok {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "Import job not found"})
+		}
+		if job.GetString("status") != "ready" {
+			return e.JSON(http.StatusConflict, map[string]any{"error": "Import job is not ready to commit"})
+		}
+
+		var data importCommit
+		if err := e.BindBody(&data); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid request body"})
+		}
+		if err := data.MergePolicies.validate(); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		}
+
+		batch, err := newImportBatch(app, user.Id, job.GetString("source"), job.Id)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to start commit"})
+		}
+
+		job.Set("batch", batch.record.Id)
+		job.Set("commit", data)
+		job.Set("result", importResult{})
+		job.Set("status", "committing")
+		job.Set("total", len(data.Rows))
+		job.Set("processed", 0)
+		if err := app.Save(job); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to start commit"})
+		}
+
+		startImportJob(app, job.Id)
+
+		return e.JSON(http.StatusAccepted, importJobJSON(job, false))
+	}
+}
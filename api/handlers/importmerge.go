@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/tristansaldanha/rosslib/api/store"
+)
+
+// Re-importing an export compares each row with what the user already has.
+// A row is "new" when the book isn't on their shelves, "unchanged" when
+// every value it carries matches, and "conflict" otherwise. Commits apply a
+// merge policy per conflicting field; unchanged rows write nothing.
+const (
+	importDiffNew       = "new"
+	importDiffUnchanged = "unchanged"
+	importDiffConflict  = "conflict"
+)
+
+// Merge policies: keep what's in rosslib, take the source's value, or take
+// whichever side changed most recently.
+const (
+	importKeepRosslib = "keep_rosslib"
+	importTakeSource  = "take_source"
+	importNewestWins  = "newest_wins"
+)
+
+// importMergeFields are the fields a row is compared on.
+var importMergeFields = []string{"rating", "review_text", "date_read", "date_added", "status"}
+
+// importConflict is one field where a row differs from the user's entry.
+// Rosslib is nil when the entry has no value, in which case the source's
+// value is always taken.
+type importConflict struct {
+	Field   string `json:"field"`
+	Rosslib any    `json:"rosslib"`
+	Source  any    `json:"source"`
+}
+
+// importValues are the comparable values of a row or shelf entry. Empty
+// values are absent: a source row without a rating never conflicts with a
+// rated entry.
+type importValues struct {
+	Rating     float64
+	ReviewText string
+	DateRead   string
+	DateAdded  string
+	Status     string
+}
+
+func (v importValues) get(field string) any {
+	switch field {
+	case "rating":
+		if v.Rating > 0 {
+			return v.Rating
+		}
+	case "review_text":
+		if s := strings.TrimSpace(v.ReviewText); s != "" {
+			return s
+		}
+	case "date_read":
+		if v.DateRead != "" {
+			return normalizeImportDate(v.DateRead)
+		}
+	case "date_added":
+		if v.DateAdded != "" {
+			return normalizeImportDate(v.DateAdded)
+		}
+	case "status":
+		if v.Status != "" {
+			return v.Status
+		}
+	}
+	return nil
+}
+
+// newest is the latest date the values carry, used as the source's side of
+// newest_wins.
+func (v importValues) newest() time.Time {
+	var t time.Time
+	for _, s := range []string{v.DateRead, v.DateAdded} {
+		if d, ok := parseImportDate(s); ok && d.After(t) {
+			t = d
+		}
+	}
+	return t
+}
+
+// importEntry is the user's current shelf entry for a book.
+type importEntry struct {
+	userBook *core.Record // nil when the book isn't shelved
+	values   importValues
+	// modified is when the entry or its status last changed; zero when
+	// unknown (entries saved before modification times were kept).
+	modified time.Time
+	// imported is set when the entry was last written by a committed
+	// import and hasn't been edited since.
+	imported bool
+}
+
+// loadImportEntry reads the user's shelf entry and status for a book.
+func loadImportEntry(app core.App, userID, bookID string) (*importEntry, error) {
+	entry := &importEntry{}
+	existing, err := app.FindRecordsByFilter("user_books",
+		"user = {:user} && book = {:book}",
+		"", 1, 0,
+		map[string]any{"user": userID, "book": bookID},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) == 0 {
+		return entry, nil
+	}
+	ub := existing[0]
+	entry.userBook = ub
+	entry.values = importValues{
+		Rating:     ub.GetFloat("rating"),
+		ReviewText: ub.GetString("review_text"),
+		DateRead:   ub.GetString("date_read"),
+		DateAdded:  ub.GetString("date_added"),
+	}
+	entry.modified = ub.GetDateTime("updated").Time()
+
+	var status struct {
+		Slug    string `db:"slug"`
+		Updated string `db:"updated"`
+	}
+	err = app.DB().NewQuery(`
+		SELECT tv.slug, btv.updated
+		FROM book_tag_values btv
+		JOIN tag_keys tk ON tk.id = btv.tag_key AND tk.slug = 'status'
+		JOIN tag_values tv ON tv.id = btv.tag_value
+		WHERE btv.user = {:user} AND btv.book = {:book}
+		LIMIT 1
+	`).Bind(map[string]any{"user": userID, "book": bookID}).One(&status)
+	if err == nil {
+		entry.values.Status = status.Slug
+		if dt, err := types.ParseDateTime(status.Updated); err == nil && dt.Time().After(entry.modified) {
+			entry.modified = dt.Time()
+		}
+	}
+
+	if batchID := ub.GetString("import_batch"); batchID != "" && !entry.modified.IsZero() {
+		if batch, err := app.FindRecordById("import_batches", batchID); err == nil {
+			committed := batch.GetDateTime("committed_at")
+			entry.imported = !committed.IsZero() && !entry.modified.After(committed.Time())
+		}
+	}
+	return entry, nil
+}
+
+// diff lists the fields where src differs from the entry.
+func (entry *importEntry) diff(src importValues) []importConflict {
+	var conflicts []importConflict
+	for _, field := range importMergeFields {
+		s := src.get(field)
+		if s == nil {
+			continue
+		}
+		r := entry.values.get(field)
+		if r == s {
+			continue
+		}
+		conflicts = append(conflicts, importConflict{Field: field, Rosslib: r, Source: s})
+	}
+	return conflicts
+}
+
+// classify names how a row relates to the entry: new, unchanged or conflict.
+func (entry *importEntry) classify(conflicts []importConflict) string {
+	switch {
+	case entry.userBook == nil:
+		return importDiffNew
+	case len(conflicts) == 0:
+		return importDiffUnchanged
+	}
+	return importDiffConflict
+}
+
+// importMergePolicies maps fields to merge policies; "default" covers
+// fields without one of their own.
+type importMergePolicies map[string]string
+
+// validate rejects unknown fields and policies.
+func (p importMergePolicies) validate() error {
+	for field, policy := range p {
+		if field != "default" && !slices.Contains(importMergeFields, field) {
+			return fmt.Errorf("Unknown merge field: %s", field)
+		}
+		switch policy {
+		case importKeepRosslib, importTakeSource, importNewestWins:
+		default:
+			return fmt.Errorf("Invalid merge policy: %s", policy)
+		}
+	}
+	return nil
+}
+
+func (p importMergePolicies) policy(field string) string {
+	if policy, ok := p[field]; ok {
+		return policy
+	}
+	if policy, ok := p["default"]; ok {
+		return policy
+	}
+	return importNewestWins
+}
+
+// takeSource decides a conflicting field. newest_wins takes the source when
+// the entry is exactly what an earlier import left, or when the row has a
+// date later than the entry's last change.
+func (p importMergePolicies) takeSource(c importConflict, entry *importEntry, src importValues) bool {
+	if c.Rosslib == nil {
+		return true
+	}
+	switch p.policy(c.Field) {
+	case importTakeSource:
+		return true
+	case importKeepRosslib:
+		return false
+	}
+	if entry.imported {
+		return true
+	}
+	return !entry.modified.IsZero() && src.newest().After(entry.modified)
+}
+
+// diffImportRows classifies parsed rows against the user's library, for
+// previews. Matched rows are compared with their shelf entry; unmatched
+// rows are unchanged if an earlier import already saved them as pending.
+// Rows of highlights are unchanged when every highlight is already saved,
+// as a quote or pending. Ambiguous rows are left unclassified until a
+// candidate is picked.
+func diffImportRows(app core.App, userID string, imp Importer, rows []ImportRow) {
+	for i := range rows {
+		row := &rows[i]
+		switch row.Status {
+		case "unmatched":
+			row.Diff = importDiffNew
+			if len(row.Highlights) > 0 {
+				saved := pendingHighlights(app, userID, imp.Source(), row.Title, row.Author)
+				if len(unsavedHighlights(saved, row.Highlights)) == 0 {
+					row.Diff = importDiffUnchanged
+				}
+			} else if hasPendingImport(app, userID, imp.Source(), row.Title, row.Author) {
+				row.Diff = importDiffUnchanged
+			}
+			continue
+		case "matched":
+		default:
+			continue
+		}
+
+		row.Diff = importDiffNew
+		book, err := app.FindFirstRecordByData("books", "open_library_id", row.Match.OLID)
+		if err != nil {
+			continue
+		}
+		if len(row.Highlights) > 0 {
+			if len(unsavedHighlights(existingQuotes(app, userID, book.Id), row.Highlights)) == 0 {
+				row.Diff = importDiffUnchanged
+			}
+			continue
+		}
+		entry, err := loadImportEntry(app, userID, book.Id)
+		if err != nil {
+			continue
+		}
+		conflicts := entry.diff(importRowValues(imp, row))
+		row.Diff = entry.classify(conflicts)
+		if row.Diff == importDiffConflict {
+			row.Conflicts = conflicts
+		}
+	}
+}
+
+// importRowValues are the comparable values of a parsed row.
+func importRowValues(imp Importer, row *ImportRow) importValues {
+	v := importValues{Status: imp.Status(row.ExclusiveShelfSlug)}
+	if row.Rating != nil {
+		v.Rating = *row.Rating
+	}
+	if row.ReviewText != nil {
+		v.ReviewText = *row.ReviewText
+	}
+	if row.DateRead != nil {
+		v.DateRead = *row.DateRead
+	}
+	if row.DateAdded != nil {
+		v.DateAdded = *row.DateAdded
+	}
+	return v
+}
+
+// countImportDiffs tallies classified rows.
+func countImportDiffs(rows []ImportRow) (added, unchanged, conflicting int) {
+	for _, r := range rows {
+		switch r.Diff {
+		case importDiffNew:
+			added++
+		case importDiffUnchanged:
+			unchanged++
+		case importDiffConflict:
+			conflicting++
+		}
+	}
+	return
+}
+
+// hasPendingImport reports whether the user already has a pending import
+// from the source for the title and author.
+func hasPendingImport(app core.App, userID, source, title, author string) bool {
+	existing, err := app.FindRecordsByFilter("pending_imports",
+		"user = {:user} && source = {:source} && title = {:title} && author = {:author}",
+		"", 1, 0,
+		map[string]any{"user": userID, "source": source, "title": title, "author": author},
+	)
+	return err == nil && len(existing) > 0
+}
+
+// importDateLayouts are the date formats exports and date fields use.
+var importDateLayouts = []string{
+	store.DateLayout,
+	"2006-01-02 15:04:05Z",
+	time.RFC3339,
+	"2006-01-02",
+	"2006/01/02",
+	"2006/1/2",
+	"2006-1-2",
+}
+
+func parseImportDate(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// normalizeImportDate reduces a date to YYYY-MM-DD so an export's
+// "2024/01/15" matches a stored "2024-01-15 00:00:00.000Z". Unparseable
+// dates are compared as written.
+func normalizeImportDate(s string) string {
+	if t, ok := parseImportDate(s); ok {
+		return t.Format("2006-01-02")
+	}
+	return strings.TrimSpace(s)
+}
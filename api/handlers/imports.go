@@ -1,14 +1,16 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
-	"net/url"
+	"os"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,371 +18,372 @@ import (
 	"github.com/pocketbase/pocketbase/core"
 )
 
-// PreviewGoodreadsImport handles POST /me/import/goodreads/preview
-// Streams NDJSON: progress lines followed by a final result line.
-func PreviewGoodreadsImport(app core.App) func(e *core.RequestEvent) error {
-	return func(e *core.RequestEvent) error {
-		user := e.Auth
-		if user == nil {
-			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
-		}
+// Importer reads one source's library export. Each source lives in its own
+// import_<source>.go file and registers itself from init(); the preview,
+// commit and import job endpoints find it by Source(), so adding a source
+// needs no other changes.
+type Importer interface {
+	// Source names the importer in routes, import_jobs and pending_imports.
+	Source() string
+	// Parse reads an export into rows. Its error is shown to the user.
+	Parse(r io.Reader) ([]ImportRow, error)
+	// Status maps a row's exclusive shelf slug to a status tag slug, or ""
+	// to leave the status alone.
+	Status(shelf string) string
+	// CleanTitle and CleanAuthor turn a row's title and author into catalog
+	// search terms. An empty author searches by title alone.
+	CleanTitle(title string) string
+	CleanAuthor(author string) string
+	// FuzzyMatch reports whether rows no lookup finds go on to fuzzy
+	// candidates: near misses in the local catalog, then LLM matching.
+	// Without it, rows are only ever matched or unmatched.
+	FuzzyMatch() bool
+}
 
-		file, _, err := e.Request.FormFile("file")
-		if err != nil {
-			return e.JSON(http.StatusBadRequest, map[string]any{"error": "CSV file required"})
-		}
-		defer file.Close()
+var importers = map[string]Importer{}
 
-		reader := csv.NewReader(file)
-		headers, err := reader.Read()
-		if err != nil {
-			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid CSV"})
-		}
+func registerImporter(imp Importer) {
+	importers[imp.Source()] = imp
+}
 
-		// Map header indices
-		colIdx := map[string]int{}
-		for i, h := range headers {
-			colIdx[strings.TrimSpace(h)] = i
-		}
+func importerFor(source string) (Importer, bool) {
+	imp, ok := importers[source]
+	return imp, ok
+}
 
-		requiredCols := []string{"Title"}
-		for _, c := range requiredCols {
-			if _, ok := colIdx[c]; !ok {
-				return e.JSON(http.StatusBadRequest, map[string]any{"error": fmt.Sprintf("Missing column: %s", c)})
-			}
-		}
+// importCandidate is a catalog match offered for a row, matching the
+// webapp's BookCandidate.
+type importCandidate struct {
+	OLID     string   `json:"ol_id"`
+	Title    string   `json:"title"`
+	Authors  []string `json:"authors"`
+	CoverURL *string  `json:"cover_url"`
+	Year     *int     `json:"year"`
+	// Score rates candidates found in the local catalog, from 0 to 1.
+	Score float64 `json:"score,omitempty"`
+}
 
-		// Types matching the webapp's PreviewRow / BookCandidate
-		type bookCandidate struct {
-			OLID     string   `json:"ol_id"`
-			Title    string   `json:"title"`
-			Authors  []string `json:"authors"`
-			CoverURL *string  `json:"cover_url"`
-			Year     *int     `json:"year"`
-		}
-		type previewRow struct {
-			RowID              int              `json:"row_id"`
-			Title              string           `json:"title"`
-			Author             string           `json:"author"`
-			ISBN13             string           `json:"isbn13"`
-			Rating             *float64         `json:"rating"`
-			ReviewText         *string          `json:"review_text"`
-			Spoiler            bool             `json:"spoiler"`
-			DateRead           *string          `json:"date_read"`
-			DateAdded          *string          `json:"date_added"`
-			ExclusiveShelfSlug string           `json:"exclusive_shelf_slug"`
-			CustomShelves      []string         `json:"custom_shelves"`
-			Status             string           `json:"status"`
-			Match              *bookCandidate   `json:"match,omitempty"`
-			Candidates         []bookCandidate  `json:"candidates,omitempty"`
-		}
+// ImportRow is one book from an export, matching the webapp's PreviewRow.
+// Status is empty until the row has been matched.
+type ImportRow struct {
+	RowID              int               `json:"row_id"`
+	Title              string            `json:"title"`
+	Author             string            `json:"author"`
+	ISBN13             string            `json:"isbn13"`
+	Rating             *float64          `json:"rating"`
+	ReviewText         *string           `json:"review_text"`
+	Spoiler            bool              `json:"spoiler"`
+	DateRead           *string           `json:"date_read"`
+	DateAdded          *string           `json:"date_added"`
+	ExclusiveShelfSlug string            `json:"exclusive_shelf_slug"`
+	CustomShelves      []string          `json:"custom_shelves"`
+	Status             string            `json:"status"`
+	Match              *importCandidate  `json:"match,omitempty"`
+	Candidates         []importCandidate `json:"candidates,omitempty"`
+	Highlights         []importHighlight `json:"highlights,omitempty"`
+	Series             string            `json:"series,omitempty"`
+	SeriesPosition     *int              `json:"series_position,omitempty"`
+	Diff               string            `json:"diff,omitempty"`
+	Conflicts          []importConflict  `json:"conflicts,omitempty"`
+}
 
-		var csvRows [][]string
-		for {
-			row, err := reader.Read()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				continue
-			}
-			csvRows = append(csvRows, row)
-		}
+// importTable is a delimited export read into memory.
+type importTable struct {
+	cols map[string]int
+	rows [][]string
+}
 
-		results := make([]previewRow, len(csvRows))
-		ol := newOLClient()
-		gb := newGBClient()
+// readImportTable reads a header row and the rows under it, skipping rows the
+// reader can't parse. Exports must have a Title column. invalid is the error
+// for a file without a readable header.
+func readImportTable(reader *csv.Reader, invalid string) (*importTable, error) {
+	headers, err := reader.Read()
+	if err != nil {
+		return nil, errors.New(invalid)
+	}
 
-		var wg sync.WaitGroup
-		sem := make(chan struct{}, 5)
+	t := &importTable{cols: map[string]int{}}
+	for i, h := range headers {
+		t.cols[strings.TrimSpace(h)] = i
+	}
+	if _, ok := t.cols["Title"]; !ok {
+		return nil, errors.New("Missing column: Title")
+	}
 
-		getCol := func(row []string, name string) string {
-			if idx, ok := colIdx[name]; ok && idx < len(row) {
-				return strings.TrimSpace(row[idx])
-			}
-			return ""
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
 		}
-
-		// Set up NDJSON streaming
-		w := e.Response
-		w.Header().Set("Content-Type", "application/x-ndjson")
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		flusher, ok := w.(http.Flusher)
-		if !ok {
-			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Streaming not supported"})
+		if err != nil {
+			continue
 		}
-		enc := json.NewEncoder(w)
+		t.rows = append(t.rows, row)
+	}
+	return t, nil
+}
+
+// get returns the trimmed value of the named column, or "" if the export
+// doesn't have it.
+func (t *importTable) get(row []string, name string) string {
+	if idx, ok := t.cols[name]; ok && idx < len(row) {
+		return strings.TrimSpace(row[idx])
+	}
+	return ""
+}
+
+// openImportDB opens an uploaded SQLite database (an e-reader's or a
+// library manager's) read-only. SQLite needs a file, so the upload is
+// copied to a temporary one that close removes.
+func openImportDB(r io.Reader) (db *sql.DB, close func(), err error) {
+	tmp, err := os.CreateTemp("", "import-*.sqlite")
+	if err != nil {
+		return nil, nil, err
+	}
+	remove := func() { os.Remove(tmp.Name()) }
+	_, err = io.Copy(tmp, r)
+	tmp.Close()
+	if err != nil {
+		remove()
+		return nil, nil, err
+	}
+
+	// The sqlite driver is registered by PocketBase.
+	db, err = sql.Open("sqlite", "file:"+tmp.Name()+"?mode=ro")
+	if err != nil {
+		remove()
+		return nil, nil, err
+	}
+	return db, func() { db.Close(); remove() }, nil
+}
 
-		type progressMsg struct {
-			Index int
-			Row   previewRow
+// parseImport parses an export and numbers its rows.
+func parseImport(imp Importer, r io.Reader) ([]ImportRow, error) {
+	rows, err := imp.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		rows[i].RowID = i
+		if rows[i].CustomShelves == nil {
+			rows[i].CustomShelves = []string{}
 		}
-		ch := make(chan progressMsg, len(csvRows))
-
-		for i, row := range csvRows {
-			wg.Add(1)
-			go func(i int, row []string) {
-				defer wg.Done()
-				sem <- struct{}{}
-				defer func() { <-sem }()
-
-				pr := previewRow{
-					RowID:  i,
-					Title:  getCol(row, "Title"),
-					Author: getCol(row, "Author"),
-					ISBN13: strings.Trim(getCol(row, "ISBN13"), "=\""),
-				}
+	}
+	return rows, nil
+}
 
-				// Map exclusive shelf — pass through Goodreads name
-				pr.ExclusiveShelfSlug = strings.ToLower(getCol(row, "Exclusive Shelf"))
+// importMatchWorkers is how many rows of one import are looked up at once.
+const importMatchWorkers = 5
+
+// matchImportRow runs the lookup chain for one row and sets its Status to
+// matched, ambiguous or unmatched.
+func matchImportRow(app core.App, ol *cachedOLClient, imp Importer, pr *ImportRow) {
+	// 1. Local DB by ISBN, then a confident fuzzy match in the local
+	// catalog, then each catalog provider in turn (ISBN, title+author,
+	// title only, comma-shortened title).
+	m, local := matchBookCandidates(app, pr.ISBN13, imp.CleanTitle(pr.Title), imp.CleanAuthor(pr.Author))
+	if m != nil {
+		pr.Status = "matched"
+		match := importCandidate{
+			OLID:    m.WorkID,
+			Title:   m.Title,
+			Authors: m.Authors,
+		}
+		if match.Title == "" {
+			match.Title = pr.Title
+		}
+		if len(match.Authors) == 0 && pr.Author != "" {
+			match.Authors = []string{pr.Author}
+		}
+		if m.CoverURL != "" {
+			coverURL := m.CoverURL
+			match.CoverURL = &coverURL
+		}
+		pr.Match = &match
+		return
+	}
 
-				if r, err := strconv.ParseFloat(getCol(row, "My Rating"), 64); err == nil && r > 0 {
-					pr.Rating = &r
-				}
-				if review := getCol(row, "My Review"); review != "" {
-					pr.ReviewText = &review
-				}
-				if dr := getCol(row, "Date Read"); dr != "" {
-					pr.DateRead = &dr
-				}
-				if da := getCol(row, "Date Added"); da != "" {
-					pr.DateAdded = &da
-				}
+	// 2. Near misses in the local catalog, offered for confirmation.
+	if imp.FuzzyMatch() && len(local) > 0 {
+		pr.Status = "ambiguous"
+		for _, c := range local {
+			pr.Candidates = append(pr.Candidates, c.importCandidate())
+		}
+		return
+	}
 
-				// Parse custom shelves from Bookshelves column
-				if bookshelves := getCol(row, "Bookshelves"); bookshelves != "" {
-					for _, s := range strings.Split(bookshelves, ",") {
-						s = strings.TrimSpace(s)
-						if s != "" && s != "to-read" && s != "currently-reading" && s != "read" {
-							pr.CustomShelves = append(pr.CustomShelves, s)
-						}
-					}
+	// 3. LLM-powered fuzzy matching — generate title/author permutations
+	// and search OL with each. Returns candidates for user confirmation.
+	if imp.FuzzyMatch() && pr.Title != "" {
+		if result := llmFuzzyMatch(ol, pr.Title, pr.Author); result != nil {
+			pr.Status = "ambiguous"
+			for _, c := range result.Candidates {
+				bc := importCandidate{
+					OLID:    c.OLID,
+					Title:   c.Title,
+					Authors: c.Authors,
+					Year:    c.Year,
 				}
-				if pr.CustomShelves == nil {
-					pr.CustomShelves = []string{}
+				if c.CoverURL != "" {
+					bc.CoverURL = &c.CoverURL
 				}
+				pr.Candidates = append(pr.Candidates, bc)
+			}
+			return
+		}
+	}
 
-				// Try to find via ISBN
-				isbn := pr.ISBN13
-				if isbn == "" {
-					isbn = strings.Trim(getCol(row, "ISBN"), "=\"")
-				}
+	pr.Status = "unmatched"
+}
 
-				found := false
-				var olID, matchTitle, coverURL string
-				var authors []string
-
-				// 1. Check local DB by ISBN (skip external API if we already have it)
-				if isbn != "" {
-					existing, localErr := app.FindRecordsByFilter("books",
-						"isbn13 = {:isbn}",
-						"", 1, 0,
-						map[string]any{"isbn": isbn},
-					)
-					if localErr == nil && len(existing) > 0 {
-						rec := existing[0]
-						olID = rec.GetString("open_library_id")
-						matchTitle = rec.GetString("title")
-						coverURL = rec.GetString("cover_url")
-						if a := rec.GetString("authors"); a != "" {
-							authors = strings.Split(a, ", ")
-						}
-						found = olID != ""
-					}
-				}
+// matchImportRows matches rows[i] for each i in todo, importMatchWorkers at
+// a time. done is called from the caller's goroutine after each row is
+// written back, so it may read rows freely.
+func matchImportRows(app core.App, imp Importer, rows []ImportRow, todo []int, done func(i int)) {
+	type matched struct {
+		Index int
+		Row   ImportRow
+	}
+	ol := newOLClient()
+	queue := make(chan int)
+	ch := make(chan matched)
+
+	var wg sync.WaitGroup
+	for w := 0; w < importMatchWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				row := rows[i]
+				matchImportRow(app, ol, imp, &row)
+				ch <- matched{Index: i, Row: row}
+			}
+		}()
+	}
+	go func() {
+		for _, i := range todo {
+			queue <- i
+		}
+		close(queue)
+		wg.Wait()
+		close(ch)
+	}()
 
-				// 2. OL direct ISBN endpoint
-				if isbn != "" && !found {
-					data, err := ol.get(fmt.Sprintf("/isbn/%s.json", isbn))
-					if err == nil {
-						if works, ok := data["works"].([]any); ok && len(works) > 0 {
-							if w, ok := works[0].(map[string]any); ok {
-								if key, ok := w["key"].(string); ok {
-									olID = strings.TrimPrefix(key, "/works/")
-									found = true
-								}
-							}
-						}
-						if t, ok := data["title"].(string); ok {
-							matchTitle = t
-						}
-						if covers, ok := data["covers"].([]any); ok && len(covers) > 0 {
-							if coverID, ok := covers[0].(float64); ok {
-								coverURL = fmt.Sprintf("https://covers.openlibrary.org/b/id/%.0f-M.jpg", coverID)
-							}
-						}
-					}
-				}
+	for m := range ch {
+		rows[m.Index] = m.Row
+		done(m.Index)
+	}
+}
 
-				// 3. OL search by ISBN (searches across all editions via search index)
-				if isbn != "" && !found {
-					data, err := ol.get(fmt.Sprintf("/search.json?isbn=%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", url.QueryEscape(isbn)))
-					if err == nil {
-						olID, matchTitle, coverURL, authors, found = extractOLSearchResult(data)
-					}
-				}
+// countImportMatches tallies rows by match status.
+func countImportMatches(rows []ImportRow) (matched, ambiguous, unmatched int) {
+	for _, r := range rows {
+		switch r.Status {
+		case "matched":
+			matched++
+		case "ambiguous":
+			ambiguous++
+		default:
+			unmatched++
+		}
+	}
+	return
+}
 
-				// 4. OL search by cleaned title+author
-				// Goodreads titles often include junk: series info "(Series, #N)",
-				// subtitles "Title: Subtitle", format tags "[Hardcover]",
-				// embedded author "by Author Name (2005)", pipe separators, etc.
-				if !found && pr.Title != "" {
-					cleaned := cleanGoodreadsTitle(pr.Title)
-					cleanedAuthor := cleanGoodreadsAuthor(pr.Author)
-					q := "title=" + url.QueryEscape(cleaned)
-					if cleanedAuthor != "" {
-						q += "&author=" + url.QueryEscape(cleanedAuthor)
-					}
-					data, err := ol.get(fmt.Sprintf("/search.json?%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", q))
-					if err == nil {
-						olID, matchTitle, coverURL, authors, found = extractOLSearchResult(data)
-					}
-				}
+// importShelf is a custom shelf and how many rows are on it.
+type importShelf struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
 
-				// 5. OL search by cleaned title only (author may be wrong/missing)
-				// Also strips author name from front of title
-				// ("Arthur C. Clark Expedition to Earth" → "Expedition to Earth")
-				if !found && pr.Title != "" {
-					cleaned := cleanGoodreadsTitle(pr.Title)
-					cleaned = stripAuthorPrefix(cleaned, pr.Author)
-					data, err := ol.get(fmt.Sprintf("/search.json?title=%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", url.QueryEscape(cleaned)))
-					if err == nil {
-						id, mt, cu, au, ok := extractOLSearchResult(data)
-						if ok && titleMatchesResult(cleaned, mt) {
-							olID, matchTitle, coverURL, authors, found = id, mt, cu, au, ok
-						}
-					}
-				}
+// importShelves builds the deduplicated custom shelf summary, most used
+// first.
+func importShelves(rows []ImportRow) []importShelf {
+	shelfCounts := map[string]int{}
+	for _, r := range rows {
+		for _, s := range r.CustomShelves {
+			shelfCounts[s]++
+		}
+	}
+	shelves := make([]importShelf, 0, len(shelfCounts))
+	for name, count := range shelfCounts {
+		shelves = append(shelves, importShelf{Name: name, Count: count})
+	}
+	sort.Slice(shelves, func(i, j int) bool {
+		return shelves[i].Count > shelves[j].Count
+	})
+	return shelves
+}
 
-				// 6. Last resort: strip comma-subtitles and retry
-				if !found && pr.Title != "" {
-					cleaned := cleanGoodreadsTitle(pr.Title)
-					if idx := strings.Index(cleaned, ","); idx > 0 {
-						shortened := strings.TrimSpace(cleaned[:idx])
-						if len(shortened) > 3 {
-							cleanedAuthor := cleanGoodreadsAuthor(pr.Author)
-							q := "title=" + url.QueryEscape(shortened)
-							if cleanedAuthor != "" {
-								q += "&author=" + url.QueryEscape(cleanedAuthor)
-							}
-							data, err := ol.get(fmt.Sprintf("/search.json?%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", q))
-							if err == nil {
-								id, mt, cu, au, ok := extractOLSearchResult(data)
-								if ok && titleMatchesResult(shortened, mt) {
-									olID, matchTitle, coverURL, authors, found = id, mt, cu, au, ok
-								}
-							}
-						}
-					}
-				}
+// PreviewImport handles POST /me/import/{source}/preview
+// Streams NDJSON: progress lines followed by a final result line. The result
+// is lost if the client disconnects; import jobs run in the background instead.
+func PreviewImport(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		user := e.Auth
+		if user == nil {
+			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
+		}
 
-				// 7. Google Books fallback — search GB, then map result back to OL
-				if !found {
-					olID, matchTitle, coverURL, authors, found = googleBooksLookup(gb, ol, isbn, cleanGoodreadsTitle(pr.Title), cleanGoodreadsAuthor(pr.Author))
-				}
+		imp, ok := importerFor(e.Request.PathValue("source"))
+		if !ok {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "Unknown import source"})
+		}
 
-				// 8. LLM-powered fuzzy matching — generate title/author permutations
-				// and search OL with each. Returns candidates for user confirmation.
-				if !found && pr.Title != "" {
-					if result := llmFuzzyMatch(ol, pr.Title, pr.Author); result != nil {
-						pr.Status = "ambiguous"
-						for _, c := range result.Candidates {
-							bc := bookCandidate{
-								OLID:    c.OLID,
-								Title:   c.Title,
-								Authors: c.Authors,
-								Year:    c.Year,
-							}
-							if c.CoverURL != "" {
-								bc.CoverURL = &c.CoverURL
-							}
-							pr.Candidates = append(pr.Candidates, bc)
-						}
-					}
-				}
+		file, _, err := e.Request.FormFile("file")
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "CSV file required"})
+		}
+		defer file.Close()
 
-				if found {
-					pr.Status = "matched"
-					match := bookCandidate{
-						OLID:    olID,
-						Title:   matchTitle,
-						Authors: authors,
-					}
-					if match.Title == "" {
-						match.Title = pr.Title
-					}
-					if len(match.Authors) == 0 && pr.Author != "" {
-						match.Authors = []string{pr.Author}
-					}
-					if coverURL != "" {
-						match.CoverURL = &coverURL
-					}
-					pr.Match = &match
-				} else if pr.Status != "ambiguous" {
-					pr.Status = "unmatched"
-				}
+		rows, err := parseImport(imp, file)
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		}
 
-				ch <- progressMsg{Index: i, Row: pr}
-			}(i, row)
+		// Set up NDJSON streaming
+		w := e.Response
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Streaming not supported"})
 		}
+		enc := json.NewEncoder(w)
 
-		go func() {
-			wg.Wait()
-			close(ch)
-		}()
+		todo := make([]int, len(rows))
+		for i := range rows {
+			todo[i] = i
+		}
 
 		// Stream progress as results come in
 		processed := 0
-		for msg := range ch {
-			results[msg.Index] = msg.Row
+		matchImportRows(app, imp, rows, todo, func(i int) {
 			processed++
 			_ = enc.Encode(map[string]any{
 				"type":    "progress",
 				"current": processed,
-				"total":   len(csvRows),
-				"title":   msg.Row.Title,
+				"total":   len(rows),
+				"title":   rows[i].Title,
 			})
 			flusher.Flush()
-		}
-
-		matched := 0
-		ambiguous := 0
-		for _, r := range results {
-			if r.Status == "matched" {
-				matched++
-			} else if r.Status == "ambiguous" {
-				ambiguous++
-			}
-		}
-
-		// Build deduplicated shelf summary with counts
-		shelfCounts := map[string]int{}
-		for _, r := range results {
-			for _, s := range r.CustomShelves {
-				shelfCounts[s]++
-			}
-		}
-		type shelfSummary struct {
-			Name  string `json:"name"`
-			Count int    `json:"count"`
-		}
-		shelves := make([]shelfSummary, 0, len(shelfCounts))
-		for name, count := range shelfCounts {
-			shelves = append(shelves, shelfSummary{Name: name, Count: count})
-		}
-		sort.Slice(shelves, func(i, j int) bool {
-			return shelves[i].Count > shelves[j].Count
 		})
 
 		// Final result line
+		diffImportRows(app, user.Id, imp, rows)
+		matched, ambiguous, unmatched := countImportMatches(rows)
+		added, unchanged, conflicting := countImportDiffs(rows)
 		_ = enc.Encode(map[string]any{
-			"type":      "result",
-			"total":     len(results),
-			"matched":   matched,
-			"ambiguous":  ambiguous,
-			"unmatched": len(results) - matched - ambiguous,
-			"rows":      results,
-			"shelves":   shelves,
+			"type":        "result",
+			"total":       len(rows),
+			"matched":     matched,
+			"ambiguous":   ambiguous,
+			"unmatched":   unmatched,
+			"new":         added,
+			"unchanged":   unchanged,
+			"conflicting": conflicting,
+			"rows":        rows,
+			"shelves":     importShelves(rows),
 		})
 		flusher.Flush()
 
@@ -388,412 +391,420 @@ func PreviewGoodreadsImport(app core.App) func(e *core.RequestEvent) error {
 	}
 }
 
-// CommitGoodreadsImport handles POST /me/import/goodreads/commit
-func CommitGoodreadsImport(app core.App) func(e *core.RequestEvent) error {
-	return func(e *core.RequestEvent) error {
-		user := e.Auth
-		if user == nil {
-			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
-		}
-
-		data := struct {
-			Rows []struct {
-				RowID              int      `json:"row_id"`
-				OLID               string   `json:"ol_id"`
-				Title              string   `json:"title"`
-				CoverURL           string   `json:"cover_url"`
-				Authors            string   `json:"authors"`
-				PublicationYear    int      `json:"publication_year"`
-				ISBN13             string   `json:"isbn13"`
-				Rating             float64  `json:"rating"`
-				ReviewText         string   `json:"review_text"`
-				Spoiler            bool     `json:"spoiler"`
-				DateRead           string   `json:"date_read"`
-				DateAdded          string   `json:"date_added"`
-				ExclusiveShelfSlug string   `json:"exclusive_shelf_slug"`
-				CustomShelves      []string `json:"custom_shelves"`
-			} `json:"rows"`
-			UnmatchedRows []struct {
-				Title              string   `json:"title"`
-				Author             string   `json:"author"`
-				ISBN13             string   `json:"isbn13"`
-				Rating             float64  `json:"rating"`
-				ReviewText         string   `json:"review_text"`
-				DateRead           string   `json:"date_read"`
-				DateAdded          string   `json:"date_added"`
-				ExclusiveShelfSlug string   `json:"exclusive_shelf_slug"`
-				CustomShelves      []string `json:"custom_shelves"`
-			} `json:"unmatched_rows"`
-			ShelfMappings []struct {
-				Shelf      string `json:"shelf"`
-				Action     string `json:"action"` // "tag", "skip", "create_label", "existing_label", "map_dnf"
-				LabelName  string `json:"label_name"`
-				LabelKeyID string `json:"label_key_id"`
-			} `json:"shelf_mappings"`
-		}{}
-		if err := e.BindBody(&data); err != nil {
-			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid request body"})
-		}
+// importCommit is the confirmed preview a client sends to commit an import.
+type importCommit struct {
+	Rows          []importCommitRow    `json:"rows"`
+	UnmatchedRows []importUnmatchedRow `json:"unmatched_rows"`
+	ShelfMappings []importShelfMapping `json:"shelf_mappings"`
+	MergePolicies importMergePolicies  `json:"merge_policies"`
+	QuotesPublic  bool                 `json:"quotes_public"`
+}
 
-		// Build tag map from shelf mappings before processing books
-		type tagMapping struct {
-			KeyID   string
-			ValueID string
-		}
-		tagMap := map[string]tagMapping{}
-		for _, sm := range data.ShelfMappings {
-			switch sm.Action {
-			case "tag":
-				key, val, err := ensureTagKey(app, user.Id, sm.Shelf, "select_multiple")
-				if err != nil {
-					continue
-				}
-				tagMap[sm.Shelf] = tagMapping{KeyID: key.Id, ValueID: val.Id}
+type importCommitRow struct {
+	RowID              int               `json:"row_id"`
+	OLID               string            `json:"ol_id"`
+	Title              string            `json:"title"`
+	CoverURL           string            `json:"cover_url"`
+	Authors            string            `json:"authors"`
+	PublicationYear    int               `json:"publication_year"`
+	ISBN13             string            `json:"isbn13"`
+	Rating             float64           `json:"rating"`
+	ReviewText         string            `json:"review_text"`
+	Spoiler            bool              `json:"spoiler"`
+	DateRead           string            `json:"date_read"`
+	DateAdded          string            `json:"date_added"`
+	ExclusiveShelfSlug string            `json:"exclusive_shelf_slug"`
+	CustomShelves      []string          `json:"custom_shelves"`
+	Highlights         []importHighlight `json:"highlights"`
+	Series             string            `json:"series"`
+	SeriesPosition     *int              `json:"series_position"`
+}
 
-			case "create_label":
-				if sm.LabelName == "" {
-					continue
-				}
-				key, _, err := ensureTagKey(app, user.Id, sm.LabelName, "select_multiple")
-				if err != nil {
-					continue
-				}
-				val, err := ensureTagValue(app, key.Id, sm.Shelf)
-				if err != nil {
-					continue
-				}
-				tagMap[sm.Shelf] = tagMapping{KeyID: key.Id, ValueID: val.Id}
+type importUnmatchedRow struct {
+	Title              string            `json:"title"`
+	Author             string            `json:"author"`
+	ISBN13             string            `json:"isbn13"`
+	Rating             float64           `json:"rating"`
+	ReviewText         string            `json:"review_text"`
+	DateRead           string            `json:"date_read"`
+	DateAdded          string            `json:"date_added"`
+	ExclusiveShelfSlug string            `json:"exclusive_shelf_slug"`
+	CustomShelves      []string          `json:"custom_shelves"`
+	Highlights         []importHighlight `json:"highlights"`
+}
 
-			case "existing_label":
-				if sm.LabelKeyID == "" {
-					continue
-				}
-				key, err := app.FindRecordById("tag_keys", sm.LabelKeyID)
-				if err != nil || key.GetString("user") != user.Id {
-					continue
-				}
-				val, err := ensureTagValue(app, key.Id, sm.Shelf)
-				if err != nil {
-					continue
-				}
-				tagMap[sm.Shelf] = tagMapping{KeyID: key.Id, ValueID: val.Id}
-			}
-		}
+type importShelfMapping struct {
+	Shelf      string `json:"shelf"`
+	Action     string `json:"action"` // "tag", "skip", "create_label", "existing_label", "map_dnf"
+	LabelName  string `json:"label_name"`
+	LabelKeyID string `json:"label_key_id"`
+}
 
-		// Collect shelves mapped to DNF status
-		dnfShelves := map[string]bool{}
-		for _, sm := range data.ShelfMappings {
-			if sm.Action == "map_dnf" {
-				dnfShelves[sm.Shelf] = true
-			}
-		}
+// importResult is the outcome of committing an import.
+type importResult struct {
+	Imported     int      `json:"imported"`
+	Unchanged    int      `json:"unchanged"`
+	Failed       int      `json:"failed"`
+	Errors       []string `json:"errors"`
+	PendingSaved int      `json:"pending_saved"`
+}
 
-		imported := 0
-		failed := 0
-		var errors []string
+func (r *importResult) add(changed bool, err error) {
+	switch {
+	case err != nil:
+		r.Failed++
+		r.Errors = append(r.Errors, err.Error())
+	case changed:
+		r.Imported++
+	default:
+		r.Unchanged++
+	}
+}
 
-		for _, b := range data.Rows {
-			if b.OLID == "" {
-				failed++
-				errors = append(errors, fmt.Sprintf("No match for row %d: %s", b.RowID, b.Title))
-				continue
-			}
+// importTag is the tag a custom shelf is mapped to.
+type importTag struct {
+	KeyID   string
+	ValueID string
+}
 
-			// Upsert book
-			book, err := upsertBook(app, b.OLID, b.Title, b.CoverURL, b.ISBN13, b.Authors, b.PublicationYear, "")
+// importShelfTags creates or finds the tags shelf mappings point at, and
+// collects the shelves mapped to DNF status. Mappings that can't be
+// resolved are skipped.
+func importShelfTags(app core.App, userID string, mappings []importShelfMapping) (map[string]importTag, map[string]bool) {
+	tagMap := map[string]importTag{}
+	dnfShelves := map[string]bool{}
+	for _, sm := range mappings {
+		switch sm.Action {
+		case "tag":
+			key, val, err := ensureTagKey(app, userID, sm.Shelf, "select_multiple")
 			if err != nil {
-				failed++
-				errors = append(errors, fmt.Sprintf("Failed to save book: %s — %v", b.Title, err))
 				continue
 			}
+			tagMap[sm.Shelf] = importTag{KeyID: key.Id, ValueID: val.Id}
 
-			// Upsert user_book
-			existing, _ := app.FindRecordsByFilter("user_books",
-				"user = {:user} && book = {:book}",
-				"", 1, 0,
-				map[string]any{"user": user.Id, "book": book.Id},
-			)
-			var ub *core.Record
-			if len(existing) > 0 {
-				ub = existing[0]
-			} else {
-				coll, err := app.FindCollectionByNameOrId("user_books")
-				if err != nil {
-					failed++
-					errors = append(errors, fmt.Sprintf("Failed to create user_book: %s — %v", b.Title, err))
-					continue
-				}
-				ub = core.NewRecord(coll)
-				ub.Set("user", user.Id)
-				ub.Set("book", book.Id)
-			}
-
-			if b.Rating > 0 {
-				ub.Set("rating", b.Rating)
-			}
-			if b.ReviewText != "" {
-				ub.Set("review_text", b.ReviewText)
-			}
-			if b.DateRead != "" {
-				ub.Set("date_read", b.DateRead)
+		case "create_label":
+			if sm.LabelName == "" {
+				continue
 			}
-			dateAdded := b.DateAdded
-			if dateAdded == "" {
-				dateAdded = time.Now().UTC().Format(time.RFC3339)
+			key, _, err := ensureTagKey(app, userID, sm.LabelName, "select_multiple")
+			if err != nil {
+				continue
 			}
-			ub.Set("date_added", dateAdded)
-
-			if err := app.Save(ub); err != nil {
-				failed++
-				errors = append(errors, fmt.Sprintf("Failed to save user_book: %s — %v", b.Title, err))
+			val, err := ensureTagValue(app, key.Id, sm.Shelf)
+			if err != nil {
 				continue
 			}
+			tagMap[sm.Shelf] = importTag{KeyID: key.Id, ValueID: val.Id}
 
-			// Map exclusive shelf to status tag
-			statusSlug := mapGoodreadsShelf(b.ExclusiveShelfSlug)
-			if statusSlug != "" {
-				setStatusTag(app, user.Id, book.Id, statusSlug)
+		case "existing_label":
+			if sm.LabelKeyID == "" {
+				continue
 			}
-
-			// Assign custom shelf tags
-			for _, shelf := range b.CustomShelves {
-				tm, ok := tagMap[shelf]
-				if !ok {
-					continue
-				}
-				dup, _ := app.FindRecordsByFilter("book_tag_values",
-					"user = {:user} && book = {:book} && tag_key = {:key} && tag_value = {:val}",
-					"", 1, 0,
-					map[string]any{"user": user.Id, "book": book.Id, "key": tm.KeyID, "val": tm.ValueID},
-				)
-				if len(dup) > 0 {
-					continue
-				}
-				btvColl, err := app.FindCollectionByNameOrId("book_tag_values")
-				if err != nil {
-					continue
-				}
-				btv := core.NewRecord(btvColl)
-				btv.Set("user", user.Id)
-				btv.Set("book", book.Id)
-				btv.Set("tag_key", tm.KeyID)
-				btv.Set("tag_value", tm.ValueID)
-				_ = app.Save(btv)
+			key, err := app.FindRecordById("tag_keys", sm.LabelKeyID)
+			if err != nil || key.GetString("user") != userID {
+				continue
 			}
-
-			// Override status to DNF if any custom shelf is mapped to DNF
-			for _, shelf := range b.CustomShelves {
-				if dnfShelves[shelf] {
-					setStatusTag(app, user.Id, book.Id, "dnf")
-					break
-				}
+			val, err := ensureTagValue(app, key.Id, sm.Shelf)
+			if err != nil {
+				continue
 			}
+			tagMap[sm.Shelf] = importTag{KeyID: key.Id, ValueID: val.Id}
 
-			imported++
-			refreshBookStats(app, book.Id)
+		case "map_dnf":
+			dnfShelves[sm.Shelf] = true
 		}
+	}
+	return tagMap, dnfShelves
+}
 
-		// Persist unmatched rows to pending_imports
-		pendingSaved := 0
-		if len(data.UnmatchedRows) > 0 {
-			piColl, piErr := app.FindCollectionByNameOrId("pending_imports")
-			if piErr == nil {
-				for _, u := range data.UnmatchedRows {
-					if u.Title == "" {
-						continue
-					}
-					pi := core.NewRecord(piColl)
-					pi.Set("user", user.Id)
-					pi.Set("source", "goodreads")
-					pi.Set("title", u.Title)
-					pi.Set("author", u.Author)
-					pi.Set("isbn13", u.ISBN13)
-					pi.Set("exclusive_shelf", u.ExclusiveShelfSlug)
-					if u.CustomShelves != nil {
-						pi.Set("custom_shelves", u.CustomShelves)
-					} else {
-						pi.Set("custom_shelves", []string{})
-					}
-					if u.Rating > 0 {
-						pi.Set("rating", u.Rating)
-					}
-					pi.Set("review_text", u.ReviewText)
-					pi.Set("date_read", u.DateRead)
-					pi.Set("date_added", u.DateAdded)
-					pi.Set("status", "unmatched")
-					if err := app.Save(pi); err == nil {
-						pendingSaved++
-					}
-				}
-			}
-		}
+// importPlan is what every row of a commit is written with.
+type importPlan struct {
+	userID     string
+	imp        Importer
+	batch      *importBatch
+	tagMap     map[string]importTag
+	dnfShelves map[string]bool
+	policies   importMergePolicies
+	// quotesPublic makes imported highlights public quotes.
+	quotesPublic bool
+}
 
-		return e.JSON(http.StatusOK, map[string]any{
-			"imported":      imported,
-			"failed":        failed,
-			"errors":        errors,
-			"pending_saved": pendingSaved,
-		})
-	}
+// newImportPlan resolves a commit's shelf mappings into tags, logging any
+// tags it creates to batch.
+func newImportPlan(app core.App, userID string, imp Importer, batch *importBatch, data importCommit) (*importPlan, error) {
+	plan := &importPlan{
+		userID:       userID,
+		imp:          imp,
+		batch:        batch,
+		policies:     data.MergePolicies,
+		quotesPublic: data.QuotesPublic,
+	}
+	err := batch.track("", func() error {
+		plan.tagMap, plan.dnfShelves = importShelfTags(app, userID, data.ShelfMappings)
+		return nil
+	})
+	return plan, err
 }
 
-func mapGoodreadsShelf(shelf string) string {
-	switch strings.ToLower(shelf) {
-	case "to-read":
-		return "want-to-read"
-	case "currently-reading":
-		return "currently-reading"
-	case "read":
-		return "finished"
-	default:
-		return ""
+// commitImportRow writes one confirmed row: the book, then either the
+// user's shelf entry, its status and its custom shelf tags, or the row's
+// highlights as quotes. Changes to the user's records are logged to the
+// batch. It reports whether anything changed; unchanged rows leave no trace.
+func commitImportRow(app core.App, plan *importPlan, b importCommitRow) (bool, error) {
+	if b.OLID == "" {
+		return false, fmt.Errorf("No match for row %d: %s", b.RowID, b.Title)
 	}
-}
 
-// cleanGoodreadsTitle strips junk that Goodreads CSV titles commonly include.
-//
-// Examples:
-//
-//	"Children of Ruin (Children of Time, #2)" → "Children of Ruin"
-//	"Skunk Works: A Personal Memoir of My Years at Lockheed" → "Skunk Works"
-//	"Red Harvest by Dashiell Hammett (July 17 1989)" → "Red Harvest"
-//	"All Men Are Brothers by Gandhi,Mohandas K.. [2005] Paperback" → "All Men Are Brothers"
-//	"Man Plus (S.F. MASTERWORKS) by Pohl, Frederik New Edition (2000)" → "Man Plus"
-//	"Survival in Auschwitz[SURVIVAL IN AUSCHWITZ][Paperback]" → "Survival in Auschwitz"
-//	"The Wealth of Nations/Books I-III" → "The Wealth of Nations"
-//	"Destinies, Feb 1980 | The Science Fiction Magazine" → "Destinies"
-//	"[(The Soul of a Butterfly)] [by: Muhammad Ali]" → "The Soul of a Butterfly"
-func cleanGoodreadsTitle(title string) string {
-	// Strip [ and ] characters but keep inner content. This handles both
-	// metadata tags like [Hardcover] and decorative brackets like [(Title)].
-	// The inner content (format words, repeated titles, etc.) is cleaned
-	// by the later steps.
-	title = strings.NewReplacer("[", "", "]", "").Replace(title)
-	title = strings.TrimSpace(title)
-
-	// Strip everything from " by " or " by:" onward (embedded author/edition info).
-	// Only strip if " by" appears after at least two words so we don't break
-	// titles like "Stand by Me".
-	lower := strings.ToLower(title)
-	for _, sep := range []string{" by ", " by:"} {
-		if idx := strings.Index(lower, sep); idx > 0 {
-			before := strings.TrimSpace(title[:idx])
-			if strings.Contains(before, " ") {
-				title = before
-				break
-			}
+	// Upsert book
+	book, err := upsertBook(app, b.OLID, b.Title, b.CoverURL, b.ISBN13, b.Authors, b.PublicationYear, "")
+	if err != nil {
+		return false, fmt.Errorf("Failed to save book: %s — %v", b.Title, err)
+	}
+	// Series are catalog data, shared by every reader, so they aren't part
+	// of the batch and stay when it's reverted.
+	if b.Series != "" {
+		if err := ensureBookSeries(app, book.Id, b.Series, b.SeriesPosition); err != nil {
+			return false, fmt.Errorf("Failed to save series: %s — %v", b.Title, err)
 		}
 	}
 
-	// Strip leading "By Author Name " prefix when title starts with "By "
-	// and the real title follows. Detect by checking if stripping "By <words>"
-	// still leaves a multi-word remainder.
-	if strings.HasPrefix(title, "By ") {
-		rest := title[3:]
-		for _, sep := range []string{" The ", " A ", " An "} {
-			if idx := strings.Index(rest, sep); idx > 0 {
-				candidate := strings.TrimSpace(rest[idx:])
-				if len(candidate) > 3 {
-					title = candidate
-					break
-				}
+	var changed bool
+	err = plan.batch.track(book.Id, func() error {
+		var err error
+		if len(b.Highlights) > 0 {
+			changed, err = saveImportHighlights(app, plan.userID, book.Id, b.Highlights, plan.quotesPublic)
+			if err != nil {
+				err = fmt.Errorf("Failed to save quotes: %s — %v", b.Title, err)
 			}
+			return err
 		}
+		changed, err = commitImportShelf(app, plan, book.Id, b)
+		return err
+	})
+	if err != nil {
+		return false, err
 	}
+	return changed, nil
+}
 
-	// Strip trailing parenthetical content: "(Series Name, #N)", "(2000)", etc.
-	// Repeat to handle nested cases like "Title (A) by Author (2000)"
-	for {
-		idx := strings.LastIndex(title, "(")
-		if idx <= 0 {
-			break
+// commitImportShelf puts a row's book on the user's shelves, merging it
+// into an existing entry field by field.
+func commitImportShelf(app core.App, plan *importPlan, bookID string, b importCommitRow) (bool, error) {
+	userID := plan.userID
+	entry, err := loadImportEntry(app, userID, bookID)
+	if err != nil {
+		return false, fmt.Errorf("Failed to load user_book: %s — %v", b.Title, err)
+	}
+	ub := entry.userBook
+	changed := ub == nil
+	if ub == nil {
+		coll, err := app.FindCollectionByNameOrId("user_books")
+		if err != nil {
+			return false, fmt.Errorf("Failed to create user_book: %s — %v", b.Title, err)
 		}
-		title = strings.TrimSpace(title[:idx])
+		ub = core.NewRecord(coll)
+		ub.Set("user", userID)
+		ub.Set("book", bookID)
+		ub.Set("date_added", time.Now().UTC().Format(time.RFC3339))
 	}
 
-	// Strip wrapping parens left over from decorative brackets: "(Title)" → "Title"
-	if strings.HasPrefix(title, "(") && strings.HasSuffix(title, ")") {
-		title = title[1 : len(title)-1]
+	// A custom shelf mapped to DNF overrides the exclusive shelf's status.
+	src := importValues{
+		Rating:     b.Rating,
+		ReviewText: b.ReviewText,
+		DateRead:   b.DateRead,
+		DateAdded:  b.DateAdded,
+		Status:     plan.imp.Status(b.ExclusiveShelfSlug),
 	}
-
-	// Strip " | " pipe-separated subtitles
-	if idx := strings.Index(title, " | "); idx > 0 {
-		title = strings.TrimSpace(title[:idx])
+	for _, shelf := range b.CustomShelves {
+		if plan.dnfShelves[shelf] {
+			src.Status = "dnf"
+			break
+		}
 	}
-	if idx := strings.Index(title, "|"); idx > 0 {
-		title = strings.TrimSpace(title[:idx])
+
+	// dirty is whether the user_book itself needs saving; changed also
+	// covers its status and tags.
+	dirty := changed
+	statusSlug := ""
+	for _, c := range entry.diff(src) {
+		if !plan.policies.takeSource(c, entry, src) {
+			continue
+		}
+		changed = true
+		if c.Field != "status" {
+			dirty = true
+		}
+		switch c.Field {
+		case "rating":
+			ub.Set("rating", src.Rating)
+		case "review_text":
+			ub.Set("review_text", src.ReviewText)
+		case "date_read":
+			ub.Set("date_read", normalizeImportDate(src.DateRead))
+		case "date_added":
+			ub.Set("date_added", normalizeImportDate(src.DateAdded))
+		case "status":
+			statusSlug = src.Status
+		}
 	}
 
-	// Strip "/subtitle" (but not mid-word slashes)
-	if idx := strings.Index(title, "/"); idx > 0 {
-		title = strings.TrimSpace(title[:idx])
+	if dirty {
+		if err := app.Save(ub); err != nil {
+			return false, fmt.Errorf("Failed to save user_book: %s — %v", b.Title, err)
+		}
 	}
 
-	// Strip subtitle after colon
-	if idx := strings.Index(title, ":"); idx > 0 {
-		title = strings.TrimSpace(title[:idx])
+	// Map exclusive shelf to status tag
+	if statusSlug != "" {
+		setStatusTag(app, userID, bookID, statusSlug)
 	}
 
-	// Strip trailing junk words: "Paperback", "Hardcover", "Mass Market", edition years
-	for {
-		trimmed := strings.TrimRight(title, " .,")
-		changed := false
-		for _, suffix := range []string{"Paperback", "Hardcover", "Mass Market"} {
-			if strings.HasSuffix(trimmed, suffix) {
-				trimmed = strings.TrimSpace(trimmed[:len(trimmed)-len(suffix)])
-				changed = true
-			}
+	// Assign custom shelf tags
+	for _, shelf := range b.CustomShelves {
+		tm, ok := plan.tagMap[shelf]
+		if !ok {
+			continue
 		}
-		title = trimmed
-		if !changed {
-			break
+		dup, _ := app.FindRecordsByFilter("book_tag_values",
+			"user = {:user} && book = {:book} && tag_key = {:key} && tag_value = {:val}",
+			"", 1, 0,
+			map[string]any{"user": userID, "book": bookID, "key": tm.KeyID, "val": tm.ValueID},
+		)
+		if len(dup) > 0 {
+			continue
+		}
+		btvColl, err := app.FindCollectionByNameOrId("book_tag_values")
+		if err != nil {
+			continue
+		}
+		btv := core.NewRecord(btvColl)
+		btv.Set("user", userID)
+		btv.Set("book", bookID)
+		btv.Set("tag_key", tm.KeyID)
+		btv.Set("tag_value", tm.ValueID)
+		if app.Save(btv) == nil {
+			changed = true
 		}
 	}
 
-	return strings.TrimSpace(title)
+	return changed, nil
 }
 
-// cleanGoodreadsAuthor returns a cleaned author name suitable for OL search,
-// or empty string if the author should be skipped (unknown, mangled, etc.).
-func cleanGoodreadsAuthor(author string) string {
-	author = strings.TrimSpace(author)
-	if author == "" {
-		return ""
-	}
+// savePendingImports persists unmatched rows to pending_imports for later
+// resolution, stamped with the import batch, and returns how many were
+// saved. Rows an earlier import from the same source already left pending
+// are skipped.
+func savePendingImports(app core.App, userID, source, batchID string, rows []importUnmatchedRow) int {
+	if len(rows) == 0 {
+		return 0
+	}
+	piColl, err := app.FindCollectionByNameOrId("pending_imports")
+	if err != nil {
+		return 0
+	}
+
+	saved := 0
+	for _, u := range rows {
+		if u.Title == "" {
+			continue
+		}
+		// Highlights already waiting for the book aren't saved twice; new
+		// ones get a pending import of their own.
+		if len(u.Highlights) > 0 {
+			u.Highlights = unsavedHighlights(pendingHighlights(app, userID, source, u.Title, u.Author), u.Highlights)
+			if len(u.Highlights) == 0 {
+				continue
+			}
+		} else if hasPendingImport(app, userID, source, u.Title, u.Author) {
+			continue
+		}
+		pi := core.NewRecord(piColl)
+		pi.Set("user", userID)
+		pi.Set("source", source)
+		pi.Set("title", u.Title)
+		pi.Set("author", u.Author)
+		pi.Set("isbn13", u.ISBN13)
+		pi.Set("exclusive_shelf", u.ExclusiveShelfSlug)
+		if u.CustomShelves != nil {
+			pi.Set("custom_shelves", u.CustomShelves)
+		} else {
+			pi.Set("custom_shelves", []string{})
+		}
+		if u.Rating > 0 {
+			pi.Set("rating", u.Rating)
+		}
+		pi.Set("review_text", u.ReviewText)
+		pi.Set("date_read", u.DateRead)
+		pi.Set("date_added", u.DateAdded)
+		if len(u.Highlights) > 0 {
+			pi.Set("highlights", u.Highlights)
+		}
+		pi.Set("status", "unmatched")
+		pi.Set("import_batch", batchID)
+		if err := app.Save(pi); err == nil {
+			saved++
+		}
+	}
+	return saved
+}
 
-	lower := strings.ToLower(author)
+// CommitImport handles POST /me/import/{source}/commit
+// Writes the confirmed preview in the request and returns the result.
+func CommitImport(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		user := e.Auth
+		if user == nil {
+			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
+		}
 
-	// Skip placeholder/unknown authors
-	if lower == "unknown author" || lower == "unknown" || lower == "various" || lower == "anonymous" {
-		return ""
-	}
+		imp, ok := importerFor(e.Request.PathValue("source"))
+		if !ok {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "Unknown import source"})
+		}
 
-	// Skip mangled multi-author with semicolons ("Leo ; Bradbury Margulies")
-	if strings.Contains(author, ";") {
-		return ""
-	}
+		var data importCommit
+		if err := e.BindBody(&data); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid request body"})
+		}
+		if err := data.MergePolicies.validate(); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		}
 
-	// Skip concatenated names with no space ("PrimoLevi") — real names have spaces
-	if !strings.Contains(author, " ") && len(author) > 1 {
-		return ""
-	}
+		batch, err := newImportBatch(app, user.Id, imp.Source(), "")
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to start import"})
+		}
 
-	// Strip single-letter middle initials: "Balaji S. Srinivasan" → "Balaji Srinivasan"
-	// OL often doesn't index middle initials.
-	parts := strings.Fields(author)
-	var cleaned []string
-	for _, p := range parts {
-		trimmed := strings.TrimRight(p, ".")
-		if len(trimmed) == 1 && trimmed == strings.ToUpper(trimmed) {
-			continue // skip single-letter initials
+		plan, err := newImportPlan(app, user.Id, imp, batch, data)
+		if err != nil {
+			log.Printf("[Import] plan batch %s: %v", batch.record.Id, err)
+			// Close the batch so whatever tags it logged can be reverted.
+			if err := batch.finish(importResult{}); err != nil {
+				log.Printf("[Import] finish batch %s: %v", batch.record.Id, err)
+			}
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to start import"})
 		}
-		cleaned = append(cleaned, p)
-	}
-	if len(cleaned) > 0 {
-		author = strings.Join(cleaned, " ")
-	}
 
-	return author
+		var result importResult
+		for _, b := range data.Rows {
+			result.add(commitImportRow(app, plan, b))
+		}
+		result.PendingSaved = savePendingImports(app, user.Id, imp.Source(), batch.record.Id, data.UnmatchedRows)
+
+		if err := batch.finish(result); err != nil {
+			log.Printf("[Import] finish batch %s: %v", batch.record.Id, err)
+		}
+
+		return e.JSON(http.StatusOK, map[string]any{
+			"imported":      result.Imported,
+			"unchanged":     result.Unchanged,
+			"failed":        result.Failed,
+			"errors":        result.Errors,
+			"pending_saved": result.PendingSaved,
+			"batch_id":      batch.record.Id,
+		})
+	}
 }
 
 // stripAuthorPrefix removes author name from the beginning of a title.
@@ -918,1334 +929,3 @@ func extractOLSearchResult(data map[string]any) (olID, matchTitle, coverURL stri
 	}
 	return
 }
-
-// PreviewStoryGraphImport handles POST /me/import/storygraph/preview
-// Streams NDJSON: progress lines followed by a final result line.
-func PreviewStoryGraphImport(app core.App) func(e *core.RequestEvent) error {
-	return func(e *core.RequestEvent) error {
-		user := e.Auth
-		if user == nil {
-			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
-		}
-
-		file, _, err := e.Request.FormFile("file")
-		if err != nil {
-			return e.JSON(http.StatusBadRequest, map[string]any{"error": "CSV file required"})
-		}
-		defer file.Close()
-
-		reader := csv.NewReader(file)
-		headers, err := reader.Read()
-		if err != nil {
-			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid CSV"})
-		}
-
-		colIdx := map[string]int{}
-		for i, h := range headers {
-			colIdx[strings.TrimSpace(h)] = i
-		}
-
-		requiredCols := []string{"Title"}
-		for _, c := range requiredCols {
-			if _, ok := colIdx[c]; !ok {
-				return e.JSON(http.StatusBadRequest, map[string]any{"error": fmt.Sprintf("Missing column: %s", c)})
-			}
-		}
-
-		type bookCandidate struct {
-			OLID     string   `json:"ol_id"`
-			Title    string   `json:"title"`
-			Authors  []string `json:"authors"`
-			CoverURL *string  `json:"cover_url"`
-			Year     *int     `json:"year"`
-		}
-		type previewRow struct {
-			RowID              int              `json:"row_id"`
-			Title              string           `json:"title"`
-			Author             string           `json:"author"`
-			ISBN13             string           `json:"isbn13"`
-			Rating             *float64         `json:"rating"`
-			ReviewText         *string          `json:"review_text"`
-			Spoiler            bool             `json:"spoiler"`
-			DateRead           *string          `json:"date_read"`
-			DateAdded          *string          `json:"date_added"`
-			ExclusiveShelfSlug string           `json:"exclusive_shelf_slug"`
-			CustomShelves      []string         `json:"custom_shelves"`
-			Status             string           `json:"status"`
-			Match              *bookCandidate   `json:"match,omitempty"`
-			Candidates         []bookCandidate  `json:"candidates,omitempty"`
-		}
-
-		var csvRows [][]string
-		for {
-			row, err := reader.Read()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				continue
-			}
-			csvRows = append(csvRows, row)
-		}
-
-		results := make([]previewRow, len(csvRows))
-		ol := newOLClient()
-		gb := newGBClient()
-
-		var wg sync.WaitGroup
-		sem := make(chan struct{}, 5)
-
-		getCol := func(row []string, name string) string {
-			if idx, ok := colIdx[name]; ok && idx < len(row) {
-				return strings.TrimSpace(row[idx])
-			}
-			return ""
-		}
-
-		// Set up NDJSON streaming
-		w := e.Response
-		w.Header().Set("Content-Type", "application/x-ndjson")
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		flusher, ok := w.(http.Flusher)
-		if !ok {
-			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Streaming not supported"})
-		}
-		enc := json.NewEncoder(w)
-
-		type progressMsg struct {
-			Index int
-			Row   previewRow
-		}
-		ch := make(chan progressMsg, len(csvRows))
-
-		for i, row := range csvRows {
-			wg.Add(1)
-			go func(i int, row []string) {
-				defer wg.Done()
-				sem <- struct{}{}
-				defer func() { <-sem }()
-
-				pr := previewRow{
-					RowID:  i,
-					Title:  getCol(row, "Title"),
-					Author: getCol(row, "Authors"),
-				}
-
-				// StoryGraph uses "ISBN/UID" column
-				isbn := strings.TrimSpace(getCol(row, "ISBN/UID"))
-
-				// Map StoryGraph read status
-				pr.ExclusiveShelfSlug = strings.ToLower(getCol(row, "Read Status"))
-
-				if r, err := strconv.ParseFloat(getCol(row, "Star Rating"), 64); err == nil && r > 0 {
-					pr.Rating = &r
-				}
-				if review := getCol(row, "Review"); review != "" {
-					pr.ReviewText = &review
-				}
-
-				// Parse Read Dates — may be a range "2024/01/15-2024/02/20" or single date
-				if dates := getCol(row, "Read Dates"); dates != "" {
-					parts := strings.SplitN(dates, "-", 2)
-					// Take the last date as date_read (finish date)
-					lastDate := strings.TrimSpace(parts[len(parts)-1])
-					if lastDate != "" {
-						// Normalize slashes to dashes for consistency
-						lastDate = strings.ReplaceAll(lastDate, "/", "-")
-						pr.DateRead = &lastDate
-					}
-				}
-
-				// Parse Tags column — comma-separated tags become custom shelves
-				if tags := getCol(row, "Tags"); tags != "" {
-					for _, t := range strings.Split(tags, ",") {
-						t = strings.TrimSpace(t)
-						if t != "" {
-							pr.CustomShelves = append(pr.CustomShelves, t)
-						}
-					}
-				}
-				if pr.CustomShelves == nil {
-					pr.CustomShelves = []string{}
-				}
-
-				pr.ISBN13 = isbn
-
-				found := false
-				var olID, matchTitle, coverURL string
-				var authors []string
-
-				// 1. Check local DB by ISBN
-				if isbn != "" {
-					existing, localErr := app.FindRecordsByFilter("books",
-						"isbn13 = {:isbn}",
-						"", 1, 0,
-						map[string]any{"isbn": isbn},
-					)
-					if localErr == nil && len(existing) > 0 {
-						rec := existing[0]
-						olID = rec.GetString("open_library_id")
-						matchTitle = rec.GetString("title")
-						coverURL = rec.GetString("cover_url")
-						if a := rec.GetString("authors"); a != "" {
-							authors = strings.Split(a, ", ")
-						}
-						found = olID != ""
-					}
-				}
-
-				// 2. OL direct ISBN endpoint
-				if isbn != "" && !found {
-					data, err := ol.get(fmt.Sprintf("/isbn/%s.json", isbn))
-					if err == nil {
-						if works, ok := data["works"].([]any); ok && len(works) > 0 {
-							if w, ok := works[0].(map[string]any); ok {
-								if key, ok := w["key"].(string); ok {
-									olID = strings.TrimPrefix(key, "/works/")
-									found = true
-								}
-							}
-						}
-						if t, ok := data["title"].(string); ok {
-							matchTitle = t
-						}
-						if covers, ok := data["covers"].([]any); ok && len(covers) > 0 {
-							if coverID, ok := covers[0].(float64); ok {
-								coverURL = fmt.Sprintf("https://covers.openlibrary.org/b/id/%.0f-M.jpg", coverID)
-							}
-						}
-					}
-				}
-
-				// 3. OL search by ISBN
-				if isbn != "" && !found {
-					data, err := ol.get(fmt.Sprintf("/search.json?isbn=%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", url.QueryEscape(isbn)))
-					if err == nil {
-						olID, matchTitle, coverURL, authors, found = extractOLSearchResult(data)
-					}
-				}
-
-				// 4. OL search by title+author
-				if !found && pr.Title != "" {
-					cleaned := cleanStoryGraphTitle(pr.Title)
-					cleanedAuthor := cleanStoryGraphAuthor(pr.Author)
-					q := "title=" + url.QueryEscape(cleaned)
-					if cleanedAuthor != "" {
-						q += "&author=" + url.QueryEscape(cleanedAuthor)
-					}
-					data, err := ol.get(fmt.Sprintf("/search.json?%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", q))
-					if err == nil {
-						olID, matchTitle, coverURL, authors, found = extractOLSearchResult(data)
-					}
-				}
-
-				// 5. OL search by title only
-				if !found && pr.Title != "" {
-					cleaned := cleanStoryGraphTitle(pr.Title)
-					data, err := ol.get(fmt.Sprintf("/search.json?title=%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", url.QueryEscape(cleaned)))
-					if err == nil {
-						id, mt, cu, au, ok := extractOLSearchResult(data)
-						if ok && titleMatchesResult(cleaned, mt) {
-							olID, matchTitle, coverURL, authors, found = id, mt, cu, au, ok
-						}
-					}
-				}
-
-				// 6. Google Books fallback
-				if !found {
-					olID, matchTitle, coverURL, authors, found = googleBooksLookup(gb, ol, isbn, cleanStoryGraphTitle(pr.Title), cleanStoryGraphAuthor(pr.Author))
-				}
-
-				// 7. LLM-powered fuzzy matching — generate title/author permutations
-				// and search OL with each. Returns candidates for user confirmation.
-				if !found && pr.Title != "" {
-					if result := llmFuzzyMatch(ol, pr.Title, pr.Author); result != nil {
-						pr.Status = "ambiguous"
-						for _, c := range result.Candidates {
-							bc := bookCandidate{
-								OLID:    c.OLID,
-								Title:   c.Title,
-								Authors: c.Authors,
-								Year:    c.Year,
-							}
-							if c.CoverURL != "" {
-								bc.CoverURL = &c.CoverURL
-							}
-							pr.Candidates = append(pr.Candidates, bc)
-						}
-					}
-				}
-
-				if found {
-					pr.Status = "matched"
-					match := bookCandidate{
-						OLID:    olID,
-						Title:   matchTitle,
-						Authors: authors,
-					}
-					if match.Title == "" {
-						match.Title = pr.Title
-					}
-					if len(match.Authors) == 0 && pr.Author != "" {
-						match.Authors = []string{pr.Author}
-					}
-					if coverURL != "" {
-						match.CoverURL = &coverURL
-					}
-					pr.Match = &match
-				} else if pr.Status != "ambiguous" {
-					pr.Status = "unmatched"
-				}
-
-				ch <- progressMsg{Index: i, Row: pr}
-			}(i, row)
-		}
-
-		go func() {
-			wg.Wait()
-			close(ch)
-		}()
-
-		processed := 0
-		for msg := range ch {
-			results[msg.Index] = msg.Row
-			processed++
-			_ = enc.Encode(map[string]any{
-				"type":    "progress",
-				"current": processed,
-				"total":   len(csvRows),
-				"title":   msg.Row.Title,
-			})
-			flusher.Flush()
-		}
-
-		matched := 0
-		ambiguous := 0
-		for _, r := range results {
-			if r.Status == "matched" {
-				matched++
-			} else if r.Status == "ambiguous" {
-				ambiguous++
-			}
-		}
-
-		// Build deduplicated shelf summary (tags) with counts
-		shelfCounts := map[string]int{}
-		for _, r := range results {
-			for _, s := range r.CustomShelves {
-				shelfCounts[s]++
-			}
-		}
-		type shelfSummary struct {
-			Name  string `json:"name"`
-			Count int    `json:"count"`
-		}
-		shelves := make([]shelfSummary, 0, len(shelfCounts))
-		for name, count := range shelfCounts {
-			shelves = append(shelves, shelfSummary{Name: name, Count: count})
-		}
-		sort.Slice(shelves, func(i, j int) bool {
-			return shelves[i].Count > shelves[j].Count
-		})
-
-		_ = enc.Encode(map[string]any{
-			"type":      "result",
-			"total":     len(results),
-			"matched":   matched,
-			"ambiguous":  ambiguous,
-			"unmatched": len(results) - matched - ambiguous,
-			"rows":      results,
-			"shelves":   shelves,
-		})
-		flusher.Flush()
-
-		return nil
-	}
-}
-
-// CommitStoryGraphImport handles POST /me/import/storygraph/commit
-func CommitStoryGraphImport(app core.App) func(e *core.RequestEvent) error {
-	return func(e *core.RequestEvent) error {
-		user := e.Auth
-		if user == nil {
-			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
-		}
-
-		data := struct {
-			Rows []struct {
-				RowID              int      `json:"row_id"`
-				OLID               string   `json:"ol_id"`
-				Title              string   `json:"title"`
-				CoverURL           string   `json:"cover_url"`
-				Authors            string   `json:"authors"`
-				PublicationYear    int      `json:"publication_year"`
-				ISBN13             string   `json:"isbn13"`
-				Rating             float64  `json:"rating"`
-				ReviewText         string   `json:"review_text"`
-				Spoiler            bool     `json:"spoiler"`
-				DateRead           string   `json:"date_read"`
-				DateAdded          string   `json:"date_added"`
-				ExclusiveShelfSlug string   `json:"exclusive_shelf_slug"`
-				CustomShelves      []string `json:"custom_shelves"`
-			} `json:"rows"`
-			UnmatchedRows []struct {
-				Title              string   `json:"title"`
-				Author             string   `json:"author"`
-				ISBN13             string   `json:"isbn13"`
-				Rating             float64  `json:"rating"`
-				ReviewText         string   `json:"review_text"`
-				DateRead           string   `json:"date_read"`
-				DateAdded          string   `json:"date_added"`
-				ExclusiveShelfSlug string   `json:"exclusive_shelf_slug"`
-				CustomShelves      []string `json:"custom_shelves"`
-			} `json:"unmatched_rows"`
-			ShelfMappings []struct {
-				Shelf      string `json:"shelf"`
-				Action     string `json:"action"`
-				LabelName  string `json:"label_name"`
-				LabelKeyID string `json:"label_key_id"`
-			} `json:"shelf_mappings"`
-		}{}
-		if err := e.BindBody(&data); err != nil {
-			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid request body"})
-		}
-
-		// Build tag map from shelf mappings
-		type tagMapping struct {
-			KeyID   string
-			ValueID string
-		}
-		tagMap := map[string]tagMapping{}
-		for _, sm := range data.ShelfMappings {
-			switch sm.Action {
-			case "tag":
-				key, val, err := ensureTagKey(app, user.Id, sm.Shelf, "select_multiple")
-				if err != nil {
-					continue
-				}
-				tagMap[sm.Shelf] = tagMapping{KeyID: key.Id, ValueID: val.Id}
-
-			case "create_label":
-				if sm.LabelName == "" {
-					continue
-				}
-				key, _, err := ensureTagKey(app, user.Id, sm.LabelName, "select_multiple")
-				if err != nil {
-					continue
-				}
-				val, err := ensureTagValue(app, key.Id, sm.Shelf)
-				if err != nil {
-					continue
-				}
-				tagMap[sm.Shelf] = tagMapping{KeyID: key.Id, ValueID: val.Id}
-
-			case "existing_label":
-				if sm.LabelKeyID == "" {
-					continue
-				}
-				key, err := app.FindRecordById("tag_keys", sm.LabelKeyID)
-				if err != nil || key.GetString("user") != user.Id {
-					continue
-				}
-				val, err := ensureTagValue(app, key.Id, sm.Shelf)
-				if err != nil {
-					continue
-				}
-				tagMap[sm.Shelf] = tagMapping{KeyID: key.Id, ValueID: val.Id}
-			}
-		}
-
-		// Collect shelves mapped to DNF status
-		dnfShelves := map[string]bool{}
-		for _, sm := range data.ShelfMappings {
-			if sm.Action == "map_dnf" {
-				dnfShelves[sm.Shelf] = true
-			}
-		}
-
-		imported := 0
-		failed := 0
-		var errors []string
-
-		for _, b := range data.Rows {
-			if b.OLID == "" {
-				failed++
-				errors = append(errors, fmt.Sprintf("No match for row %d: %s", b.RowID, b.Title))
-				continue
-			}
-
-			book, err := upsertBook(app, b.OLID, b.Title, b.CoverURL, b.ISBN13, b.Authors, b.PublicationYear, "")
-			if err != nil {
-				failed++
-				errors = append(errors, fmt.Sprintf("Failed to save book: %s — %v", b.Title, err))
-				continue
-			}
-
-			existing, _ := app.FindRecordsByFilter("user_books",
-				"user = {:user} && book = {:book}",
-				"", 1, 0,
-				map[string]any{"user": user.Id, "book": book.Id},
-			)
-			var ub *core.Record
-			if len(existing) > 0 {
-				ub = existing[0]
-			} else {
-				coll, err := app.FindCollectionByNameOrId("user_books")
-				if err != nil {
-					failed++
-					errors = append(errors, fmt.Sprintf("Failed to create user_book: %s — %v", b.Title, err))
-					continue
-				}
-				ub = core.NewRecord(coll)
-				ub.Set("user", user.Id)
-				ub.Set("book", book.Id)
-			}
-
-			if b.Rating > 0 {
-				ub.Set("rating", b.Rating)
-			}
-			if b.ReviewText != "" {
-				ub.Set("review_text", b.ReviewText)
-			}
-			if b.DateRead != "" {
-				ub.Set("date_read", b.DateRead)
-			}
-			dateAdded := b.DateAdded
-			if dateAdded == "" {
-				dateAdded = time.Now().UTC().Format(time.RFC3339)
-			}
-			ub.Set("date_added", dateAdded)
-
-			if err := app.Save(ub); err != nil {
-				failed++
-				errors = append(errors, fmt.Sprintf("Failed to save user_book: %s — %v", b.Title, err))
-				continue
-			}
-
-			// Map StoryGraph status to status tag
-			statusSlug := mapStoryGraphStatus(b.ExclusiveShelfSlug)
-			if statusSlug != "" {
-				setStatusTag(app, user.Id, book.Id, statusSlug)
-			}
-
-			// Assign custom shelf tags (StoryGraph tags)
-			for _, shelf := range b.CustomShelves {
-				tm, ok := tagMap[shelf]
-				if !ok {
-					continue
-				}
-				dup, _ := app.FindRecordsByFilter("book_tag_values",
-					"user = {:user} && book = {:book} && tag_key = {:key} && tag_value = {:val}",
-					"", 1, 0,
-					map[string]any{"user": user.Id, "book": book.Id, "key": tm.KeyID, "val": tm.ValueID},
-				)
-				if len(dup) > 0 {
-					continue
-				}
-				btvColl, err := app.FindCollectionByNameOrId("book_tag_values")
-				if err != nil {
-					continue
-				}
-				btv := core.NewRecord(btvColl)
-				btv.Set("user", user.Id)
-				btv.Set("book", book.Id)
-				btv.Set("tag_key", tm.KeyID)
-				btv.Set("tag_value", tm.ValueID)
-				_ = app.Save(btv)
-			}
-
-			// Override status to DNF if any custom shelf is mapped to DNF
-			for _, shelf := range b.CustomShelves {
-				if dnfShelves[shelf] {
-					setStatusTag(app, user.Id, book.Id, "dnf")
-					break
-				}
-			}
-
-			imported++
-			refreshBookStats(app, book.Id)
-		}
-
-		// Persist unmatched rows to pending_imports
-		pendingSaved := 0
-		if len(data.UnmatchedRows) > 0 {
-			piColl, piErr := app.FindCollectionByNameOrId("pending_imports")
-			if piErr == nil {
-				for _, u := range data.UnmatchedRows {
-					if u.Title == "" {
-						continue
-					}
-					pi := core.NewRecord(piColl)
-					pi.Set("user", user.Id)
-					pi.Set("source", "storygraph")
-					pi.Set("title", u.Title)
-					pi.Set("author", u.Author)
-					pi.Set("isbn13", u.ISBN13)
-					pi.Set("exclusive_shelf", u.ExclusiveShelfSlug)
-					if u.CustomShelves != nil {
-						pi.Set("custom_shelves", u.CustomShelves)
-					} else {
-						pi.Set("custom_shelves", []string{})
-					}
-					if u.Rating > 0 {
-						pi.Set("rating", u.Rating)
-					}
-					pi.Set("review_text", u.ReviewText)
-					pi.Set("date_read", u.DateRead)
-					pi.Set("date_added", u.DateAdded)
-					pi.Set("status", "unmatched")
-					if err := app.Save(pi); err == nil {
-						pendingSaved++
-					}
-				}
-			}
-		}
-
-		return e.JSON(http.StatusOK, map[string]any{
-			"imported":      imported,
-			"failed":        failed,
-			"errors":        errors,
-			"pending_saved": pendingSaved,
-		})
-	}
-}
-
-func mapStoryGraphStatus(status string) string {
-	switch strings.ToLower(strings.TrimSpace(status)) {
-	case "to-read":
-		return "want-to-read"
-	case "currently-reading":
-		return "currently-reading"
-	case "read":
-		return "finished"
-	case "did-not-finish":
-		return "dnf"
-	default:
-		return ""
-	}
-}
-
-// cleanStoryGraphTitle strips subtitle/series info from StoryGraph titles.
-// StoryGraph titles are generally cleaner than Goodreads but may include subtitles.
-func cleanStoryGraphTitle(title string) string {
-	title = strings.TrimSpace(title)
-
-	// Strip trailing parenthetical (series info)
-	for {
-		idx := strings.LastIndex(title, "(")
-		if idx <= 0 {
-			break
-		}
-		title = strings.TrimSpace(title[:idx])
-	}
-
-	// Strip subtitle after colon
-	if idx := strings.Index(title, ":"); idx > 0 {
-		title = strings.TrimSpace(title[:idx])
-	}
-
-	return strings.TrimSpace(title)
-}
-
-// cleanStoryGraphAuthor returns a cleaned author name for OL search.
-// StoryGraph may list multiple authors comma-separated; use the first.
-func cleanStoryGraphAuthor(author string) string {
-	author = strings.TrimSpace(author)
-	if author == "" {
-		return ""
-	}
-
-	// Take first author if comma-separated
-	if idx := strings.Index(author, ","); idx > 0 {
-		author = strings.TrimSpace(author[:idx])
-	}
-
-	return author
-}
-
-// PreviewLibraryThingImport handles POST /me/import/librarything/preview
-// Streams NDJSON: progress lines followed by a final result line.
-func PreviewLibraryThingImport(app core.App) func(e *core.RequestEvent) error {
-	return func(e *core.RequestEvent) error {
-		user := e.Auth
-		if user == nil {
-			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
-		}
-
-		file, _, err := e.Request.FormFile("file")
-		if err != nil {
-			return e.JSON(http.StatusBadRequest, map[string]any{"error": "CSV file required"})
-		}
-		defer file.Close()
-
-		// LibraryThing exports use tab-separated values
-		reader := csv.NewReader(file)
-		reader.Comma = '\t'
-		reader.LazyQuotes = true
-		headers, err := reader.Read()
-		if err != nil {
-			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid CSV/TSV"})
-		}
-
-		colIdx := map[string]int{}
-		for i, h := range headers {
-			colIdx[strings.TrimSpace(h)] = i
-		}
-
-		// LibraryThing requires Title column
-		if _, ok := colIdx["Title"]; !ok {
-			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Missing column: Title"})
-		}
-
-		type bookCandidate struct {
-			OLID     string   `json:"ol_id"`
-			Title    string   `json:"title"`
-			Authors  []string `json:"authors"`
-			CoverURL *string  `json:"cover_url"`
-			Year     *int     `json:"year"`
-		}
-		type previewRow struct {
-			RowID              int            `json:"row_id"`
-			Title              string         `json:"title"`
-			Author             string         `json:"author"`
-			ISBN13             string         `json:"isbn13"`
-			Rating             *float64       `json:"rating"`
-			ReviewText         *string        `json:"review_text"`
-			Spoiler            bool           `json:"spoiler"`
-			DateRead           *string        `json:"date_read"`
-			DateAdded          *string        `json:"date_added"`
-			ExclusiveShelfSlug string         `json:"exclusive_shelf_slug"`
-			CustomShelves      []string       `json:"custom_shelves"`
-			Status             string         `json:"status"`
-			Match              *bookCandidate `json:"match,omitempty"`
-		}
-
-		var csvRows [][]string
-		for {
-			row, err := reader.Read()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				continue
-			}
-			csvRows = append(csvRows, row)
-		}
-
-		results := make([]previewRow, len(csvRows))
-		ol := newOLClient()
-		gb := newGBClient()
-
-		var wg sync.WaitGroup
-		sem := make(chan struct{}, 5)
-
-		getCol := func(row []string, name string) string {
-			if idx, ok := colIdx[name]; ok && idx < len(row) {
-				return strings.TrimSpace(row[idx])
-			}
-			return ""
-		}
-
-		// Set up NDJSON streaming
-		w := e.Response
-		w.Header().Set("Content-Type", "application/x-ndjson")
-		w.Header().Set("X-Content-Type-Options", "nosniff")
-		flusher, ok := w.(http.Flusher)
-		if !ok {
-			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Streaming not supported"})
-		}
-		enc := json.NewEncoder(w)
-
-		type progressMsg struct {
-			Index int
-			Row   previewRow
-		}
-		ch := make(chan progressMsg, len(csvRows))
-
-		for i, row := range csvRows {
-			wg.Add(1)
-			go func(i int, row []string) {
-				defer wg.Done()
-				sem <- struct{}{}
-				defer func() { <-sem }()
-
-				pr := previewRow{
-					RowID: i,
-					Title: getCol(row, "Title"),
-				}
-
-				// LibraryThing uses "Author (First, Last)" — convert "Last, First" to "First Last"
-				rawAuthor := getCol(row, "Author (First, Last)")
-				if rawAuthor == "" {
-					rawAuthor = getCol(row, "Author (Last, First)")
-				}
-				pr.Author = cleanLibraryThingAuthor(rawAuthor)
-
-				// ISBN — LT may use "ISBN" or "ISBNs" columns; strip brackets
-				isbn := strings.Trim(getCol(row, "ISBN"), "[] ")
-				if isbn == "" {
-					// Try ISBNs column (may have multiple, semicolon-separated)
-					isbns := getCol(row, "ISBNs")
-					if isbns != "" {
-						for _, candidate := range strings.Split(isbns, ",") {
-							candidate = strings.Trim(candidate, "[] ")
-							if len(candidate) >= 10 {
-								isbn = candidate
-								break
-							}
-						}
-					}
-				}
-				pr.ISBN13 = isbn
-
-				// Rating — LT uses 0-5 scale (sometimes 0-10 with halves)
-				if r, err := strconv.ParseFloat(getCol(row, "Rating"), 64); err == nil && r > 0 {
-					// LT ratings > 5 are on a 10-point scale; normalize to 5
-					if r > 5 {
-						r = r / 2.0
-					}
-					pr.Rating = &r
-				}
-
-				if review := getCol(row, "Review"); review != "" {
-					pr.ReviewText = &review
-				}
-
-				// Date Read
-				if dr := getCol(row, "Date Read"); dr != "" {
-					pr.DateRead = &dr
-				}
-
-				// Date Added (LT uses "Entry Date")
-				if da := getCol(row, "Entry Date"); da != "" {
-					pr.DateAdded = &da
-				}
-
-				// Map status from Collections
-				collections := getCol(row, "Collections")
-				pr.ExclusiveShelfSlug = mapLibraryThingStatus(collections, pr.DateRead != nil)
-
-				// Parse Collections (semicolon-separated) and Tags (comma-separated) as custom shelves
-				statusCollections := map[string]bool{
-					"currently reading": true, "to read": true, "wishlist": true,
-					"read but unowned": true, "your library": true,
-				}
-				if collections != "" {
-					for _, c := range strings.Split(collections, ",") {
-						c = strings.TrimSpace(c)
-						if c != "" && !statusCollections[strings.ToLower(c)] {
-							pr.CustomShelves = append(pr.CustomShelves, c)
-						}
-					}
-				}
-				if tags := getCol(row, "Tags"); tags != "" {
-					for _, t := range strings.Split(tags, ",") {
-						t = strings.TrimSpace(t)
-						if t != "" {
-							pr.CustomShelves = append(pr.CustomShelves, t)
-						}
-					}
-				}
-				if pr.CustomShelves == nil {
-					pr.CustomShelves = []string{}
-				}
-
-				found := false
-				var olID, matchTitle, coverURL string
-				var authors []string
-
-				// 1. Check local DB by ISBN
-				if isbn != "" {
-					existing, localErr := app.FindRecordsByFilter("books",
-						"isbn13 = {:isbn}",
-						"", 1, 0,
-						map[string]any{"isbn": isbn},
-					)
-					if localErr == nil && len(existing) > 0 {
-						rec := existing[0]
-						olID = rec.GetString("open_library_id")
-						matchTitle = rec.GetString("title")
-						coverURL = rec.GetString("cover_url")
-						if a := rec.GetString("authors"); a != "" {
-							authors = strings.Split(a, ", ")
-						}
-						found = olID != ""
-					}
-				}
-
-				// 2. OL direct ISBN endpoint
-				if isbn != "" && !found {
-					data, err := ol.get(fmt.Sprintf("/isbn/%s.json", isbn))
-					if err == nil {
-						if works, ok := data["works"].([]any); ok && len(works) > 0 {
-							if w, ok := works[0].(map[string]any); ok {
-								if key, ok := w["key"].(string); ok {
-									olID = strings.TrimPrefix(key, "/works/")
-									found = true
-								}
-							}
-						}
-						if t, ok := data["title"].(string); ok {
-							matchTitle = t
-						}
-						if covers, ok := data["covers"].([]any); ok && len(covers) > 0 {
-							if coverID, ok := covers[0].(float64); ok {
-								coverURL = fmt.Sprintf("https://covers.openlibrary.org/b/id/%.0f-M.jpg", coverID)
-							}
-						}
-					}
-				}
-
-				// 3. OL search by ISBN
-				if isbn != "" && !found {
-					data, err := ol.get(fmt.Sprintf("/search.json?isbn=%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", url.QueryEscape(isbn)))
-					if err == nil {
-						olID, matchTitle, coverURL, authors, found = extractOLSearchResult(data)
-					}
-				}
-
-				// 4. OL search by title+author
-				if !found && pr.Title != "" {
-					cleaned := cleanLibraryThingTitle(pr.Title)
-					cleanedAuthor := cleanLibraryThingSearchAuthor(pr.Author)
-					q := "title=" + url.QueryEscape(cleaned)
-					if cleanedAuthor != "" {
-						q += "&author=" + url.QueryEscape(cleanedAuthor)
-					}
-					data, err := ol.get(fmt.Sprintf("/search.json?%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", q))
-					if err == nil {
-						olID, matchTitle, coverURL, authors, found = extractOLSearchResult(data)
-					}
-				}
-
-				// 5. OL search by title only
-				if !found && pr.Title != "" {
-					cleaned := cleanLibraryThingTitle(pr.Title)
-					data, err := ol.get(fmt.Sprintf("/search.json?title=%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", url.QueryEscape(cleaned)))
-					if err == nil {
-						id, mt, cu, au, ok := extractOLSearchResult(data)
-						if ok && titleMatchesResult(cleaned, mt) {
-							olID, matchTitle, coverURL, authors, found = id, mt, cu, au, ok
-						}
-					}
-				}
-
-				// 6. Google Books fallback
-				if !found {
-					olID, matchTitle, coverURL, authors, found = googleBooksLookup(gb, ol, isbn, cleanLibraryThingTitle(pr.Title), cleanLibraryThingSearchAuthor(pr.Author))
-				}
-
-				if found {
-					pr.Status = "matched"
-					match := bookCandidate{
-						OLID:    olID,
-						Title:   matchTitle,
-						Authors: authors,
-					}
-					if match.Title == "" {
-						match.Title = pr.Title
-					}
-					if len(match.Authors) == 0 && pr.Author != "" {
-						match.Authors = []string{pr.Author}
-					}
-					if coverURL != "" {
-						match.CoverURL = &coverURL
-					}
-					pr.Match = &match
-				} else {
-					pr.Status = "unmatched"
-				}
-
-				ch <- progressMsg{Index: i, Row: pr}
-			}(i, row)
-		}
-
-		go func() {
-			wg.Wait()
-			close(ch)
-		}()
-
-		processed := 0
-		for msg := range ch {
-			results[msg.Index] = msg.Row
-			processed++
-			_ = enc.Encode(map[string]any{
-				"type":    "progress",
-				"current": processed,
-				"total":   len(csvRows),
-				"title":   msg.Row.Title,
-			})
-			flusher.Flush()
-		}
-
-		matched := 0
-		for _, r := range results {
-			if r.Status == "matched" {
-				matched++
-			}
-		}
-
-		// Build deduplicated shelf summary with counts
-		shelfCounts := map[string]int{}
-		for _, r := range results {
-			for _, s := range r.CustomShelves {
-				shelfCounts[s]++
-			}
-		}
-		type shelfSummary struct {
-			Name  string `json:"name"`
-			Count int    `json:"count"`
-		}
-		shelves := make([]shelfSummary, 0, len(shelfCounts))
-		for name, count := range shelfCounts {
-			shelves = append(shelves, shelfSummary{Name: name, Count: count})
-		}
-		sort.Slice(shelves, func(i, j int) bool {
-			return shelves[i].Count > shelves[j].Count
-		})
-
-		_ = enc.Encode(map[string]any{
-			"type":      "result",
-			"total":     len(results),
-			"matched":   matched,
-			"ambiguous":  0,
-			"unmatched": len(results) - matched,
-			"rows":      results,
-			"shelves":   shelves,
-		})
-		flusher.Flush()
-
-		return nil
-	}
-}
-
-// CommitLibraryThingImport handles POST /me/import/librarything/commit
-func CommitLibraryThingImport(app core.App) func(e *core.RequestEvent) error {
-	return func(e *core.RequestEvent) error {
-		user := e.Auth
-		if user == nil {
-			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
-		}
-
-		data := struct {
-			Rows []struct {
-				RowID              int      `json:"row_id"`
-				OLID               string   `json:"ol_id"`
-				Title              string   `json:"title"`
-				CoverURL           string   `json:"cover_url"`
-				Authors            string   `json:"authors"`
-				PublicationYear    int      `json:"publication_year"`
-				ISBN13             string   `json:"isbn13"`
-				Rating             float64  `json:"rating"`
-				ReviewText         string   `json:"review_text"`
-				Spoiler            bool     `json:"spoiler"`
-				DateRead           string   `json:"date_read"`
-				DateAdded          string   `json:"date_added"`
-				ExclusiveShelfSlug string   `json:"exclusive_shelf_slug"`
-				CustomShelves      []string `json:"custom_shelves"`
-			} `json:"rows"`
-			UnmatchedRows []struct {
-				Title              string   `json:"title"`
-				Author             string   `json:"author"`
-				ISBN13             string   `json:"isbn13"`
-				Rating             float64  `json:"rating"`
-				ReviewText         string   `json:"review_text"`
-				DateRead           string   `json:"date_read"`
-				DateAdded          string   `json:"date_added"`
-				ExclusiveShelfSlug string   `json:"exclusive_shelf_slug"`
-				CustomShelves      []string `json:"custom_shelves"`
-			} `json:"unmatched_rows"`
-			ShelfMappings []struct {
-				Shelf      string `json:"shelf"`
-				Action     string `json:"action"`
-				LabelName  string `json:"label_name"`
-				LabelKeyID string `json:"label_key_id"`
-			} `json:"shelf_mappings"`
-		}{}
-		if err := e.BindBody(&data); err != nil {
-			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid request body"})
-		}
-
-		// Build tag map from shelf mappings
-		type tagMapping struct {
-			KeyID   string
-			ValueID string
-		}
-		tagMap := map[string]tagMapping{}
-		for _, sm := range data.ShelfMappings {
-			switch sm.Action {
-			case "tag":
-				key, val, err := ensureTagKey(app, user.Id, sm.Shelf, "select_multiple")
-				if err != nil {
-					continue
-				}
-				tagMap[sm.Shelf] = tagMapping{KeyID: key.Id, ValueID: val.Id}
-
-			case "create_label":
-				if sm.LabelName == "" {
-					continue
-				}
-				key, _, err := ensureTagKey(app, user.Id, sm.LabelName, "select_multiple")
-				if err != nil {
-					continue
-				}
-				val, err := ensureTagValue(app, key.Id, sm.Shelf)
-				if err != nil {
-					continue
-				}
-				tagMap[sm.Shelf] = tagMapping{KeyID: key.Id, ValueID: val.Id}
-
-			case "existing_label":
-				if sm.LabelKeyID == "" {
-					continue
-				}
-				key, err := app.FindRecordById("tag_keys", sm.LabelKeyID)
-				if err != nil || key.GetString("user") != user.Id {
-					continue
-				}
-				val, err := ensureTagValue(app, key.Id, sm.Shelf)
-				if err != nil {
-					continue
-				}
-				tagMap[sm.Shelf] = tagMapping{KeyID: key.Id, ValueID: val.Id}
-			}
-		}
-
-		// Collect shelves mapped to DNF status
-		dnfShelves := map[string]bool{}
-		for _, sm := range data.ShelfMappings {
-			if sm.Action == "map_dnf" {
-				dnfShelves[sm.Shelf] = true
-			}
-		}
-
-		imported := 0
-		failed := 0
-		var errors []string
-
-		for _, b := range data.Rows {
-			if b.OLID == "" {
-				failed++
-				errors = append(errors, fmt.Sprintf("No match for row %d: %s", b.RowID, b.Title))
-				continue
-			}
-
-			book, err := upsertBook(app, b.OLID, b.Title, b.CoverURL, b.ISBN13, b.Authors, b.PublicationYear, "")
-			if err != nil {
-				failed++
-				errors = append(errors, fmt.Sprintf("Failed to save book: %s — %v", b.Title, err))
-				continue
-			}
-
-			existing, _ := app.FindRecordsByFilter("user_books",
-				"user = {:user} && book = {:book}",
-				"", 1, 0,
-				map[string]any{"user": user.Id, "book": book.Id},
-			)
-			var ub *core.Record
-			if len(existing) > 0 {
-				ub = existing[0]
-			} else {
-				coll, err := app.FindCollectionByNameOrId("user_books")
-				if err != nil {
-					failed++
-					errors = append(errors, fmt.Sprintf("Failed to create user_book: %s — %v", b.Title, err))
-					continue
-				}
-				ub = core.NewRecord(coll)
-				ub.Set("user", user.Id)
-				ub.Set("book", book.Id)
-			}
-
-			if b.Rating > 0 {
-				ub.Set("rating", b.Rating)
-			}
-			if b.ReviewText != "" {
-				ub.Set("review_text", b.ReviewText)
-			}
-			if b.DateRead != "" {
-				ub.Set("date_read", b.DateRead)
-			}
-			dateAdded := b.DateAdded
-			if dateAdded == "" {
-				dateAdded = time.Now().UTC().Format(time.RFC3339)
-			}
-			ub.Set("date_added", dateAdded)
-
-			if err := app.Save(ub); err != nil {
-				failed++
-				errors = append(errors, fmt.Sprintf("Failed to save user_book: %s — %v", b.Title, err))
-				continue
-			}
-
-			// Map status
-			statusSlug := mapLibraryThingStatusSlug(b.ExclusiveShelfSlug)
-			if statusSlug != "" {
-				setStatusTag(app, user.Id, book.Id, statusSlug)
-			}
-
-			// Assign custom shelf tags
-			for _, shelf := range b.CustomShelves {
-				tm, ok := tagMap[shelf]
-				if !ok {
-					continue
-				}
-				dup, _ := app.FindRecordsByFilter("book_tag_values",
-					"user = {:user} && book = {:book} && tag_key = {:key} && tag_value = {:val}",
-					"", 1, 0,
-					map[string]any{"user": user.Id, "book": book.Id, "key": tm.KeyID, "val": tm.ValueID},
-				)
-				if len(dup) > 0 {
-					continue
-				}
-				btvColl, err := app.FindCollectionByNameOrId("book_tag_values")
-				if err != nil {
-					continue
-				}
-				btv := core.NewRecord(btvColl)
-				btv.Set("user", user.Id)
-				btv.Set("book", book.Id)
-				btv.Set("tag_key", tm.KeyID)
-				btv.Set("tag_value", tm.ValueID)
-				_ = app.Save(btv)
-			}
-
-			// Override status to DNF if any custom shelf is mapped to DNF
-			for _, shelf := range b.CustomShelves {
-				if dnfShelves[shelf] {
-					setStatusTag(app, user.Id, book.Id, "dnf")
-					break
-				}
-			}
-
-			imported++
-			refreshBookStats(app, book.Id)
-		}
-
-		// Persist unmatched rows to pending_imports
-		pendingSaved := 0
-		if len(data.UnmatchedRows) > 0 {
-			piColl, piErr := app.FindCollectionByNameOrId("pending_imports")
-			if piErr == nil {
-				for _, u := range data.UnmatchedRows {
-					if u.Title == "" {
-						continue
-					}
-					pi := core.NewRecord(piColl)
-					pi.Set("user", user.Id)
-					pi.Set("source", "librarything")
-					pi.Set("title", u.Title)
-					pi.Set("author", u.Author)
-					pi.Set("isbn13", u.ISBN13)
-					pi.Set("exclusive_shelf", u.ExclusiveShelfSlug)
-					if u.CustomShelves != nil {
-						pi.Set("custom_shelves", u.CustomShelves)
-					} else {
-						pi.Set("custom_shelves", []string{})
-					}
-					if u.Rating > 0 {
-						pi.Set("rating", u.Rating)
-					}
-					pi.Set("review_text", u.ReviewText)
-					pi.Set("date_read", u.DateRead)
-					pi.Set("date_added", u.DateAdded)
-					pi.Set("status", "unmatched")
-					if err := app.Save(pi); err == nil {
-						pendingSaved++
-					}
-				}
-			}
-		}
-
-		return e.JSON(http.StatusOK, map[string]any{
-			"imported":      imported,
-			"failed":        failed,
-			"errors":        errors,
-			"pending_saved": pendingSaved,
-		})
-	}
-}
-
-// mapLibraryThingStatus determines the exclusive shelf slug from LT Collections.
-// LibraryThing collections: "Currently Reading" → currently-reading,
-// "To Read"/"Wishlist" → to-read, "Read but unowned"/has date read → read.
-func mapLibraryThingStatus(collections string, hasDateRead bool) string {
-	lower := strings.ToLower(collections)
-	if strings.Contains(lower, "currently reading") {
-		return "currently-reading"
-	}
-	if strings.Contains(lower, "to read") || strings.Contains(lower, "wishlist") {
-		return "to-read"
-	}
-	if strings.Contains(lower, "read but unowned") || hasDateRead {
-		return "read"
-	}
-	return ""
-}
-
-// mapLibraryThingStatusSlug maps the LT exclusive shelf slug to internal status.
-func mapLibraryThingStatusSlug(slug string) string {
-	switch strings.ToLower(strings.TrimSpace(slug)) {
-	case "to-read":
-		return "want-to-read"
-	case "currently-reading":
-		return "currently-reading"
-	case "read":
-		return "finished"
-	default:
-		return ""
-	}
-}
-
-// cleanLibraryThingAuthor converts "Last, First" format to "First Last".
-func cleanLibraryThingAuthor(author string) string {
-	author = strings.TrimSpace(author)
-	if author == "" {
-		return ""
-	}
-	// LT format is typically "Last, First" — reverse it
-	if idx := strings.Index(author, ","); idx > 0 {
-		last := strings.TrimSpace(author[:idx])
-		first := strings.TrimSpace(author[idx+1:])
-		if first != "" && last != "" {
-			return first + " " + last
-		}
-	}
-	return author
-}
-
-// cleanLibraryThingTitle strips subtitle/series info from LT titles.
-func cleanLibraryThingTitle(title string) string {
-	title = strings.TrimSpace(title)
-
-	// Strip trailing parenthetical (series info)
-	for {
-		idx := strings.LastIndex(title, "(")
-		if idx <= 0 {
-			break
-		}
-		title = strings.TrimSpace(title[:idx])
-	}
-
-	// Strip subtitle after colon
-	if idx := strings.Index(title, ":"); idx > 0 {
-		title = strings.TrimSpace(title[:idx])
-	}
-
-	return strings.TrimSpace(title)
-}
-
-// cleanLibraryThingSearchAuthor returns a cleaned author suitable for OL search.
-func cleanLibraryThingSearchAuthor(author string) string {
-	author = strings.TrimSpace(author)
-	if author == "" {
-		return ""
-	}
-
-	lower := strings.ToLower(author)
-	if lower == "unknown" || lower == "anonymous" || lower == "various" {
-		return ""
-	}
-
-	return author
-}
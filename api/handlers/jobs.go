@@ -0,0 +1,316 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/tristansaldanha/rosslib/api/jobs"
+	"github.com/tristansaldanha/rosslib/api/store"
+)
+
+// Background work runs through the jobs queue (see api/jobs) rather than bare
+// goroutines, so it survives restarts and its failures are retried and
+// visible under /admin/jobs. Each job type has a typed enqueue helper here;
+// handlers call those instead of jobs.Enqueue.
+const (
+	jobActivity       = "activity"
+	jobNotification   = "notification"
+	jobThreadMentions = "thread_mentions"
+	jobAPITokenUsed   = "api_token_used"
+	jobImport         = "import"
+	jobExport         = "export"
+)
+
+// RegisterJobs registers the handlers package's job types. Call before
+// jobs.Start.
+func RegisterJobs() {
+	jobs.Register(jobs.Type{Name: jobActivity, Run: runActivityJob})
+	jobs.Register(jobs.Type{Name: jobNotification, Run: runNotificationJob})
+	jobs.Register(jobs.Type{Name: jobThreadMentions, Run: runThreadMentionsJob})
+	jobs.Register(jobs.Type{Name: jobAPITokenUsed, Run: runAPITokenUsedJob, MaxAttempts: 3})
+	// Import and export jobs track their own progress and failures in
+	// import_jobs and export_jobs, so a queue retry only covers a crash.
+	jobs.Register(jobs.Type{Name: jobImport, Run: runImportQueueJob, MaxAttempts: 3, Concurrency: 2})
+	jobs.Register(jobs.Type{Name: jobExport, Run: runExportQueueJob, MaxAttempts: 3, Concurrency: 2})
+}
+
+// enqueueJob enqueues a job, logging rather than returning a failure for
+// callers that have already done their main work.
+func enqueueJob(app core.App, jobType string, payload any) {
+	if err := jobs.Enqueue(app, jobType, payload); err != nil {
+		log.Printf("[Jobs] enqueue %s: %v", jobType, err)
+	}
+}
+
+// enqueueUniqueJob is enqueueJob for jobs.EnqueueUnique.
+func enqueueUniqueJob(app core.App, jobType, key string, payload any) {
+	if err := jobs.EnqueueUnique(app, jobType, key, payload); err != nil {
+		log.Printf("[Jobs] enqueue %s %s: %v", jobType, key, err)
+	}
+}
+
+// ── Activities ─────────────────────────────────────────────────
+
+type activityJob struct {
+	User         string         `json:"user"`
+	ActivityType string         `json:"activity_type"`
+	Created      string         `json:"created"`
+	Opts         map[string]any `json:"opts"`
+}
+
+// recordActivity queues an activity record. It is stamped with the current
+// time so a delayed or retried job keeps its place in feeds.
+func recordActivity(app core.App, userID, activityType string, opts map[string]any) {
+	enqueueJob(app, jobActivity, activityJob{
+		User:         userID,
+		ActivityType: activityType,
+		Created:      store.FormatTime(time.Now()),
+		Opts:         opts,
+	})
+}
+
+func runActivityJob(app core.App, payload []byte) error {
+	var job activityJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return err
+	}
+	coll, err := app.FindCollectionByNameOrId("activities")
+	if err != nil {
+		return err
+	}
+	rec := core.NewRecord(coll)
+	rec.Set("user", job.User)
+	rec.Set("activity_type", job.ActivityType)
+	// created is an autodate field, which ignores Set; SetRaw keeps the
+	// enqueue time.
+	if created, err := types.ParseDateTime(job.Created); err == nil && !created.IsZero() {
+		rec.SetRaw("created", created)
+	}
+	for _, field := range []string{"book", "target_user", "collection_ref", "thread", "metadata"} {
+		if v, ok := job.Opts[field]; ok {
+			rec.Set(field, v)
+		}
+	}
+	return app.Save(rec)
+}
+
+// ── Notifications ──────────────────────────────────────────────
+
+type notificationJob struct {
+	User     string         `json:"user"`
+	Type     string         `json:"notif_type"`
+	Title    string         `json:"title"`
+	Body     string         `json:"body,omitempty"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// sendNotification queues a notification. The recipient's preferences are
+// checked when it is delivered.
+func sendNotification(app core.App, n notificationJob) {
+	enqueueJob(app, jobNotification, n)
+}
+
+func runNotificationJob(app core.App, payload []byte) error {
+	var n notificationJob
+	if err := json.Unmarshal(payload, &n); err != nil {
+		return err
+	}
+	if !ShouldNotify(app, n.User, n.Type) {
+		return nil
+	}
+	coll, err := app.FindCollectionByNameOrId("notifications")
+	if err != nil {
+		return err
+	}
+	rec := core.NewRecord(coll)
+	rec.Set("user", n.User)
+	rec.Set("notif_type", n.Type)
+	rec.Set("title", n.Title)
+	if n.Body != "" {
+		rec.Set("body", n.Body)
+	}
+	if n.Metadata != nil {
+		rec.Set("metadata", n.Metadata)
+	}
+	rec.Set("read", false)
+	return app.Save(rec)
+}
+
+type threadMentionsJob struct {
+	Commenter string `json:"commenter"`
+	Thread    string `json:"thread"`
+	Comment   string `json:"comment"`
+	Body      string `json:"body"`
+}
+
+// notifyThreadMentions queues notifications for the users @mentioned in a
+// thread comment.
+func notifyThreadMentions(app core.App, commenterID, threadID, commentID, body string) {
+	enqueueJob(app, jobThreadMentions, threadMentionsJob{
+		Commenter: commenterID,
+		Thread:    threadID,
+		Comment:   commentID,
+		Body:      body,
+	})
+}
+
+func runThreadMentionsJob(app core.App, payload []byte) error {
+	var job threadMentionsJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return err
+	}
+	commenter, err := app.FindRecordById("users", job.Commenter)
+	if err != nil {
+		return nil // the commenter has since been deleted
+	}
+	thread, err := app.FindRecordById("threads", job.Thread)
+	if err != nil {
+		return nil
+	}
+	// One notification job per mention, enqueued together, so a retry
+	// can't notify anyone twice.
+	return app.RunInTransaction(func(txApp core.App) error {
+		fanOutMentionNotifications(txApp, commenter, thread, job.Comment, job.Body)
+		return nil
+	})
+}
+
+// ── API tokens ─────────────────────────────────────────────────
+
+type apiTokenUsedJob struct {
+	Token  string `json:"token"`
+	UsedAt string `json:"used_at"`
+}
+
+// touchAPIToken queues an update of a token's last_used_at.
+func touchAPIToken(app core.App, tokenID string) {
+	enqueueJob(app, jobAPITokenUsed, apiTokenUsedJob{
+		Token:  tokenID,
+		UsedAt: store.FormatTime(time.Now()),
+	})
+}
+
+func runAPITokenUsedJob(app core.App, payload []byte) error {
+	var job apiTokenUsedJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return err
+	}
+	// Direct SQL, so a job that runs late can't move last_used_at back or
+	// race a save of the token record.
+	_, err := app.DB().NewQuery(`
+		UPDATE api_tokens SET last_used_at = {:used_at}
+		WHERE id = {:id} AND (last_used_at IS NULL OR last_used_at = '' OR last_used_at < {:used_at})
+	`).Bind(map[string]any{"id": job.Token, "used_at": job.UsedAt}).Execute()
+	return err
+}
+
+// ── Imports and exports ────────────────────────────────────────
+
+type recordJob struct {
+	ID string `json:"id"`
+}
+
+// startImportJob queues an import job unless it is already queued or
+// running.
+func startImportJob(app core.App, id string) {
+	enqueueUniqueJob(app, jobImport, id, recordJob{ID: id})
+}
+
+func runImportQueueJob(app core.App, payload []byte) error {
+	var job recordJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return err
+	}
+	runImportJob(app, job.ID)
+	return nil
+}
+
+// startExportJob queues an export job's archive unless it is already queued
+// or being built.
+func startExportJob(app core.App, id string) {
+	enqueueUniqueJob(app, jobExport, id, recordJob{ID: id})
+}
+
+func runExportQueueJob(app core.App, payload []byte) error {
+	var job recordJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return err
+	}
+	runExportJob(app, job.ID)
+	return nil
+}
+
+// ── Admin ──────────────────────────────────────────────────────
+
+// GetAdminJobs handles GET /admin/jobs?status=<pending|running|dead>&type=<type>&page=<n>
+// Lists queued, running and dead-lettered jobs with per-type counts.
+func GetAdminJobs(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		status := e.Request.URL.Query().Get("status")
+		jobType := e.Request.URL.Query().Get("type")
+		page, _ := strconv.Atoi(e.Request.URL.Query().Get("page"))
+		if page < 1 {
+			page = 1
+		}
+		perPage := 50
+
+		items, err := jobs.List(app, status, jobType, perPage+1, (page-1)*perPage)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to list jobs"})
+		}
+		counts, err := jobs.Counts(app)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to count jobs"})
+		}
+
+		hasNext := len(items) > perPage
+		if hasNext {
+			items = items[:perPage]
+		}
+
+		return e.JSON(http.StatusOK, map[string]any{
+			"counts":   counts,
+			"jobs":     items,
+			"page":     page,
+			"has_next": hasNext,
+		})
+	}
+}
+
+// RetryAdminJob handles POST /admin/jobs/{jobId}/retry
+// Requeues a dead job with a fresh set of attempts.
+func RetryAdminJob(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		err := jobs.Retry(app, e.Request.PathValue("jobId"))
+		if errors.Is(err, jobs.ErrNotFound) {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "Dead job not found"})
+		}
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to retry job"})
+		}
+		return e.JSON(http.StatusOK, map[string]any{"retried": true})
+	}
+}
+
+// DeleteAdminJob handles DELETE /admin/jobs/{jobId}
+// Discards a pending or dead job.
+func DeleteAdminJob(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		err := jobs.Discard(app, e.Request.PathValue("jobId"))
+		if errors.Is(err, jobs.ErrNotFound) {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "Job not found or running"})
+		}
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to delete job"})
+		}
+		e.Response.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
@@ -31,8 +31,9 @@ type llmCandidate struct {
 // Returns up to 5 candidates for user confirmation. Returns nil if the LLM API
 // key is not configured or no candidates are found.
 func llmFuzzyMatch(ol *cachedOLClient, title, author string) *llmMatchResult {
+	// Replayed fixtures don't need a real key.
 	apiKey := os.Getenv("ANTHROPIC_API_KEY")
-	if apiKey == "" {
+	if apiKey == "" && fixtureMode() != fixtureReplay {
 		return nil
 	}
 
@@ -150,7 +151,7 @@ Return a JSON array of objects with "title" and "author" fields. Each should be
 	req.Header.Set("x-api-key", apiKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
 
-	client := &http.Client{Timeout: 15 * time.Second}
+	client := newExternalHTTPClient(15*time.Second, nil)
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/tristansaldanha/rosslib/api/search"
+)
+
+// Before any remote lookup, imported rows are matched against books already
+// in the local catalog. Candidates come from the full-text index (by the
+// cleaned title, the title with any author prefix stripped, its longest word
+// and the author's surname, so one misspelled word doesn't lose the book)
+// and are scored by title trigram similarity and author surname agreement.
+
+const (
+	// localMatchAccept is the score at which the best local candidate is
+	// taken as the match without asking.
+	localMatchAccept = 0.85
+	// localMatchMargin is how far the best candidate must lead the next
+	// one to be accepted; otherwise the row is ambiguous.
+	localMatchMargin = 0.05
+	// localMatchOffer is the lowest score offered as a candidate.
+	localMatchOffer = 0.5
+	// localMatchProbe is how many index hits each probe contributes.
+	localMatchProbe = 20
+	// localMatchCandidates is how many candidates are offered.
+	localMatchCandidates = 5
+)
+
+// localCandidate is a local book scored against an imported row, from 0 to
+// 1.
+type localCandidate struct {
+	CatalogMatch
+	Score float64
+}
+
+// importCandidate converts a local candidate to the webapp's BookCandidate.
+func (c localCandidate) importCandidate() importCandidate {
+	ic := importCandidate{
+		OLID:    c.WorkID,
+		Title:   c.Title,
+		Authors: c.Authors,
+		Score:   c.Score,
+	}
+	if c.CoverURL != "" {
+		coverURL := c.CoverURL
+		ic.CoverURL = &coverURL
+	}
+	if c.Year > 0 {
+		year := c.Year
+		ic.Year = &year
+	}
+	return ic
+}
+
+// matchLocalBook scores local books against a row. It returns the match when
+// the best candidate is confident and clear of the rest, and otherwise the
+// candidates worth offering, best first. title and author should already be
+// cleaned by the row's importer.
+func matchLocalBook(app core.App, title, author string) (*CatalogMatch, []localCandidate) {
+	candidates := findLocalCandidates(app, title, author)
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	best := candidates[0]
+	if best.Score >= localMatchAccept &&
+		(len(candidates) == 1 || best.Score-candidates[1].Score >= localMatchMargin) {
+		return &best.CatalogMatch, nil
+	}
+
+	var offered []localCandidate
+	for _, c := range candidates {
+		if c.Score < localMatchOffer || len(offered) == localMatchCandidates {
+			break
+		}
+		offered = append(offered, c)
+	}
+	return nil, offered
+}
+
+// findLocalCandidates returns local books that might be the row's, scored and
+// sorted best first.
+func findLocalCandidates(app core.App, title, author string) []localCandidate {
+	norm := localMatchTitle(title)
+	if norm == "" {
+		return nil
+	}
+	stripped := localMatchTitle(stripAuthorPrefix(title, author))
+	surname := authorSurname(author)
+
+	probes := []string{title}
+	if stripped != norm {
+		probes = append(probes, stripAuthorPrefix(title, author))
+	}
+	if w := longestWord(norm); w != "" && w != norm {
+		probes = append(probes, w)
+	}
+	if surname != "" {
+		probes = append(probes, surname)
+	}
+
+	seen := map[string]bool{}
+	var ids []string
+	for _, q := range probes {
+		hits, _, err := search.Books(app, q, localMatchProbe, 0)
+		if err != nil {
+			continue
+		}
+		for _, id := range hits {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	type bookRow struct {
+		OLID     string `db:"open_library_id"`
+		Title    string `db:"title"`
+		Authors  string `db:"authors"`
+		CoverURL string `db:"cover_url"`
+		ISBN13   string `db:"isbn13"`
+		Year     int    `db:"publication_year"`
+	}
+	placeholders, params := inPlaceholders(ids)
+	var rows []bookRow
+	err := app.DB().NewQuery(`
+		SELECT open_library_id, title, COALESCE(authors, '') as authors,
+			   COALESCE(cover_url, '') as cover_url, COALESCE(isbn13, '') as isbn13,
+			   COALESCE(publication_year, 0) as publication_year
+		FROM books
+		WHERE id IN (` + placeholders + `) AND open_library_id != ''
+	`).Bind(params).All(&rows)
+	if err != nil {
+		return nil
+	}
+
+	candidates := make([]localCandidate, 0, len(rows))
+	for _, r := range rows {
+		bookTitle := localMatchTitle(r.Title)
+		titleScore := trigramSimilarity(norm, bookTitle)
+		if stripped != norm {
+			titleScore = max(titleScore, trigramSimilarity(stripped, bookTitle))
+		}
+		authors := splitAuthors(r.Authors)
+
+		// Without an author the title alone can't be trusted to pick a
+		// book, so the score stays below localMatchAccept.
+		score := titleScore * 0.8
+		if surname != "" {
+			score = 0.7*titleScore + 0.3*authorScore(surname, authors)
+		}
+		candidates = append(candidates, localCandidate{
+			CatalogMatch: CatalogMatch{
+				WorkID:   r.OLID,
+				Title:    r.Title,
+				Authors:  authors,
+				CoverURL: r.CoverURL,
+				ISBN13:   r.ISBN13,
+				Year:     r.Year,
+			},
+			Score: score,
+		})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates
+}
+
+// localMatchTitle normalizes a title for comparison: Goodreads-style noise
+// and subtitles removed, accents folded, punctuation dropped and a leading
+// article skipped, so "The Left Hand of Darkness (Hainish Cycle, #4)" and
+// "Left Hand of Darkness" compare equal.
+func localMatchTitle(title string) string {
+	title = search.Fold(cleanGoodreadsTitle(title))
+	title = strings.Map(func(r rune) rune {
+		if r == '&' {
+			return ' '
+		}
+		if strings.ContainsRune(".,;:!?'\"’‘“”-–—", r) {
+			return -1
+		}
+		return r
+	}, title)
+	words := strings.Fields(title)
+	if len(words) > 1 {
+		switch words[0] {
+		case "the", "a", "an":
+			words = words[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// authorSurname returns the folded last word of an author's name, or "".
+func authorSurname(author string) string {
+	_, family := splitAuthorName(strings.ReplaceAll(author, ".", ""))
+	return search.Fold(family)
+}
+
+// authorScore rates how well surname matches any of a book's authors: 1 for
+// the same surname, their trigram similarity when close (a misspelling),
+// and 0 otherwise.
+func authorScore(surname string, authors []string) float64 {
+	best := 0.0
+	for _, a := range authors {
+		other := authorSurname(a)
+		if other == surname {
+			return 1
+		}
+		if sim := trigramSimilarity(surname, other); sim >= 0.5 && sim > best {
+			best = sim
+		}
+	}
+	return best
+}
+
+// longestWord returns the longest word in s if it has at least four letters,
+// as a probe that survives a misspelling elsewhere in the title.
+func longestWord(s string) string {
+	longest := ""
+	for _, w := range strings.Fields(s) {
+		if len([]rune(w)) > len([]rune(longest)) {
+			longest = w
+		}
+	}
+	if len([]rune(longest)) < 4 {
+		return ""
+	}
+	return longest
+}
@@ -1,70 +1,525 @@
 package handlers
 
 import (
+	"container/list"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/store"
 )
 
 const olCacheTTL = 24 * time.Hour
 
-// cacheEntry holds a cached response with its expiration time.
+// olCacheClass describes how long responses for a family of OL paths stay
+// fresh, and how long past that they may still be served while a background
+// refresh runs (stale-while-revalidate).
+type olCacheClass struct {
+	Name     string
+	TTL      time.Duration
+	StaleFor time.Duration
+}
+
+// olCacheClasses maps OL path prefixes to cache classes. The first matching
+// prefix wins; paths that match nothing fall back to olDefaultClass.
+var olCacheClasses = []struct {
+	Prefix string
+	Class  olCacheClass
+}{
+	{"/search", olCacheClass{Name: "search", TTL: 6 * time.Hour, StaleFor: 24 * time.Hour}},
+	{"/subjects/", olCacheClass{Name: "subjects", TTL: 24 * time.Hour, StaleFor: 3 * 24 * time.Hour}},
+	{"/isbn/", olCacheClass{Name: "editions", TTL: 7 * 24 * time.Hour, StaleFor: 30 * 24 * time.Hour}},
+	{"/books/", olCacheClass{Name: "editions", TTL: 7 * 24 * time.Hour, StaleFor: 30 * 24 * time.Hour}},
+	{"/authors/", olCacheClass{Name: "authors", TTL: 7 * 24 * time.Hour, StaleFor: 30 * 24 * time.Hour}},
+	{"/works/", olCacheClass{Name: "works", TTL: 7 * 24 * time.Hour, StaleFor: 30 * 24 * time.Hour}},
+}
+
+var olDefaultClass = olCacheClass{Name: "default", TTL: olCacheTTL, StaleFor: 24 * time.Hour}
+
+// classifyOLPath returns the cache class for an OL request path.
+// Edition listings live under /works/ but churn faster than work records.
+func classifyOLPath(path string) olCacheClass {
+	if strings.HasPrefix(path, "/works/") && strings.Contains(path, "/editions.json") {
+		return olCacheClass{Name: "editions", TTL: 3 * 24 * time.Hour, StaleFor: 14 * 24 * time.Hour}
+	}
+	for _, c := range olCacheClasses {
+		if strings.HasPrefix(path, c.Prefix) {
+			return c.Class
+		}
+	}
+	return olDefaultClass
+}
+
+// olCacheClassNames lists every class name so metrics can be pre-allocated.
+func olCacheClassNames() []string {
+	names := []string{olDefaultClass.Name}
+	seen := map[string]bool{olDefaultClass.Name: true}
+	for _, c := range olCacheClasses {
+		if !seen[c.Class.Name] {
+			seen[c.Class.Name] = true
+			names = append(names, c.Class.Name)
+		}
+	}
+	return names
+}
+
+// cacheEntry holds a cached response with its freshness window.
 type cacheEntry struct {
-	data      []byte
-	expiresAt time.Time
+	key        string
+	class      string
+	data       []byte
+	fetchedAt  time.Time
+	expiresAt  time.Time
+	staleUntil time.Time
 }
 
-// olCache is a simple in-memory TTL cache for Open Library API responses.
+// cacheState reports whether a lookup missed, hit a fresh entry, or hit an
+// expired entry that is still inside its stale window.
+type cacheState int
+
+const (
+	cacheMiss cacheState = iota
+	cacheFresh
+	cacheStale
+)
+
+// olCacheCounters are cumulative per-class counters since process start.
+type olCacheCounters struct {
+	hits      atomic.Int64
+	staleHits atomic.Int64
+	misses    atomic.Int64
+	writes    atomic.Int64
+	evictions atomic.Int64
+}
+
+// olCache is a two-tier cache for Open Library API responses: a byte-bounded
+// in-memory LRU in front of the ol_cache collection, which survives restarts
+// and is trimmed to its own byte budget by evictExpired.
 type olCache struct {
-	entries sync.Map
-	hits    atomic.Int64
-	misses  atomic.Int64
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      *list.List
+	memBytes int64
+	memLimit int64
+
+	app       core.App // durable store; nil until attach is called
+	diskLimit int64
+
+	// touched collects keys served from memory since the last flush so the
+	// durable LRU order can be updated in one batch instead of per hit.
+	touched map[string]int
+
+	counters map[string]*olCacheCounters
 }
 
-func (c *olCache) get(key string) ([]byte, bool) {
-	val, ok := c.entries.Load(key)
-	if !ok {
-		c.misses.Add(1)
+func newOLCache(memLimit, diskLimit int64) *olCache {
+	c := &olCache{
+		entries:   map[string]*list.Element{},
+		lru:       list.New(),
+		memLimit:  memLimit,
+		diskLimit: diskLimit,
+		touched:   map[string]int{},
+		counters:  map[string]*olCacheCounters{},
+	}
+	for _, name := range olCacheClassNames() {
+		c.counters[name] = &olCacheCounters{}
+	}
+	return c
+}
+
+// attach backs the cache with the ol_cache collection.
+func (c *olCache) attach(app core.App) {
+	c.mu.Lock()
+	c.app = app
+	c.mu.Unlock()
+}
+
+func (c *olCache) counter(class string) *olCacheCounters {
+	if ctr, ok := c.counters[class]; ok {
+		return ctr
+	}
+	return c.counters[olDefaultClass.Name]
+}
+
+func (c *olCache) get(key string, class olCacheClass) ([]byte, cacheState) {
+	now := time.Now()
+	ctr := c.counter(class.Name)
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*cacheEntry)
+		if now.Before(entry.staleUntil) {
+			c.lru.MoveToFront(el)
+			c.touched[key]++
+			c.mu.Unlock()
+			return entry.data, c.record(ctr, entry, now)
+		}
+		c.removeElement(el)
+	}
+	app := c.app
+	c.mu.Unlock()
+
+	if app == nil {
+		ctr.misses.Add(1)
+		return nil, cacheMiss
+	}
+
+	entry, ok := c.loadFromDisk(app, key)
+	if !ok || !now.Before(entry.staleUntil) {
+		ctr.misses.Add(1)
+		return nil, cacheMiss
+	}
+
+	c.mu.Lock()
+	c.insert(entry)
+	c.mu.Unlock()
+
+	_, _ = app.DB().NewQuery(`
+		UPDATE ol_cache SET hits = hits + 1, last_accessed = {:now} WHERE key = {:key}
+	`).Bind(map[string]any{"key": key, "now": store.FormatTime(now)}).Execute()
+
+	return entry.data, c.record(ctr, entry, now)
+}
+
+// record bumps the hit counters for a served entry and reports its state.
+func (c *olCache) record(ctr *olCacheCounters, entry *cacheEntry, now time.Time) cacheState {
+	if now.After(entry.expiresAt) {
+		ctr.staleHits.Add(1)
+		return cacheStale
+	}
+	ctr.hits.Add(1)
+	return cacheFresh
+}
+
+func (c *olCache) set(key string, class olCacheClass, data []byte) {
+	now := time.Now()
+	entry := &cacheEntry{
+		key:        key,
+		class:      class.Name,
+		data:       data,
+		fetchedAt:  now,
+		expiresAt:  now.Add(class.TTL),
+		staleUntil: now.Add(class.TTL + class.StaleFor),
+	}
+	c.counter(class.Name).writes.Add(1)
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.removeElement(el)
+	}
+	c.insert(entry)
+	app := c.app
+	c.mu.Unlock()
+
+	if app == nil {
+		return
+	}
+	nowStr := store.FormatTime(now)
+	_, err := app.DB().NewQuery(`
+		INSERT INTO ol_cache (key, ttl_class, body, size, hits, fetched_at, expires_at, stale_until, last_accessed)
+		VALUES ({:key}, {:class}, {:body}, {:size}, 0, {:fetched}, {:expires}, {:stale}, {:now})
+		ON CONFLICT(key) DO UPDATE SET
+			ttl_class = excluded.ttl_class,
+			body = excluded.body,
+			size = excluded.size,
+			fetched_at = excluded.fetched_at,
+			expires_at = excluded.expires_at,
+			stale_until = excluded.stale_until,
+			last_accessed = excluded.last_accessed
+	`).Bind(map[string]any{
+		"key":     key,
+		"class":   class.Name,
+		"body":    string(data),
+		"size":    len(data),
+		"fetched": nowStr,
+		"expires": store.FormatTime(entry.expiresAt),
+		"stale":   store.FormatTime(entry.staleUntil),
+		"now":     nowStr,
+	}).Execute()
+	if err != nil {
+		log.Printf("[OL Cache] failed to persist %s: %v", key, err)
+	}
+}
+
+// insert adds an entry to the in-memory LRU and evicts from the tail until
+// the memory budget is respected. Callers must hold c.mu.
+func (c *olCache) insert(entry *cacheEntry) {
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.memBytes += int64(len(entry.data))
+	for c.memBytes > c.memLimit && c.lru.Len() > 1 {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// removeElement drops an entry from memory. Callers must hold c.mu.
+func (c *olCache) removeElement(el *list.Element) {
+	entry := el.Value.(*cacheEntry)
+	c.lru.Remove(el)
+	delete(c.entries, entry.key)
+	c.memBytes -= int64(len(entry.data))
+}
+
+func (c *olCache) loadFromDisk(app core.App, key string) (*cacheEntry, bool) {
+	type row struct {
+		Class      string `db:"ttl_class"`
+		Body       string `db:"body"`
+		FetchedAt  string `db:"fetched_at"`
+		ExpiresAt  string `db:"expires_at"`
+		StaleUntil string `db:"stale_until"`
+	}
+	var r row
+	err := app.DB().NewQuery(`
+		SELECT ttl_class, body, fetched_at, expires_at, stale_until
+		FROM ol_cache WHERE key = {:key}
+	`).Bind(map[string]any{"key": key}).One(&r)
+	if err != nil {
 		return nil, false
 	}
-	entry := val.(cacheEntry)
-	if time.Now().After(entry.expiresAt) {
-		c.entries.Delete(key)
-		c.misses.Add(1)
+	fetchedAt, _ := time.Parse(store.DateLayout, r.FetchedAt)
+	expiresAt, err1 := time.Parse(store.DateLayout, r.ExpiresAt)
+	staleUntil, err2 := time.Parse(store.DateLayout, r.StaleUntil)
+	if err1 != nil || err2 != nil {
+		return nil, false
+	}
+	return &cacheEntry{
+		key:        key,
+		class:      r.Class,
+		data:       []byte(r.Body),
+		fetchedAt:  fetchedAt,
+		expiresAt:  expiresAt,
+		staleUntil: staleUntil,
+	}, true
+}
+
+// peek returns any stored copy of key regardless of freshness. Used as a
+// last resort when the upstream is unavailable.
+func (c *olCache) peek(key string) ([]byte, bool) {
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		data := el.Value.(*cacheEntry).data
+		c.mu.Unlock()
+		return data, true
+	}
+	app := c.app
+	c.mu.Unlock()
+
+	if app == nil {
+		return nil, false
+	}
+	entry, ok := c.loadFromDisk(app, key)
+	if !ok {
 		return nil, false
 	}
-	c.hits.Add(1)
 	return entry.data, true
 }
 
-func (c *olCache) set(key string, data []byte) {
-	c.entries.Store(key, cacheEntry{
-		data:      data,
-		expiresAt: time.Now().Add(olCacheTTL),
-	})
+// purge removes entries whose key matches exactly, or starts with prefix when
+// prefix is non-empty. Returns the number of durable rows removed.
+func (c *olCache) purge(key, prefix string) int64 {
+	c.mu.Lock()
+	for k, el := range c.entries {
+		if (key != "" && k == key) || (prefix != "" && strings.HasPrefix(k, prefix)) {
+			c.removeElement(el)
+			delete(c.touched, k)
+		}
+	}
+	app := c.app
+	c.mu.Unlock()
+
+	if app == nil {
+		return 0
+	}
+	var res sql.Result
+	var err error
+	if key != "" {
+		res, err = app.DB().NewQuery(`DELETE FROM ol_cache WHERE key = {:key}`).
+			Bind(map[string]any{"key": key}).Execute()
+	} else {
+		res, err = app.DB().NewQuery(`DELETE FROM ol_cache WHERE substr(key, 1, length({:prefix})) = {:prefix}`).
+			Bind(map[string]any{"prefix": prefix}).Execute()
+	}
+	if err != nil {
+		return 0
+	}
+	n, _ := res.RowsAffected()
+	return n
+}
+
+// olCacheClassStats is the per-class slice of olCacheStats.
+type olCacheClassStats struct {
+	Hits      int64   `json:"hits"`
+	StaleHits int64   `json:"stale_hits"`
+	Misses    int64   `json:"misses"`
+	Writes    int64   `json:"writes"`
+	Evictions int64   `json:"evictions"`
+	HitRate   float64 `json:"hit_rate"`
+}
+
+// olCacheStats is a point-in-time snapshot of cache usage.
+type olCacheStats struct {
+	MemoryEntries int                          `json:"memory_entries"`
+	MemoryBytes   int64                        `json:"memory_bytes"`
+	MemoryLimit   int64                        `json:"memory_limit"`
+	DiskEntries   int64                        `json:"disk_entries"`
+	DiskBytes     int64                        `json:"disk_bytes"`
+	DiskLimit     int64                        `json:"disk_limit"`
+	Circuit       string                       `json:"circuit"`
+	Classes       map[string]olCacheClassStats `json:"classes"`
+	Totals        olCacheClassStats            `json:"totals"`
+}
+
+// stats returns cumulative hit/miss counters per class plus current sizes.
+func (c *olCache) stats() olCacheStats {
+	s := olCacheStats{
+		MemoryLimit: c.memLimit,
+		DiskLimit:   c.diskLimit,
+		Circuit:     olGuard.breaker.state(),
+		Classes:     map[string]olCacheClassStats{},
+	}
+	for name, ctr := range c.counters {
+		cs := olCacheClassStats{
+			Hits:      ctr.hits.Load(),
+			StaleHits: ctr.staleHits.Load(),
+			Misses:    ctr.misses.Load(),
+			Writes:    ctr.writes.Load(),
+			Evictions: ctr.evictions.Load(),
+		}
+		cs.HitRate = hitRate(cs.Hits+cs.StaleHits, cs.Misses)
+		s.Classes[name] = cs
+		s.Totals.Hits += cs.Hits
+		s.Totals.StaleHits += cs.StaleHits
+		s.Totals.Misses += cs.Misses
+		s.Totals.Writes += cs.Writes
+		s.Totals.Evictions += cs.Evictions
+	}
+	s.Totals.HitRate = hitRate(s.Totals.Hits+s.Totals.StaleHits, s.Totals.Misses)
+
+	c.mu.Lock()
+	s.MemoryEntries = len(c.entries)
+	s.MemoryBytes = c.memBytes
+	app := c.app
+	c.mu.Unlock()
+
+	if app != nil {
+		var row struct {
+			Count int64 `db:"count"`
+			Bytes int64 `db:"bytes"`
+		}
+		_ = app.DB().NewQuery(`SELECT COUNT(*) as count, COALESCE(SUM(size), 0) as bytes FROM ol_cache`).One(&row)
+		s.DiskEntries = row.Count
+		s.DiskBytes = row.Bytes
+	}
+	return s
 }
 
-// stats returns current hit/miss counts and resets them.
-func (c *olCache) stats() (hits, misses int64) {
-	hits = c.hits.Swap(0)
-	misses = c.misses.Swap(0)
-	return
+func hitRate(hits, misses int64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
 }
 
-// evictExpired removes entries that have passed their TTL.
-func (c *olCache) evictExpired() {
+// evictExpired removes entries past their stale window, flushes batched
+// access times to the durable store, and trims it to the disk byte budget by
+// least-recent access. Returns the number of durable rows removed.
+func (c *olCache) evictExpired() int {
 	now := time.Now()
-	c.entries.Range(func(key, val any) bool {
-		if now.After(val.(cacheEntry).expiresAt) {
-			c.entries.Delete(key)
+
+	c.mu.Lock()
+	for _, el := range c.entries {
+		entry := el.Value.(*cacheEntry)
+		if !now.Before(entry.staleUntil) {
+			c.removeElement(el)
+			c.counter(entry.class).evictions.Add(1)
 		}
-		return true
-	})
+	}
+	touched := c.touched
+	c.touched = map[string]int{}
+	app := c.app
+	c.mu.Unlock()
+
+	if app == nil {
+		return 0
+	}
+
+	nowStr := store.FormatTime(now)
+	for key, n := range touched {
+		_, _ = app.DB().NewQuery(`
+			UPDATE ol_cache SET hits = hits + {:n}, last_accessed = {:now} WHERE key = {:key}
+		`).Bind(map[string]any{"key": key, "n": n, "now": nowStr}).Execute()
+	}
+
+	removed := 0
+
+	// 1. Drop everything past its stale window.
+	type evictRow struct {
+		Key   string `db:"key"`
+		Class string `db:"ttl_class"`
+		Size  int64  `db:"size"`
+	}
+	var expired []evictRow
+	_ = app.DB().NewQuery(`SELECT key, ttl_class, size FROM ol_cache WHERE stale_until <= {:now}`).
+		Bind(map[string]any{"now": nowStr}).All(&expired)
+	for _, r := range expired {
+		if _, err := app.DB().NewQuery(`DELETE FROM ol_cache WHERE key = {:key}`).
+			Bind(map[string]any{"key": r.Key}).Execute(); err == nil {
+			c.counter(r.Class).evictions.Add(1)
+			removed++
+		}
+	}
+
+	// 2. Trim least-recently-accessed rows until under the byte budget.
+	var total struct {
+		Bytes int64 `db:"bytes"`
+	}
+	_ = app.DB().NewQuery(`SELECT COALESCE(SUM(size), 0) as bytes FROM ol_cache`).One(&total)
+	excess := total.Bytes - c.diskLimit
+	for excess > 0 {
+		var batch []evictRow
+		err := app.DB().NewQuery(`
+			SELECT key, ttl_class, size FROM ol_cache ORDER BY last_accessed ASC LIMIT 200
+		`).All(&batch)
+		if err != nil || len(batch) == 0 {
+			break
+		}
+		trimmed := 0
+		for _, r := range batch {
+			if excess <= 0 {
+				break
+			}
+			if _, err := app.DB().NewQuery(`DELETE FROM ol_cache WHERE key = {:key}`).
+				Bind(map[string]any{"key": r.Key}).Execute(); err != nil {
+				continue
+			}
+			c.mu.Lock()
+			if el, ok := c.entries[r.Key]; ok {
+				c.removeElement(el)
+			}
+			c.mu.Unlock()
+			c.counter(r.Class).evictions.Add(1)
+			excess -= r.Size
+			trimmed++
+		}
+		// The next pass would select the same rows again; give up until
+		// the next sweep rather than spin on deletes that keep failing.
+		if trimmed == 0 {
+			break
+		}
+		removed += trimmed
+	}
+
+	return removed
 }
 
 var (
@@ -77,36 +532,51 @@ type cachedOLClient struct {
 	httpClient *http.Client
 	baseURL    string
 	cache      *olCache
+
+	// refreshing tracks keys with a stale-while-revalidate fetch in flight.
+	refreshing sync.Map
+	// flights coalesces concurrent fetches of the same URL.
+	flights flightGroup
+}
+
+// envInt reads an integer environment variable, returning def when it is
+// unset or invalid.
+func envInt(name string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil && v > 0 {
+		return v
+	}
+	return def
 }
 
-// newOLClient returns a singleton OL client with response caching.
-// The first call starts a background goroutine that logs cache stats
-// and evicts expired entries every hour.
+// newOLClient returns a singleton OL client with response caching. The base
+// URL defaults to openlibrary.org and can be pointed at a local stand-in with
+// OPEN_LIBRARY_BASE_URL.
+// Expired entries are evicted by the ol_cache_eviction task.
 func newOLClient() *cachedOLClient {
 	olClientOnce.Do(func() {
-		c := &olCache{}
+		c := newOLCache(
+			int64(envInt("OL_CACHE_MEMORY_MB", 64))<<20,
+			int64(envInt("OL_CACHE_MAX_MB", 512))<<20,
+		)
+		baseURL := os.Getenv("OPEN_LIBRARY_BASE_URL")
+		if baseURL == "" {
+			baseURL = "https://openlibrary.org"
+		}
 		globalOLClient = &cachedOLClient{
-			httpClient: &http.Client{Timeout: 10 * time.Second},
-			baseURL:    "https://openlibrary.org",
+			httpClient: newExternalHTTPClient(10*time.Second, olGuard),
+			baseURL:    strings.TrimRight(baseURL, "/"),
 			cache:      c,
 		}
-		go func() {
-			ticker := time.NewTicker(1 * time.Hour)
-			defer ticker.Stop()
-			for range ticker.C {
-				c.evictExpired()
-				hits, misses := c.stats()
-				total := hits + misses
-				if total > 0 {
-					log.Printf("[OL Cache] hits=%d misses=%d total=%d hit_rate=%.1f%%",
-						hits, misses, total, float64(hits)/float64(total)*100)
-				}
-			}
-		}()
 	})
 	return globalOLClient
 }
 
+// InitOLCache backs the shared OL client's cache with the ol_cache collection
+// so cached responses survive restarts. Call once from OnServe.
+func InitOLCache(app core.App) {
+	newOLClient().cache.attach(app)
+}
+
 func (c *cachedOLClient) get(path string) (map[string]any, error) {
 	raw, err := c.getRaw(path)
 	if err != nil {
@@ -119,13 +589,78 @@ func (c *cachedOLClient) get(path string) (map[string]any, error) {
 	return result, nil
 }
 
+// getFresh is get for callers that need the current response, such as
+// pollers comparing it against a snapshot: it always goes to the network,
+// and refreshes the cached copy on success.
+func (c *cachedOLClient) getFresh(path string) (map[string]any, error) {
+	raw, err := c.fetchAndStore(c.baseURL+path, classifyOLPath(path))
+	if err != nil {
+		return nil, err
+	}
+	var result map[string]any
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 func (c *cachedOLClient) getRaw(path string) ([]byte, error) {
 	url := c.baseURL + path
+	class := classifyOLPath(path)
 
-	if cached, ok := c.cache.get(url); ok {
+	// In record mode every request goes to the network so the fixture set
+	// is complete regardless of what is already cached.
+	state := cacheMiss
+	var cached []byte
+	if fixtureMode() != fixtureRecord {
+		cached, state = c.cache.get(url, class)
+	}
+	switch state {
+	case cacheFresh:
+		return cached, nil
+	case cacheStale:
+		c.revalidate(url, class)
 		return cached, nil
 	}
 
+	body, err := c.fetchAndStore(url, class)
+	if err != nil {
+		// Upstream is failing or the breaker is open: serve whatever copy we
+		// still have, however old, rather than nothing.
+		if old, ok := c.cache.peek(url); ok {
+			return old, nil
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+// fetchAndStore fetches url and caches a successful response. Concurrent
+// calls for the same url share one request.
+func (c *cachedOLClient) fetchAndStore(url string, class olCacheClass) ([]byte, error) {
+	return c.flights.do(url, func() ([]byte, error) {
+		body, err := c.fetch(url)
+		if err != nil {
+			return nil, err
+		}
+		c.cache.set(url, class, body)
+		return body, nil
+	})
+}
+
+// revalidate refreshes a stale entry in the background. Concurrent callers
+// for the same key share a single refresh.
+func (c *cachedOLClient) revalidate(url string, class olCacheClass) {
+	if _, inFlight := c.refreshing.LoadOrStore(url, struct{}{}); inFlight {
+		return
+	}
+	go func() {
+		defer c.refreshing.Delete(url)
+		_, _ = c.fetchAndStore(url, class)
+	}()
+}
+
+func (c *cachedOLClient) fetch(url string) ([]byte, error) {
 	resp, err := c.httpClient.Get(url)
 	if err != nil {
 		return nil, err
@@ -134,11 +669,93 @@ func (c *cachedOLClient) getRaw(path string) ([]byte, error) {
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("OL API returned %d", resp.StatusCode)
 	}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	return io.ReadAll(resp.Body)
+}
+
+// GetOLCacheStats handles GET /admin/ol-cache
+func GetOLCacheStats(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		return e.JSON(http.StatusOK, newOLClient().cache.stats())
 	}
+}
 
-	c.cache.set(url, body)
-	return body, nil
+// GetOLCacheEntries handles GET /admin/ol-cache/entries?q=<substring>&class=<name>&page=<n>
+func GetOLCacheEntries(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		q := e.Request.URL.Query().Get("q")
+		class := e.Request.URL.Query().Get("class")
+		page, _ := strconv.Atoi(e.Request.URL.Query().Get("page"))
+		if page < 1 {
+			page = 1
+		}
+		perPage := 50
+		offset := (page - 1) * perPage
+
+		query := `
+			SELECT key, ttl_class, size, hits, fetched_at, expires_at, stale_until, last_accessed
+			FROM ol_cache WHERE 1=1`
+		params := map[string]any{"limit": perPage + 1, "offset": offset}
+		if q != "" {
+			query += ` AND key LIKE {:q}`
+			params["q"] = "%" + q + "%"
+		}
+		if class != "" {
+			query += ` AND ttl_class = {:class}`
+			params["class"] = class
+		}
+		query += ` ORDER BY last_accessed DESC LIMIT {:limit} OFFSET {:offset}`
+
+		type entryRow struct {
+			Key          string `db:"key" json:"key"`
+			Class        string `db:"ttl_class" json:"class"`
+			Size         int64  `db:"size" json:"size"`
+			Hits         int64  `db:"hits" json:"hits"`
+			FetchedAt    string `db:"fetched_at" json:"fetched_at"`
+			ExpiresAt    string `db:"expires_at" json:"expires_at"`
+			StaleUntil   string `db:"stale_until" json:"stale_until"`
+			LastAccessed string `db:"last_accessed" json:"last_accessed"`
+		}
+		var rows []entryRow
+		if err := app.DB().NewQuery(query).Bind(params).All(&rows); err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to list cache entries"})
+		}
+
+		hasNext := len(rows) > perPage
+		if hasNext {
+			rows = rows[:perPage]
+		}
+		if rows == nil {
+			rows = []entryRow{}
+		}
+
+		return e.JSON(http.StatusOK, map[string]any{
+			"entries":  rows,
+			"page":     page,
+			"has_next": hasNext,
+		})
+	}
+}
+
+// PurgeOLCache handles DELETE /admin/ol-cache/entries?key=<path>|prefix=<path>
+// Keys and prefixes are OL paths such as "/works/OL45883W.json"; they are
+// resolved against the client's base URL.
+func PurgeOLCache(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		key := e.Request.URL.Query().Get("key")
+		prefix := e.Request.URL.Query().Get("prefix")
+		if key == "" && prefix == "" {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "key or prefix is required"})
+		}
+
+		ol := newOLClient()
+		if key != "" && !strings.HasPrefix(key, "http") {
+			key = ol.baseURL + key
+		}
+		if prefix != "" && !strings.HasPrefix(prefix, "http") {
+			prefix = ol.baseURL + prefix
+		}
+
+		removed := ol.cache.purge(key, prefix)
+		return e.JSON(http.StatusOK, map[string]any{"ok": true, "removed": removed})
+	}
 }
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Process-wide guards for outbound catalog traffic. Every client talking to
+// the same upstream shares one guard, so import fan-out, ghost seeding and
+// page views all draw from the same budget.
+var (
+	olGuard = newOutboundGuard("Open Library",
+		float64(envInt("OL_RATE_LIMIT", 5)), envInt("OL_RATE_BURST", 10))
+	gbGuard = newOutboundGuard("Google Books",
+		float64(envInt("GOOGLE_BOOKS_RATE_LIMIT", 2)), envInt("GOOGLE_BOOKS_RATE_BURST", 5))
+)
+
+const (
+	outboundMaxAttempts = 3
+	outboundBaseBackoff = 500 * time.Millisecond
+	outboundMaxBackoff  = 5 * time.Second
+	breakerFailureLimit = 5
+	breakerCooldown     = 30 * time.Second
+)
+
+var errCircuitOpen = errors.New("upstream unavailable (circuit open)")
+
+// tokenBucket is a blocking rate limiter: rate tokens per second, up to burst.
+type tokenBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	burst  float64
+	rate   float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{tokens: float64(burst), burst: float64(burst), rate: rate, last: time.Now()}
+}
+
+// reserve takes a token and returns how long the caller must wait before
+// using it.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// circuitBreaker opens after breakerFailureLimit consecutive failures and
+// rejects calls until breakerCooldown passes, then lets a single probe
+// through (half-open). A successful probe closes it again. A probe that never
+// reports back (e.g. the caller gave up) is replaced after another cooldown.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probeAt   time.Time
+}
+
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.failures < breakerFailureLimit {
+		return true
+	}
+	now := time.Now()
+	if now.Before(cb.openUntil) || now.Before(cb.probeAt.Add(breakerCooldown)) {
+		return false
+	}
+	cb.probeAt = now
+	return true
+}
+
+func (cb *circuitBreaker) success() {
+	cb.mu.Lock()
+	cb.failures = 0
+	cb.probeAt = time.Time{}
+	cb.mu.Unlock()
+}
+
+func (cb *circuitBreaker) failure() {
+	cb.mu.Lock()
+	cb.failures++
+	cb.probeAt = time.Time{}
+	if cb.failures >= breakerFailureLimit {
+		cb.openUntil = time.Now().Add(breakerCooldown)
+	}
+	cb.mu.Unlock()
+}
+
+// state reports "closed", "open" or "half-open".
+func (cb *circuitBreaker) state() string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	switch {
+	case cb.failures < breakerFailureLimit:
+		return "closed"
+	case time.Now().Before(cb.openUntil):
+		return "open"
+	default:
+		return "half-open"
+	}
+}
+
+// outboundGuard combines the limiter and breaker for one upstream.
+type outboundGuard struct {
+	name    string
+	bucket  *tokenBucket
+	breaker *circuitBreaker
+}
+
+func newOutboundGuard(name string, rate float64, burst int) *outboundGuard {
+	return &outboundGuard{name: name, bucket: newTokenBucket(rate, burst), breaker: &circuitBreaker{}}
+}
+
+// guardedTransport applies an outboundGuard to every request: it waits for a
+// token, short-circuits while the breaker is open, and retries 429/5xx and
+// network errors with jittered exponential backoff, honoring Retry-After.
+type guardedTransport struct {
+	guard *outboundGuard
+	next  http.RoundTripper
+}
+
+func (t *guardedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	g := t.guard
+	if !g.breaker.allow() {
+		return nil, fmt.Errorf("%s: %w", g.name, errCircuitOpen)
+	}
+
+	var resp *http.Response
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err := sleepCtx(req, g.bucket.reserve()); err != nil {
+			return nil, err
+		}
+		if attempt > 1 && req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, bodyErr
+			}
+			req.Body = body
+		}
+
+		resp, err = t.next.RoundTrip(req)
+		if !retryable(resp, err) {
+			break
+		}
+		canRetry := attempt < outboundMaxAttempts && (req.Body == nil || req.GetBody != nil)
+		if !canRetry {
+			break
+		}
+
+		wait := backoff(attempt)
+		if resp != nil {
+			if ra := retryAfter(resp); ra > 0 {
+				wait = ra
+			}
+			resp.Body.Close()
+		}
+		if wait > outboundMaxBackoff {
+			// Upstream asked us to back off longer than we're willing to
+			// hold a request open; give up now.
+			resp = nil
+			err = fmt.Errorf("%s asked to retry after %s", g.name, wait)
+			break
+		}
+		if err := sleepCtx(req, wait); err != nil {
+			return nil, err
+		}
+	}
+
+	if retryable(resp, err) {
+		g.breaker.failure()
+	} else {
+		g.breaker.success()
+	}
+	return resp, err
+}
+
+// retryable reports whether a response or error is worth another attempt.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// backoff returns a full-jitter exponential delay for the given attempt.
+func backoff(attempt int) time.Duration {
+	d := outboundBaseBackoff << (attempt - 1)
+	if d > outboundMaxBackoff {
+		d = outboundMaxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// retryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func sleepCtx(req *http.Request, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+// flightGroup coalesces concurrent calls with the same key into one.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	wg  sync.WaitGroup
+	val []byte
+	err error
+}
+
+// do runs fn once per key at a time; concurrent callers wait for and share
+// the first caller's result.
+func (g *flightGroup) do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*flightCall{}
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err
+	}
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return c.val, c.err
+}
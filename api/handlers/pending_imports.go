@@ -2,12 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log"
 	"net/http"
-	"net/url"
 	"strings"
+	"time"
 
 	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/isbn"
+	"github.com/tristansaldanha/rosslib/api/store"
 )
 
 // GetPendingImports handles GET /me/imports/pending
@@ -41,6 +45,8 @@ func GetPendingImports(app core.App) func(e *core.RequestEvent) error {
 			if customShelves == nil {
 				customShelves = []string{}
 			}
+			highlights := []importHighlight{}
+			_ = r.UnmarshalJSONField("highlights", &highlights)
 
 			items = append(items, map[string]any{
 				"id":              r.Id,
@@ -53,6 +59,7 @@ func GetPendingImports(app core.App) func(e *core.RequestEvent) error {
 				"review_text":     r.GetString("review_text"),
 				"date_read":       r.GetString("date_read"),
 				"date_added":      r.GetString("date_added"),
+				"highlights":      highlights,
 				"created":         r.GetString("created"),
 			})
 		}
@@ -106,47 +113,8 @@ func ResolvePendingImport(app core.App) func(e *core.RequestEvent) error {
 				return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to save book"})
 			}
 
-			// Create user_book
-			existing, _ := app.FindRecordsByFilter("user_books",
-				"user = {:user} && book = {:book}",
-				"", 1, 0,
-				map[string]any{"user": user.Id, "book": book.Id},
-			)
-			var ub *core.Record
-			if len(existing) > 0 {
-				ub = existing[0]
-			} else {
-				coll, err := app.FindCollectionByNameOrId("user_books")
-				if err != nil {
-					return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to create user_book"})
-				}
-				ub = core.NewRecord(coll)
-				ub.Set("user", user.Id)
-				ub.Set("book", book.Id)
-			}
-
-			rating := record.Get("rating")
-			if rating != nil && rating != 0.0 {
-				ub.Set("rating", rating)
-			}
-			if review := record.GetString("review_text"); review != "" {
-				ub.Set("review_text", review)
-			}
-			if dr := record.GetString("date_read"); dr != "" {
-				ub.Set("date_read", dr)
-			}
-			if da := record.GetString("date_added"); da != "" {
-				ub.Set("date_added", da)
-			}
-
-			if err := app.Save(ub); err != nil {
-				return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to save user_book"})
-			}
-
-			// Map exclusive shelf to status tag
-			statusSlug := mapGoodreadsShelf(record.GetString("exclusive_shelf"))
-			if statusSlug != "" {
-				setStatusTag(app, user.Id, book.Id, statusSlug)
+			if err := resolvePendingImport(app, user.Id, record, pendingImporter(record), book.Id); err != nil {
+				return e.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
 			}
 
 			// Mark resolved
@@ -155,8 +123,6 @@ func ResolvePendingImport(app core.App) func(e *core.RequestEvent) error {
 				return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to update"})
 			}
 
-			refreshBookStats(app, book.Id)
-
 			return e.JSON(http.StatusOK, map[string]any{"ok": true, "book_id": book.Id})
 
 		default:
@@ -189,7 +155,8 @@ func DeletePendingImport(app core.App) func(e *core.RequestEvent) error {
 
 // RetryPendingImport handles POST /me/imports/pending/:id/retry
 // Re-runs the lookup chain for a single pending import and returns the result.
-// If a match is found, it auto-resolves (creates user_book) and removes the pending import.
+// If a match is found, it auto-resolves (creates user_book, or quotes for
+// highlights) and removes the pending import.
 func RetryPendingImport(app core.App) func(e *core.RequestEvent) error {
 	return func(e *core.RequestEvent) error {
 		user := e.Auth
@@ -208,128 +175,51 @@ func RetryPendingImport(app core.App) func(e *core.RequestEvent) error {
 
 		title := record.GetString("title")
 		author := record.GetString("author")
-		isbn := record.GetString("isbn13")
+		isbn13 := isbn.Normalize(record.GetString("isbn13"))
 
+		imp := pendingImporter(record)
 		ol := newOLClient()
-		gb := newGBClient()
 
 		found := false
 		var olID, matchTitle, coverURL string
 		var authors []string
 
-		// 1. Check local DB by ISBN
-		if isbn != "" {
-			existing, localErr := app.FindRecordsByFilter("books",
-				"isbn13 = {:isbn}",
-				"", 1, 0,
-				map[string]any{"isbn": isbn},
-			)
-			if localErr == nil && len(existing) > 0 {
-				rec := existing[0]
-				olID = rec.GetString("open_library_id")
-				matchTitle = rec.GetString("title")
-				coverURL = rec.GetString("cover_url")
-				if a := rec.GetString("authors"); a != "" {
-					authors = strings.Split(a, ", ")
-				}
-				found = olID != ""
-			}
-		}
-
-		// 2. OL direct ISBN endpoint
-		if isbn != "" && !found {
-			data, err := ol.get(fmt.Sprintf("/isbn/%s.json", isbn))
-			if err == nil {
-				if works, ok := data["works"].([]any); ok && len(works) > 0 {
-					if w, ok := works[0].(map[string]any); ok {
-						if key, ok := w["key"].(string); ok {
-							olID = strings.TrimPrefix(key, "/works/")
-							found = true
-						}
-					}
-				}
-				if t, ok := data["title"].(string); ok {
-					matchTitle = t
-				}
-				if covers, ok := data["covers"].([]any); ok && len(covers) > 0 {
-					if coverID, ok := covers[0].(float64); ok {
-						coverURL = fmt.Sprintf("https://covers.openlibrary.org/b/id/%.0f-M.jpg", coverID)
-					}
-				}
-			}
+		// 1. Local DB by ISBN, then the local catalog, then each catalog
+		// provider in turn
+		m, local := matchBookCandidates(app, isbn13, imp.CleanTitle(title), imp.CleanAuthor(author))
+		if m != nil {
+			olID, matchTitle, coverURL, authors, found = m.WorkID, m.Title, m.CoverURL, m.Authors, true
 		}
 
-		// 3. OL search by ISBN
-		if isbn != "" && !found {
-			data, err := ol.get(fmt.Sprintf("/search.json?isbn=%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", url.QueryEscape(isbn)))
-			if err == nil {
-				olID, matchTitle, coverURL, authors, found = extractOLSearchResult(data)
-			}
-		}
-
-		// 4. OL search by cleaned title+author
-		if !found && title != "" {
-			cleaned := cleanGoodreadsTitle(title)
-			cleanedAuthor := cleanGoodreadsAuthor(author)
-			q := "title=" + url.QueryEscape(cleaned)
-			if cleanedAuthor != "" {
-				q += "&author=" + url.QueryEscape(cleanedAuthor)
-			}
-			data, err := ol.get(fmt.Sprintf("/search.json?%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", q))
-			if err == nil {
-				olID, matchTitle, coverURL, authors, found = extractOLSearchResult(data)
-			}
-		}
-
-		// 5. OL search by title only
-		if !found && title != "" {
-			cleaned := cleanGoodreadsTitle(title)
-			cleaned = stripAuthorPrefix(cleaned, author)
-			data, err := ol.get(fmt.Sprintf("/search.json?title=%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", url.QueryEscape(cleaned)))
-			if err == nil {
-				id, mt, cu, au, ok := extractOLSearchResult(data)
-				if ok && titleMatchesResult(cleaned, mt) {
-					olID, matchTitle, coverURL, authors, found = id, mt, cu, au, ok
-				}
-			}
-		}
-
-		// 6. Strip comma-subtitles and retry
-		if !found && title != "" {
-			cleaned := cleanGoodreadsTitle(title)
-			if idx := strings.Index(cleaned, ","); idx > 0 {
-				shortened := strings.TrimSpace(cleaned[:idx])
-				if len(shortened) > 3 {
-					cleanedAuthor := cleanGoodreadsAuthor(author)
-					q := "title=" + url.QueryEscape(shortened)
-					if cleanedAuthor != "" {
-						q += "&author=" + url.QueryEscape(cleanedAuthor)
-					}
-					data, err := ol.get(fmt.Sprintf("/search.json?%s&fields=key,title,author_name,first_publish_year,cover_i&limit=1", q))
-					if err == nil {
-						id, mt, cu, au, ok := extractOLSearchResult(data)
-						if ok && titleMatchesResult(shortened, mt) {
-							olID, matchTitle, coverURL, authors, found = id, mt, cu, au, ok
-						}
-					}
-				}
-			}
-		}
-
-		// 7. Google Books fallback
-		if !found {
-			olID, matchTitle, coverURL, authors, found = googleBooksLookup(gb, ol, isbn, cleanGoodreadsTitle(title), cleanGoodreadsAuthor(author))
-		}
-
-		// 8. LLM-powered fuzzy matching
 		type candidate struct {
 			OLID     string   `json:"ol_id"`
 			Title    string   `json:"title"`
 			Authors  []string `json:"authors"`
 			CoverURL *string  `json:"cover_url"`
+			Score    float64  `json:"score,omitempty"`
+		}
+
+		// 2. Near misses in the local catalog
+		if !found && imp.FuzzyMatch() && len(local) > 0 {
+			var candidates []candidate
+			for _, c := range local {
+				ic := c.importCandidate()
+				candidates = append(candidates, candidate{
+					OLID:     ic.OLID,
+					Title:    ic.Title,
+					Authors:  ic.Authors,
+					CoverURL: ic.CoverURL,
+					Score:    ic.Score,
+				})
+			}
+			return e.JSON(http.StatusOK, map[string]any{
+				"status":     "ambiguous",
+				"candidates": candidates,
+			})
 		}
 
-		if !found && title != "" {
+		// 3. LLM-powered fuzzy matching
+		if !found && imp.FuzzyMatch() && title != "" {
 			if result := llmFuzzyMatch(ol, title, author); result != nil {
 				var candidates []candidate
 				for _, c := range result.Candidates {
@@ -357,68 +247,136 @@ func RetryPendingImport(app core.App) func(e *core.RequestEvent) error {
 		}
 
 		// Match found — auto-resolve: upsert book + user_book
-		book, err := upsertBook(app, olID, matchTitle, coverURL, isbn, strings.Join(authors, ", "), 0, "")
+		bookID, err := resolvePendingMatch(app, record, imp, olID, matchTitle, coverURL, isbn13, authors)
 		if err != nil {
-			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to save book"})
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": err.Error()})
 		}
 
-		existing, _ := app.FindRecordsByFilter("user_books",
-			"user = {:user} && book = {:book}",
-			"", 1, 0,
-			map[string]any{"user": user.Id, "book": book.Id},
-		)
-		var ub *core.Record
-		if len(existing) > 0 {
-			ub = existing[0]
-		} else {
-			coll, err := app.FindCollectionByNameOrId("user_books")
-			if err != nil {
-				return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to create user_book"})
+		return e.JSON(http.StatusOK, map[string]any{
+			"status":  "matched",
+			"book_id": bookID,
+			"match": map[string]any{
+				"ol_id":     olID,
+				"title":     matchTitle,
+				"authors":   authors,
+				"cover_url": coverURL,
+			},
+		})
+	}
+}
+
+// resolvePendingMatch saves the book a pending import matched, writes the
+// import against it and marks the pending row resolved. Returns the book id.
+func resolvePendingMatch(app core.App, record *core.Record, imp Importer, olID, title, coverURL, isbn13 string, authors []string) (string, error) {
+	book, err := upsertBook(app, olID, title, coverURL, isbn13, strings.Join(authors, ", "), 0, "")
+	if err != nil {
+		return "", errors.New("Failed to save book")
+	}
+	if err := resolvePendingImport(app, record.GetString("user"), record, imp, book.Id); err != nil {
+		return "", err
+	}
+	record.Set("status", "resolved")
+	_ = app.Save(record)
+	return book.Id, nil
+}
+
+// retryPendingImports re-runs the exact lookup chain (local ISBN, local
+// catalog, catalog providers) for up to limit unmatched pending imports,
+// those tried longest ago first, and resolves the ones that now match. Fuzzy
+// and LLM matching are left to the user's manual retry, since their
+// candidates need confirming. Returns how many were tried and resolved.
+func retryPendingImports(app core.App, limit int) (tried, resolved int, err error) {
+	records, err := app.FindRecordsByFilter("pending_imports",
+		"status = 'unmatched'", "retried_at", limit, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	now := store.FormatTime(time.Now())
+	for _, record := range records {
+		tried++
+		imp := pendingImporter(record)
+		isbn13 := isbn.Normalize(record.GetString("isbn13"))
+		title := imp.CleanTitle(record.GetString("title"))
+		author := imp.CleanAuthor(record.GetString("author"))
+
+		if m, _ := matchBookCandidates(app, isbn13, title, author); m != nil {
+			if _, err := resolvePendingMatch(app, record, imp, m.WorkID, m.Title, m.CoverURL, isbn13, m.Authors); err != nil {
+				log.Printf("[PendingImports] resolve %s: %v", record.Id, err)
+			} else {
+				resolved++
+				continue
 			}
-			ub = core.NewRecord(coll)
-			ub.Set("user", user.Id)
-			ub.Set("book", book.Id)
 		}
 
-		rating := record.Get("rating")
-		if rating != nil && rating != 0.0 {
-			ub.Set("rating", rating)
-		}
-		if review := record.GetString("review_text"); review != "" {
-			ub.Set("review_text", review)
-		}
-		if dr := record.GetString("date_read"); dr != "" {
-			ub.Set("date_read", dr)
-		}
-		if da := record.GetString("date_added"); da != "" {
-			ub.Set("date_added", da)
+		record.Set("retried_at", now)
+		if err := app.Save(record); err != nil {
+			log.Printf("[PendingImports] save %s: %v", record.Id, err)
 		}
+	}
+	return tried, resolved, nil
+}
 
-		if err := app.Save(ub); err != nil {
-			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to save user_book"})
+// resolvePendingImport writes a pending import once its book is known: its
+// highlights as quotes, or else a shelf entry and status.
+func resolvePendingImport(app core.App, userID string, record *core.Record, imp Importer, bookID string) error {
+	var highlights []importHighlight
+	_ = record.UnmarshalJSONField("highlights", &highlights)
+	if len(highlights) > 0 {
+		if _, err := saveImportHighlights(app, userID, bookID, highlights, false); err != nil {
+			return errors.New("Failed to save quotes")
 		}
+		return nil
+	}
 
-		// Map exclusive shelf to status tag
-		statusSlug := mapGoodreadsShelf(record.GetString("exclusive_shelf"))
-		if statusSlug != "" {
-			setStatusTag(app, user.Id, book.Id, statusSlug)
+	existing, _ := app.FindRecordsByFilter("user_books",
+		"user = {:user} && book = {:book}",
+		"", 1, 0,
+		map[string]any{"user": userID, "book": bookID},
+	)
+	var ub *core.Record
+	if len(existing) > 0 {
+		ub = existing[0]
+	} else {
+		coll, err := app.FindCollectionByNameOrId("user_books")
+		if err != nil {
+			return errors.New("Failed to create user_book")
 		}
+		ub = core.NewRecord(coll)
+		ub.Set("user", userID)
+		ub.Set("book", bookID)
+	}
 
-		// Mark resolved
-		record.Set("status", "resolved")
-		_ = app.Save(record)
+	rating := record.Get("rating")
+	if rating != nil && rating != 0.0 {
+		ub.Set("rating", rating)
+	}
+	if review := record.GetString("review_text"); review != "" {
+		ub.Set("review_text", review)
+	}
+	if dr := record.GetString("date_read"); dr != "" {
+		ub.Set("date_read", dr)
+	}
+	if da := record.GetString("date_added"); da != "" {
+		ub.Set("date_added", da)
+	}
 
-		refreshBookStats(app, book.Id)
+	if err := app.Save(ub); err != nil {
+		return errors.New("Failed to save user_book")
+	}
 
-		return e.JSON(http.StatusOK, map[string]any{
-			"status":  "matched",
-			"book_id": book.Id,
-			"match": map[string]any{
-				"ol_id":     olID,
-				"title":     matchTitle,
-				"authors":   authors,
-				"cover_url": coverURL,
-			},
-		})
+	// Map exclusive shelf to status tag
+	if statusSlug := imp.Status(record.GetString("exclusive_shelf")); statusSlug != "" {
+		setStatusTag(app, userID, bookID, statusSlug)
+	}
+	return nil
+}
+
+// pendingImporter returns the importer a pending row was saved by, falling
+// back to Goodreads for sources that are no longer registered.
+func pendingImporter(record *core.Record) Importer {
+	if imp, ok := importerFor(record.GetString("source")); ok {
+		return imp
 	}
+	return goodreadsImporter{}
 }
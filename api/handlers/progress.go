@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/progress"
+)
+
+// requestLocation is the time zone named by ?tz= (IANA, e.g.
+// "Europe/Paris"), which progress days, streaks and heatmaps are counted
+// in. Defaults to UTC.
+func requestLocation(e *core.RequestEvent) (*time.Location, bool) {
+	tz := e.Request.URL.Query().Get("tz")
+	if tz == "" {
+		return time.UTC, true
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, false
+	}
+	return loc, true
+}
+
+// GetBookProgress handles GET /me/books/{olId}/progress?from=&to=&tz=
+// Returns every progress update for the book, pages read per day over the
+// range (default the last 30 days) and the reader's recent pace.
+func GetBookProgress(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		user := e.Auth
+		if user == nil {
+			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
+		}
+		loc, ok := requestLocation(e)
+		if !ok {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Unknown time zone"})
+		}
+		q := e.Request.URL.Query()
+		r, err := progress.NewRange(q.Get("from"), q.Get("to"), 30, loc)
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Dates must be YYYY-MM-DD"})
+		}
+
+		books, _ := app.FindRecordsByFilter("books",
+			"open_library_id = {:id}", "", 1, 0,
+			map[string]any{"id": e.Request.PathValue("olId")},
+		)
+		if len(books) == 0 {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "Book not found"})
+		}
+		book := books[0]
+
+		ubs, _ := app.FindRecordsByFilter("user_books",
+			"user = {:user} && book = {:book}",
+			"", 1, 0,
+			map[string]any{"user": user.Id, "book": book.Id},
+		)
+		if len(ubs) == 0 {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "Book not in your library"})
+		}
+		ub := ubs[0]
+
+		events, err := progress.BookEvents(app, user.Id, book.Id)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to load progress"})
+		}
+		days, err := progress.Daily(app, user.Id, book.Id, r)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to load progress"})
+		}
+		pagesRead, activeDays := progress.Totals(days)
+
+		return e.JSON(http.StatusOK, map[string]any{
+			"events":           events,
+			"days":             days,
+			"total_pages_read": pagesRead,
+			"active_days":      activeDays,
+			"pace":             progress.BookPace(events, remainingPages(ub, book), loc),
+		})
+	}
+}
+
+// remainingPages is how many pages of a book a reader has left, from their
+// progress and the device or catalog page count, or 0 if unknown.
+func remainingPages(ub, book *core.Record) float64 {
+	total := ub.GetFloat("device_total_pages")
+	if total <= 0 {
+		total = book.GetFloat("page_count")
+	}
+	if total <= 0 {
+		return 0
+	}
+	read := ub.GetFloat("progress_pages")
+	if read <= 0 {
+		read = total * ub.GetFloat("progress_percent") / 100
+	}
+	return max(0, total-read)
+}
+
+// GetUserProgress handles GET /users/{username}/progress?from=&to=&tz=
+// Returns pages read per day across all books over the range (default the
+// last 30 days), with the user's reading streaks.
+func GetUserProgress(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		users, err := app.FindRecordsByFilter("users",
+			"username = {:username}", "", 1, 0,
+			map[string]any{"username": e.Request.PathValue("username")},
+		)
+		if err != nil || len(users) == 0 {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "User not found"})
+		}
+		user := users[0]
+
+		viewerID := ""
+		if e.Auth != nil {
+			viewerID = e.Auth.Id
+		}
+		if !canViewProfile(app, viewerID, user) {
+			return e.JSON(http.StatusForbidden, map[string]any{"error": "Profile is private"})
+		}
+
+		loc, ok := requestLocation(e)
+		if !ok {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Unknown time zone"})
+		}
+		q := e.Request.URL.Query()
+		r, err := progress.NewRange(q.Get("from"), q.Get("to"), 30, loc)
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Dates must be YYYY-MM-DD"})
+		}
+
+		days, err := progress.Daily(app, user.Id, "", r)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to load progress"})
+		}
+		streak, err := progress.Streaks(app, user.Id, loc)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to load progress"})
+		}
+		pagesRead, activeDays := progress.Totals(days)
+
+		return e.JSON(http.StatusOK, map[string]any{
+			"days":             days,
+			"total_pages_read": pagesRead,
+			"active_days":      activeDays,
+			"streak":           streak,
+		})
+	}
+}
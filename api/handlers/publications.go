@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// maxNewTitles caps how many new work titles a new_publication notification
+// names.
+const maxNewTitles = 5
+
+// pollNewPublications checks the Open Library work count of every followed
+// author against author_works_snapshot and notifies the author's followers
+// when it has grown. An author's first poll only seeds the snapshot, so
+// following an author doesn't bring a flood of their back catalog. Returns
+// how many authors were checked and how many notifications were sent.
+func pollNewPublications(app core.App) (checked, notified int, err error) {
+	type followed struct {
+		AuthorKey  string `db:"author_key"`
+		AuthorName string `db:"author_name"`
+	}
+	// Follows of authors without an OL key are keyed by the author's record
+	// id and have no catalog works to poll.
+	var authors []followed
+	err = app.DB().NewQuery(`
+		SELECT af.author_key,
+			COALESCE(NULLIF(MAX(a.name), ''), MAX(af.author_name), '') AS author_name
+		FROM author_follows af
+		LEFT JOIN authors a ON a.id = af.author
+		WHERE af.author_key != ''
+			AND af.author_key != COALESCE(af.author, '')
+		GROUP BY af.author_key
+	`).All(&authors)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ol := newOLClient()
+	failed := 0
+	for _, a := range authors {
+		data, err := ol.getFresh(fmt.Sprintf("/authors/%s/works.json?limit=%d", a.AuthorKey, maxNewTitles))
+		if err != nil {
+			failed++
+			continue
+		}
+		size, ok := data["size"].(float64)
+		if !ok {
+			failed++
+			continue
+		}
+		checked++
+		count := int(size)
+
+		snap, err := app.FindFirstRecordByData("author_works_snapshot", "author_key", a.AuthorKey)
+		if err != nil {
+			coll, err := app.FindCollectionByNameOrId("author_works_snapshot")
+			if err != nil {
+				return checked, notified, err
+			}
+			snap = core.NewRecord(coll)
+			snap.Set("author_key", a.AuthorKey)
+			snap.Set("work_count", count)
+			if err := app.Save(snap); err != nil {
+				log.Printf("[Publications] seed %s: %v", a.AuthorKey, err)
+			}
+			continue
+		}
+
+		previous := snap.GetInt("work_count")
+		if count == previous {
+			continue
+		}
+		// A drop means works were merged or removed upstream; just follow it.
+		if count > previous {
+			notified += notifyNewPublication(app, a.AuthorKey, a.AuthorName, count-previous, newWorkTitles(data, count-previous))
+		}
+		snap.Set("work_count", count)
+		if err := app.Save(snap); err != nil {
+			log.Printf("[Publications] update %s: %v", a.AuthorKey, err)
+		}
+	}
+
+	if failed > 0 && checked == 0 {
+		return 0, 0, fmt.Errorf("could not fetch works for any of %d authors", failed)
+	}
+	return checked, notified, nil
+}
+
+// newWorkTitles returns up to n work titles from a works.json response,
+// which lists the most recently added works first.
+func newWorkTitles(data map[string]any, n int) []string {
+	entries, _ := data["entries"].([]any)
+	var titles []string
+	for _, entry := range entries {
+		if len(titles) >= min(n, maxNewTitles) {
+			break
+		}
+		e, _ := entry.(map[string]any)
+		if title, _ := e["title"].(string); title != "" {
+			titles = append(titles, title)
+		}
+	}
+	return titles
+}
+
+// notifyNewPublication queues a new_publication notification for each
+// follower of an author. Returns how many were queued.
+func notifyNewPublication(app core.App, authorKey, authorName string, newCount int, titles []string) int {
+	followers, err := app.FindRecordsByFilter("author_follows",
+		"author_key = {:key}", "", 0, 0,
+		map[string]any{"key": authorKey},
+	)
+	if err != nil {
+		log.Printf("[Publications] load followers of %s: %v", authorKey, err)
+		return 0
+	}
+
+	if authorName == "" {
+		authorName = authorKey
+	}
+	title := fmt.Sprintf("New work by %s", authorName)
+	body := fmt.Sprintf("%s published %d new works", authorName, newCount)
+	if newCount == 1 {
+		body = fmt.Sprintf("%s published a new work", authorName)
+	}
+	if len(titles) > 0 {
+		body += ": " + strings.Join(titles, ", ")
+	}
+
+	for _, f := range followers {
+		sendNotification(app, notificationJob{
+			User:  f.GetString("user"),
+			Type:  "new_publication",
+			Title: title,
+			Body:  body,
+			Metadata: map[string]any{
+				"author_key":  authorKey,
+				"author_name": authorName,
+				"new_count":   strconv.Itoa(newCount),
+				"new_titles":  strings.Join(titles, ", "),
+			},
+		})
+	}
+	return len(followers)
+}
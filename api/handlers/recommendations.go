@@ -101,29 +101,18 @@ func SendRecommendation(app core.App) func(e *core.RequestEvent) error {
 		}
 		bookTitle := book.GetString("title")
 
-		go func() {
-			if !ShouldNotify(app, recipient.Id, "book_recommendation") {
-				return
-			}
-
-			notifsColl, err := app.FindCollectionByNameOrId("notifications")
-			if err != nil {
-				return
-			}
-			notif := core.NewRecord(notifsColl)
-			notif.Set("user", recipient.Id)
-			notif.Set("notif_type", "book_recommendation")
-			notif.Set("title", fmt.Sprintf("%s recommended a book", senderName))
-			notif.Set("body", fmt.Sprintf("%s recommended \"%s\"", senderName, bookTitle))
-			notif.Set("metadata", map[string]any{
+		sendNotification(app, notificationJob{
+			User:  recipient.Id,
+			Type:  "book_recommendation",
+			Title: fmt.Sprintf("%s recommended a book", senderName),
+			Body:  fmt.Sprintf("%s recommended \"%s\"", senderName, bookTitle),
+			Metadata: map[string]any{
 				"sender_username": user.GetString("username"),
-				"book_ol_id":     body.BookOlID,
-				"book_title":     bookTitle,
-				"note":           body.Note,
-			})
-			notif.Set("read", false)
-			_ = app.Save(notif)
-		}()
+				"book_ol_id":      body.BookOlID,
+				"book_title":      bookTitle,
+				"note":            body.Note,
+			},
+		})
 
 		// Record activity
 		recordActivity(app, user.Id, "sent_recommendation", map[string]any{
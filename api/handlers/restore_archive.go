@@ -0,0 +1,491 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/filesystem"
+)
+
+// Restoring an archive (see export_archive.go) merges it into the signed-in
+// account, which may be on another server. Records the account already has
+// are left alone, so restoring the same archive twice changes nothing.
+// Books are found or created from the archive's book list; other users are
+// found by username and skipped when they don't exist here.
+
+// archiveRestoreMaxSize bounds the uploaded archive, and each file read from
+// it. The whole archive is held in memory and restored in one transaction,
+// so it is kept well under what a long-running job would warrant.
+const archiveRestoreMaxSize = 64 * 1024 * 1024
+
+var (
+	errArchiveInvalid     = errors.New("invalid archive")
+	errArchiveFormat      = errors.New("not a rosslib archive")
+	errArchiveUnsupported = errors.New("unsupported archive version")
+)
+
+// archiveRestore is an archive section a restore writes. owner is the field
+// set to the restoring user ("" when ownership follows a ref), and unique
+// the fields that identify a record the account already has.
+type archiveRestore struct {
+	key    string
+	owner  string
+	unique []string
+}
+
+// archiveRestores are restored in order, each after the sections it refers
+// to. Community content and others' records (threads, comments, links,
+// likes, recommendations, followers) aren't restored.
+var archiveRestores = []archiveRestore{
+	{key: "library", owner: "user", unique: []string{"book"}},
+	{key: "label_keys", owner: "user", unique: []string{"slug"}},
+	{key: "label_values", unique: []string{"tag_key", "slug"}},
+	{key: "book_labels", owner: "user", unique: []string{"book", "tag_key", "tag_value"}},
+	{key: "shelves", owner: "user", unique: []string{"slug"}},
+	{key: "shelf_items", owner: "user", unique: []string{"collection", "book"}},
+	{key: "reading_sessions", owner: "user", unique: []string{"book", "date_started", "date_finished"}},
+	{key: "quotes", owner: "user", unique: []string{"book", "text"}},
+	{key: "genre_ratings", owner: "user", unique: []string{"book", "genre"}},
+	{key: "reading_goals", owner: "user", unique: []string{"year"}},
+	{key: "following", owner: "follower", unique: []string{"followee"}},
+}
+
+// archiveRestoreProfile are profile fields filled in where the account has
+// none.
+var archiveRestoreProfile = []string{"display_name", "bio", "theme"}
+
+// archiveCounts is the outcome of restoring one section.
+type archiveCounts struct {
+	Restored int `json:"restored"`
+	Skipped  int `json:"skipped"`
+}
+
+// archiveRestorer restores one archive into one account.
+type archiveRestorer struct {
+	app    core.App
+	user   *core.Record
+	books  map[string]map[string]any // archive books by Open Library ID
+	bookID map[string]string         // Open Library ID → books id, "" when unusable
+	ids    map[string]string         // archive id → record id
+	users  map[string]string         // username → users id, "" when missing
+
+	counts       map[string]archiveCounts
+	missingUsers []string
+}
+
+// readArchive reads archive.json and the files beside it from an uploaded
+// zip, or a bare archive.json.
+func readArchive(data []byte) (map[string]json.RawMessage, map[string]*zip.File, error) {
+	files := map[string]*zip.File{}
+	raw := data
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, nil, errArchiveInvalid
+		}
+		for _, f := range zr.File {
+			files[f.Name] = f
+		}
+		f, ok := files["archive.json"]
+		if !ok {
+			return nil, nil, errArchiveInvalid
+		}
+		if raw, err = readArchiveFile(f); err != nil {
+			return nil, nil, errArchiveInvalid
+		}
+	}
+
+	var archive map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &archive); err != nil {
+		return nil, nil, errArchiveInvalid
+	}
+	var format string
+	var version int
+	_ = json.Unmarshal(archive["format"], &format)
+	_ = json.Unmarshal(archive["version"], &version)
+	if format != archiveFormat {
+		return nil, nil, errArchiveFormat
+	}
+	if version < 1 || version > archiveVersion {
+		return nil, nil, fmt.Errorf("%w: %d", errArchiveUnsupported, version)
+	}
+	return archive, files, nil
+}
+
+func readArchiveFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, archiveRestoreMaxSize))
+}
+
+// restore writes every restorable section.
+func (r *archiveRestorer) restore(archive map[string]json.RawMessage) error {
+	var books []map[string]any
+	_ = json.Unmarshal(archive["books"], &books)
+	for _, b := range books {
+		if olid, _ := b["open_library_id"].(string); olid != "" {
+			r.books[olid] = b
+		}
+	}
+
+	for _, rs := range archiveRestores {
+		var items []map[string]any
+		if raw, ok := archive[rs.key]; ok {
+			if err := json.Unmarshal(raw, &items); err != nil {
+				return fmt.Errorf("%w: section %s", errArchiveInvalid, rs.key)
+			}
+		}
+		if err := r.section(archiveSectionFor(rs.key), rs, items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func archiveSectionFor(key string) archiveSection {
+	for _, s := range archiveSections {
+		if s.key == key {
+			return s
+		}
+	}
+	panic("no archive section " + key)
+}
+
+// archiveRefPatch is a ref to a record later in the same section, set once
+// that record exists.
+type archiveRefPatch struct {
+	record *core.Record
+	field  string
+	id     string
+}
+
+// section restores one section's items.
+func (r *archiveRestorer) section(s archiveSection, rs archiveRestore, items []map[string]any) error {
+	coll, err := r.app.FindCollectionByNameOrId(s.collection)
+	if err != nil {
+		return err
+	}
+
+	counts := archiveCounts{}
+	var patches []archiveRefPatch
+	for _, item := range items {
+		values, later, ok := r.resolve(s, item)
+		if !ok || !r.allowed(rs, values) {
+			counts.Skipped++
+			continue
+		}
+		if rs.owner != "" {
+			values[rs.owner] = r.user.Id
+		}
+
+		existing, err := r.find(s.collection, rs, values)
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			r.remember(item, existing.Id)
+			counts.Skipped++
+			continue
+		}
+
+		rec := core.NewRecord(coll)
+		for field, v := range values {
+			rec.Set(field, v)
+		}
+		if err := r.app.Save(rec); err != nil {
+			return fmt.Errorf("restore %s: %w", rs.key, err)
+		}
+		r.remember(item, rec.Id)
+		for field, id := range later {
+			patches = append(patches, archiveRefPatch{rec, field, id})
+		}
+		counts.Restored++
+	}
+
+	for _, p := range patches {
+		if id, ok := r.ids[p.id]; ok {
+			p.record.Set(p.field, id)
+			if err := r.app.Save(p.record); err != nil {
+				return fmt.Errorf("restore %s: %w", rs.key, err)
+			}
+		}
+	}
+	r.counts[rs.key] = counts
+	return nil
+}
+
+// resolve turns an archive item into record values. ok is false when a
+// book or user it needs can't be found; later holds local refs to records
+// not restored yet.
+func (r *archiveRestorer) resolve(s archiveSection, item map[string]any) (values map[string]any, later map[string]string, ok bool) {
+	values = map[string]any{}
+	for _, f := range s.fields {
+		if v, ok := item[f]; ok {
+			values[f] = v
+		}
+	}
+	later = map[string]string{}
+	for field, kind := range s.refs {
+		ref, _ := item[field].(string)
+		if ref == "" {
+			continue
+		}
+		switch kind {
+		case "book":
+			id := r.book(ref)
+			if id == "" {
+				return nil, nil, false
+			}
+			values[field] = id
+		case "user":
+			id := r.userID(ref)
+			if id == "" {
+				return nil, nil, false
+			}
+			values[field] = id
+		case "local":
+			if id, ok := r.ids[ref]; ok {
+				values[field] = id
+			} else {
+				later[field] = ref
+			}
+		}
+	}
+	return values, later, true
+}
+
+// allowed applies the rules a section's records are normally created
+// under.
+func (r *archiveRestorer) allowed(rs archiveRestore, values map[string]any) bool {
+	switch rs.key {
+	case "label_values", "book_labels":
+		// Values need their key, which may have been skipped.
+		if values["tag_key"] == nil || (rs.key == "book_labels" && values["tag_value"] == nil) {
+			return false
+		}
+		if rs.key == "label_values" {
+			return true
+		}
+		// A book has one value of a select_one key, such as its status.
+		key, err := r.app.FindRecordById("tag_keys", values["tag_key"].(string))
+		if err != nil {
+			return false
+		}
+		if key.GetString("mode") == "select_one" {
+			existing, _ := r.app.FindRecordsByFilter("book_tag_values",
+				"user = {:user} && book = {:book} && tag_key = {:key}", "", 1, 0,
+				map[string]any{"user": r.user.Id, "book": values["book"], "key": key.Id},
+			)
+			return len(existing) == 0
+		}
+	case "shelf_items":
+		return values["collection"] != nil
+	case "following":
+		followee, _ := values["followee"].(string)
+		if followee == "" || followee == r.user.Id || isBlockedEitherDirection(r.app, r.user.Id, followee) {
+			return false
+		}
+		// Follows of private accounts go back to being requests.
+		values["status"] = "active"
+		if target, err := r.app.FindRecordById("users", followee); err == nil && target.GetBool("is_private") {
+			values["status"] = "pending"
+		}
+	}
+	return true
+}
+
+// find returns the record the account already has for values, if any.
+func (r *archiveRestorer) find(collection string, rs archiveRestore, values map[string]any) (*core.Record, error) {
+	var conds []string
+	params := map[string]any{}
+	fields := rs.unique
+	if rs.owner != "" {
+		fields = append([]string{rs.owner}, fields...)
+	}
+	for _, f := range fields {
+		// Filters only match unset fields against a literal ''.
+		v, ok := values[f]
+		if !ok || v == "" {
+			conds = append(conds, f+" = ''")
+			continue
+		}
+		conds = append(conds, fmt.Sprintf("%s = {:%s}", f, f))
+		params[f] = v
+	}
+	existing, err := r.app.FindRecordsByFilter(collection, strings.Join(conds, " && "), "", 1, 0, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) == 0 {
+		return nil, nil
+	}
+	return existing[0], nil
+}
+
+// remember maps an item's archive id to the record now standing for it.
+func (r *archiveRestorer) remember(item map[string]any, id string) {
+	if archiveID, _ := item["id"].(string); archiveID != "" {
+		r.ids[archiveID] = id
+	}
+}
+
+// book finds or creates a book from the archive's book list.
+func (r *archiveRestorer) book(olid string) string {
+	if id, ok := r.bookID[olid]; ok {
+		return id
+	}
+	b := r.books[olid]
+	str := func(k string) string { s, _ := b[k].(string); return s }
+	year, _ := b["publication_year"].(float64)
+
+	var id string
+	if rec, err := upsertBook(r.app, olid, str("title"), str("cover_url"), str("isbn13"), str("authors"), int(year), ""); err == nil {
+		id = rec.Id
+	}
+	r.bookID[olid] = id
+	return id
+}
+
+// userID finds a user by username, noting usernames that don't exist here.
+func (r *archiveRestorer) userID(username string) string {
+	if id, ok := r.users[username]; ok {
+		return id
+	}
+	var id string
+	found, _ := r.app.FindRecordsByFilter("users", "username = {:username}", "", 1, 0,
+		map[string]any{"username": username})
+	if len(found) > 0 {
+		id = found[0].Id
+	} else {
+		r.missingUsers = append(r.missingUsers, username)
+	}
+	r.users[username] = id
+	return id
+}
+
+// restoreProfile fills in profile fields and images the account lacks, and
+// returns the fields it set.
+func (r *archiveRestorer) restoreProfile(archive map[string]json.RawMessage, files map[string]*zip.File) ([]string, error) {
+	var profile map[string]any
+	_ = json.Unmarshal(archive["profile"], &profile)
+
+	user, err := r.app.FindRecordById("users", r.user.Id)
+	if err != nil {
+		return nil, err
+	}
+	restored := []string{}
+	for _, f := range archiveRestoreProfile {
+		if v, _ := profile[f].(string); v != "" && user.GetString(f) == "" {
+			user.Set(f, v)
+			restored = append(restored, f)
+		}
+	}
+	for _, f := range []string{"avatar", "banner"} {
+		name, _ := profile[f].(string)
+		zf, ok := files[name]
+		if !ok || user.GetString(f) != "" {
+			continue
+		}
+		data, err := readArchiveFile(zf)
+		if err != nil {
+			continue
+		}
+		file, err := filesystem.NewFileFromBytes(data, f+path.Ext(name))
+		if err != nil {
+			continue
+		}
+		user.Set(f, file)
+		restored = append(restored, f)
+	}
+	if len(restored) == 0 {
+		return restored, nil
+	}
+	return restored, r.app.Save(user)
+}
+
+// RestoreArchive handles POST /me/import/rosslib
+// Accepts a multipart form with a file field holding an account archive (the
+// zip from GET /me/export/archive, or its archive.json) and merges it into
+// the user's account.
+func RestoreArchive(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		user := e.Auth
+		if user == nil {
+			return e.JSON(http.StatusUnauthorized, map[string]any{"error": "Authentication required"})
+		}
+
+		file, _, err := e.Request.FormFile("file")
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Archive file required"})
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, archiveRestoreMaxSize+1))
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid archive"})
+		}
+		if len(data) > archiveRestoreMaxSize {
+			return e.JSON(http.StatusRequestEntityTooLarge, map[string]any{"error": "Archive too large"})
+		}
+
+		archive, files, err := readArchive(data)
+		if errors.Is(err, errArchiveFormat) {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Not a rosslib archive"})
+		}
+		if errors.Is(err, errArchiveUnsupported) {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Unsupported archive version"})
+		}
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid archive"})
+		}
+
+		// All or nothing: a restore that fails partway leaves the account
+		// as it was.
+		var r *archiveRestorer
+		var profile []string
+		err = app.RunInTransaction(func(txApp core.App) error {
+			r = &archiveRestorer{
+				app:    txApp,
+				user:   user,
+				books:  map[string]map[string]any{},
+				bookID: map[string]string{},
+				ids:    map[string]string{},
+				users:  map[string]string{},
+				counts: map[string]archiveCounts{},
+			}
+			if err := r.restore(archive); err != nil {
+				return err
+			}
+			profile, err = r.restoreProfile(archive, files)
+			return err
+		})
+		if errors.Is(err, errArchiveInvalid) {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid archive"})
+		}
+		if err != nil {
+			log.Printf("[Restore] user %s: %v", user.Id, err)
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to restore archive"})
+		}
+
+		missing := r.missingUsers
+		if missing == nil {
+			missing = []string{}
+		}
+		return e.JSON(http.StatusOK, map[string]any{
+			"sections":      r.counts,
+			"profile":       profile,
+			"missing_users": missing,
+		})
+	}
+}
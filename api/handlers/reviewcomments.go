@@ -124,7 +124,7 @@ func AddReviewComment(app core.App) func(e *core.RequestEvent) error {
 
 		// Notify the review author (unless commenting on own review)
 		if user.Id != reviewUserID {
-			go notifyReviewComment(app, user, reviewUserID, workID, data.Body)
+			notifyReviewComment(app, user, reviewUserID, workID, data.Body)
 		}
 
 		return e.JSON(http.StatusOK, map[string]any{
@@ -164,12 +164,8 @@ func DeleteReviewComment(app core.App) func(e *core.RequestEvent) error {
 	}
 }
 
-// notifyReviewComment sends a review_comment notification to the review author.
+// notifyReviewComment queues a review_comment notification to the review author.
 func notifyReviewComment(app core.App, commenter *core.Record, reviewUserID, bookOLID, body string) {
-	if !ShouldNotify(app, reviewUserID, "review_comment") {
-		return
-	}
-
 	commenterName := commenter.GetString("display_name")
 	if commenterName == "" {
 		commenterName = commenter.GetString("username")
@@ -180,19 +176,14 @@ func notifyReviewComment(app core.App, commenter *core.Record, reviewUserID, boo
 		preview = preview[:120] + "..."
 	}
 
-	notifColl, err := app.FindCollectionByNameOrId("notifications")
-	if err != nil {
-		return
-	}
-	rec := core.NewRecord(notifColl)
-	rec.Set("user", reviewUserID)
-	rec.Set("notif_type", "review_comment")
-	rec.Set("title", fmt.Sprintf("%s commented on your review", commenterName))
-	rec.Set("body", preview)
-	rec.Set("metadata", map[string]any{
-		"book_ol_id":   bookOLID,
-		"commenter_id": commenter.Id,
+	sendNotification(app, notificationJob{
+		User:  reviewUserID,
+		Type:  "review_comment",
+		Title: fmt.Sprintf("%s commented on your review", commenterName),
+		Body:  preview,
+		Metadata: map[string]any{
+			"book_ol_id":   bookOLID,
+			"commenter_id": commenter.Id,
+		},
 	})
-	rec.Set("read", false)
-	_ = app.Save(rec)
 }
@@ -88,29 +88,16 @@ func ToggleReviewLike(app core.App) func(e *core.RequestEvent) error {
 		})
 
 		// Send notification to review author
-		go func() {
-			if !ShouldNotify(app, reviewUserID, "review_liked") {
-				return
-			}
-
-			likerUsername := user.GetString("username")
-			bookTitle := book.GetString("title")
-
-			notifColl, err := app.FindCollectionByNameOrId("notifications")
-			if err != nil {
-				return
-			}
-			notif := core.NewRecord(notifColl)
-			notif.Set("user", reviewUserID)
-			notif.Set("notif_type", "review_liked")
-			notif.Set("title", fmt.Sprintf("%s liked your review of %s", likerUsername, bookTitle))
-			notif.Set("metadata", map[string]any{
+		likerUsername := user.GetString("username")
+		sendNotification(app, notificationJob{
+			User:  reviewUserID,
+			Type:  "review_liked",
+			Title: fmt.Sprintf("%s liked your review of %s", likerUsername, book.GetString("title")),
+			Metadata: map[string]any{
 				"book_ol_id":     workID,
 				"liker_username": likerUsername,
-			})
-			notif.Set("read", false)
-			_ = app.Save(notif)
-		}()
+			},
+		})
 
 		return e.JSON(http.StatusOK, map[string]any{"liked": true})
 	}
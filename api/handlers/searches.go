@@ -28,6 +28,7 @@ func GetSavedSearches(app core.App) func(e *core.RequestEvent) error {
 				"id":         r.Id,
 				"name":       r.GetString("name"),
 				"query":      r.GetString("query"),
+				"target":     savedSearchTarget(r),
 				"filters":    r.Get("filters"),
 				"created_at": r.GetString("created"),
 			})
@@ -51,12 +52,28 @@ func CreateSavedSearch(app core.App) func(e *core.RequestEvent) error {
 		data := struct {
 			Name    string         `json:"name"`
 			Query   string         `json:"query"`
+			Target  string         `json:"target"`
 			Filters map[string]any `json:"filters"`
 		}{}
 		if err := e.BindBody(&data); err != nil || data.Name == "" || data.Query == "" {
 			return e.JSON(http.StatusBadRequest, map[string]any{"error": "name and query are required"})
 		}
 
+		switch data.Target {
+		case "":
+			data.Target = "books"
+		case "books":
+		case "all":
+			// A unified search may narrow its groups with filters.types.
+			if types, ok := data.Filters["types"].(string); ok {
+				if _, err := parseSearchTypes(types); err != nil {
+					return e.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+				}
+			}
+		default:
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "target must be books or all"})
+		}
+
 		if len(data.Name) > 100 {
 			return e.JSON(http.StatusBadRequest, map[string]any{"error": "name must be 100 characters or fewer"})
 		}
@@ -80,6 +97,7 @@ func CreateSavedSearch(app core.App) func(e *core.RequestEvent) error {
 		rec.Set("user", user.Id)
 		rec.Set("name", data.Name)
 		rec.Set("query", data.Query)
+		rec.Set("target", data.Target)
 		if data.Filters != nil {
 			rec.Set("filters", data.Filters)
 		}
@@ -91,6 +109,7 @@ func CreateSavedSearch(app core.App) func(e *core.RequestEvent) error {
 			"id":         rec.Id,
 			"name":       rec.GetString("name"),
 			"query":      rec.GetString("query"),
+			"target":     savedSearchTarget(rec),
 			"filters":    rec.Get("filters"),
 			"created_at": rec.GetString("created"),
 		})
@@ -121,3 +140,12 @@ func DeleteSavedSearch(app core.App) func(e *core.RequestEvent) error {
 		return e.JSON(http.StatusOK, map[string]any{"ok": true})
 	}
 }
+
+// savedSearchTarget returns which endpoint a saved search runs against:
+// "books" (GET /books/search) or "all" (GET /search).
+func savedSearchTarget(r *core.Record) string {
+	if t := r.GetString("target"); t != "" {
+		return t
+	}
+	return "books"
+}
@@ -393,3 +393,56 @@ func AddBookToSeries(app core.App) func(e *core.RequestEvent) error {
 		})
 	}
 }
+
+// ensureBookSeries links a book to the named series, creating the series if
+// needed. An existing link keeps its position; a position is only filled in
+// where there was none.
+func ensureBookSeries(app core.App, bookID, name string, position *int) error {
+	name = strings.TrimSpace(name)
+	if len(name) > 255 {
+		name = name[:255]
+	}
+
+	var seriesRec *core.Record
+	existing, _ := app.FindRecordsByFilter("series",
+		"name = {:name}", "", 1, 0,
+		map[string]any{"name": name},
+	)
+	if len(existing) > 0 {
+		seriesRec = existing[0]
+	} else {
+		coll, err := app.FindCollectionByNameOrId("series")
+		if err != nil {
+			return err
+		}
+		seriesRec = core.NewRecord(coll)
+		seriesRec.Set("name", name)
+		if err := app.Save(seriesRec); err != nil {
+			return err
+		}
+	}
+
+	links, _ := app.FindRecordsByFilter("book_series",
+		"book = {:book} && series = {:series}", "", 1, 0,
+		map[string]any{"book": bookID, "series": seriesRec.Id},
+	)
+	if len(links) > 0 {
+		if position == nil || links[0].GetInt("position") != 0 {
+			return nil
+		}
+		links[0].Set("position", *position)
+		return app.Save(links[0])
+	}
+
+	coll, err := app.FindCollectionByNameOrId("book_series")
+	if err != nil {
+		return err
+	}
+	bs := core.NewRecord(coll)
+	bs.Set("book", bookID)
+	bs.Set("series", seriesRec.Id)
+	if position != nil {
+		bs.Set("position", *position)
+	}
+	return app.Save(bs)
+}
@@ -308,11 +308,6 @@ func SetBookTag(app core.App) func(e *core.RequestEvent) error {
 			return e.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
 		}
 
-		// If this is the status tag, refresh book stats
-		if key.GetString("slug") == "status" {
-			refreshBookStats(app, book.Id)
-		}
-
 		return e.JSON(http.StatusOK, map[string]any{
 			"key_id":   keyID,
 			"value_id": data.ValueID,
@@ -531,6 +526,15 @@ func GetUserTagBooks(app core.App) func(e *core.RequestEvent) error {
 			books = []bookRow{}
 		}
 
+		if format := e.Request.URL.Query().Get("format"); format != "" {
+			ids := make([]string, len(books))
+			for i, b := range books {
+				ids[i] = b.BookID
+			}
+			name := username + "-" + strings.ReplaceAll(tagPath, "/", "-")
+			return writeCitations(app, e, format, name, targetUser.Id, ids)
+		}
+
 		return e.JSON(http.StatusOK, map[string]any{"books": books})
 	}
 }
@@ -615,6 +619,15 @@ func GetUserLabelBooks(app core.App) func(e *core.RequestEvent) error {
 			books = []bookRow{}
 		}
 
+		if format := e.Request.URL.Query().Get("format"); format != "" {
+			ids := make([]string, len(books))
+			for i, b := range books {
+				ids[i] = b.BookID
+			}
+			name := username + "-" + keySlug + "-" + strings.ReplaceAll(valuePath, "/", "-")
+			return writeCitations(app, e, format, name, targetUser.Id, ids)
+		}
+
 		return e.JSON(http.StatusOK, map[string]any{
 			"key_name":   key.GetString("name"),
 			"value_name": values[0].GetString("name"),
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/bookstats"
+	"github.com/tristansaldanha/rosslib/api/store"
+	"github.com/tristansaldanha/rosslib/api/tasks"
+)
+
+// Recurring work runs as scheduled tasks (see api/tasks), visible and
+// triggerable under /admin/tasks. Each schedule can be replaced with
+// TASK_<NAME>_SCHEDULE or from the admin endpoint.
+const (
+	taskBookStatsRepair     = "book_stats_repair"
+	taskWorkMetadataRefresh = "work_metadata_refresh"
+	taskOLCacheEviction     = "ol_cache_eviction"
+	taskPendingImportRetry  = "pending_import_retry"
+	taskNotificationCleanup = "notification_cleanup"
+	taskGhostSimulation     = "ghost_simulation"
+	taskNewPublications     = "new_publications"
+)
+
+const (
+	// pendingImportRetryBatch is how many pending imports one auto-retry
+	// run tries.
+	pendingImportRetryBatch = 200
+	// workMetadataRefreshBatch is how many stale works one refresh run
+	// fetches.
+	workMetadataRefreshBatch = 200
+	// defaultNotificationRetentionDays is how long read notifications are
+	// kept unless NOTIFICATION_RETENTION_DAYS says otherwise.
+	defaultNotificationRetentionDays = 90
+)
+
+// RegisterTasks registers the recurring tasks. Call before tasks.Start.
+func RegisterTasks() {
+	tasks.Register(tasks.Task{
+		Name:        taskBookStatsRepair,
+		Description: "Recompute book_stats from source rows and repair any drift",
+		Schedule:    "@daily",
+		RunOnStart:  true,
+		Run:         runBookStatsRepair,
+	})
+	tasks.Register(tasks.Task{
+		Name:        taskWorkMetadataRefresh,
+		Description: "Refresh missing or stale work metadata from the catalog",
+		Schedule:    "0 */6 * * *",
+		RunOnStart:  true,
+		Run:         runWorkMetadataRefresh,
+	})
+	tasks.Register(tasks.Task{
+		Name:        taskOLCacheEviction,
+		Description: "Evict expired Open Library cache entries and trim the cache to its size budget",
+		Schedule:    "@hourly",
+		Run:         runOLCacheEviction,
+	})
+	tasks.Register(tasks.Task{
+		Name:        taskPendingImportRetry,
+		Description: "Retry exact matching for unmatched pending imports and resolve the ones that now match",
+		Schedule:    "30 3 * * *",
+		Run:         runPendingImportRetry,
+	})
+	tasks.Register(tasks.Task{
+		Name:        taskNotificationCleanup,
+		Description: "Delete read notifications older than the retention period",
+		Schedule:    "0 4 * * *",
+		Run:         runNotificationCleanup,
+	})
+	tasks.Register(tasks.Task{
+		Name:        taskGhostSimulation,
+		Description: "Have ghost users rate and finish a few books",
+		Schedule:    tasks.Off,
+		Run:         runGhostSimulation,
+	})
+	tasks.Register(tasks.Task{
+		Name:        taskNewPublications,
+		Description: "Notify followers when a followed author has new works on Open Library",
+		Schedule:    "0 */6 * * *",
+		Run:         runNewPublications,
+	})
+}
+
+func runBookStatsRepair(app core.App) error {
+	report, err := bookstats.BackfillAll(app)
+	if err != nil {
+		return err
+	}
+	log.Printf("[BookStats] drift repair complete: %d books checked, %d rows created, %d repaired",
+		report.Books, report.Created, report.Repaired)
+	return tasks.SetResult(app, taskBookStatsRepair, report)
+}
+
+func runWorkMetadataRefresh(app core.App) error {
+	if n := refreshStaleWorks(app, workMetadataRefreshBatch); n > 0 {
+		log.Printf("[WorkMeta] refreshed %d works", n)
+	}
+	return nil
+}
+
+func runOLCacheEviction(app core.App) error {
+	if removed := newOLClient().cache.evictExpired(); removed > 0 {
+		log.Printf("[OL Cache] evicted %d entries", removed)
+	}
+	return nil
+}
+
+func runPendingImportRetry(app core.App) error {
+	tried, resolved, err := retryPendingImports(app, pendingImportRetryBatch)
+	if err != nil {
+		return err
+	}
+	if tried > 0 {
+		log.Printf("[PendingImports] retried %d, resolved %d", tried, resolved)
+	}
+	return nil
+}
+
+func runNotificationCleanup(app core.App) error {
+	days := envInt("NOTIFICATION_RETENTION_DAYS", defaultNotificationRetentionDays)
+	cutoff := store.FormatTime(time.Now().AddDate(0, 0, -days))
+	res, err := app.DB().NewQuery(`
+		DELETE FROM notifications WHERE read = TRUE AND created != '' AND created < {:cutoff}
+	`).Bind(map[string]any{"cutoff": cutoff}).Execute()
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("[Notifications] deleted %d read notifications older than %d days", n, days)
+	}
+	return nil
+}
+
+func runGhostSimulation(app core.App) error {
+	results, _, err := simulateGhosts(app)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Ghosts] simulated %d ghosts", len(results))
+	return nil
+}
+
+func runNewPublications(app core.App) error {
+	checked, notified, err := pollNewPublications(app)
+	if err != nil {
+		return err
+	}
+	log.Printf("[Publications] checked %d authors, sent %d notifications", checked, notified)
+	return nil
+}
+
+// ── Admin ──────────────────────────────────────────────────────
+
+// GetAdminTasks handles GET /admin/tasks
+// Lists every scheduled task with its schedule, next run and last run.
+func GetAdminTasks(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		items, err := tasks.List(app)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to list tasks"})
+		}
+		return e.JSON(http.StatusOK, items)
+	}
+}
+
+// RunAdminTask handles POST /admin/tasks/{name}/run
+// Starts a task now, in the background.
+func RunAdminTask(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		err := tasks.RunNow(app, e.Request.PathValue("name"))
+		if errors.Is(err, tasks.ErrNotFound) {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "Task not found"})
+		}
+		if errors.Is(err, tasks.ErrRunning) {
+			return e.JSON(http.StatusConflict, map[string]any{"error": "Task is already running"})
+		}
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to start task"})
+		}
+		return e.JSON(http.StatusAccepted, map[string]any{"started": true})
+	}
+}
+
+// UpdateAdminTask handles PUT /admin/tasks/{name}
+// Body: {"schedule": "<cron expression>"}. "off" disables the task and an
+// empty schedule falls back to the environment or the default.
+func UpdateAdminTask(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		var body struct {
+			Schedule string `json:"schedule"`
+		}
+		if err := e.BindBody(&body); err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Invalid request body"})
+		}
+
+		name := e.Request.PathValue("name")
+		err := tasks.SetSchedule(app, name, body.Schedule)
+		if errors.Is(err, tasks.ErrNotFound) {
+			return e.JSON(http.StatusNotFound, map[string]any{"error": "Task not found"})
+		}
+		if errors.Is(err, tasks.ErrInvalidSchedule) {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		}
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to update task"})
+		}
+
+		status, err := tasks.Get(app, name)
+		if err != nil {
+			return e.JSON(http.StatusInternalServerError, map[string]any{"error": "Failed to load task"})
+		}
+		return e.JSON(http.StatusOK, status)
+	}
+}
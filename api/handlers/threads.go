@@ -358,7 +358,7 @@ func AddComment(app core.App) func(e *core.RequestEvent) error {
 		}
 
 		// Fan out @mention notifications
-		go fanOutMentionNotifications(app, user, thread, rec.Id, data.Body)
+		notifyThreadMentions(app, user.Id, thread.Id, rec.Id, data.Body)
 
 		return e.JSON(http.StatusOK, map[string]any{
 			"id":   rec.Id,
@@ -671,7 +671,7 @@ func GetSimilarThreads(app core.App) func(e *core.RequestEvent) error {
 }
 
 // fanOutMentionNotifications scans a comment body for @username mentions and
-// creates a thread_mention notification for each valid, distinct, non-self user.
+// queues a thread_mention notification for each valid, distinct, non-self user.
 func fanOutMentionNotifications(app core.App, commenter *core.Record, thread *core.Record, commentID, body string) {
 	matches := mentionRegex.FindAllStringSubmatch(body, -1)
 	if len(matches) == 0 {
@@ -717,27 +717,16 @@ func fanOutMentionNotifications(app core.App, commenter *core.Record, thread *co
 		if err != nil || len(users) == 0 {
 			continue
 		}
-		mentioned := users[0]
-
-		if !ShouldNotify(app, mentioned.Id, "thread_mention") {
-			continue
-		}
-
-		notifColl, err := app.FindCollectionByNameOrId("notifications")
-		if err != nil {
-			continue
-		}
-		rec := core.NewRecord(notifColl)
-		rec.Set("user", mentioned.Id)
-		rec.Set("notif_type", "thread_mention")
-		rec.Set("title", fmt.Sprintf("%s mentioned you in a thread", commenterName))
-		rec.Set("body", preview)
-		rec.Set("metadata", map[string]any{
-			"thread_id":  thread.Id,
-			"comment_id": commentID,
-			"book_ol_id": bookOLID,
+		sendNotification(app, notificationJob{
+			User:  users[0].Id,
+			Type:  "thread_mention",
+			Title: fmt.Sprintf("%s mentioned you in a thread", commenterName),
+			Body:  preview,
+			Metadata: map[string]any{
+				"thread_id":  thread.Id,
+				"comment_id": commentID,
+				"book_ol_id": bookOLID,
+			},
 		})
-		rec.Set("read", false)
-		_ = app.Save(rec)
 	}
 }
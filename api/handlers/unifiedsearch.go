@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/search"
+)
+
+// searchScope is what a unified search group runs with.
+type searchScope struct {
+	q        string
+	viewerID string
+	spoilers bool
+	limit    int
+	offset   int
+}
+
+// searchGroup runs one typed search and returns its results and total.
+type searchGroup func(app core.App, s searchScope) ([]map[string]any, int)
+
+// searchTypes lists the result groups of GET /search in their default order.
+var searchTypes = []string{"books", "authors", "users", "lists", "threads", "reviews", "quotes"}
+
+var searchGroups = map[string]searchGroup{
+	"books":   searchBookGroup,
+	"authors": searchAuthorGroup,
+	"users":   searchUserGroup,
+	"lists":   searchListGroup,
+	"threads": searchThreadGroup,
+	"reviews": searchReviewGroup,
+	"quotes":  searchQuoteGroup,
+}
+
+// Visibility rules for owned content, in SQL over a users row aliased u.
+// searchNotBlockedSQL hides users blocked in either direction;
+// searchVisibleOwnerSQL adds the privacy rule of canViewProfile.
+const searchNotBlockedSQL = `NOT EXISTS (SELECT 1 FROM blocks bl
+	WHERE (bl.blocker = {:viewer} AND bl.blocked = u.id) OR (bl.blocker = u.id AND bl.blocked = {:viewer}))`
+
+const searchVisibleOwnerSQL = `(u.is_private = false OR u.id = {:viewer}
+	OR EXISTS (SELECT 1 FROM follows f WHERE f.follower = {:viewer} AND f.followee = u.id AND f.status = 'active'))
+	AND ` + searchNotBlockedSQL
+
+// parseSearchTypes validates a comma-separated types= value. Empty means
+// every type.
+func parseSearchTypes(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return searchTypes, nil
+	}
+	var types []string
+	seen := map[string]bool{}
+	for _, t := range strings.Split(raw, ",") {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		if _, ok := searchGroups[t]; !ok {
+			return nil, fmt.Errorf("unknown type: %s", t)
+		}
+		seen[t] = true
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// Search handles GET /search?q=...&types=books,users&limit=5&page=1&spoilers=true
+// Returns one ranked group per requested type.
+func Search(app core.App) func(e *core.RequestEvent) error {
+	return func(e *core.RequestEvent) error {
+		query := e.Request.URL.Query()
+		q := strings.TrimSpace(query.Get("q"))
+
+		types, err := parseSearchTypes(query.Get("types"))
+		if err != nil {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": err.Error()})
+		}
+		if q == "" {
+			return e.JSON(http.StatusOK, map[string]any{"query": "", "groups": []any{}})
+		}
+
+		limit, _ := strconv.Atoi(query.Get("limit"))
+		if limit <= 0 {
+			limit = 5
+		}
+		if limit > 50 {
+			limit = 50
+		}
+		page, _ := strconv.Atoi(query.Get("page"))
+		if page < 1 {
+			page = 1
+		}
+
+		s := searchScope{
+			q:        q,
+			spoilers: query.Get("spoilers") == "true",
+			limit:    limit,
+			offset:   (page - 1) * limit,
+		}
+		if e.Auth != nil {
+			s.viewerID = e.Auth.Id
+		}
+
+		groups := make([]map[string]any, 0, len(types))
+		for _, t := range types {
+			results, total := searchGroups[t](app, s)
+			if results == nil {
+				results = []map[string]any{}
+			}
+			groups = append(groups, map[string]any{
+				"type":    t,
+				"total":   total,
+				"results": results,
+			})
+		}
+
+		return e.JSON(http.StatusOK, map[string]any{
+			"query":  q,
+			"page":   page,
+			"groups": groups,
+		})
+	}
+}
+
+func searchBookGroup(app core.App, s searchScope) ([]map[string]any, int) {
+	ids, total, err := search.Books(app, s.q, s.limit, s.offset)
+	if err != nil {
+		log.Printf("[Search] books %q: %v", s.q, err)
+		return nil, 0
+	}
+	var results []map[string]any
+	for _, b := range findRecordsInOrder(app, "books", ids) {
+		results = append(results, map[string]any{
+			"key":          b.GetString("open_library_id"),
+			"title":        b.GetString("title"),
+			"subtitle":     nilIfEmpty(b.GetString("subtitle")),
+			"authors":      splitAuthors(b.GetString("authors")),
+			"cover_url":    nilIfEmpty(b.GetString("cover_url")),
+			"publish_year": b.GetInt("publication_year"),
+		})
+	}
+	return results, total
+}
+
+func searchAuthorGroup(app core.App, s searchScope) ([]map[string]any, int) {
+	// Author search isn't paginated; rank the first page's worth past the
+	// offset and slice.
+	ids, err := search.Authors(app, s.q, s.offset+s.limit)
+	if err != nil {
+		log.Printf("[Search] authors %q: %v", s.q, err)
+		return nil, 0
+	}
+	idsJSON, _ := json.Marshal(ids)
+
+	type authorRow struct {
+		ID        string `db:"id"`
+		Key       string `db:"ol_key"`
+		Name      string `db:"name"`
+		PhotoURL  string `db:"photo_url"`
+		BookCount int    `db:"book_count"`
+	}
+	var rows []authorRow
+	_ = app.DB().NewQuery(`
+		SELECT a.id, a.ol_key, a.name, a.photo_url,
+			   (SELECT COUNT(*) FROM book_authors ba WHERE ba.author = a.id) AS book_count
+		FROM json_each({:ids}) ranked
+		JOIN authors a ON a.id = ranked.value
+		ORDER BY ranked.key
+	`).Bind(map[string]any{"ids": string(idsJSON)}).All(&rows)
+
+	total := len(rows)
+	if s.offset >= len(rows) {
+		return nil, total
+	}
+	rows = rows[s.offset:]
+
+	var results []map[string]any
+	for _, a := range rows {
+		results = append(results, map[string]any{
+			"key":        authorRouteKey(a.ID, a.Key),
+			"name":       a.Name,
+			"photo_url":  authorPhotoURL(a.Key, a.PhotoURL),
+			"book_count": a.BookCount,
+		})
+	}
+	return results, total
+}
+
+func searchUserGroup(app core.App, s searchScope) ([]map[string]any, int) {
+	params := map[string]any{
+		"viewer": s.viewerID,
+		"q":      strings.ToLower(s.q),
+		"prefix": strings.ToLower(s.q) + "%",
+		"like":   "%" + s.q + "%",
+		"limit":  s.limit,
+		"offset": s.offset,
+	}
+	where := `(u.username LIKE {:like} OR u.display_name LIKE {:like}) AND ` + searchNotBlockedSQL
+
+	type userRow struct {
+		ID          string  `db:"id"`
+		Username    string  `db:"username"`
+		DisplayName *string `db:"display_name"`
+		Avatar      *string `db:"avatar"`
+	}
+	var rows []userRow
+	// Exact username, then username prefix, then display-name prefix, then
+	// anything containing the text; most-followed first within each.
+	err := app.DB().NewQuery(`
+		SELECT u.id, u.username, u.display_name, u.avatar
+		FROM users u
+		WHERE ` + where + `
+		ORDER BY
+			CASE
+				WHEN LOWER(u.username) = {:q} THEN 0
+				WHEN LOWER(u.username) LIKE {:prefix} THEN 1
+				WHEN LOWER(u.display_name) LIKE {:prefix} THEN 2
+				ELSE 3
+			END,
+			(SELECT COUNT(*) FROM follows f WHERE f.followee = u.id AND f.status = 'active') DESC,
+			u.username
+		LIMIT {:limit} OFFSET {:offset}
+	`).Bind(params).All(&rows)
+	if err != nil {
+		return nil, 0
+	}
+
+	var count struct {
+		N int `db:"n"`
+	}
+	_ = app.DB().NewQuery(`SELECT COUNT(*) AS n FROM users u WHERE ` + where).Bind(params).One(&count)
+
+	var results []map[string]any
+	for _, r := range rows {
+		var avatarURL *string
+		if r.Avatar != nil && *r.Avatar != "" {
+			url := fmt.Sprintf("/api/files/users/%s/%s", r.ID, *r.Avatar)
+			avatarURL = &url
+		}
+		results = append(results, map[string]any{
+			"user_id":      r.ID,
+			"username":     r.Username,
+			"display_name": r.DisplayName,
+			"avatar_url":   avatarURL,
+		})
+	}
+	return results, count.N
+}
+
+// searchDocs runs a document search with visibility rules over the owner
+// (joined as u) and returns the matching refs in rank order as JSON for a
+// json_each join.
+func searchDocs(app core.App, s searchScope, kind, join, where string) (string, int) {
+	refs, total, err := search.Docs(app, search.DocQuery{
+		Kind:     kind,
+		Text:     s.q,
+		Spoilers: s.spoilers,
+		Join:     "JOIN users u ON u.id = sd.owner " + join,
+		Where:    where,
+		Params:   map[string]any{"viewer": s.viewerID},
+		Limit:    s.limit,
+		Offset:   s.offset,
+	})
+	if err != nil {
+		log.Printf("[Search] %s %q: %v", kind, s.q, err)
+		return "[]", 0
+	}
+	refsJSON, _ := json.Marshal(refs)
+	return string(refsJSON), total
+}
+
+// searchExcerpt shortens text for a result, and withholds it for spoilers
+// unless the caller asked to see them.
+func searchExcerpt(text string, spoiler, showSpoilers bool) *string {
+	if spoiler && !showSpoilers {
+		return nil
+	}
+	text = strings.TrimSpace(text)
+	if r := []rune(text); len(r) > 200 {
+		text = strings.TrimSpace(string(r[:200])) + "…"
+	}
+	return &text
+}
+
+func searchListGroup(app core.App, s searchScope) ([]map[string]any, int) {
+	refs, total := searchDocs(app, s, search.KindList,
+		"JOIN collections c ON c.id = sd.ref",
+		"c.is_public = true AND "+searchVisibleOwnerSQL)
+
+	type listRow struct {
+		ID             string `db:"id"`
+		Name           string `db:"name"`
+		Slug           string `db:"slug"`
+		Description    string `db:"description"`
+		CollectionType string `db:"collection_type"`
+		Username       string `db:"username"`
+		ItemCount      int    `db:"item_count"`
+	}
+	var rows []listRow
+	_ = app.DB().NewQuery(`
+		SELECT c.id, c.name, c.slug, COALESCE(c.description, '') AS description,
+			   COALESCE(c.collection_type, '') AS collection_type, u.username,
+			   (SELECT COUNT(*) FROM collection_items ci WHERE ci.collection = c.id) AS item_count
+		FROM json_each({:refs}) ranked
+		JOIN collections c ON c.id = ranked.value
+		JOIN users u ON u.id = c.user
+		ORDER BY ranked.key
+	`).Bind(map[string]any{"refs": refs}).All(&rows)
+
+	var results []map[string]any
+	for _, r := range rows {
+		results = append(results, map[string]any{
+			"id":              r.ID,
+			"name":            r.Name,
+			"slug":            r.Slug,
+			"description":     nilIfEmpty(r.Description),
+			"collection_type": r.CollectionType,
+			"username":        r.Username,
+			"item_count":      r.ItemCount,
+		})
+	}
+	return results, total
+}
+
+func searchThreadGroup(app core.App, s searchScope) ([]map[string]any, int) {
+	// Threads are public book discussion, listed regardless of the
+	// author's privacy (as on book pages); only blocks hide them.
+	refs, total := searchDocs(app, s, search.KindThread, "", searchNotBlockedSQL)
+
+	type threadRow struct {
+		ID           string `db:"id"`
+		Title        string `db:"title"`
+		Body         string `db:"body"`
+		Spoiler      bool   `db:"spoiler"`
+		BookKey      string `db:"book_key"`
+		BookTitle    string `db:"book_title"`
+		Username     string `db:"username"`
+		CommentCount int    `db:"comment_count"`
+	}
+	var rows []threadRow
+	_ = app.DB().NewQuery(`
+		SELECT t.id, t.title, t.body, t.spoiler, b.open_library_id AS book_key, b.title AS book_title,
+			   u.username,
+			   (SELECT COUNT(*) FROM thread_comments tc
+			    WHERE tc.thread = t.id AND (tc.deleted_at IS NULL OR tc.deleted_at = '')) AS comment_count
+		FROM json_each({:refs}) ranked
+		JOIN threads t ON t.id = ranked.value
+		JOIN books b ON b.id = t.book
+		JOIN users u ON u.id = t.user
+		ORDER BY ranked.key
+	`).Bind(map[string]any{"refs": refs}).All(&rows)
+
+	var results []map[string]any
+	for _, r := range rows {
+		results = append(results, map[string]any{
+			"id":            r.ID,
+			"title":         r.Title,
+			"excerpt":       searchExcerpt(r.Body, r.Spoiler, s.spoilers),
+			"spoiler":       r.Spoiler,
+			"book_key":      r.BookKey,
+			"book_title":    r.BookTitle,
+			"username":      r.Username,
+			"comment_count": r.CommentCount,
+		})
+	}
+	return results, total
+}
+
+func searchReviewGroup(app core.App, s searchScope) ([]map[string]any, int) {
+	refs, total := searchDocs(app, s, search.KindReview, "", searchVisibleOwnerSQL)
+
+	type reviewRow struct {
+		ID         string   `db:"id"`
+		ReviewText string   `db:"review_text"`
+		Spoiler    bool     `db:"spoiler"`
+		Rating     *float64 `db:"rating"`
+		BookKey    string   `db:"book_key"`
+		BookTitle  string   `db:"book_title"`
+		Username   string   `db:"username"`
+		DateAdded  string   `db:"date_added"`
+	}
+	var rows []reviewRow
+	_ = app.DB().NewQuery(`
+		SELECT ub.id, ub.review_text, ub.spoiler, ub.rating,
+			   b.open_library_id AS book_key, b.title AS book_title, u.username, ub.date_added
+		FROM json_each({:refs}) ranked
+		JOIN user_books ub ON ub.id = ranked.value
+		JOIN books b ON b.id = ub.book
+		JOIN users u ON u.id = ub.user
+		ORDER BY ranked.key
+	`).Bind(map[string]any{"refs": refs}).All(&rows)
+
+	var results []map[string]any
+	for _, r := range rows {
+		results = append(results, map[string]any{
+			"user_book_id": r.ID,
+			"excerpt":      searchExcerpt(r.ReviewText, r.Spoiler, s.spoilers),
+			"spoiler":      r.Spoiler,
+			"rating":       r.Rating,
+			"book_key":     r.BookKey,
+			"book_title":   r.BookTitle,
+			"username":     r.Username,
+			"date_added":   r.DateAdded,
+		})
+	}
+	return results, total
+}
+
+func searchQuoteGroup(app core.App, s searchScope) ([]map[string]any, int) {
+	refs, total := searchDocs(app, s, search.KindQuote,
+		"JOIN book_quotes bq ON bq.id = sd.ref",
+		"bq.is_public = true AND "+searchVisibleOwnerSQL)
+
+	type quoteRow struct {
+		ID         string  `db:"id"`
+		Text       string  `db:"text"`
+		PageNumber *int    `db:"page_number"`
+		Note       *string `db:"note"`
+		BookKey    string  `db:"book_key"`
+		BookTitle  string  `db:"book_title"`
+		Username   string  `db:"username"`
+	}
+	var rows []quoteRow
+	_ = app.DB().NewQuery(`
+		SELECT q.id, q.text, q.page_number, q.note,
+			   b.open_library_id AS book_key, b.title AS book_title, u.username
+		FROM json_each({:refs}) ranked
+		JOIN book_quotes q ON q.id = ranked.value
+		JOIN books b ON b.id = q.book
+		JOIN users u ON u.id = q.user
+		ORDER BY ranked.key
+	`).Bind(map[string]any{"refs": refs}).All(&rows)
+
+	var results []map[string]any
+	for _, r := range rows {
+		results = append(results, map[string]any{
+			"id":          r.ID,
+			"text":        r.Text,
+			"page_number": r.PageNumber,
+			"note":        r.Note,
+			"book_key":    r.BookKey,
+			"book_title":  r.BookTitle,
+			"username":    r.Username,
+		})
+	}
+	return results, total
+}
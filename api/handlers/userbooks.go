@@ -1,13 +1,16 @@
 package handlers
 
 import (
-	"fmt"
+	"encoding/json"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/search"
 )
 
 // AddBook handles POST /me/books
@@ -82,7 +85,6 @@ func AddBook(app core.App) func(e *core.RequestEvent) error {
 		}
 
 		recordActivity(app, user.Id, "shelved", map[string]any{"book": book.Id})
-		refreshBookStats(app, book.Id)
 
 		return e.JSON(http.StatusOK, map[string]any{
 			"book_id":         book.Id,
@@ -210,8 +212,6 @@ func UpdateBook(app core.App) func(e *core.RequestEvent) error {
 			setStatusTag(app, user.Id, book.Id, *data.StatusSlug)
 		}
 
-		refreshBookStats(app, book.Id)
-
 		return e.JSON(http.StatusOK, map[string]any{"message": "Book updated"})
 	}
 }
@@ -346,8 +346,6 @@ func DeleteBook(app core.App) func(e *core.RequestEvent) error {
 			}
 		}
 
-		refreshBookStats(app, book.Id)
-
 		return e.JSON(http.StatusOK, map[string]any{"message": "Book removed"})
 	}
 }
@@ -550,6 +548,15 @@ func GetUserBooks(app core.App) func(e *core.RequestEvent) error {
 			return e.JSON(http.StatusForbidden, map[string]any{"error": "Profile is private"})
 		}
 
+		// With a citation format, export the whole library.
+		if format := e.Request.URL.Query().Get("format"); format != "" {
+			var ids []string
+			_ = app.DB().NewQuery(`
+				SELECT book FROM user_books WHERE user = {:user} ORDER BY date_added DESC
+			`).Bind(map[string]any{"user": targetUser.Id}).Column(&ids)
+			return writeCitations(app, e, format, username+"-library", targetUser.Id, ids)
+		}
+
 		statusFilter := e.Request.URL.Query().Get("status")
 		limit, _ := strconv.Atoi(e.Request.URL.Query().Get("limit"))
 		if limit <= 0 {
@@ -772,7 +779,11 @@ func SearchUserBooks(app core.App) func(e *core.RequestEvent) error {
 			limit = 50
 		}
 
-		likePattern := "%" + q + "%"
+		ids, err := search.UserBooks(app, targetUser.Id, q, limit)
+		if err != nil {
+			log.Printf("[Search] user books %q: %v", q, err)
+		}
+		idsJSON, _ := json.Marshal(ids)
 
 		type bookRow struct {
 			BookID   string   `db:"book_id" json:"book_id"`
@@ -784,20 +795,18 @@ func SearchUserBooks(app core.App) func(e *core.RequestEvent) error {
 			AddedAt  string   `db:"added_at" json:"added_at"`
 		}
 		var books []bookRow
+		// json_each keeps the search ranking order.
 		err = app.DB().NewQuery(`
 			SELECT b.id as book_id, b.open_library_id, b.title,
 				   COALESCE(NULLIF(ub.selected_edition_cover_url, ''), b.cover_url) as cover_url,
 				   b.authors, ub.rating, ub.date_added as added_at
-			FROM user_books ub
-			JOIN books b ON ub.book = b.id
-			WHERE ub.user = {:user}
-			AND (b.title LIKE {:q} OR b.authors LIKE {:q})
-			ORDER BY ub.date_added DESC
-			LIMIT {:limit}
+			FROM json_each({:ids}) ranked
+			JOIN books b ON b.id = ranked.value
+			JOIN user_books ub ON ub.book = b.id AND ub.user = {:user}
+			ORDER BY ranked.key
 		`).Bind(map[string]any{
-			"user":  targetUser.Id,
-			"q":     likePattern,
-			"limit": limit,
+			"user": targetUser.Id,
+			"ids":  string(idsJSON),
 		}).All(&books)
 		if err != nil || books == nil {
 			books = []bookRow{}
@@ -916,9 +925,8 @@ func GetMyBookEditions(app core.App) func(e *core.RequestEvent) error {
 			}
 		}
 
-		// Fetch editions from Open Library
-		ol := newOLClient()
-		data, err := ol.get(fmt.Sprintf("/works/%s/editions.json?limit=%d&offset=%d", olID, limit, offset))
+		// Fetch editions from the catalog
+		data, err := newCatalog().editions(olID, limit, offset)
 		if err != nil {
 			data = map[string]any{"entries": []any{}}
 		}
@@ -25,6 +25,7 @@ func DeleteAccount(app core.App) func(e *core.RequestEvent) error {
 			"collection_items",
 			"genre_ratings",
 			"saved_searches",
+			"progress_events",
 			"reading_sessions",
 			"book_quotes",
 			"reading_goals",
@@ -35,6 +36,8 @@ func DeleteAccount(app core.App) func(e *core.RequestEvent) error {
 			"notification_preferences",
 			"user_books",
 			"pending_imports",
+			"import_batches", // their import_changes go with them
+			"export_jobs",    // deleting a job removes its archive file
 			"notifications",
 			"author_follows",
 			"book_follows",
@@ -119,6 +122,7 @@ func DeleteAllData(app core.App) func(e *core.RequestEvent) error {
 			"collection_items",
 			"genre_ratings",
 			"saved_searches",
+			"progress_events",
 			"reading_sessions",
 			"book_quotes",
 			"reading_goals",
@@ -129,6 +133,8 @@ func DeleteAllData(app core.App) func(e *core.RequestEvent) error {
 			"notification_preferences",
 			"user_books",
 			"pending_imports",
+			"import_batches", // their import_changes go with them
+			"export_jobs",    // deleting a job removes its archive file
 			"notifications",
 			"author_follows",
 			"book_follows",
@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/progress"
 )
 
 // SearchUsers handles GET /users?q=...&sort=newest|books|followers
@@ -548,14 +550,31 @@ func GetUserStats(app core.App) func(e *core.RequestEvent) error {
 			totalPagesRead = *totalPages.Total
 		}
 
+		// Reading streaks, this week's pages and a year of daily activity,
+		// from progress history
+		loc, ok := requestLocation(e)
+		if !ok {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Unknown time zone"})
+		}
+		streak, _ := progress.Streaks(app, uid, loc)
+		yearRange, _ := progress.NewRange("", "", 365, loc)
+		days, _ := progress.Daily(app, uid, "", yearRange)
+		pagesThisWeek := 0
+		if len(days) >= 7 {
+			pagesThisWeek, _ = progress.Totals(days[len(days)-7:])
+		}
+
 		return e.JSON(http.StatusOK, map[string]any{
-			"books_by_year":       booksByYear,
-			"books_by_month":      booksByMonth,
-			"average_rating":      avgRating.Avg,
-			"rating_distribution": ratingDistribution,
-			"total_books":         totalBooks.Count,
-			"total_reviews":       totalReviews.Count,
-			"total_pages_read":    totalPagesRead,
+			"books_by_year":        booksByYear,
+			"books_by_month":       booksByMonth,
+			"average_rating":       avgRating.Avg,
+			"rating_distribution":  ratingDistribution,
+			"total_books":          totalBooks.Count,
+			"total_reviews":        totalReviews.Count,
+			"total_pages_read":     totalPagesRead,
+			"reading_streak":       streak,
+			"pages_read_this_week": pagesThisWeek,
+			"heatmap":              progress.Heatmap(days),
 		})
 	}
 }
@@ -1120,21 +1139,10 @@ func GetUserFollowedAuthors(app core.App) func(e *core.RequestEvent) error {
 			return e.JSON(http.StatusForbidden, map[string]any{"error": "Profile is private"})
 		}
 
-		records, err := app.FindRecordsByFilter("author_follows",
-			"user = {:user}", "-created", 50, 0,
-			map[string]any{"user": user.Id},
-		)
+		results, err := followedAuthors(app, user.Id, 50, 0)
 		if err != nil {
 			return e.JSON(http.StatusOK, []any{})
 		}
-
-		results := make([]map[string]any, len(records))
-		for i, r := range records {
-			results[i] = map[string]any{
-				"author_key":  r.GetString("author_key"),
-				"author_name": r.GetString("author_name"),
-			}
-		}
 		return e.JSON(http.StatusOK, results)
 	}
 }
@@ -0,0 +1,352 @@
+package handlers
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/isbn"
+	"github.com/tristansaldanha/rosslib/api/store"
+)
+
+// workMetadataTTL is how long locally stored work metadata is served before a
+// background refresh is scheduled.
+const workMetadataTTL = 30 * 24 * time.Hour
+
+// bookFields is the set of catalog-sourced columns on a books record.
+// Zero values mean "unknown" and never overwrite stored data.
+type bookFields struct {
+	Title         string
+	Subtitle      string
+	CoverURL      string
+	ISBN13        string
+	Authors       string
+	PubYear       int
+	Subjects      string
+	Description   string
+	FirstSentence string
+	CoverIDs      []int
+	Links         []CatalogLink
+	Excerpts      []CatalogExcerpt
+	AuthorKeys    []string
+	EditionCount  int
+	// ISBNs are additional ISBN-13s (other editions) the book should
+	// resolve from; they are recorded in book_isbns, never overwritten.
+	ISBNs []string
+	// FetchedAt marks the fields as a full catalog snapshot; set only by
+	// refreshWorkMetadata.
+	FetchedAt time.Time
+}
+
+// upsertBookFields finds or creates a book record by open_library_id. With
+// overwrite false, existing records only have empty fields filled in. With
+// overwrite true, every non-empty value in f replaces what is stored, which
+// is how stale catalog data gets corrected.
+func upsertBookFields(app core.App, olID string, f bookFields, overwrite bool) (*core.Record, error) {
+	var rec *core.Record
+	existing, err := app.FindRecordsByFilter("books",
+		"open_library_id = {:id}",
+		"", 1, 0,
+		map[string]any{"id": olID},
+	)
+	if err == nil && len(existing) > 0 {
+		rec = existing[0]
+	} else if target := resolveBookRedirect(app, olID); target != nil {
+		// The work was merged into another book; only fill gaps on the
+		// survivor rather than resurrecting the duplicate.
+		rec = target
+		overwrite = false
+		f.FetchedAt = time.Time{}
+	} else {
+		booksColl, err := app.FindCollectionByNameOrId("books")
+		if err != nil {
+			return nil, err
+		}
+		rec = core.NewRecord(booksColl)
+		rec.Set("open_library_id", olID)
+		overwrite = true
+	}
+
+	changed := rec.IsNew()
+	setString := func(field, v string) {
+		if v == "" || v == rec.GetString(field) {
+			return
+		}
+		if overwrite || rec.GetString(field) == "" {
+			rec.Set(field, v)
+			changed = true
+		}
+	}
+	setInt := func(field string, v int) {
+		if v == 0 || v == rec.GetInt(field) {
+			return
+		}
+		if overwrite || rec.GetInt(field) == 0 {
+			rec.Set(field, v)
+			changed = true
+		}
+	}
+	setJSON := func(field string, n int, v any) {
+		if n == 0 {
+			return
+		}
+		if overwrite || isEmptyJSON(rec.GetString(field)) {
+			rec.Set(field, v)
+			changed = true
+		}
+	}
+
+	setString("title", f.Title)
+	setString("subtitle", f.Subtitle)
+	setString("cover_url", f.CoverURL)
+	setString("isbn13", isbn.Normalize(f.ISBN13))
+	authorsBefore := rec.GetString("authors") + rec.GetString("author_keys")
+	setString("authors", f.Authors)
+	setInt("publication_year", f.PubYear)
+	setString("subjects", f.Subjects)
+	setString("description", f.Description)
+	setString("first_sentence", f.FirstSentence)
+	setJSON("cover_ids", len(f.CoverIDs), f.CoverIDs)
+	setJSON("links", len(f.Links), f.Links)
+	setJSON("excerpts", len(f.Excerpts), f.Excerpts)
+	setJSON("author_keys", len(f.AuthorKeys), f.AuthorKeys)
+	setInt("edition_count", f.EditionCount)
+	if !f.FetchedAt.IsZero() {
+		rec.Set("metadata_fetched_at", store.FormatTime(f.FetchedAt))
+		changed = true
+	}
+
+	if changed {
+		if err := app.Save(rec); err != nil {
+			return nil, err
+		}
+	}
+	if rec.GetString("authors")+rec.GetString("author_keys") != authorsBefore {
+		if err := syncBookAuthors(app, rec); err != nil {
+			log.Printf("[Authors] sync for %s failed: %v", olID, err)
+		}
+	}
+	addBookISBNs(app, rec, append([]string{f.ISBN13}, f.ISBNs...))
+	return rec, nil
+}
+
+// addBookISBNs records ISBNs in book_isbns so any of them resolves to the
+// book locally. Invalid ISBNs are skipped, as are ones another book already
+// holds (the first book to claim an ISBN keeps it).
+func addBookISBNs(app core.App, book *core.Record, candidates []string) {
+	type row struct {
+		ISBN13 string `db:"isbn13"`
+	}
+	var rows []row
+	_ = app.DB().NewQuery(`SELECT isbn13 FROM book_isbns WHERE book = {:book}`).
+		Bind(map[string]any{"book": book.Id}).All(&rows)
+	have := make(map[string]bool, len(rows))
+	for _, r := range rows {
+		have[r.ISBN13] = true
+	}
+
+	var coll *core.Collection
+	for _, c := range candidates {
+		isbn13 := isbn.Normalize(c)
+		if isbn13 == "" || have[isbn13] {
+			continue
+		}
+		have[isbn13] = true
+		if _, err := app.FindFirstRecordByData("book_isbns", "isbn13", isbn13); err == nil {
+			continue
+		}
+		if coll == nil {
+			var err error
+			if coll, err = app.FindCollectionByNameOrId("book_isbns"); err != nil {
+				return
+			}
+		}
+		rec := core.NewRecord(coll)
+		rec.Set("book", book.Id)
+		rec.Set("isbn13", isbn13)
+		if err := app.Save(rec); err != nil {
+			log.Printf("[ISBN] failed to record %s for %s: %v", isbn13, book.GetString("open_library_id"), err)
+		}
+	}
+}
+
+// fetchWorkFields pulls a full metadata snapshot for a work from the catalog.
+// Author names and keys are kept index-aligned.
+func fetchWorkFields(catalog *catalogChain, workID string) (bookFields, []string, error) {
+	work, err := catalog.work(workID)
+	if err != nil {
+		return bookFields{}, nil, err
+	}
+
+	f := bookFields{
+		Title:         work.Title,
+		Subtitle:      work.Subtitle,
+		CoverURL:      work.CoverURL,
+		PubYear:       work.FirstPublishYear,
+		Subjects:      strings.Join(work.Subjects, ", "),
+		Description:   work.Description,
+		FirstSentence: work.FirstSentence,
+		CoverIDs:      work.CoverIDs,
+		Links:         work.Links,
+		Excerpts:      work.Excerpts,
+		FetchedAt:     time.Now(),
+	}
+
+	var names []string
+	for _, key := range work.AuthorKeys {
+		if a, err := catalog.author(key); err == nil && a.Name != "" {
+			names = append(names, a.Name)
+			f.AuthorKeys = append(f.AuthorKeys, key)
+		}
+	}
+	f.Authors = strings.Join(names, ", ")
+
+	if editions, err := catalog.editions(workID, 100, 0); err == nil {
+		if size, ok := editions["size"].(float64); ok {
+			f.EditionCount = int(size)
+		}
+		f.ISBNs = editionISBNs(editions)
+	}
+	return f, work.Subjects, nil
+}
+
+// refreshWorkMetadata fetches a work from the catalog and overwrites the
+// local books record with it, creating the record if needed. Series links are
+// populated from edition data on the way.
+func refreshWorkMetadata(app core.App, workID string) (*core.Record, error) {
+	catalog := newCatalog()
+	f, subjects, err := fetchWorkFields(catalog, workID)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := upsertBookFields(app, workID, f, true)
+	if err != nil {
+		return nil, err
+	}
+	populateSeriesFromOL(app, catalog, rec, workID, subjects)
+	return rec, nil
+}
+
+// workRefreshing dedupes background refreshes triggered by page views.
+var workRefreshing sync.Map
+
+// loadWorkMetadata returns the local record for a work, following merge
+// redirects. Books that have never been fetched are fetched synchronously;
+// stale ones are returned as-is and refreshed in the background. Returns nil
+// when the work is unknown locally and the catalog is unreachable.
+func loadWorkMetadata(app core.App, workID string) *core.Record {
+	var rec *core.Record
+	local, _ := app.FindRecordsByFilter("books",
+		"open_library_id = {:id}", "", 1, 0,
+		map[string]any{"id": workID},
+	)
+	if len(local) > 0 {
+		rec = local[0]
+	} else if target := resolveBookRedirect(app, workID); target != nil {
+		return target
+	}
+
+	fetchedAt := time.Time{}
+	if rec != nil {
+		fetchedAt = rec.GetDateTime("metadata_fetched_at").Time()
+	}
+
+	if fetchedAt.IsZero() {
+		if fresh, err := refreshWorkMetadata(app, workID); err == nil {
+			return fresh
+		}
+		return rec
+	}
+
+	if time.Since(fetchedAt) > workMetadataTTL {
+		if _, inFlight := workRefreshing.LoadOrStore(workID, struct{}{}); !inFlight {
+			go func() {
+				defer workRefreshing.Delete(workID)
+				if _, err := refreshWorkMetadata(app, workID); err != nil {
+					log.Printf("[WorkMeta] refresh %s failed: %v", workID, err)
+				}
+			}()
+		}
+	}
+	return rec
+}
+
+// refreshStaleWorks refreshes up to limit books whose metadata is missing or
+// older than workMetadataTTL. Returns the number refreshed. Ties are broken
+// randomly so works the catalog can't resolve don't block the queue.
+func refreshStaleWorks(app core.App, limit int) int {
+	type row struct {
+		OLID string `db:"open_library_id"`
+	}
+	var rows []row
+	cutoff := store.FormatTime(time.Now().Add(-workMetadataTTL))
+	err := app.DB().NewQuery(`
+		SELECT open_library_id FROM books
+		WHERE open_library_id != ''
+		  AND (metadata_fetched_at = '' OR metadata_fetched_at IS NULL OR metadata_fetched_at < {:cutoff})
+		ORDER BY metadata_fetched_at ASC, RANDOM()
+		LIMIT {:limit}
+	`).Bind(map[string]any{"cutoff": cutoff, "limit": limit}).All(&rows)
+	if err != nil {
+		log.Printf("[WorkMeta] query failed: %v", err)
+		return 0
+	}
+
+	refreshed := 0
+	for _, r := range rows {
+		if _, err := refreshWorkMetadata(app, r.OLID); err != nil {
+			continue
+		}
+		refreshed++
+	}
+	return refreshed
+}
+
+// bookISBNList returns every ISBN-13 a book holds, its primary isbn13 first.
+func bookISBNList(app core.App, book *core.Record) []string {
+	type row struct {
+		ISBN13 string `db:"isbn13"`
+	}
+	var rows []row
+	_ = app.DB().NewQuery(`
+		SELECT isbn13 FROM book_isbns WHERE book = {:book} ORDER BY isbn13 = {:primary} DESC, isbn13
+	`).Bind(map[string]any{"book": book.Id, "primary": book.GetString("isbn13")}).All(&rows)
+	out := make([]string, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, r.ISBN13)
+	}
+	return out
+}
+
+// editionISBNs collects the ISBN-10s and ISBN-13s listed on an OL editions
+// page.
+func editionISBNs(editions map[string]any) []string {
+	var out []string
+	entries, _ := editions["entries"].([]any)
+	for _, entry := range entries {
+		ed, ok := entry.(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, field := range []string{"isbn_13", "isbn_10"} {
+			list, _ := ed[field].([]any)
+			for _, v := range list {
+				if s, ok := v.(string); ok {
+					out = append(out, s)
+				}
+			}
+		}
+	}
+	return out
+}
+
+func isEmptyJSON(raw string) bool {
+	switch strings.TrimSpace(raw) {
+	case "", "null", "[]", "{}":
+		return true
+	}
+	return false
+}
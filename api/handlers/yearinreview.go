@@ -9,6 +9,8 @@ import (
 	"time"
 
 	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/progress"
 )
 
 // GetYearInReview handles GET /users/{username}/year-in-review?year=2025
@@ -242,6 +244,15 @@ func GetYearInReview(app core.App) func(e *core.RequestEvent) error {
 			availableYears = []int{}
 		}
 
+		// Reading days, longest streak, logged pages and a heatmap for the
+		// year, from progress history
+		loc, ok := requestLocation(e)
+		if !ok {
+			return e.JSON(http.StatusBadRequest, map[string]any{"error": "Unknown time zone"})
+		}
+		days, _ := progress.Daily(app, uid, "", progress.YearRange(year, loc))
+		pagesLogged, readingDays := progress.Totals(days)
+
 		result := map[string]any{
 			"year":             year,
 			"total_books":      totalBooks,
@@ -253,6 +264,10 @@ func GetYearInReview(app core.App) func(e *core.RequestEvent) error {
 			"top_genres":       genres,
 			"books_by_month":   byMonth,
 			"available_years":  availableYears,
+			"reading_days":     readingDays,
+			"longest_streak":   progress.LongestStreak(days),
+			"pages_logged":     pagesLogged,
+			"heatmap":          progress.Heatmap(days),
 		}
 
 		return e.JSON(http.StatusOK, result)
@@ -0,0 +1,196 @@
+// Package isbn parses, validates, converts and hyphenates ISBNs.
+//
+// Input is accepted in the shapes imports and scanners actually produce:
+// ISBN-10 or ISBN-13 with or without hyphens/spaces, an "ISBN" label,
+// Goodreads' spreadsheet-escaped `="9780..."`, LibraryThing's `[0441013597]`
+// and EAN-13 barcodes with a 2- or 5-digit price add-on. Everything is
+// normalized to ISBN-13, which is how ISBNs are stored.
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrEmpty    = errors.New("isbn: empty")
+	ErrSyntax   = errors.New("isbn: unexpected characters")
+	ErrLength   = errors.New("isbn: wrong number of digits")
+	ErrChecksum = errors.New("isbn: bad check digit")
+	ErrPrefix   = errors.New("isbn: not a 978/979 bookland EAN")
+)
+
+// ISBN is a validated ISBN held in its 13-digit form.
+type ISBN struct {
+	digits string
+}
+
+// Parse cleans and validates s. ISBN-10s are converted to ISBN-13.
+func Parse(s string) (ISBN, error) {
+	d, ok := clean(s)
+	switch {
+	case !ok:
+		return ISBN{}, ErrSyntax
+	case d == "":
+		return ISBN{}, ErrEmpty
+	case len(d) == 10:
+		if !Valid10(d) {
+			return ISBN{}, ErrChecksum
+		}
+		return ISBN{digits: to13(d)}, nil
+	case len(d) == 15 || len(d) == 18:
+		// EAN-13 followed by an EAN-2/EAN-5 add-on (price or issue code).
+		d = d[:13]
+		fallthrough
+	case len(d) == 13:
+		if !strings.HasPrefix(d, "978") && !strings.HasPrefix(d, "979") {
+			return ISBN{}, ErrPrefix
+		}
+		if !Valid13(d) {
+			return ISBN{}, ErrChecksum
+		}
+		return ISBN{digits: d}, nil
+	}
+	return ISBN{}, ErrLength
+}
+
+// Normalize returns the ISBN-13 form of s, or "" if s isn't a valid ISBN.
+func Normalize(s string) string {
+	i, err := Parse(s)
+	if err != nil {
+		return ""
+	}
+	return i.digits
+}
+
+// First returns the first valid ISBN-13 in a list of candidates separated by
+// commas, semicolons or whitespace, or "".
+func First(list string) string {
+	for _, c := range strings.FieldsFunc(list, func(r rune) bool {
+		return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\n'
+	}) {
+		if n := Normalize(c); n != "" {
+			return n
+		}
+	}
+	return ""
+}
+
+// ISBN13 returns the 13 digits with no separators.
+func (i ISBN) ISBN13() string { return i.digits }
+
+// ISBN10 returns the 10-character form. ISBNs with the 979 prefix have no
+// ISBN-10 and return false.
+func (i ISBN) ISBN10() (string, bool) {
+	if !strings.HasPrefix(i.digits, "978") {
+		return "", false
+	}
+	body := i.digits[3:12]
+	return body + string(check10(body)), true
+}
+
+// String returns the hyphenated ISBN-13.
+func (i ISBN) String() string { return i.Hyphenate() }
+
+// Valid13 reports whether s is 13 digits with a correct ISBN-13 check digit.
+func Valid13(s string) bool {
+	if len(s) != 13 || !allDigits(s) {
+		return false
+	}
+	return s[12] == check13(s[:12])
+}
+
+// Valid10 reports whether s is 9 digits plus a correct check character
+// (0-9 or X).
+func Valid10(s string) bool {
+	if len(s) != 10 || !allDigits(s[:9]) {
+		return false
+	}
+	return s[9] == check10(s[:9])
+}
+
+// To13 converts a valid ISBN-10 to ISBN-13, or returns "".
+func To13(isbn10 string) string {
+	d, _ := clean(isbn10)
+	if !Valid10(d) {
+		return ""
+	}
+	return to13(d)
+}
+
+// To10 converts a valid 978-prefixed ISBN-13 to ISBN-10, or returns "".
+func To10(isbn13 string) string {
+	i, err := Parse(isbn13)
+	if err != nil {
+		return ""
+	}
+	s, _ := i.ISBN10()
+	return s
+}
+
+func to13(isbn10 string) string {
+	body := "978" + isbn10[:9]
+	return body + string(check13(body))
+}
+
+func check13(first12 string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		n := int(first12[i] - '0')
+		if i%2 == 1 {
+			n *= 3
+		}
+		sum += n
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func check10(first9 string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(first9[i]-'0') * (10 - i)
+	}
+	c := (11 - sum%11) % 11
+	if c == 10 {
+		return 'X'
+	}
+	return byte('0' + c)
+}
+
+// clean strips labels, quoting and separators, keeping digits and a
+// trailing X. It reports false if anything else is left.
+func clean(s string) (string, bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimPrefix(s, "=")
+	s = strings.Trim(s, "\"'[] ")
+	for _, label := range []string{"ISBN-13", "ISBN-10", "ISBN13", "ISBN10", "ISBN", "EAN"} {
+		if strings.HasPrefix(s, label) {
+			s = strings.TrimLeft(s[len(label):], ": ")
+			break
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= '0' && c <= '9':
+			b.WriteByte(c)
+		case c == 'X' && b.Len() == 9:
+			b.WriteByte(c)
+		case c == '-' || c == ' ':
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,163 @@
+package isbn
+
+import (
+	"strconv"
+	"strings"
+)
+
+// rangeRule maps a 7-digit lookahead window to the length of the next
+// element, following the International ISBN Agency's range message. A
+// length of 0 marks an unassigned range.
+type rangeRule struct {
+	lo, hi int
+	length int
+}
+
+// groupRules splits the registration group after a 978/979 prefix.
+var groupRules = map[string][]rangeRule{
+	"978": {
+		{0, 5999999, 1},
+		{6000000, 6499999, 3},
+		{6500000, 6599999, 2},
+		{6600000, 6999999, 0},
+		{7000000, 7999999, 1},
+		{8000000, 9499999, 2},
+		{9500000, 9899999, 3},
+		{9900000, 9989999, 4},
+		{9990000, 9999999, 5},
+	},
+	"979": {
+		{0, 999999, 0},
+		{1000000, 1299999, 2},
+		{1300000, 7999999, 0},
+		{8000000, 8999999, 1},
+		{9000000, 9999999, 0},
+	},
+}
+
+// registrantRules splits the registrant (publisher) element within the
+// largest registration groups. Groups not listed here are hyphenated at the
+// group boundary only.
+var registrantRules = map[string][]rangeRule{
+	// English language
+	"978-0": {
+		{0, 1999999, 2},
+		{2000000, 6999999, 3},
+		{7000000, 8499999, 4},
+		{8500000, 8999999, 5},
+		{9000000, 9499999, 6},
+		{9500000, 9999999, 7},
+	},
+	"978-1": {
+		{0, 999999, 2},
+		{1000000, 3999999, 3},
+		{4000000, 5499999, 4},
+		{5500000, 8697999, 5},
+		{8698000, 9989999, 6},
+		{9990000, 9999999, 7},
+	},
+	// French language
+	"978-2": {
+		{0, 1999999, 2},
+		{2000000, 3499999, 3},
+		{3500000, 3999999, 5},
+		{4000000, 6999999, 3},
+		{7000000, 8399999, 4},
+		{8400000, 8999999, 5},
+		{9000000, 9499999, 6},
+		{9500000, 9999999, 7},
+	},
+	// German language
+	"978-3": {
+		{0, 299999, 2},
+		{300000, 339999, 3},
+		{340000, 369999, 4},
+		{370000, 399999, 5},
+		{400000, 1999999, 2},
+		{2000000, 6999999, 3},
+		{7000000, 8499999, 4},
+		{8500000, 8999999, 5},
+		{9000000, 9499999, 6},
+		{9500000, 9539999, 7},
+		{9540000, 9699999, 5},
+		{9700000, 9849999, 7},
+		{9850000, 9999999, 5},
+	},
+	// Japan
+	"978-4": {
+		{0, 1999999, 2},
+		{2000000, 6999999, 3},
+		{7000000, 8499999, 4},
+		{8500000, 8999999, 5},
+		{9000000, 9499999, 6},
+		{9500000, 9999999, 7},
+	},
+	// France (979 prefix)
+	"979-10": {
+		{0, 1999999, 2},
+		{2000000, 6999999, 3},
+		{7000000, 8999999, 4},
+		{9000000, 9759999, 5},
+		{9760000, 9999999, 6},
+	},
+}
+
+// Hyphenate returns the ISBN-13 split into prefix, registration group,
+// registrant, publication and check digit, e.g. 978-0-441-01359-3. When the
+// registrant ranges for a group aren't known, the registrant and publication
+// elements are left joined (978-91-7000123-4); when the group itself isn't
+// assigned, only the prefix and check digit are split off.
+func (i ISBN) Hyphenate() string {
+	prefix, body, check := i.digits[:3], i.digits[3:12], i.digits[12:]
+	parts := append([]string{prefix}, splitBody(prefix, body)...)
+	return strings.Join(append(parts, check), "-")
+}
+
+// Hyphenate10 returns the hyphenated ISBN-10 form, or false for 979 ISBNs.
+func (i ISBN) Hyphenate10() (string, bool) {
+	isbn10, ok := i.ISBN10()
+	if !ok {
+		return "", false
+	}
+	parts := splitBody("978", isbn10[:9])
+	return strings.Join(append(parts, isbn10[9:]), "-"), true
+}
+
+// splitBody splits the nine digits between prefix and check digit into
+// group, registrant and publication elements as far as the rules allow.
+func splitBody(prefix, body string) []string {
+	groupLen := lookup(groupRules[prefix], body)
+	if groupLen == 0 {
+		return []string{body}
+	}
+	group, rest := body[:groupLen], body[groupLen:]
+
+	regLen := lookup(registrantRules[prefix+"-"+group], rest)
+	if regLen == 0 || regLen >= len(rest) {
+		return []string{group, rest}
+	}
+	return []string{group, rest[:regLen], rest[regLen:]}
+}
+
+// lookup returns the element length for the 7-digit window at the start of
+// s (right-padded with zeros), or 0.
+func lookup(rules []rangeRule, s string) int {
+	if len(rules) == 0 {
+		return 0
+	}
+	window := s
+	if len(window) > 7 {
+		window = window[:7]
+	}
+	window += strings.Repeat("0", 7-len(window))
+	n, err := strconv.Atoi(window)
+	if err != nil {
+		return 0
+	}
+	for _, r := range rules {
+		if n >= r.lo && n <= r.hi {
+			return r.length
+		}
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package jobs
+
+import (
+	"errors"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+// ErrNotFound is returned for a job that doesn't exist or isn't in a state
+// the operation applies to.
+var ErrNotFound = errors.New("job not found")
+
+// Job is a stored job, as shown to admins.
+type Job struct {
+	ID          string        `db:"id" json:"id"`
+	Type        string        `db:"type" json:"type"`
+	Key         string        `db:"key" json:"key"`
+	Payload     types.JSONRaw `db:"payload" json:"payload"`
+	Status      string        `db:"status" json:"status"`
+	Attempts    int           `db:"attempts" json:"attempts"`
+	MaxAttempts int           `db:"max_attempts" json:"max_attempts"`
+	RunAfter    string        `db:"run_after" json:"run_after"`
+	StartedAt   string        `db:"started_at" json:"started_at"`
+	LastError   string        `db:"last_error" json:"last_error"`
+	Created     string        `db:"created" json:"created"`
+	Updated     string        `db:"updated" json:"updated"`
+}
+
+// List returns jobs, most recently updated first, optionally filtered by
+// status and type.
+func List(app core.App, status, jobType string, limit, offset int) ([]Job, error) {
+	query := `
+		SELECT id, type, key, payload, status, attempts, max_attempts, run_after,
+			   started_at, last_error, created, updated
+		FROM jobs WHERE 1=1`
+	params := map[string]any{"limit": limit, "offset": offset}
+	if status != "" {
+		query += ` AND status = {:status}`
+		params["status"] = status
+	}
+	if jobType != "" {
+		query += ` AND type = {:type}`
+		params["type"] = jobType
+	}
+	query += ` ORDER BY updated DESC LIMIT {:limit} OFFSET {:offset}`
+
+	var jobs []Job
+	if err := app.DB().NewQuery(query).Bind(params).All(&jobs); err != nil {
+		return nil, err
+	}
+	if jobs == nil {
+		jobs = []Job{}
+	}
+	return jobs, nil
+}
+
+// Count is how many jobs of a type are in a status.
+type Count struct {
+	Type   string `db:"type" json:"type"`
+	Status string `db:"status" json:"status"`
+	Count  int    `db:"count" json:"count"`
+}
+
+// Counts tallies jobs by type and status.
+func Counts(app core.App) ([]Count, error) {
+	var counts []Count
+	err := app.DB().NewQuery(`
+		SELECT type, status, COUNT(*) AS count FROM jobs GROUP BY type, status ORDER BY type, status
+	`).All(&counts)
+	if counts == nil {
+		counts = []Count{}
+	}
+	return counts, err
+}
+
+// Retry gives a dead job a fresh set of attempts, starting now.
+func Retry(app core.App, id string) error {
+	res, err := app.DB().NewQuery(`
+		UPDATE jobs SET status = 'pending', attempts = 0, run_after = {:now}, updated = {:now}
+		WHERE id = {:id} AND status = 'dead'
+	`).Bind(map[string]any{"id": id, "now": now()}).Execute()
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Discard deletes a job that isn't running.
+func Discard(app core.App, id string) error {
+	res, err := app.DB().NewQuery(`
+		DELETE FROM jobs WHERE id = {:id} AND status != 'running'
+	`).Bind(map[string]any{"id": id}).Execute()
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
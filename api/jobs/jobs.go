@@ -0,0 +1,142 @@
+// Package jobs runs durable background work. Jobs are rows in the jobs
+// collection, so work enqueued by a request survives a restart, and a job
+// enqueued inside a transaction only runs if the transaction commits. A pool
+// of workers claims due jobs, retries failures with exponential backoff and
+// dead-letters jobs that run out of attempts for inspection under
+// /admin/jobs. Finished jobs are deleted.
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/tristansaldanha/rosslib/api/store"
+)
+
+// Handler runs one job. payload is the JSON the job was enqueued with. A
+// returned error (or panic) schedules a retry.
+type Handler func(app core.App, payload []byte) error
+
+// Type describes a kind of job.
+type Type struct {
+	Name string
+	Run  Handler
+	// MaxAttempts is how many times a job is tried before it is
+	// dead-lettered. Defaults to defaultMaxAttempts.
+	MaxAttempts int
+	// Concurrency caps how many jobs of this type run at once, so long
+	// jobs can't occupy the whole pool. 0 means no cap.
+	Concurrency int
+}
+
+// defaultMaxAttempts is how many tries a job gets unless its type says
+// otherwise.
+const defaultMaxAttempts = 5
+
+var registry = struct {
+	sync.RWMutex
+	types map[string]Type
+}{types: map[string]Type{}}
+
+// Register adds a job type. Register every type before Start, so jobs left
+// from the last run find their handler.
+func Register(t Type) {
+	if t.MaxAttempts <= 0 {
+		t.MaxAttempts = defaultMaxAttempts
+	}
+	registry.Lock()
+	registry.types[t.Name] = t
+	registry.Unlock()
+}
+
+func lookup(name string) (Type, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok := registry.types[name]
+	return t, ok
+}
+
+// typeNames lists the registered types in order.
+func typeNames() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	names := make([]string, 0, len(registry.types))
+	for name := range registry.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Enqueue adds a job to run as soon as a worker is free. payload is stored
+// as JSON. Called with a transaction's app, the job is part of the
+// transaction.
+func Enqueue(app core.App, jobType string, payload any) error {
+	return enqueue(app, jobType, "", payload)
+}
+
+// EnqueueUnique is Enqueue unless a job of the same type and key is already
+// pending or running, in which case it does nothing. Jobs sharing a key
+// never run at the same time.
+func EnqueueUnique(app core.App, jobType, key string, payload any) error {
+	return enqueue(app, jobType, key, payload)
+}
+
+func enqueue(app core.App, jobType, key string, payload any) error {
+	t, ok := lookup(jobType)
+	if !ok {
+		return fmt.Errorf("unknown job type %q", jobType)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	err = app.RunInTransaction(func(txApp core.App) error {
+		if key != "" {
+			var n int
+			err := txApp.DB().NewQuery(`
+				SELECT COUNT(*) FROM jobs
+				WHERE type = {:type} AND key = {:key} AND status IN ('pending', 'running')
+			`).Bind(map[string]any{"type": jobType, "key": key}).Row(&n)
+			if err != nil || n > 0 {
+				return err
+			}
+		}
+
+		coll, err := txApp.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return err
+		}
+		rec := core.NewRecord(coll)
+		rec.Set("type", jobType)
+		rec.Set("key", key)
+		rec.Set("payload", types.JSONRaw(data))
+		rec.Set("status", "pending")
+		rec.Set("attempts", 0)
+		rec.Set("max_attempts", t.MaxAttempts)
+		rec.Set("run_after", now())
+		return txApp.Save(rec)
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// now is the current time in the format PocketBase stores dates in, which
+// sorts as text.
+func now() string {
+	return store.FormatTime(time.Now())
+}
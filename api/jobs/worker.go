@@ -0,0 +1,245 @@
+package jobs
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/store"
+)
+
+const (
+	// defaultWorkers is the pool size unless JOB_WORKERS says otherwise.
+	defaultWorkers = 4
+	// defaultDrainTimeout is how long shutdown waits for running jobs
+	// unless JOB_DRAIN_SECONDS says otherwise. Jobs still running after it
+	// are retried at the next startup.
+	defaultDrainTimeout = 30 * time.Second
+	// pollInterval is how often idle workers look for due jobs; enqueues
+	// wake one immediately.
+	pollInterval = 2 * time.Second
+	// retryBase and retryMax bound the backoff between attempts: 30s,
+	// 1m, 2m, ... up to an hour.
+	retryBase = 30 * time.Second
+	retryMax  = time.Hour
+)
+
+// wake nudges an idle worker when a job is enqueued.
+var wake = make(chan struct{}, 1)
+
+// running counts claimed jobs by type, for Type.Concurrency.
+var running = struct {
+	sync.Mutex
+	byType map[string]int
+}{byType: map[string]int{}}
+
+var startOnce sync.Once
+
+// Start launches the worker pool and drains it when the app terminates:
+// workers stop claiming jobs and shutdown waits for the running ones. Jobs
+// left running by a crash or an expired drain are made pending again first.
+// Call once, after every type is registered.
+func Start(app core.App) {
+	startOnce.Do(func() {
+		if _, err := app.DB().NewQuery(
+			"UPDATE jobs SET status = 'pending', run_after = {:now} WHERE status = 'running'",
+		).Bind(map[string]any{"now": now()}).Execute(); err != nil {
+			log.Printf("[Jobs] requeue interrupted jobs: %v", err)
+		}
+
+		workers := envInt("JOB_WORKERS", defaultWorkers)
+		drain := time.Duration(envInt("JOB_DRAIN_SECONDS", int(defaultDrainTimeout/time.Second))) * time.Second
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				work(app, stop)
+			}()
+		}
+		log.Printf("[Jobs] started %d workers", workers)
+
+		app.OnTerminate().BindFunc(func(e *core.TerminateEvent) error {
+			close(stop)
+			done := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(done)
+			}()
+			select {
+			case <-done:
+				log.Printf("[Jobs] drained")
+			case <-time.After(drain):
+				log.Printf("[Jobs] drain timed out after %s; unfinished jobs resume at next start", drain)
+			}
+			return e.Next()
+		})
+	})
+}
+
+// work runs jobs until stop is closed.
+func work(app core.App, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		j, err := claim(app)
+		if err != nil {
+			log.Printf("[Jobs] claim: %v", err)
+		}
+		if j == nil {
+			select {
+			case <-stop:
+				return
+			case <-wake:
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+		run(app, j)
+	}
+}
+
+// claimed is a job a worker has taken.
+type claimed struct {
+	ID          string `db:"id"`
+	Type        string `db:"type"`
+	Payload     string `db:"payload"`
+	Attempts    int    `db:"attempts"`
+	MaxAttempts int    `db:"max_attempts"`
+}
+
+// claim marks the oldest due job running and returns it, or nil if none
+// is due. Jobs whose type is at its concurrency cap, or that share a key
+// with a running job, are skipped.
+func claim(app core.App) (*claimed, error) {
+	running.Lock()
+	defer running.Unlock()
+
+	params := map[string]any{"now": now()}
+	var allowed []string
+	for _, name := range typeNames() {
+		t, _ := lookup(name)
+		if t.Concurrency > 0 && running.byType[name] >= t.Concurrency {
+			continue
+		}
+		key := fmt.Sprintf("t%d", len(allowed))
+		allowed = append(allowed, "{:"+key+"}")
+		params[key] = name
+	}
+	if len(allowed) == 0 {
+		return nil, nil
+	}
+
+	var j claimed
+	err := app.DB().NewQuery(`
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, started_at = {:now}, updated = {:now}
+		WHERE status = 'pending' AND id = (
+			SELECT j.id FROM jobs j
+			WHERE j.status = 'pending' AND j.run_after <= {:now}
+			  AND j.type IN (` + strings.Join(allowed, ", ") + `)
+			  AND (j.key = '' OR NOT EXISTS (
+				SELECT 1 FROM jobs r
+				WHERE r.status = 'running' AND r.type = j.type AND r.key = j.key
+			  ))
+			ORDER BY j.run_after
+			LIMIT 1
+		)
+		RETURNING id, type, COALESCE(payload, 'null') AS payload, attempts, max_attempts
+	`).Bind(params).One(&j)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	running.byType[j.Type]++
+	return &j, nil
+}
+
+// run executes a claimed job and records the outcome: deleted on success,
+// rescheduled with backoff on failure, dead once out of attempts.
+func run(app core.App, j *claimed) {
+	defer func() {
+		running.Lock()
+		running.byType[j.Type]--
+		running.Unlock()
+	}()
+
+	start := time.Now()
+	err := call(app, j)
+	if err == nil {
+		if _, err := app.DB().NewQuery("DELETE FROM jobs WHERE id = {:id}").
+			Bind(map[string]any{"id": j.ID}).Execute(); err != nil {
+			log.Printf("[Jobs] delete finished %s job %s: %v", j.Type, j.ID, err)
+		}
+		return
+	}
+
+	status, runAfter := "pending", time.Now().Add(backoff(j.Attempts))
+	if j.Attempts >= j.MaxAttempts {
+		status = "dead"
+		log.Printf("[Jobs] %s job %s dead after %d attempts: %v", j.Type, j.ID, j.Attempts, err)
+	} else {
+		log.Printf("[Jobs] %s job %s attempt %d failed after %s, retrying at %s: %v",
+			j.Type, j.ID, j.Attempts, time.Since(start).Round(time.Millisecond), store.FormatTime(runAfter), err)
+	}
+	if _, dbErr := app.DB().NewQuery(`
+		UPDATE jobs SET status = {:status}, run_after = {:run_after}, last_error = {:error}, updated = {:now}
+		WHERE id = {:id}
+	`).Bind(map[string]any{
+		"id":        j.ID,
+		"status":    status,
+		"run_after": store.FormatTime(runAfter),
+		"error":     err.Error(),
+		"now":       now(),
+	}).Execute(); dbErr != nil {
+		log.Printf("[Jobs] record %s job %s failure: %v", j.Type, j.ID, dbErr)
+	}
+}
+
+// call runs a job's handler, turning a panic into an error.
+func call(app core.App, j *claimed) (err error) {
+	t, ok := lookup(j.Type)
+	if !ok {
+		return fmt.Errorf("no handler for job type %q", j.Type)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return t.Run(app, []byte(j.Payload))
+}
+
+// backoff is the wait after a job's attempt-th failure.
+func backoff(attempt int) time.Duration {
+	d := retryBase
+	for i := 1; i < attempt && d < retryMax; i++ {
+		d *= 2
+	}
+	return min(d, retryMax)
+}
+
+// envInt reads a positive integer environment variable, returning def when
+// it is unset or invalid.
+func envInt(name string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
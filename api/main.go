@@ -11,7 +11,11 @@ import (
 
 	"github.com/tristansaldanha/rosslib/api/bookstats"
 	"github.com/tristansaldanha/rosslib/api/handlers"
+	"github.com/tristansaldanha/rosslib/api/jobs"
 	_ "github.com/tristansaldanha/rosslib/api/migrations"
+	"github.com/tristansaldanha/rosslib/api/progress"
+	"github.com/tristansaldanha/rosslib/api/search"
+	"github.com/tristansaldanha/rosslib/api/tasks"
 )
 
 func main() {
@@ -21,12 +25,29 @@ func main() {
 		Automigrate: true,
 	})
 
+	// Keep the full-text search index in sync with books, series and authors.
+	search.RegisterHooks(app)
+	// Keep book_stats in sync with shelves, ratings, reviews and statuses.
+	bookstats.RegisterHooks(app)
+	// Record every change to reading progress in progress_events.
+	progress.RegisterHooks(app)
+	// Background job types run by the jobs worker pool.
+	handlers.RegisterJobs()
+	// Recurring tasks run on the app's cron.
+	handlers.RegisterTasks()
+
 	app.OnServe().BindFunc(func(se *core.ServeEvent) error {
+		// Back the Open Library response cache with SQLite.
+		handlers.InitOLCache(app)
+
 		// ── Auth (public) ────────────────────────────────────────
 		se.Router.POST("/auth/login", handlers.Login(app))
 		se.Router.POST("/auth/register", handlers.Register(app))
 		se.Router.POST("/auth/google", handlers.GoogleAuth(app))
 
+		// ── Search (optional auth) ───────────────────────────────
+		se.Router.GET("/search", handlers.Search(app)).BindFunc(handlers.OptionalAuthFunc(app))
+
 		// ── Books (public) ───────────────────────────────────────
 		se.Router.GET("/books/search", handlers.SearchBooks(app))
 		se.Router.GET("/books/popular", handlers.GetPopularBooks(app))
@@ -84,6 +105,7 @@ func main() {
 		se.Router.GET("/users/{username}/timeline", handlers.GetReadingTimeline(app)).BindFunc(handlers.OptionalAuthFunc(app))
 		se.Router.GET("/users/{username}/goals/{year}", handlers.GetUserGoalYear(app)).BindFunc(handlers.OptionalAuthFunc(app))
 		se.Router.GET("/users/{username}/year-in-review", handlers.GetYearInReview(app)).BindFunc(handlers.OptionalAuthFunc(app))
+		se.Router.GET("/users/{username}/progress", handlers.GetUserProgress(app)).BindFunc(handlers.OptionalAuthFunc(app))
 
 		// ── Threads (public GET) ─────────────────────────────────
 		se.Router.GET("/threads/{threadId}", handlers.GetThread(app))
@@ -153,6 +175,7 @@ func main() {
 
 		// Export
 		authed.GET("/me/export/csv", handlers.ExportCSV(app))
+		authed.GET("/me/export/archive", handlers.ExportArchive(app))
 
 		// Follow
 		authed.POST("/users/{username}/follow", handlers.FollowUser(app))
@@ -195,12 +218,15 @@ func main() {
 		authed.PUT("/me/notification-preferences", handlers.UpdateNotificationPreferences(app))
 
 		// Imports
-		authed.POST("/me/import/goodreads/preview", handlers.PreviewGoodreadsImport(app))
-		authed.POST("/me/import/goodreads/commit", handlers.CommitGoodreadsImport(app))
-		authed.POST("/me/import/storygraph/preview", handlers.PreviewStoryGraphImport(app))
-		authed.POST("/me/import/storygraph/commit", handlers.CommitStoryGraphImport(app))
-		authed.POST("/me/import/librarything/preview", handlers.PreviewLibraryThingImport(app))
-		authed.POST("/me/import/librarything/commit", handlers.CommitLibraryThingImport(app))
+		authed.POST("/me/import/{source}/preview", handlers.PreviewImport(app))
+		authed.POST("/me/import/{source}/commit", handlers.CommitImport(app))
+		authed.POST("/me/import/rosslib", handlers.RestoreArchive(app))
+		authed.POST("/me/import/jobs", handlers.CreateImportJob(app))
+		authed.GET("/me/import/jobs", handlers.GetImportJobs(app))
+		authed.GET("/me/import/jobs/{id}", handlers.GetImportJob(app))
+		authed.POST("/me/import/jobs/{id}/commit", handlers.CommitImportJob(app))
+		authed.GET("/me/imports", handlers.GetImportHistory(app))
+		authed.POST("/me/imports/{id}/revert", handlers.RevertImport(app))
 		authed.GET("/me/imports/pending", handlers.GetPendingImports(app))
 		authed.PATCH("/me/imports/pending/{id}", handlers.ResolvePendingImport(app))
 		authed.POST("/me/imports/pending/{id}/retry", handlers.RetryPendingImport(app))
@@ -213,6 +239,7 @@ func main() {
 
 		// Reading sessions
 		authed.GET("/me/books/{olId}/sessions", handlers.GetSessions(app))
+		authed.GET("/me/books/{olId}/progress", handlers.GetBookProgress(app))
 		authed.POST("/me/books/{olId}/sessions", handlers.CreateSession(app))
 		authed.PATCH("/me/sessions/{sessionId}", handlers.UpdateSession(app))
 		authed.DELETE("/me/sessions/{sessionId}", handlers.DeleteSession(app))
@@ -280,12 +307,25 @@ func main() {
 		admin.PUT("/users/{userId}/author", handlers.SetAuthorKey(app))
 		admin.GET("/link-edits", handlers.GetPendingLinkEdits(app))
 		admin.PUT("/link-edits/{editId}", handlers.ReviewLinkEdit(app))
+		admin.GET("/ol-cache", handlers.GetOLCacheStats(app))
+		admin.GET("/ol-cache/entries", handlers.GetOLCacheEntries(app))
+		admin.DELETE("/ol-cache/entries", handlers.PurgeOLCache(app))
+		admin.POST("/books/merge", handlers.MergeBooks(app))
+		admin.GET("/jobs", handlers.GetAdminJobs(app))
+		admin.POST("/jobs/{jobId}/retry", handlers.RetryAdminJob(app))
+		admin.DELETE("/jobs/{jobId}", handlers.DeleteAdminJob(app))
+		admin.GET("/tasks", handlers.GetAdminTasks(app))
+		admin.PUT("/tasks/{name}", handlers.UpdateAdminTask(app))
+		admin.POST("/tasks/{name}/run", handlers.RunAdminTask(app))
 
 		// Start background pollers after the server is ready.
 		go func() {
 			// Small delay to ensure se.Next() has returned and the server is serving.
 			time.Sleep(2 * time.Second)
-			bookstats.StartPoller(app)
+			jobs.Start(app)
+			handlers.ResumeImportJobs(app)
+			handlers.ResumeExportJobs(app)
+			tasks.Start(app)
 		}()
 
 		return se.Next()
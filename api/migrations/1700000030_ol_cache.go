@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		cache := core.NewBaseCollection("ol_cache")
+		cache.Fields.Add(&core.TextField{Name: "key", Required: true})
+		cache.Fields.Add(&core.TextField{Name: "ttl_class"})
+		cache.Fields.Add(&core.TextField{Name: "body", Max: 10 * 1024 * 1024})
+		cache.Fields.Add(&core.NumberField{Name: "size"})
+		cache.Fields.Add(&core.NumberField{Name: "hits"})
+		cache.Fields.Add(&core.DateField{Name: "fetched_at"})
+		cache.Fields.Add(&core.DateField{Name: "expires_at"})
+		cache.Fields.Add(&core.DateField{Name: "stale_until"})
+		cache.Fields.Add(&core.DateField{Name: "last_accessed"})
+		cache.AddIndex("idx_ol_cache_key", true, "key", "")
+		cache.AddIndex("idx_ol_cache_last_accessed", false, "last_accessed", "")
+		cache.AddIndex("idx_ol_cache_stale_until", false, "stale_until", "")
+
+		return app.Save(cache)
+	}, func(app core.App) error {
+		coll, err := app.FindCollectionByNameOrId("ol_cache")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(coll)
+	})
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		books, err := app.FindCollectionByNameOrId("books")
+		if err != nil {
+			return err
+		}
+
+		books.Fields.Add(&core.TextField{Name: "description", Max: 50000})
+		books.Fields.Add(&core.TextField{Name: "first_sentence", Max: 5000})
+		books.Fields.Add(&core.JSONField{Name: "cover_ids"})
+		books.Fields.Add(&core.JSONField{Name: "links"})
+		books.Fields.Add(&core.JSONField{Name: "excerpts"})
+		books.Fields.Add(&core.JSONField{Name: "author_keys"})
+		books.Fields.Add(&core.NumberField{Name: "edition_count"})
+		books.Fields.Add(&core.DateField{Name: "metadata_fetched_at"})
+		books.AddIndex("idx_books_metadata_fetched_at", false, "metadata_fetched_at", "")
+
+		return app.Save(books)
+	}, func(app core.App) error {
+		return nil
+	})
+}
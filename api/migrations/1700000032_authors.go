@@ -0,0 +1,220 @@
+package migrations
+
+import (
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		books, err := app.FindCollectionByNameOrId("books")
+		if err != nil {
+			return err
+		}
+
+		// authors
+		authors := core.NewBaseCollection("authors")
+		authors.Fields.Add(&core.TextField{Name: "ol_key"})
+		authors.Fields.Add(&core.TextField{Name: "name", Required: true})
+		authors.Fields.Add(&core.JSONField{Name: "alternate_names"})
+		authors.Fields.Add(&core.TextField{Name: "bio", Max: 50000})
+		authors.Fields.Add(&core.TextField{Name: "photo_url"})
+		authors.Fields.Add(&core.TextField{Name: "birth_date"})
+		authors.Fields.Add(&core.TextField{Name: "death_date"})
+		authors.Fields.Add(&core.JSONField{Name: "links"})
+		authors.Fields.Add(&core.DateField{Name: "fetched_at"})
+		authors.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		authors.AddIndex("idx_authors_ol_key", true, "ol_key", "ol_key != ''")
+		authors.AddIndex("idx_authors_name", false, "name COLLATE NOCASE", "")
+		if err := app.Save(authors); err != nil {
+			return err
+		}
+
+		// book_authors
+		bookAuthors := core.NewBaseCollection("book_authors")
+		bookAuthors.Fields.Add(&core.RelationField{
+			Name:          "book",
+			CollectionId:  books.Id,
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		bookAuthors.Fields.Add(&core.RelationField{
+			Name:          "author",
+			CollectionId:  authors.Id,
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		bookAuthors.Fields.Add(&core.SelectField{
+			Name:      "role",
+			Values:    []string{"author", "translator", "illustrator", "editor"},
+			MaxSelect: 1,
+			Required:  true,
+		})
+		bookAuthors.Fields.Add(&core.NumberField{Name: "position"})
+		bookAuthors.AddIndex("idx_book_authors_unique", true, "book,author,role", "")
+		bookAuthors.AddIndex("idx_book_authors_author", false, "author", "")
+		if err := app.Save(bookAuthors); err != nil {
+			return err
+		}
+
+		// author_follows gains a relation to the authors row, plus the created
+		// column its listings already sort by.
+		follows, err := app.FindCollectionByNameOrId("author_follows")
+		if err != nil {
+			return err
+		}
+		follows.Fields.Add(&core.RelationField{
+			Name:          "author",
+			CollectionId:  authors.Id,
+			CascadeDelete: false,
+			MaxSelect:     1,
+		})
+		follows.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		if err := app.Save(follows); err != nil {
+			return err
+		}
+
+		return backfillAuthors(app, authors, bookAuthors, follows)
+	}, func(app core.App) error {
+		if follows, err := app.FindCollectionByNameOrId("author_follows"); err == nil {
+			follows.Fields.RemoveByName("author")
+			follows.Fields.RemoveByName("created")
+			if err := app.Save(follows); err != nil {
+				return err
+			}
+		}
+		for _, name := range []string{"book_authors", "authors"} {
+			coll, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			if err := app.Delete(coll); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// backfillAuthors builds authors/book_authors from the comma-separated
+// books.authors strings (paired with books.author_keys when the two line up)
+// and links existing author follows by OL key.
+func backfillAuthors(app core.App, authors, bookAuthors, follows *core.Collection) error {
+	byKey := map[string]*core.Record{}
+	byName := map[string]*core.Record{}
+
+	ensure := func(key, name string) (*core.Record, error) {
+		name = strings.TrimSpace(name)
+		lname := strings.ToLower(name)
+		if key != "" {
+			if rec, ok := byKey[key]; ok {
+				return rec, nil
+			}
+		}
+		if rec, ok := byName[lname]; ok && (key == "" || rec.GetString("ol_key") == "") {
+			if key != "" {
+				rec.Set("ol_key", key)
+				if err := app.Save(rec); err != nil {
+					return nil, err
+				}
+				byKey[key] = rec
+			}
+			return rec, nil
+		}
+		rec := core.NewRecord(authors)
+		rec.Set("ol_key", key)
+		rec.Set("name", name)
+		if err := app.Save(rec); err != nil {
+			return nil, err
+		}
+		if key != "" {
+			byKey[key] = rec
+		}
+		if _, ok := byName[lname]; !ok {
+			byName[lname] = rec
+		}
+		return rec, nil
+	}
+
+	type bookRow struct {
+		ID         string `db:"id"`
+		Authors    string `db:"authors"`
+		AuthorKeys string `db:"author_keys"`
+	}
+	var rows []bookRow
+	if err := app.DB().NewQuery(`
+		SELECT id, authors, COALESCE(author_keys, '') as author_keys FROM books WHERE authors != ''
+	`).All(&rows); err != nil {
+		return err
+	}
+
+	for _, r := range rows {
+		var names []string
+		for _, n := range strings.Split(r.Authors, ", ") {
+			if n = strings.TrimSpace(n); n != "" {
+				names = append(names, n)
+			}
+		}
+		var keys []string
+		if r.AuthorKeys != "" && r.AuthorKeys != "null" {
+			trimmed := strings.Trim(r.AuthorKeys, "[]")
+			for _, k := range strings.Split(trimmed, ",") {
+				if k = strings.Trim(strings.TrimSpace(k), `"`); k != "" {
+					keys = append(keys, k)
+				}
+			}
+		}
+		if len(keys) != len(names) {
+			keys = nil
+		}
+
+		seen := map[string]bool{}
+		for i, name := range names {
+			key := ""
+			if keys != nil {
+				key = keys[i]
+			}
+			author, err := ensure(key, name)
+			if err != nil {
+				return err
+			}
+			if seen[author.Id] {
+				continue
+			}
+			seen[author.Id] = true
+			link := core.NewRecord(bookAuthors)
+			link.Set("book", r.ID)
+			link.Set("author", author.Id)
+			link.Set("role", "author")
+			link.Set("position", i)
+			if err := app.Save(link); err != nil {
+				return err
+			}
+		}
+	}
+
+	followRecs, err := app.FindAllRecords(follows)
+	if err != nil {
+		return err
+	}
+	for _, f := range followRecs {
+		key := f.GetString("author_key")
+		name := f.GetString("author_name")
+		if name == "" {
+			name = key
+		}
+		author, err := ensure(key, name)
+		if err != nil {
+			return err
+		}
+		f.Set("author", author.Id)
+		if err := app.Save(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
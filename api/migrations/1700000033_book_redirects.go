@@ -0,0 +1,44 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		books, err := app.FindCollectionByNameOrId("books")
+		if err != nil {
+			return err
+		}
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		redirects := core.NewBaseCollection("book_redirects")
+		redirects.Fields.Add(&core.TextField{Name: "from_ol_id", Required: true})
+		redirects.Fields.Add(&core.RelationField{
+			Name:          "book",
+			CollectionId:  books.Id,
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		redirects.Fields.Add(&core.RelationField{
+			Name:         "merged_by",
+			CollectionId: users.Id,
+			MaxSelect:    1,
+		})
+		redirects.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		redirects.AddIndex("idx_book_redirects_from", true, "from_ol_id", "")
+		redirects.AddIndex("idx_book_redirects_book", false, "book", "")
+		return app.Save(redirects)
+	}, func(app core.App) error {
+		coll, err := app.FindCollectionByNameOrId("book_redirects")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(coll)
+	})
+}
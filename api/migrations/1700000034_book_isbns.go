@@ -0,0 +1,74 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+
+	"github.com/tristansaldanha/rosslib/api/isbn"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		books, err := app.FindCollectionByNameOrId("books")
+		if err != nil {
+			return err
+		}
+
+		bookISBNs := core.NewBaseCollection("book_isbns")
+		bookISBNs.Fields.Add(&core.RelationField{
+			Name:          "book",
+			CollectionId:  books.Id,
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		bookISBNs.Fields.Add(&core.TextField{Name: "isbn13", Required: true, Min: 13, Max: 13})
+		bookISBNs.AddIndex("idx_book_isbns_isbn13", true, "isbn13", "")
+		bookISBNs.AddIndex("idx_book_isbns_book", false, "book", "")
+		if err := app.Save(bookISBNs); err != nil {
+			return err
+		}
+
+		// Normalize stored ISBNs to validated ISBN-13 (converting ISBN-10s
+		// and stripping import quoting), clear ones that fail the checksum,
+		// and index the rest.
+		type row struct {
+			ID     string `db:"id"`
+			ISBN13 string `db:"isbn13"`
+		}
+		var rows []row
+		if err := app.DB().NewQuery(`
+			SELECT id, isbn13 FROM books WHERE isbn13 != '' AND isbn13 IS NOT NULL
+		`).All(&rows); err != nil {
+			return err
+		}
+
+		seen := map[string]bool{}
+		for _, r := range rows {
+			normalized := isbn.Normalize(r.ISBN13)
+			if normalized != r.ISBN13 {
+				if _, err := app.DB().NewQuery(`UPDATE books SET isbn13 = {:isbn} WHERE id = {:id}`).
+					Bind(map[string]any{"isbn": normalized, "id": r.ID}).Execute(); err != nil {
+					return err
+				}
+			}
+			if normalized == "" || seen[normalized] {
+				continue
+			}
+			seen[normalized] = true
+			rec := core.NewRecord(bookISBNs)
+			rec.Set("book", r.ID)
+			rec.Set("isbn13", normalized)
+			if err := app.Save(rec); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, func(app core.App) error {
+		coll, err := app.FindCollectionByNameOrId("book_isbns")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(coll)
+	})
+}
@@ -0,0 +1,101 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+
+	"github.com/tristansaldanha/rosslib/api/search"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		books, err := app.FindCollectionByNameOrId("books")
+		if err != nil {
+			return err
+		}
+		books.Fields.Add(&core.TextField{Name: "subtitle", Max: 1000})
+		if err := app.Save(books); err != nil {
+			return err
+		}
+
+		// search_books/search_authors hold accent-folded text written by the
+		// search package; the FTS5 tables index them as external content and
+		// the triggers keep the two in step.
+		stmts := []string{
+			`CREATE TABLE search_books (
+				id INTEGER PRIMARY KEY,
+				book TEXT NOT NULL UNIQUE,
+				title TEXT NOT NULL DEFAULT '',
+				subtitle TEXT NOT NULL DEFAULT '',
+				authors TEXT NOT NULL DEFAULT '',
+				series TEXT NOT NULL DEFAULT '',
+				subjects TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE VIRTUAL TABLE search_books_fts USING fts5(
+				title, subtitle, authors, series, subjects,
+				content='search_books', content_rowid='id',
+				tokenize='unicode61', prefix='2 3'
+			)`,
+			`CREATE TRIGGER search_books_ai AFTER INSERT ON search_books BEGIN
+				INSERT INTO search_books_fts(rowid, title, subtitle, authors, series, subjects)
+				VALUES (new.id, new.title, new.subtitle, new.authors, new.series, new.subjects);
+			END`,
+			`CREATE TRIGGER search_books_ad AFTER DELETE ON search_books BEGIN
+				INSERT INTO search_books_fts(search_books_fts, rowid, title, subtitle, authors, series, subjects)
+				VALUES ('delete', old.id, old.title, old.subtitle, old.authors, old.series, old.subjects);
+			END`,
+			`CREATE TRIGGER search_books_au AFTER UPDATE ON search_books BEGIN
+				INSERT INTO search_books_fts(search_books_fts, rowid, title, subtitle, authors, series, subjects)
+				VALUES ('delete', old.id, old.title, old.subtitle, old.authors, old.series, old.subjects);
+				INSERT INTO search_books_fts(rowid, title, subtitle, authors, series, subjects)
+				VALUES (new.id, new.title, new.subtitle, new.authors, new.series, new.subjects);
+			END`,
+
+			`CREATE TABLE search_authors (
+				id INTEGER PRIMARY KEY,
+				author TEXT NOT NULL UNIQUE,
+				name TEXT NOT NULL DEFAULT '',
+				alternate_names TEXT NOT NULL DEFAULT ''
+			)`,
+			`CREATE VIRTUAL TABLE search_authors_fts USING fts5(
+				name, alternate_names,
+				content='search_authors', content_rowid='id',
+				tokenize='unicode61', prefix='2 3'
+			)`,
+			`CREATE TRIGGER search_authors_ai AFTER INSERT ON search_authors BEGIN
+				INSERT INTO search_authors_fts(rowid, name, alternate_names)
+				VALUES (new.id, new.name, new.alternate_names);
+			END`,
+			`CREATE TRIGGER search_authors_ad AFTER DELETE ON search_authors BEGIN
+				INSERT INTO search_authors_fts(search_authors_fts, rowid, name, alternate_names)
+				VALUES ('delete', old.id, old.name, old.alternate_names);
+			END`,
+			`CREATE TRIGGER search_authors_au AFTER UPDATE ON search_authors BEGIN
+				INSERT INTO search_authors_fts(search_authors_fts, rowid, name, alternate_names)
+				VALUES ('delete', old.id, old.name, old.alternate_names);
+				INSERT INTO search_authors_fts(rowid, name, alternate_names)
+				VALUES (new.id, new.name, new.alternate_names);
+			END`,
+		}
+		for _, stmt := range stmts {
+			if _, err := app.DB().NewQuery(stmt).Execute(); err != nil {
+				return err
+			}
+		}
+
+		_, err = search.Rebuild(app)
+		return err
+	}, func(app core.App) error {
+		for _, table := range []string{"search_books_fts", "search_books", "search_authors_fts", "search_authors"} {
+			if _, err := app.DB().NewQuery("DROP TABLE IF EXISTS " + table).Execute(); err != nil {
+				return err
+			}
+		}
+		books, err := app.FindCollectionByNameOrId("books")
+		if err != nil {
+			return err
+		}
+		books.Fields.RemoveByName("subtitle")
+		return app.Save(books)
+	})
+}
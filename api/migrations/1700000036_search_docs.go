@@ -0,0 +1,81 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+
+	"github.com/tristansaldanha/rosslib/api/search"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// search_docs indexes user-written content (threads, lists, quotes,
+		// reviews) the same way search_books indexes the catalog.
+		stmts := []string{
+			`CREATE TABLE search_docs (
+				id INTEGER PRIMARY KEY,
+				kind TEXT NOT NULL,
+				ref TEXT NOT NULL,
+				owner TEXT NOT NULL DEFAULT '',
+				spoiler INTEGER NOT NULL DEFAULT 0,
+				title TEXT NOT NULL DEFAULT '',
+				body TEXT NOT NULL DEFAULT '',
+				UNIQUE (kind, ref)
+			)`,
+			`CREATE VIRTUAL TABLE search_docs_fts USING fts5(
+				title, body,
+				content='search_docs', content_rowid='id',
+				tokenize='unicode61', prefix='2 3'
+			)`,
+			`CREATE TRIGGER search_docs_ai AFTER INSERT ON search_docs BEGIN
+				INSERT INTO search_docs_fts(rowid, title, body) VALUES (new.id, new.title, new.body);
+			END`,
+			`CREATE TRIGGER search_docs_ad AFTER DELETE ON search_docs BEGIN
+				INSERT INTO search_docs_fts(search_docs_fts, rowid, title, body)
+				VALUES ('delete', old.id, old.title, old.body);
+			END`,
+			`CREATE TRIGGER search_docs_au AFTER UPDATE ON search_docs BEGIN
+				INSERT INTO search_docs_fts(search_docs_fts, rowid, title, body)
+				VALUES ('delete', old.id, old.title, old.body);
+				INSERT INTO search_docs_fts(rowid, title, body) VALUES (new.id, new.title, new.body);
+			END`,
+		}
+		for _, stmt := range stmts {
+			if _, err := app.DB().NewQuery(stmt).Execute(); err != nil {
+				return err
+			}
+		}
+		if _, err := search.RebuildDocs(app); err != nil {
+			return err
+		}
+
+		// Saved searches can target the unified /search endpoint as well as
+		// book search. Existing rows are book searches.
+		savedSearches, err := app.FindCollectionByNameOrId("saved_searches")
+		if err != nil {
+			return err
+		}
+		savedSearches.Fields.Add(&core.SelectField{
+			Name:      "target",
+			Values:    []string{"books", "all"},
+			MaxSelect: 1,
+		})
+		if err := app.Save(savedSearches); err != nil {
+			return err
+		}
+		_, err = app.DB().NewQuery(`UPDATE saved_searches SET target = 'books' WHERE target = '' OR target IS NULL`).Execute()
+		return err
+	}, func(app core.App) error {
+		for _, table := range []string{"search_docs_fts", "search_docs"} {
+			if _, err := app.DB().NewQuery("DROP TABLE IF EXISTS " + table).Execute(); err != nil {
+				return err
+			}
+		}
+		savedSearches, err := app.FindCollectionByNameOrId("saved_searches")
+		if err != nil {
+			return err
+		}
+		savedSearches.Fields.RemoveByName("target")
+		return app.Save(savedSearches)
+	})
+}
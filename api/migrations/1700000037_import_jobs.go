@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		jobs := core.NewBaseCollection("import_jobs")
+		jobs.Fields.Add(&core.RelationField{
+			Name:          "user",
+			CollectionId:  users.Id,
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		jobs.Fields.Add(&core.TextField{Name: "source", Required: true})
+		jobs.Fields.Add(&core.SelectField{
+			Name:      "status",
+			Values:    []string{"matching", "ready", "committing", "done", "failed"},
+			MaxSelect: 1,
+			Required:  true,
+		})
+		jobs.Fields.Add(&core.NumberField{Name: "total"})
+		jobs.Fields.Add(&core.NumberField{Name: "processed"})
+		jobs.Fields.Add(&core.NumberField{Name: "matched"})
+		jobs.Fields.Add(&core.NumberField{Name: "ambiguous"})
+		jobs.Fields.Add(&core.NumberField{Name: "unmatched"})
+		// rows and commit can run to megabytes for large libraries; hiding
+		// them keeps realtime progress events small.
+		jobs.Fields.Add(&core.JSONField{Name: "rows", MaxSize: 32 * 1024 * 1024, Hidden: true})
+		jobs.Fields.Add(&core.JSONField{Name: "commit", MaxSize: 32 * 1024 * 1024, Hidden: true})
+		jobs.Fields.Add(&core.JSONField{Name: "result", MaxSize: 1024 * 1024})
+		jobs.Fields.Add(&core.TextField{Name: "error"})
+		jobs.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		jobs.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+		jobs.AddIndex("idx_import_jobs_user", false, "user", "")
+		jobs.AddIndex("idx_import_jobs_status", false, "status", "")
+
+		// Owners may read their jobs, so clients can subscribe to progress
+		// over PocketBase realtime. All writes go through the API.
+		jobs.ListRule = types.Pointer("user = @request.auth.id")
+		jobs.ViewRule = types.Pointer("user = @request.auth.id")
+
+		return app.Save(jobs)
+	}, func(app core.App) error {
+		coll, err := app.FindCollectionByNameOrId("import_jobs")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(coll)
+	})
+}
@@ -0,0 +1,109 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+// importStamped are the collections whose records carry the import batch
+// that last created or changed them.
+var importStamped = []string{"user_books", "book_tag_values", "tag_keys", "tag_values", "pending_imports"}
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		batches := core.NewBaseCollection("import_batches")
+		batches.Fields.Add(&core.RelationField{
+			Name:          "user",
+			CollectionId:  users.Id,
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		batches.Fields.Add(&core.TextField{Name: "source", Required: true})
+		batches.Fields.Add(&core.TextField{Name: "job"})
+		batches.Fields.Add(&core.SelectField{
+			Name:      "status",
+			Values:    []string{"committing", "committed", "reverted"},
+			MaxSelect: 1,
+			Required:  true,
+		})
+		batches.Fields.Add(&core.NumberField{Name: "imported"})
+		batches.Fields.Add(&core.NumberField{Name: "failed"})
+		batches.Fields.Add(&core.NumberField{Name: "pending_saved"})
+		batches.Fields.Add(&core.DateField{Name: "reverted_at"})
+		batches.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		batches.AddIndex("idx_import_batches_user", false, "user", "")
+		if err := app.Save(batches); err != nil {
+			return err
+		}
+
+		changes := core.NewBaseCollection("import_changes")
+		changes.Fields.Add(&core.RelationField{
+			Name:          "batch",
+			CollectionId:  batches.Id,
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		changes.Fields.Add(&core.NumberField{Name: "seq"})
+		changes.Fields.Add(&core.TextField{Name: "collection", Required: true})
+		changes.Fields.Add(&core.TextField{Name: "record", Required: true})
+		changes.Fields.Add(&core.SelectField{
+			Name:      "action",
+			Values:    []string{"created", "updated", "deleted"},
+			MaxSelect: 1,
+			Required:  true,
+		})
+		changes.Fields.Add(&core.JSONField{Name: "before", MaxSize: 1024 * 1024})
+		changes.AddIndex("idx_import_changes_batch_seq", false, "batch,seq", "")
+		changes.AddIndex("idx_import_changes_record", false, "record", "")
+		if err := app.Save(changes); err != nil {
+			return err
+		}
+
+		for _, name := range importStamped {
+			coll, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				return err
+			}
+			coll.Fields.Add(&core.TextField{Name: "import_batch"})
+			if err := app.Save(coll); err != nil {
+				return err
+			}
+		}
+
+		jobs, err := app.FindCollectionByNameOrId("import_jobs")
+		if err != nil {
+			return err
+		}
+		jobs.Fields.Add(&core.TextField{Name: "batch"})
+		return app.Save(jobs)
+	}, func(app core.App) error {
+		for _, name := range append(importStamped, "import_jobs") {
+			coll, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			coll.Fields.RemoveByName("import_batch")
+			coll.Fields.RemoveByName("batch")
+			if err := app.Save(coll); err != nil {
+				return err
+			}
+		}
+		for _, name := range []string{"import_changes", "import_batches"} {
+			coll, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			if err := app.Delete(coll); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,41 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// user_books.updated and import_batches.committed_at let re-imports
+		// tell whether a shelf entry was edited since the import that last
+		// wrote it. Existing entries keep an empty updated until next saved.
+		userBooks, err := app.FindCollectionByNameOrId("user_books")
+		if err != nil {
+			return err
+		}
+		userBooks.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+		if err := app.Save(userBooks); err != nil {
+			return err
+		}
+
+		batches, err := app.FindCollectionByNameOrId("import_batches")
+		if err != nil {
+			return err
+		}
+		batches.Fields.Add(&core.DateField{Name: "committed_at"})
+		return app.Save(batches)
+	}, func(app core.App) error {
+		for name, field := range map[string]string{"user_books": "updated", "import_batches": "committed_at"} {
+			coll, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			coll.Fields.RemoveByName(field)
+			if err := app.Save(coll); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
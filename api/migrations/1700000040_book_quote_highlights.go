@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Highlights imported from e-readers keep where and when they were
+		// made. created/updated were missing from book_quotes and
+		// pending_imports, whose listings already sort by created.
+		quotes, err := app.FindCollectionByNameOrId("book_quotes")
+		if err != nil {
+			return err
+		}
+		quotes.Fields.Add(&core.TextField{Name: "location"})
+		quotes.Fields.Add(&core.DateField{Name: "highlighted_at"})
+		quotes.Fields.Add(&core.TextField{Name: "import_batch"})
+		quotes.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		quotes.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+		if err := app.Save(quotes); err != nil {
+			return err
+		}
+
+		pending, err := app.FindCollectionByNameOrId("pending_imports")
+		if err != nil {
+			return err
+		}
+		pending.Fields.Add(&core.JSONField{Name: "highlights", MaxSize: 1024 * 1024})
+		pending.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		pending.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+		return app.Save(pending)
+	}, func(app core.App) error {
+		if quotes, err := app.FindCollectionByNameOrId("book_quotes"); err == nil {
+			for _, name := range []string{"location", "highlighted_at", "import_batch", "created", "updated"} {
+				quotes.Fields.RemoveByName(name)
+			}
+			if err := app.Save(quotes); err != nil {
+				return err
+			}
+		}
+		pending, err := app.FindCollectionByNameOrId("pending_imports")
+		if err != nil {
+			return nil
+		}
+		for _, name := range []string{"highlights", "created", "updated"} {
+			pending.Fields.RemoveByName(name)
+		}
+		return app.Save(pending)
+	})
+}
@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+	"github.com/pocketbase/pocketbase/tools/types"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+
+		jobs := core.NewBaseCollection("export_jobs")
+		jobs.Fields.Add(&core.RelationField{
+			Name:          "user",
+			CollectionId:  users.Id,
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		jobs.Fields.Add(&core.SelectField{
+			Name:      "status",
+			Values:    []string{"building", "done", "failed"},
+			MaxSelect: 1,
+			Required:  true,
+		})
+		jobs.Fields.Add(&core.NumberField{Name: "total"})
+		jobs.Fields.Add(&core.NumberField{Name: "processed"})
+		// Archives are only served through GET /me/export/archive.
+		jobs.Fields.Add(&core.FileField{
+			Name:      "archive",
+			MaxSelect: 1,
+			MaxSize:   512 * 1024 * 1024,
+			Protected: true,
+		})
+		jobs.Fields.Add(&core.TextField{Name: "error"})
+		jobs.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		jobs.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+		jobs.AddIndex("idx_export_jobs_user", false, "user", "")
+
+		// Owners may read their jobs to follow progress over realtime.
+		jobs.ListRule = types.Pointer("user = @request.auth.id")
+		jobs.ViewRule = types.Pointer("user = @request.auth.id")
+
+		return app.Save(jobs)
+	}, func(app core.App) error {
+		coll, err := app.FindCollectionByNameOrId("export_jobs")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(coll)
+	})
+}
@@ -0,0 +1,29 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// book_stats is now kept up to date by record hooks, which also
+		// count readers in progress and readers who gave up. The next drift
+		// repair fills these in for existing books.
+		stats, err := app.FindCollectionByNameOrId("book_stats")
+		if err != nil {
+			return err
+		}
+		stats.Fields.Add(&core.NumberField{Name: "currently_reading_count"})
+		stats.Fields.Add(&core.NumberField{Name: "dnf_count"})
+		return app.Save(stats)
+	}, func(app core.App) error {
+		stats, err := app.FindCollectionByNameOrId("book_stats")
+		if err != nil {
+			return nil
+		}
+		stats.Fields.RemoveByName("currently_reading_count")
+		stats.Fields.RemoveByName("dnf_count")
+		return app.Save(stats)
+	})
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Rating histogram (by half star), Bayesian-weighted score and time
+		// to finish. The next drift repair fills these in for existing books.
+		stats, err := app.FindCollectionByNameOrId("book_stats")
+		if err != nil {
+			return err
+		}
+		stats.Fields.Add(&core.JSONField{Name: "rating_histogram"})
+		stats.Fields.Add(&core.NumberField{Name: "weighted_score"})
+		stats.Fields.Add(&core.NumberField{Name: "finish_count"})
+		stats.Fields.Add(&core.NumberField{Name: "median_days_to_finish"})
+		stats.AddIndex("idx_book_stats_weighted_score", false, "weighted_score", "")
+		return app.Save(stats)
+	}, func(app core.App) error {
+		stats, err := app.FindCollectionByNameOrId("book_stats")
+		if err != nil {
+			return nil
+		}
+		stats.RemoveIndex("idx_book_stats_weighted_score")
+		for _, name := range []string{"rating_histogram", "weighted_score", "finish_count", "median_days_to_finish"} {
+			stats.Fields.RemoveByName(name)
+		}
+		return app.Save(stats)
+	})
+}
@@ -0,0 +1,42 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Durable background work, run by the worker pool in api/jobs.
+		// Finished jobs are deleted; jobs out of attempts stay as "dead".
+		jobs := core.NewBaseCollection("jobs")
+		jobs.Fields.Add(&core.TextField{Name: "type", Required: true})
+		// Optional dedupe key: at most one pending or running job per
+		// type and key.
+		jobs.Fields.Add(&core.TextField{Name: "key"})
+		jobs.Fields.Add(&core.JSONField{Name: "payload", MaxSize: 1024 * 1024})
+		jobs.Fields.Add(&core.SelectField{
+			Name:      "status",
+			Values:    []string{"pending", "running", "dead"},
+			MaxSelect: 1,
+			Required:  true,
+		})
+		jobs.Fields.Add(&core.NumberField{Name: "attempts"})
+		jobs.Fields.Add(&core.NumberField{Name: "max_attempts"})
+		jobs.Fields.Add(&core.DateField{Name: "run_after"})
+		jobs.Fields.Add(&core.DateField{Name: "started_at"})
+		jobs.Fields.Add(&core.TextField{Name: "last_error"})
+		jobs.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		jobs.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+		jobs.AddIndex("idx_jobs_status_run_after", false, "status, run_after", "")
+		jobs.AddIndex("idx_jobs_type_key", false, "type, key", "")
+
+		return app.Save(jobs)
+	}, func(app core.App) error {
+		coll, err := app.FindCollectionByNameOrId("jobs")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(coll)
+	})
+}
@@ -0,0 +1,101 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+
+	"github.com/tristansaldanha/rosslib/api/store"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		// Run state and schedule overrides for the recurring tasks in
+		// api/tasks, one row per task.
+		tasks := core.NewBaseCollection("scheduled_tasks")
+		tasks.Fields.Add(&core.TextField{Name: "name", Required: true})
+		// Admin override of the task's schedule; empty means use the
+		// environment or the built-in default.
+		tasks.Fields.Add(&core.TextField{Name: "schedule"})
+		tasks.Fields.Add(&core.DateField{Name: "last_started_at"})
+		tasks.Fields.Add(&core.DateField{Name: "last_finished_at"})
+		tasks.Fields.Add(&core.NumberField{Name: "last_duration_ms"})
+		tasks.Fields.Add(&core.SelectField{
+			Name:      "last_status",
+			Values:    []string{"running", "ok", "error", "interrupted"},
+			MaxSelect: 1,
+		})
+		tasks.Fields.Add(&core.TextField{Name: "last_error"})
+		// What the last run reported through tasks.SetResult, such as the
+		// drift book_stats_repair fixed; null for tasks that report nothing.
+		tasks.Fields.Add(&core.JSONField{Name: "last_result", MaxSize: 1 << 20})
+		tasks.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+		tasks.AddIndex("idx_scheduled_tasks_name", true, "name", "")
+		if err := app.Save(tasks); err != nil {
+			return err
+		}
+
+		// Work counts last seen for followed authors, so the publication
+		// poller can tell when one has grown.
+		snapshots := core.NewBaseCollection("author_works_snapshot")
+		snapshots.Fields.Add(&core.TextField{Name: "author_key", Required: true})
+		snapshots.Fields.Add(&core.NumberField{Name: "work_count"})
+		snapshots.Fields.Add(&core.AutodateField{Name: "updated", OnCreate: true, OnUpdate: true})
+		snapshots.AddIndex("idx_author_works_snapshot_key", true, "author_key", "")
+		if err := app.Save(snapshots); err != nil {
+			return err
+		}
+
+		// notifications gains the created column its listing already sorts
+		// by, and which the cleanup task ages read notifications out on.
+		// Existing rows are stamped now so they age out from here.
+		notifications, err := app.FindCollectionByNameOrId("notifications")
+		if err != nil {
+			return err
+		}
+		notifications.Fields.Add(&core.AutodateField{Name: "created", OnCreate: true})
+		notifications.AddIndex("idx_notifications_read_created", false, "read,created", "")
+		if err := app.Save(notifications); err != nil {
+			return err
+		}
+		if _, err := app.DB().NewQuery(
+			"UPDATE notifications SET created = {:now} WHERE created = '' OR created IS NULL",
+		).Bind(map[string]any{"now": store.FormatTime(time.Now())}).Execute(); err != nil {
+			return err
+		}
+
+		// pending_imports records when the auto-retry task last tried a row,
+		// so each run moves on to the rows tried longest ago.
+		pending, err := app.FindCollectionByNameOrId("pending_imports")
+		if err != nil {
+			return err
+		}
+		pending.Fields.Add(&core.DateField{Name: "retried_at"})
+		return app.Save(pending)
+	}, func(app core.App) error {
+		if pending, err := app.FindCollectionByNameOrId("pending_imports"); err == nil {
+			pending.Fields.RemoveByName("retried_at")
+			if err := app.Save(pending); err != nil {
+				return err
+			}
+		}
+		if notifications, err := app.FindCollectionByNameOrId("notifications"); err == nil {
+			notifications.RemoveIndex("idx_notifications_read_created")
+			notifications.Fields.RemoveByName("created")
+			if err := app.Save(notifications); err != nil {
+				return err
+			}
+		}
+		for _, name := range []string{"author_works_snapshot", "scheduled_tasks"} {
+			coll, err := app.FindCollectionByNameOrId(name)
+			if err != nil {
+				continue
+			}
+			if err := app.Delete(coll); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
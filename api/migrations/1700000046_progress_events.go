@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		users, err := app.FindCollectionByNameOrId("users")
+		if err != nil {
+			return err
+		}
+		books, err := app.FindCollectionByNameOrId("books")
+		if err != nil {
+			return err
+		}
+		sessions, err := app.FindCollectionByNameOrId("reading_sessions")
+		if err != nil {
+			return err
+		}
+
+		// One row per change to a user_books record's progress, written by
+		// the hooks in api/progress.
+		events := core.NewBaseCollection("progress_events")
+		events.Fields.Add(&core.RelationField{
+			Name:          "user",
+			CollectionId:  users.Id,
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		events.Fields.Add(&core.RelationField{
+			Name:          "book",
+			CollectionId:  books.Id,
+			CascadeDelete: true,
+			MaxSelect:     1,
+			Required:      true,
+		})
+		// The reading session open for the book when progress was made.
+		events.Fields.Add(&core.RelationField{
+			Name:          "session",
+			CollectionId:  sessions.Id,
+			CascadeDelete: false,
+			MaxSelect:     1,
+		})
+		events.Fields.Add(&core.NumberField{Name: "pages"})
+		events.Fields.Add(&core.NumberField{Name: "percent"})
+		// How far this change moved the reader forward, in pages and in
+		// percentage points. Zero for the first event of a shelf entry and
+		// for changes that go backwards.
+		events.Fields.Add(&core.NumberField{Name: "pages_read"})
+		events.Fields.Add(&core.NumberField{Name: "percent_read"})
+		events.Fields.Add(&core.DateField{Name: "recorded_at", Required: true})
+		events.AddIndex("idx_progress_events_user_recorded", false, "user,recorded_at", "")
+		events.AddIndex("idx_progress_events_user_book_recorded", false, "user,book,recorded_at", "")
+
+		return app.Save(events)
+	}, func(app core.App) error {
+		coll, err := app.FindCollectionByNameOrId("progress_events")
+		if err != nil {
+			return nil
+		}
+		return app.Delete(coll)
+	})
+}
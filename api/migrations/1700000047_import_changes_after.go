@@ -0,0 +1,23 @@
+package migrations
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+	m "github.com/pocketbase/pocketbase/migrations"
+)
+
+func init() {
+	m.Register(func(app core.App) error {
+		changes, err := app.FindCollectionByNameOrId("import_changes")
+		if err != nil {
+			return err
+		}
+
+		// The record as the import left it, so a revert can tell whether
+		// it has been edited since and which fields the import changed.
+		changes.Fields.Add(&core.JSONField{Name: "after", MaxSize: 1024 * 1024})
+
+		return app.Save(changes)
+	}, func(app core.App) error {
+		return nil
+	})
+}
@@ -0,0 +1,124 @@
+// Package progress keeps the history of reading progress. user_books only
+// holds a shelf entry's latest progress_pages and progress_percent, so every
+// change to them is also written to progress_events, from which this
+// package builds daily series, reading streaks and heatmaps.
+package progress
+
+import (
+	"math"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/store"
+)
+
+// RegisterHooks records a progress event whenever a user_books record is
+// created with progress or has its progress changed, in the same transaction
+// as the write.
+func RegisterHooks(app core.App) {
+	app.OnRecordCreate("user_books").BindFunc(func(e *core.RecordEvent) error {
+		return e.App.RunInTransaction(func(txApp core.App) error {
+			return store.NextThen(e, txApp, func() error { return record(txApp, nil, e.Record) })
+		})
+	})
+	app.OnRecordUpdate("user_books").BindFunc(func(e *core.RecordEvent) error {
+		return e.App.RunInTransaction(func(txApp core.App) error {
+			// Read what is stored rather than Original(), which a record
+			// saved twice from memory would report as unchanged.
+			before, err := txApp.FindRecordById("user_books", e.Record.Id)
+			if err != nil {
+				return err
+			}
+			return store.NextThen(e, txApp, func() error { return record(txApp, before, e.Record) })
+		})
+	})
+}
+
+// record writes the event for a shelf entry's progress moving from before
+// to after, if it moved. before is nil for a new entry. A new entry's
+// progress, or an entry moved to another book, starts a baseline event that
+// counts nothing as read: the pages were read at some unknown earlier time
+// (typically an import).
+func record(app core.App, before, after *core.Record) error {
+	pages, percent := after.GetFloat("progress_pages"), after.GetFloat("progress_percent")
+	baseline := before == nil || before.GetString("book") != after.GetString("book")
+	if baseline && pages == 0 && percent == 0 {
+		return nil
+	}
+
+	var pagesRead, percentRead float64
+	if !baseline {
+		oldPages, oldPercent := before.GetFloat("progress_pages"), before.GetFloat("progress_percent")
+		if pages == oldPages && percent == oldPercent {
+			return nil
+		}
+		// Measure from where the reader was in the unit they updated, so
+		// switching between pages and percent doesn't count the whole book
+		// again, and fill in the other unit from the book's length.
+		total := totalPages(app, after)
+		if pages != oldPages {
+			from := oldPages
+			if from == 0 && total > 0 {
+				from = oldPercent * total / 100
+			}
+			pagesRead = math.Max(0, math.Round(pages-from))
+			if total > 0 {
+				percentRead = math.Round(pagesRead*1000/total) / 10
+			} else {
+				percentRead = math.Max(0, percent-oldPercent)
+			}
+		} else {
+			from := oldPercent
+			if from == 0 && total > 0 {
+				from = oldPages * 100 / total
+			}
+			percentRead = math.Max(0, math.Round((percent-from)*10)/10)
+			if total > 0 {
+				pagesRead = math.Round(percentRead * total / 100)
+			}
+		}
+	}
+
+	coll, err := app.FindCollectionByNameOrId("progress_events")
+	if err != nil {
+		return err
+	}
+	rec := core.NewRecord(coll)
+	rec.Set("user", after.GetString("user"))
+	rec.Set("book", after.GetString("book"))
+	rec.Set("session", openSession(app, after.GetString("user"), after.GetString("book")))
+	rec.Set("pages", pages)
+	rec.Set("percent", percent)
+	rec.Set("pages_read", pagesRead)
+	rec.Set("percent_read", percentRead)
+	rec.Set("recorded_at", store.FormatTime(time.Now()))
+	return app.Save(rec)
+}
+
+// totalPages is the length of a shelf entry's book: the reader's device
+// page count when set, else the catalog's.
+func totalPages(app core.App, ub *core.Record) float64 {
+	if n := ub.GetFloat("device_total_pages"); n > 0 {
+		return n
+	}
+	var n float64
+	_ = app.DB().NewQuery(
+		"SELECT COALESCE(page_count, 0) FROM books WHERE id = {:id}",
+	).Bind(map[string]any{"id": ub.GetString("book")}).Row(&n)
+	return n
+}
+
+// openSession returns the id of the user's unfinished reading session for a
+// book, most recently started first, or "" if there is none.
+func openSession(app core.App, userID, bookID string) string {
+	var id string
+	_ = app.DB().NewQuery(`
+		SELECT id FROM reading_sessions
+		WHERE user = {:user} AND book = {:book}
+		  AND (date_finished IS NULL OR date_finished = '')
+		ORDER BY date_started DESC, rowid DESC
+		LIMIT 1
+	`).Bind(map[string]any{"user": userID, "book": bookID}).Row(&id)
+	return id
+}
@@ -0,0 +1,360 @@
+package progress
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+
+	"github.com/tristansaldanha/rosslib/api/store"
+)
+
+// dateLayout is the layout of the dates days are keyed by.
+const dateLayout = "2006-01-02"
+
+// maxRangeDays caps how many days a series or heatmap covers.
+const maxRangeDays = 366
+
+// Event is one stored change to a shelf entry's progress.
+type Event struct {
+	ID          string  `db:"id" json:"id"`
+	Book        string  `db:"book" json:"-"`
+	Session     string  `db:"session" json:"session_id"`
+	Pages       float64 `db:"pages" json:"pages"`
+	Percent     float64 `db:"percent" json:"percent"`
+	PagesRead   float64 `db:"pages_read" json:"pages_read"`
+	PercentRead float64 `db:"percent_read" json:"percent_read"`
+	RecordedAt  string  `db:"recorded_at" json:"recorded_at"`
+}
+
+// BookEvents returns a user's progress events for a book, oldest first.
+func BookEvents(app core.App, userID, bookID string) ([]Event, error) {
+	var events []Event
+	err := app.DB().NewQuery(`
+		SELECT id, book, COALESCE(session, '') AS session, pages, percent, pages_read, percent_read, recorded_at
+		FROM progress_events
+		WHERE user = {:user} AND book = {:book}
+		ORDER BY recorded_at, rowid
+	`).Bind(map[string]any{"user": userID, "book": bookID}).All(&events)
+	if events == nil {
+		events = []Event{}
+	}
+	return events, err
+}
+
+// Day is a day's progress in the reader's time zone.
+type Day struct {
+	Date        string  `json:"date"`
+	PagesRead   int     `json:"pages_read"`
+	PercentRead float64 `json:"percent_read"`
+	// Events counts the progress updates that moved the reader forward.
+	Events int `json:"events"`
+}
+
+// Active reports whether the reader made progress that day.
+func (d Day) Active() bool {
+	return d.Events > 0
+}
+
+// Range is the days from From to To inclusive, in Location.
+type Range struct {
+	From     time.Time
+	To       time.Time
+	Location *time.Location
+}
+
+// NewRange returns the range of days from..to in loc, given as YYYY-MM-DD.
+// An empty from or to defaults to the days ending today; the range is
+// clamped to maxRangeDays ending at to.
+func NewRange(from, to string, defaultDays int, loc *time.Location) (Range, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	end := startOfDay(time.Now().In(loc))
+	if to != "" {
+		t, err := time.ParseInLocation(dateLayout, to, loc)
+		if err != nil {
+			return Range{}, err
+		}
+		end = t
+	}
+	start := end.AddDate(0, 0, 1-defaultDays)
+	if from != "" {
+		t, err := time.ParseInLocation(dateLayout, from, loc)
+		if err != nil {
+			return Range{}, err
+		}
+		start = t
+	}
+	if start.After(end) {
+		start = end
+	}
+	if earliest := end.AddDate(0, 0, 1-maxRangeDays); start.Before(earliest) {
+		start = earliest
+	}
+	return Range{From: start, To: end, Location: loc}, nil
+}
+
+// YearRange is the days of a calendar year in loc.
+func YearRange(year int, loc *time.Location) Range {
+	if loc == nil {
+		loc = time.UTC
+	}
+	return Range{
+		From:     time.Date(year, time.January, 1, 0, 0, 0, 0, loc),
+		To:       time.Date(year, time.December, 31, 0, 0, 0, 0, loc),
+		Location: loc,
+	}
+}
+
+// Daily returns one Day per day in r, including days without progress. An
+// empty bookID covers all of the user's books.
+func Daily(app core.App, userID, bookID string, r Range) ([]Day, error) {
+	byDate, err := load(app, userID, bookID, r.From, r.To.AddDate(0, 0, 1), r.Location)
+	if err != nil {
+		return nil, err
+	}
+	var days []Day
+	for d := r.From; !d.After(r.To); d = d.AddDate(0, 0, 1) {
+		key := d.Format(dateLayout)
+		if day, ok := byDate[key]; ok {
+			days = append(days, *day)
+		} else {
+			days = append(days, Day{Date: key})
+		}
+	}
+	if days == nil {
+		days = []Day{}
+	}
+	return days, nil
+}
+
+// load sums a user's forward progress by day in loc for events recorded in
+// [from, to). A zero from means from the beginning.
+func load(app core.App, userID, bookID string, from, to time.Time, loc *time.Location) (map[string]*Day, error) {
+	query := `
+		SELECT recorded_at, pages_read, percent_read FROM progress_events
+		WHERE user = {:user} AND recorded_at < {:to} AND (pages_read > 0 OR percent_read > 0)`
+	params := map[string]any{"user": userID, "to": store.FormatTime(to)}
+	if !from.IsZero() {
+		query += ` AND recorded_at >= {:from}`
+		params["from"] = store.FormatTime(from)
+	}
+	if bookID != "" {
+		query += ` AND book = {:book}`
+		params["book"] = bookID
+	}
+
+	type row struct {
+		RecordedAt  string  `db:"recorded_at"`
+		PagesRead   float64 `db:"pages_read"`
+		PercentRead float64 `db:"percent_read"`
+	}
+	var rows []row
+	if err := app.DB().NewQuery(query).Bind(params).All(&rows); err != nil {
+		return nil, err
+	}
+
+	byDate := map[string]*Day{}
+	for _, r := range rows {
+		t, err := time.Parse(store.DateLayout, r.RecordedAt)
+		if err != nil {
+			continue
+		}
+		key := t.In(loc).Format(dateLayout)
+		day, ok := byDate[key]
+		if !ok {
+			day = &Day{Date: key}
+			byDate[key] = day
+		}
+		day.PagesRead += int(r.PagesRead)
+		day.PercentRead += r.PercentRead
+		day.Events++
+	}
+	for _, day := range byDate {
+		day.PercentRead = math.Round(day.PercentRead*10) / 10
+	}
+	return byDate, nil
+}
+
+// Totals sums a series.
+func Totals(days []Day) (pagesRead, activeDays int) {
+	for _, d := range days {
+		pagesRead += d.PagesRead
+		if d.Active() {
+			activeDays++
+		}
+	}
+	return pagesRead, activeDays
+}
+
+// Streak is a user's run of consecutive reading days.
+type Streak struct {
+	// Current counts the days up to today, or up to yesterday while today
+	// has no progress yet.
+	Current int `json:"current"`
+	Longest int `json:"longest"`
+	// LastActive is the last day with progress, or nil.
+	LastActive *string `json:"last_active"`
+}
+
+// Streaks computes a user's current and longest reading streaks over all of
+// their progress, by day in loc.
+func Streaks(app core.App, userID string, loc *time.Location) (Streak, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	today := startOfDay(time.Now().In(loc))
+	byDate, err := load(app, userID, "", time.Time{}, today.AddDate(0, 0, 1), loc)
+	if err != nil {
+		return Streak{}, err
+	}
+	dates := make([]string, 0, len(byDate))
+	for d := range byDate {
+		dates = append(dates, d)
+	}
+	sort.Strings(dates)
+
+	var s Streak
+	run := 0
+	var prev time.Time
+	for _, d := range dates {
+		t, _ := time.ParseInLocation(dateLayout, d, loc)
+		if run > 0 && prev.AddDate(0, 0, 1).Equal(t) {
+			run++
+		} else {
+			run = 1
+		}
+		s.Longest = max(s.Longest, run)
+		prev = t
+	}
+	if len(dates) > 0 {
+		last := dates[len(dates)-1]
+		s.LastActive = &last
+		if !prev.Before(today.AddDate(0, 0, -1)) {
+			s.Current = run
+		}
+	}
+	return s, nil
+}
+
+// LongestStreak returns the longest run of consecutive active days in a
+// dense series.
+func LongestStreak(days []Day) int {
+	longest, run := 0, 0
+	for _, d := range days {
+		if d.Active() {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return longest
+}
+
+// HeatmapDay is a day of a heatmap. Level grades the day's pages from 0 (no
+// progress) to 4 against the range's busiest days; a day with progress but
+// no known page count is level 1.
+type HeatmapDay struct {
+	Date      string `json:"date"`
+	PagesRead int    `json:"pages_read"`
+	Level     int    `json:"level"`
+}
+
+// Heatmap grades a dense series for display as a calendar heatmap. Levels
+// 1-4 split the active days' page counts at their quartiles.
+func Heatmap(days []Day) []HeatmapDay {
+	var pages []int
+	for _, d := range days {
+		if d.PagesRead > 0 {
+			pages = append(pages, d.PagesRead)
+		}
+	}
+	sort.Ints(pages)
+	quartile := func(q int) int {
+		if len(pages) == 0 {
+			return 0
+		}
+		return pages[(len(pages)-1)*q/4]
+	}
+	q1, q2, q3 := quartile(1), quartile(2), quartile(3)
+
+	out := make([]HeatmapDay, len(days))
+	for i, d := range days {
+		level := 0
+		switch {
+		case !d.Active():
+		case d.PagesRead > q3:
+			level = 4
+		case d.PagesRead > q2:
+			level = 3
+		case d.PagesRead > q1:
+			level = 2
+		default:
+			level = 1
+		}
+		out[i] = HeatmapDay{Date: d.Date, PagesRead: d.PagesRead, Level: level}
+	}
+	return out
+}
+
+// Pace is a reader's recent speed through a book.
+type Pace struct {
+	// PagesPerDay averages the pages read over the days from the first
+	// progress in the window to today.
+	PagesPerDay float64 `json:"pages_per_day"`
+	// EstimatedFinish is the day the remaining pages run out at that pace,
+	// or nil when it can't be estimated.
+	EstimatedFinish *string `json:"estimated_finish"`
+}
+
+// paceWindowDays is how far back BookPace looks.
+const paceWindowDays = 14
+
+// BookPace estimates a reader's pace through a book from the last two weeks
+// of its progress events. remaining is the pages left to read (0 if
+// unknown). Returns nil when there has been no progress in the window.
+func BookPace(events []Event, remaining float64, loc *time.Location) *Pace {
+	if loc == nil {
+		loc = time.UTC
+	}
+	now := time.Now().In(loc)
+	today := startOfDay(now)
+	windowStart := today.AddDate(0, 0, 1-paceWindowDays)
+
+	var pages float64
+	var first time.Time
+	for _, e := range events {
+		t, err := time.Parse(store.DateLayout, e.RecordedAt)
+		if err != nil || e.PagesRead <= 0 {
+			continue
+		}
+		day := startOfDay(t.In(loc))
+		if day.Before(windowStart) {
+			continue
+		}
+		if first.IsZero() || day.Before(first) {
+			first = day
+		}
+		pages += e.PagesRead
+	}
+	if pages == 0 {
+		return nil
+	}
+
+	days := math.Round(today.Sub(first).Hours()/24) + 1
+	perDay := pages / days
+	p := &Pace{PagesPerDay: math.Round(perDay*10) / 10}
+	if remaining > 0 {
+		daysLeft := int(math.Ceil(remaining / perDay))
+		finish := today.AddDate(0, 0, daysLeft).Format(dateLayout)
+		p.EstimatedFinish = &finish
+	}
+	return p
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
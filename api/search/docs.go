@@ -0,0 +1,205 @@
+package search
+
+import (
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Document kinds in search_docs: user-written content, as opposed to the
+// catalog indexed in search_books/search_authors.
+const (
+	KindThread = "thread"
+	KindList   = "list"
+	KindQuote  = "quote"
+	KindReview = "review"
+)
+
+// Doc is one piece of user-written content in the index. Ref is the id of
+// the record it came from (a user_books id for reviews), Owner the user who
+// wrote it. Spoiler docs only match on Title unless the caller opts in, so
+// a search can't reveal what a spoiler body says.
+type Doc struct {
+	Kind    string
+	Ref     string
+	Owner   string
+	Spoiler bool
+	Title   string
+	Body    string
+}
+
+// IndexDoc (re)writes a document. Docs with no text are removed instead.
+func IndexDoc(app core.App, d Doc) error {
+	title, body := Fold(d.Title), Fold(d.Body)
+	if strings.TrimSpace(title+body) == "" {
+		return RemoveDoc(app, d.Kind, d.Ref)
+	}
+	_, err := app.DB().NewQuery(`
+		INSERT INTO search_docs (kind, ref, owner, spoiler, title, body)
+		VALUES ({:kind}, {:ref}, {:owner}, {:spoiler}, {:title}, {:body})
+		ON CONFLICT(kind, ref) DO UPDATE SET
+			owner = excluded.owner, spoiler = excluded.spoiler,
+			title = excluded.title, body = excluded.body
+	`).Bind(map[string]any{
+		"kind":    d.Kind,
+		"ref":     d.Ref,
+		"owner":   d.Owner,
+		"spoiler": d.Spoiler,
+		"title":   title,
+		"body":    body,
+	}).Execute()
+	return err
+}
+
+// RemoveDoc drops a document from the index.
+func RemoveDoc(app core.App, kind, ref string) error {
+	_, err := app.DB().NewQuery(`DELETE FROM search_docs WHERE kind = {:kind} AND ref = {:ref}`).
+		Bind(map[string]any{"kind": kind, "ref": ref}).Execute()
+	return err
+}
+
+// DocQuery searches one kind of document. Join and Where are spliced into
+// the query so callers can apply visibility rules; the document row is
+// aliased sd (sd.ref, sd.owner, sd.spoiler) and Params are bound alongside
+// the query's own.
+type DocQuery struct {
+	Kind     string
+	Text     string
+	Spoilers bool
+	Join     string
+	Where    string
+	Params   map[string]any
+	Limit    int
+	Offset   int
+}
+
+// Docs returns the refs of matching documents, best first, and the total
+// number of matches. Title hits weigh three times body hits.
+func Docs(app core.App, q DocQuery) ([]string, int, error) {
+	match := MatchQuery(q.Text)
+	if match == "" {
+		return nil, 0, nil
+	}
+
+	params := map[string]any{
+		"kind":       q.Kind,
+		"match":      match,
+		"titleMatch": "title : (" + match + ")",
+		"limit":      q.Limit,
+		"offset":     q.Offset,
+	}
+	for k, v := range q.Params {
+		params[k] = v
+	}
+	where := "sd.kind = {:kind}"
+	if !q.Spoilers {
+		where += ` AND (sd.spoiler = 0 OR sd.id IN (
+			SELECT rowid FROM search_docs_fts WHERE search_docs_fts MATCH {:titleMatch}))`
+	}
+	if q.Where != "" {
+		where += " AND (" + q.Where + ")"
+	}
+	from := `
+		FROM search_docs_fts
+		JOIN search_docs sd ON sd.id = search_docs_fts.rowid
+		` + q.Join + `
+		WHERE search_docs_fts MATCH {:match} AND ` + where
+
+	type hitRow struct {
+		Ref string `db:"ref"`
+	}
+	var hits []hitRow
+	err := app.DB().NewQuery(`SELECT sd.ref ` + from + `
+		ORDER BY bm25(search_docs_fts, 3.0, 1.0)
+		LIMIT {:limit} OFFSET {:offset}
+	`).Bind(params).All(&hits)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var count struct {
+		N int `db:"n"`
+	}
+	if q.Offset == 0 && len(hits) < q.Limit {
+		count.N = len(hits)
+	} else if err := app.DB().NewQuery(`SELECT COUNT(*) AS n ` + from).Bind(params).One(&count); err != nil {
+		return nil, 0, err
+	}
+
+	refs := make([]string, len(hits))
+	for i, h := range hits {
+		refs[i] = h.Ref
+	}
+	return refs, count.N, nil
+}
+
+// indexThread, indexList, indexQuote and indexReview map records to docs.
+// Soft-deleted threads and empty reviews leave the index.
+
+func indexThread(app core.App, r *core.Record) error {
+	if r.GetString("deleted_at") != "" {
+		return RemoveDoc(app, KindThread, r.Id)
+	}
+	return IndexDoc(app, Doc{
+		Kind: KindThread, Ref: r.Id, Owner: r.GetString("user"), Spoiler: r.GetBool("spoiler"),
+		Title: r.GetString("title"), Body: r.GetString("body"),
+	})
+}
+
+func indexList(app core.App, r *core.Record) error {
+	return IndexDoc(app, Doc{
+		Kind: KindList, Ref: r.Id, Owner: r.GetString("user"),
+		Title: r.GetString("name"), Body: r.GetString("description"),
+	})
+}
+
+func indexQuote(app core.App, r *core.Record) error {
+	return IndexDoc(app, Doc{
+		Kind: KindQuote, Ref: r.Id, Owner: r.GetString("user"),
+		Body: r.GetString("text") + "\n" + r.GetString("note"),
+	})
+}
+
+func indexReview(app core.App, r *core.Record) error {
+	if strings.TrimSpace(r.GetString("review_text")) == "" {
+		return RemoveDoc(app, KindReview, r.Id)
+	}
+	return IndexDoc(app, Doc{
+		Kind: KindReview, Ref: r.Id, Owner: r.GetString("user"), Spoiler: r.GetBool("spoiler"),
+		Body: r.GetString("review_text"),
+	})
+}
+
+// docSources maps each indexed collection to its document kind and mapper.
+// fields lists the columns the mapper reads; updates that touch none of
+// them skip reindexing.
+var docSources = []struct {
+	collection string
+	kind       string
+	fields     []string
+	index      func(core.App, *core.Record) error
+}{
+	{"threads", KindThread, []string{"title", "body", "spoiler", "deleted_at"}, indexThread},
+	{"collections", KindList, []string{"name", "description"}, indexList},
+	{"book_quotes", KindQuote, []string{"text", "note"}, indexQuote},
+	{"user_books", KindReview, []string{"review_text", "spoiler"}, indexReview},
+}
+
+// RebuildDocs reindexes every thread, collection, quote and review and
+// returns how many records were visited.
+func RebuildDocs(app core.App) (int, error) {
+	n := 0
+	for _, src := range docSources {
+		records, err := app.FindAllRecords(src.collection)
+		if err != nil {
+			return n, err
+		}
+		for _, r := range records {
+			if err := src.index(app, r); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,59 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// foldLetters covers letters that don't decompose into a base letter plus a
+// combining mark, so stripping marks alone leaves them untouched.
+var foldLetters = strings.NewReplacer(
+	"ø", "o", "æ", "ae", "œ", "oe", "ł", "l", "đ", "d", "ð", "d",
+	"þ", "th", "ı", "i", "ħ", "h", "ŧ", "t",
+)
+
+var caseFolder = cases.Fold()
+
+// Fold lowercases s and strips diacritics, so "Brontë", "BRONTE" and
+// "bronte" all index and match the same way. Both indexed text and queries
+// go through it.
+func Fold(s string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+	return foldLetters.Replace(caseFolder.String(folded))
+}
+
+// tokens splits folded text into the words FTS5's unicode61 tokenizer
+// would produce.
+func tokens(s string) []string {
+	return strings.FieldsFunc(Fold(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// MatchQuery turns free text into an FTS5 MATCH expression: every word must
+// appear, and the last one is matched as a prefix unless the text ends in a
+// space, so results narrow as the user types. Returns "" when there is
+// nothing to search for.
+func MatchQuery(q string) string {
+	words := tokens(q)
+	if len(words) == 0 {
+		return ""
+	}
+	parts := make([]string, len(words))
+	for i, w := range words {
+		parts[i] = `"` + w + `"`
+	}
+	if last := q[len(q)-1]; last != ' ' && last != '\t' {
+		parts[len(parts)-1] += "*"
+	}
+	return strings.Join(parts, " ")
+}
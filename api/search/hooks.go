@@ -0,0 +1,129 @@
+package search
+
+import (
+	"log"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// RegisterHooks keeps the index in sync with record changes. Index writes
+// run on the event's app, so inside a transaction they commit or roll back
+// with the change that caused them. Indexing failures are logged and never
+// fail the save.
+func RegisterHooks(app core.App) {
+	// Books: the book's own text fields.
+	onChange(app, func(e *core.RecordEvent) {
+		reindexBook(e.App, e.Record.Id)
+	}, "books")
+
+	// Series memberships and credits: the book they point at, and the one
+	// they pointed at before if it moved.
+	onChange(app, func(e *core.RecordEvent) {
+		reindexBook(e.App, e.Record.GetString("book"))
+		if prev := e.Record.Original().GetString("book"); prev != e.Record.GetString("book") {
+			reindexBook(e.App, prev)
+		}
+	}, "book_series", "book_authors")
+
+	// Series renames: every book in the series.
+	app.OnRecordUpdate("series").BindFunc(func(e *core.RecordEvent) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+		if e.Record.Original().GetString("name") != e.Record.GetString("name") {
+			reindexBooksWhere(e.App, "SELECT book FROM book_series WHERE series = {:id}", e.Record.Id)
+		}
+		return nil
+	})
+
+	// Authors: the author row, plus their books when the names they're
+	// indexed under change.
+	onChange(app, func(e *core.RecordEvent) {
+		if err := IndexAuthor(e.App, e.Record.Id); err != nil {
+			log.Printf("[Search] index author %s: %v", e.Record.Id, err)
+		}
+		orig := e.Record.Original()
+		if orig.GetString("name") != e.Record.GetString("name") ||
+			orig.GetString("alternate_names") != e.Record.GetString("alternate_names") {
+			reindexBooksWhere(e.App, "SELECT book FROM book_authors WHERE author = {:id}", e.Record.Id)
+		}
+	}, "authors")
+
+	// User-written content: threads, lists, quotes and reviews.
+	for _, src := range docSources {
+		src := src
+		save := func(e *core.RecordEvent) error {
+			if err := e.Next(); err != nil {
+				return err
+			}
+			if !fieldsChanged(e.Record, src.fields) {
+				return nil
+			}
+			if err := src.index(e.App, e.Record); err != nil {
+				log.Printf("[Search] index %s %s: %v", src.kind, e.Record.Id, err)
+			}
+			return nil
+		}
+		app.OnRecordCreate(src.collection).BindFunc(save)
+		app.OnRecordUpdate(src.collection).BindFunc(save)
+		app.OnRecordDelete(src.collection).BindFunc(func(e *core.RecordEvent) error {
+			if err := e.Next(); err != nil {
+				return err
+			}
+			if err := RemoveDoc(e.App, src.kind, e.Record.Id); err != nil {
+				log.Printf("[Search] remove %s %s: %v", src.kind, e.Record.Id, err)
+			}
+			return nil
+		})
+	}
+}
+
+// fieldsChanged reports whether any of fields differs from the record's
+// state before the save (blank for new records).
+func fieldsChanged(r *core.Record, fields []string) bool {
+	orig := r.Original()
+	for _, f := range fields {
+		if orig.GetString(f) != r.GetString(f) {
+			return true
+		}
+	}
+	return false
+}
+
+// onChange runs fn after a successful create, update or delete of a record in
+// any of the collections.
+func onChange(app core.App, fn func(e *core.RecordEvent), collections ...string) {
+	handler := func(e *core.RecordEvent) error {
+		if err := e.Next(); err != nil {
+			return err
+		}
+		fn(e)
+		return nil
+	}
+	app.OnRecordCreate(collections...).BindFunc(handler)
+	app.OnRecordUpdate(collections...).BindFunc(handler)
+	app.OnRecordDelete(collections...).BindFunc(handler)
+}
+
+func reindexBook(app core.App, bookID string) {
+	if bookID == "" {
+		return
+	}
+	if err := IndexBook(app, bookID); err != nil {
+		log.Printf("[Search] index book %s: %v", bookID, err)
+	}
+}
+
+func reindexBooksWhere(app core.App, query, id string) {
+	type bookRow struct {
+		Book string `db:"book"`
+	}
+	var rows []bookRow
+	if err := app.DB().NewQuery(query).Bind(map[string]any{"id": id}).All(&rows); err != nil {
+		log.Printf("[Search] find books to reindex: %v", err)
+		return
+	}
+	for _, r := range rows {
+		reindexBook(app, r.Book)
+	}
+}
@@ -0,0 +1,189 @@
+// Package search maintains the SQLite FTS5 index over the local catalog and
+// answers ranked queries against it.
+//
+// Each indexed record has a row in a plain table (search_books,
+// search_authors, and search_docs for user-written threads, lists, quotes
+// and reviews) holding accent-folded text, and an external-content FTS5
+// table over it that SQL triggers keep in step. Record hooks (see
+// RegisterHooks) rewrite a book's row whenever the book, its series or its
+// credited authors change, and a document's row whenever its text does.
+package search
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// IndexBook (re)writes the search row for a book: title, subtitle, authors
+// (including alternate names of credited authors), series names and
+// subjects. A book that no longer exists is removed from the index.
+func IndexBook(app core.App, bookID string) error {
+	type bookRow struct {
+		Title    string `db:"title"`
+		Subtitle string `db:"subtitle"`
+		Authors  string `db:"authors"`
+		Subjects string `db:"subjects"`
+	}
+	var b bookRow
+	err := app.DB().NewQuery(`
+		SELECT title, COALESCE(subtitle, '') AS subtitle,
+			   COALESCE(authors, '') AS authors, COALESCE(subjects, '') AS subjects
+		FROM books WHERE id = {:id}
+	`).Bind(map[string]any{"id": bookID}).One(&b)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RemoveBook(app, bookID)
+	} else if err != nil {
+		return err
+	}
+
+	type creditRow struct {
+		Name           string `db:"name"`
+		AlternateNames string `db:"alternate_names"`
+	}
+	var credits []creditRow
+	_ = app.DB().NewQuery(`
+		SELECT a.name, COALESCE(a.alternate_names, '') AS alternate_names
+		FROM book_authors ba
+		JOIN authors a ON a.id = ba.author
+		WHERE ba.book = {:id}
+		ORDER BY ba.position
+	`).Bind(map[string]any{"id": bookID}).All(&credits)
+	var authors []string
+	for _, c := range credits {
+		authors = append(authors, c.Name)
+		authors = append(authors, jsonStrings(c.AlternateNames)...)
+	}
+	if len(credits) == 0 {
+		// Not linked to authors records yet; fall back to the display string.
+		authors = strings.Split(b.Authors, ",")
+	}
+
+	type seriesRow struct {
+		Name string `db:"name"`
+	}
+	var series []seriesRow
+	_ = app.DB().NewQuery(`
+		SELECT s.name FROM book_series bs
+		JOIN series s ON s.id = bs.series
+		WHERE bs.book = {:id}
+	`).Bind(map[string]any{"id": bookID}).All(&series)
+	seriesNames := make([]string, 0, len(series))
+	for _, s := range series {
+		seriesNames = append(seriesNames, s.Name)
+	}
+
+	_, err = app.DB().NewQuery(`
+		INSERT INTO search_books (book, title, subtitle, authors, series, subjects)
+		VALUES ({:book}, {:title}, {:subtitle}, {:authors}, {:series}, {:subjects})
+		ON CONFLICT(book) DO UPDATE SET
+			title = excluded.title, subtitle = excluded.subtitle, authors = excluded.authors,
+			series = excluded.series, subjects = excluded.subjects
+	`).Bind(map[string]any{
+		"book":     bookID,
+		"title":    Fold(b.Title),
+		"subtitle": Fold(b.Subtitle),
+		"authors":  foldUnique(authors),
+		"series":   foldUnique(seriesNames),
+		"subjects": Fold(b.Subjects),
+	}).Execute()
+	return err
+}
+
+// RemoveBook drops a book from the index.
+func RemoveBook(app core.App, bookID string) error {
+	_, err := app.DB().NewQuery(`DELETE FROM search_books WHERE book = {:book}`).
+		Bind(map[string]any{"book": bookID}).Execute()
+	return err
+}
+
+// IndexAuthor (re)writes the search row for an author: name and alternate
+// names. An author that no longer exists is removed from the index.
+func IndexAuthor(app core.App, authorID string) error {
+	type authorRow struct {
+		Name           string `db:"name"`
+		AlternateNames string `db:"alternate_names"`
+	}
+	var a authorRow
+	err := app.DB().NewQuery(`
+		SELECT name, COALESCE(alternate_names, '') AS alternate_names FROM authors WHERE id = {:id}
+	`).Bind(map[string]any{"id": authorID}).One(&a)
+	if errors.Is(err, sql.ErrNoRows) {
+		return RemoveAuthor(app, authorID)
+	} else if err != nil {
+		return err
+	}
+
+	_, err = app.DB().NewQuery(`
+		INSERT INTO search_authors (author, name, alternate_names)
+		VALUES ({:author}, {:name}, {:alternate})
+		ON CONFLICT(author) DO UPDATE SET
+			name = excluded.name, alternate_names = excluded.alternate_names
+	`).Bind(map[string]any{
+		"author":    authorID,
+		"name":      Fold(a.Name),
+		"alternate": foldUnique(jsonStrings(a.AlternateNames)),
+	}).Execute()
+	return err
+}
+
+// RemoveAuthor drops an author from the index.
+func RemoveAuthor(app core.App, authorID string) error {
+	_, err := app.DB().NewQuery(`DELETE FROM search_authors WHERE author = {:author}`).
+		Bind(map[string]any{"author": authorID}).Execute()
+	return err
+}
+
+// Rebuild reindexes every book and author and returns how many rows were
+// written.
+func Rebuild(app core.App) (int, error) {
+	type idRow struct {
+		ID string `db:"id"`
+	}
+	n := 0
+	for _, table := range []string{"books", "authors"} {
+		var rows []idRow
+		if err := app.DB().NewQuery("SELECT id FROM " + table).All(&rows); err != nil {
+			return n, err
+		}
+		for _, r := range rows {
+			var err error
+			if table == "books" {
+				err = IndexBook(app, r.ID)
+			} else {
+				err = IndexAuthor(app, r.ID)
+			}
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	return n, nil
+}
+
+// foldUnique folds each value and joins the distinct, non-empty results.
+func foldUnique(values []string) string {
+	seen := map[string]bool{}
+	var out []string
+	for _, v := range values {
+		f := strings.TrimSpace(Fold(v))
+		if f == "" || seen[f] {
+			continue
+		}
+		seen[f] = true
+		out = append(out, f)
+	}
+	return strings.Join(out, " | ")
+}
+
+func jsonStrings(raw string) []string {
+	var out []string
+	if raw == "" || json.Unmarshal([]byte(raw), &out) != nil {
+		return nil
+	}
+	return out
+}
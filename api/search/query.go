@@ -0,0 +1,136 @@
+package search
+
+import (
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// Column weights for bm25(): a title hit outranks an author hit, which
+// outranks series, subtitle and finally subject hits. Order follows the
+// search_books_fts columns.
+const bookWeights = "10.0, 4.0, 6.0, 3.0, 1.0"
+
+// popularityWeight scales how much readership lifts a text match. bm25 is
+// negative (lower is better), so the score is multiplied by
+// 1 + popularityWeight*ln(1+readers): a popular book edges out an obscure
+// one with a similar text score but can't bury a much better match.
+const popularityWeight = 0.25
+
+// Books returns the ids of local books matching q, best first, and the total
+// number of matches.
+func Books(app core.App, q string, limit, offset int) ([]string, int, error) {
+	return books(app, q, "", "", limit, offset)
+}
+
+// BooksBy is Books ranked first by order, an ORDER BY expression over the
+// matching books' book_stats rows aliased bs (NULL for books without one),
+// with relevance breaking ties. An empty order ranks by relevance alone.
+func BooksBy(app core.App, q, order string, limit, offset int) ([]string, int, error) {
+	return books(app, q, "", order, limit, offset)
+}
+
+// UserBooks is Books restricted to books on userID's shelves.
+func UserBooks(app core.App, userID, q string, limit int) ([]string, error) {
+	ids, _, err := books(app, q, userID, "", limit, 0)
+	return ids, err
+}
+
+func books(app core.App, q, userID, order string, limit, offset int) ([]string, int, error) {
+	match := MatchQuery(q)
+	if match == "" {
+		return nil, 0, nil
+	}
+
+	userJoin := ""
+	if userID != "" {
+		userJoin = "JOIN user_books ub ON ub.book = sb.book AND ub.user = {:user}"
+	}
+	if order != "" {
+		order += ", "
+	}
+	params := map[string]any{
+		"match":  match,
+		"user":   userID,
+		"weight": popularityWeight,
+		"limit":  limit,
+		"offset": offset,
+	}
+
+	type hitRow struct {
+		Book string `db:"book"`
+	}
+	var hits []hitRow
+	err := app.DB().NewQuery(`
+		SELECT sb.book
+		FROM search_books_fts
+		JOIN search_books sb ON sb.id = search_books_fts.rowid
+		` + userJoin + `
+		LEFT JOIN book_stats bs ON bs.book = sb.book
+		WHERE search_books_fts MATCH {:match}
+		ORDER BY ` + order + `bm25(search_books_fts, ` + bookWeights + `)
+			* (1 + {:weight} * ln(1 + COALESCE(bs.reads_count + bs.want_to_read_count + bs.rating_count, 0)))
+		LIMIT {:limit} OFFSET {:offset}
+	`).Bind(params).All(&hits)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var count struct {
+		N int `db:"n"`
+	}
+	if offset == 0 && len(hits) < limit {
+		count.N = len(hits)
+	} else {
+		err = app.DB().NewQuery(`
+			SELECT COUNT(*) AS n
+			FROM search_books_fts
+			JOIN search_books sb ON sb.id = search_books_fts.rowid
+			` + userJoin + `
+			WHERE search_books_fts MATCH {:match}
+		`).Bind(params).One(&count)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.Book
+	}
+	return ids, count.N, nil
+}
+
+// Authors returns the ids of local authors whose name or an alternate name
+// matches q, best first. Authors credited on more local books rank higher.
+func Authors(app core.App, q string, limit int) ([]string, error) {
+	match := MatchQuery(q)
+	if match == "" {
+		return nil, nil
+	}
+
+	type hitRow struct {
+		Author string `db:"author"`
+	}
+	var hits []hitRow
+	err := app.DB().NewQuery(`
+		SELECT sa.author
+		FROM search_authors_fts
+		JOIN search_authors sa ON sa.id = search_authors_fts.rowid
+		WHERE search_authors_fts MATCH {:match}
+		ORDER BY bm25(search_authors_fts, 4.0, 1.0)
+			* (1 + {:weight} * ln(1 + (SELECT COUNT(*) FROM book_authors ba WHERE ba.author = sa.author)))
+		LIMIT {:limit}
+	`).Bind(map[string]any{
+		"match":  match,
+		"weight": popularityWeight,
+		"limit":  limit,
+	}).All(&hits)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(hits))
+	for i, h := range hits {
+		ids[i] = h.Author
+	}
+	return ids, nil
+}
@@ -0,0 +1,31 @@
+// Package store holds helpers for working with PocketBase records and dates
+// that the packages outside handlers share.
+package store
+
+import (
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+)
+
+// DateLayout is the format PocketBase stores dates in. Stored dates in this
+// layout sort as text, so they can be compared in SQL directly.
+const DateLayout = "2006-01-02 15:04:05.000Z"
+
+// FormatTime formats t the way PocketBase stores dates.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(DateLayout)
+}
+
+// NextThen runs the rest of a record event's chain on txApp, then fn. Hooks
+// call it inside txApp.RunInTransaction so that the write and whatever fn
+// derives from it commit or roll back together.
+func NextThen(e *core.RecordEvent, txApp core.App, fn func() error) error {
+	app := e.App
+	e.App = txApp
+	defer func() { e.App = app }()
+	if err := e.Next(); err != nil {
+		return err
+	}
+	return fn()
+}
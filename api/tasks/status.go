@@ -0,0 +1,142 @@
+package tasks
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/types"
+
+	"github.com/tristansaldanha/rosslib/api/store"
+)
+
+// Status is a task's schedule and last run, as shown to admins.
+type Status struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Schedule    string `json:"schedule"`
+	// ScheduleSource is "default", "env" or "override".
+	ScheduleSource string  `json:"schedule_source"`
+	Running        bool    `json:"running"`
+	NextRunAt      *string `json:"next_run_at"`
+	LastStartedAt  string  `json:"last_started_at"`
+	LastFinishedAt string  `json:"last_finished_at"`
+	LastDurationMs int     `json:"last_duration_ms"`
+	LastStatus     string  `json:"last_status"`
+	LastError      string  `json:"last_error"`
+	// LastResult is what the last run reported through SetResult, or null.
+	LastResult types.JSONRaw `json:"last_result"`
+}
+
+// lastRun is a task's scheduled_tasks row.
+type lastRun struct {
+	Name           string        `db:"name"`
+	LastStartedAt  string        `db:"last_started_at"`
+	LastFinishedAt string        `db:"last_finished_at"`
+	LastDurationMs int           `db:"last_duration_ms"`
+	LastStatus     string        `db:"last_status"`
+	LastError      string        `db:"last_error"`
+	LastResult     types.JSONRaw `db:"last_result"`
+}
+
+// List returns the status of every registered task, by name.
+func List(app core.App) ([]Status, error) {
+	var rows []lastRun
+	if err := app.DB().NewQuery(`
+		SELECT name, last_started_at, last_finished_at, last_duration_ms, last_status, last_error, last_result
+		FROM scheduled_tasks
+	`).All(&rows); err != nil {
+		return nil, err
+	}
+	runs := make(map[string]lastRun, len(rows))
+	for _, r := range rows {
+		runs[r.Name] = r
+	}
+
+	now := time.Now()
+	all := names()
+	out := make([]Status, 0, len(all))
+	for _, name := range all {
+		t, _ := lookup(name)
+		expr, source := effectiveSchedule(app, name)
+		r := runs[name]
+		s := Status{
+			Name:           name,
+			Description:    t.Description,
+			Schedule:       expr,
+			ScheduleSource: source,
+			Running:        isRunning(name),
+			LastStartedAt:  r.LastStartedAt,
+			LastFinishedAt: r.LastFinishedAt,
+			LastDurationMs: r.LastDurationMs,
+			LastStatus:     r.LastStatus,
+			LastError:      r.LastError,
+			LastResult:     r.LastResult,
+		}
+		if expr != Off {
+			if next := nextRun(expr, now); !next.IsZero() {
+				at := store.FormatTime(next)
+				s.NextRunAt = &at
+			}
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// Get returns one task's status.
+func Get(app core.App, name string) (Status, error) {
+	if _, ok := lookup(name); !ok {
+		return Status{}, ErrNotFound
+	}
+	all, err := List(app)
+	if err != nil {
+		return Status{}, err
+	}
+	for _, s := range all {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return Status{}, ErrNotFound
+}
+
+// RunNow starts a task in the background outside its schedule. It returns
+// ErrNotFound for an unknown task and ErrRunning if the task is running.
+func RunNow(app core.App, name string) error {
+	t, ok := lookup(name)
+	if !ok {
+		return ErrNotFound
+	}
+	if !claim(name) {
+		return ErrRunning
+	}
+	go func() {
+		defer release(name)
+		execute(app, t)
+	}()
+	return nil
+}
+
+// SetSchedule overrides a task's schedule with a cron expression or Off and
+// reschedules it. An empty expr clears the override, falling back to the
+// environment or the default.
+func SetSchedule(app core.App, name, expr string) error {
+	if _, ok := lookup(name); !ok {
+		return ErrNotFound
+	}
+	expr = strings.TrimSpace(expr)
+	if strings.EqualFold(expr, Off) {
+		expr = Off
+	}
+	if expr != "" {
+		if err := validate(expr); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+	}
+	if err := save(app, name, map[string]any{"schedule": expr}); err != nil {
+		return err
+	}
+	return schedule(app, name)
+}
@@ -0,0 +1,292 @@
+// Package tasks runs recurring maintenance on cron schedules. Each task has
+// a built-in schedule that the TASK_<NAME>_SCHEDULE environment variable or
+// an admin override can replace, and its last run is recorded in the
+// scheduled_tasks collection for /admin/tasks. A task never runs twice at
+// once: a run that comes due while the previous one is still going is
+// skipped.
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pocketbase/pocketbase/core"
+	"github.com/pocketbase/pocketbase/tools/cron"
+
+	"github.com/tristansaldanha/rosslib/api/store"
+)
+
+// Off is the schedule of a task that only runs when triggered by hand.
+const Off = "off"
+
+// Task describes a recurring task.
+type Task struct {
+	Name        string
+	Description string
+	// Schedule is the default cron expression (five fields, UTC) or macro
+	// such as "@daily". Off disables the task unless it is reconfigured.
+	Schedule string
+	// RunOnStart also runs the task once at startup, for work that should
+	// not wait up to a full interval after a deploy.
+	RunOnStart bool
+	Run        func(app core.App) error
+}
+
+var (
+	// ErrNotFound is returned for a task name that isn't registered.
+	ErrNotFound = errors.New("task not found")
+	// ErrRunning is returned when a task is triggered while it is running.
+	ErrRunning = errors.New("task is already running")
+	// ErrInvalidSchedule is returned for a schedule the cron can't parse.
+	ErrInvalidSchedule = errors.New("invalid schedule")
+)
+
+var registry = struct {
+	sync.RWMutex
+	tasks   map[string]Task
+	running map[string]bool
+}{tasks: map[string]Task{}, running: map[string]bool{}}
+
+// Register adds a task. Register every task before Start.
+func Register(t Task) {
+	registry.Lock()
+	registry.tasks[t.Name] = t
+	registry.Unlock()
+}
+
+func lookup(name string) (Task, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok := registry.tasks[name]
+	return t, ok
+}
+
+// names lists the registered tasks in order.
+func names() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	out := make([]string, 0, len(registry.tasks))
+	for name := range registry.tasks {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+var startOnce sync.Once
+
+// Start schedules every registered task on the app's cron and runs the
+// RunOnStart ones. Runs recorded as still going are marked interrupted
+// first. Call once, after every task is registered.
+func Start(app core.App) {
+	startOnce.Do(func() {
+		if _, err := app.DB().NewQuery(
+			"UPDATE scheduled_tasks SET last_status = 'interrupted' WHERE last_status = 'running'",
+		).Execute(); err != nil {
+			log.Printf("[Tasks] mark interrupted runs: %v", err)
+		}
+
+		for _, name := range names() {
+			if err := schedule(app, name); err != nil {
+				log.Printf("[Tasks] schedule %s: %v", name, err)
+			}
+		}
+		for _, name := range names() {
+			if t, _ := lookup(name); t.RunOnStart {
+				go trigger(app, name)
+			}
+		}
+	})
+}
+
+// cronID is the task's job id on the app's cron.
+func cronID(name string) string {
+	return "task:" + name
+}
+
+// schedule (re)adds a task to the app's cron with its effective schedule,
+// or removes it if the task is off.
+func schedule(app core.App, name string) error {
+	app.Cron().Remove(cronID(name))
+	expr, _ := effectiveSchedule(app, name)
+	if expr == Off {
+		return nil
+	}
+	return app.Cron().Add(cronID(name), expr, func() { trigger(app, name) })
+}
+
+// effectiveSchedule returns a task's schedule and where it came from:
+// "override" for an admin override, "env" for TASK_<NAME>_SCHEDULE, else
+// "default".
+func effectiveSchedule(app core.App, name string) (string, string) {
+	var override string
+	_ = app.DB().NewQuery(
+		"SELECT schedule FROM scheduled_tasks WHERE name = {:name}",
+	).Bind(map[string]any{"name": name}).Row(&override)
+	if override != "" {
+		return override, "override"
+	}
+	if env := strings.TrimSpace(os.Getenv(envName(name))); env != "" {
+		if strings.EqualFold(env, Off) {
+			return Off, "env"
+		}
+		return env, "env"
+	}
+	t, _ := lookup(name)
+	if t.Schedule == "" {
+		return Off, "default"
+	}
+	return t.Schedule, "default"
+}
+
+// envName is the environment variable that overrides a task's schedule.
+func envName(name string) string {
+	return "TASK_" + strings.ToUpper(name) + "_SCHEDULE"
+}
+
+// validate checks that expr is Off or a cron expression the app's cron
+// accepts.
+func validate(expr string) error {
+	if expr == Off {
+		return nil
+	}
+	_, err := cron.NewSchedule(expr)
+	return err
+}
+
+// nextRun returns when a schedule next comes due after t, or the zero time
+// for an invalid schedule or one that doesn't come due within a year.
+func nextRun(expr string, t time.Time) time.Time {
+	s, err := cron.NewSchedule(expr)
+	if err != nil {
+		return time.Time{}
+	}
+	next := t.UTC().Truncate(time.Minute).Add(time.Minute)
+	for end := next.AddDate(1, 0, 1); next.Before(end); next = next.Add(time.Minute) {
+		if s.IsDue(cron.NewMoment(next)) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// trigger runs a task unless it is already running.
+func trigger(app core.App, name string) {
+	if err := run(app, name); errors.Is(err, ErrRunning) {
+		log.Printf("[Tasks] %s still running; skipped this run", name)
+	}
+}
+
+// run runs a task in the calling goroutine. It returns ErrNotFound or
+// ErrRunning without running anything; the task's own error is recorded and
+// logged, not returned.
+func run(app core.App, name string) error {
+	t, ok := lookup(name)
+	if !ok {
+		return ErrNotFound
+	}
+	if !claim(name) {
+		return ErrRunning
+	}
+	defer release(name)
+	execute(app, t)
+	return nil
+}
+
+// execute runs a claimed task and records the outcome.
+func execute(app core.App, t Task) {
+	name := t.Name
+	start := time.Now()
+	record(app, name, map[string]any{
+		"last_started_at": store.FormatTime(start),
+		"last_status":     "running",
+		"last_result":     nil,
+	})
+
+	err := call(app, t)
+	elapsed := time.Since(start)
+
+	state := map[string]any{
+		"last_finished_at": store.FormatTime(time.Now()),
+		"last_duration_ms": elapsed.Milliseconds(),
+		"last_status":      "ok",
+		"last_error":       "",
+	}
+	if err != nil {
+		state["last_status"] = "error"
+		state["last_error"] = err.Error()
+		log.Printf("[Tasks] %s failed after %s: %v", name, elapsed.Round(time.Millisecond), err)
+	} else {
+		log.Printf("[Tasks] %s finished in %s", name, elapsed.Round(time.Millisecond))
+	}
+	record(app, name, state)
+}
+
+func claim(name string) bool {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.running[name] {
+		return false
+	}
+	registry.running[name] = true
+	return true
+}
+
+func release(name string) {
+	registry.Lock()
+	delete(registry.running, name)
+	registry.Unlock()
+}
+
+func isRunning(name string) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.running[name]
+}
+
+// call runs a task, turning a panic into an error.
+func call(app core.App, t Task) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return t.Run(app)
+}
+
+// SetResult records what a task's current run found or did, for admins to
+// see as its last_result. Call it from the task's Run.
+func SetResult(app core.App, name string, result any) error {
+	return save(app, name, map[string]any{"last_result": result})
+}
+
+// record saves fields on a task's scheduled_tasks row, creating it if
+// needed.
+func record(app core.App, name string, fields map[string]any) {
+	if err := save(app, name, fields); err != nil {
+		log.Printf("[Tasks] record %s state: %v", name, err)
+	}
+}
+
+func save(app core.App, name string, fields map[string]any) error {
+	rec, err := app.FindFirstRecordByData("scheduled_tasks", "name", name)
+	if err != nil {
+		coll, err := app.FindCollectionByNameOrId("scheduled_tasks")
+		if err != nil {
+			return err
+		}
+		rec = core.NewRecord(coll)
+		rec.Set("name", name)
+	}
+	for k, v := range fields {
+		rec.Set(k, v)
+	}
+	return app.Save(rec)
+}
@@ -1,4 +1,4 @@
-import { notFound } from "next/navigation";
+import { notFound, redirect } from "next/navigation";
 import Link from "next/link";
 import StarRating from "@/components/star-rating";
 import StatusPicker, { type StatusValue } from "@/components/shelf-picker";
@@ -464,6 +464,8 @@ export default async function BookPage({
   ]);
 
   if (!book) notFound();
+  // Merged duplicates resolve to the surviving work.
+  if (book.key && book.key !== workId) redirect(`/books/${book.key}`);
 
   // Fetch "more by this author" works
   const firstAuthor = book.authors?.find((a) => a.key) ?? null;